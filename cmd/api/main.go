@@ -9,7 +9,14 @@ import (
 	"syscall"
 
 	"github.com/danikarik/salesforge/internal/app"
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/model/memory"
 	"github.com/danikarik/salesforge/internal/model/pg"
+	"github.com/danikarik/salesforge/internal/rescheduler"
+	"github.com/danikarik/salesforge/internal/scheduler"
+	"github.com/danikarik/salesforge/internal/secret"
+	"github.com/danikarik/salesforge/internal/sender"
+	"github.com/danikarik/salesforge/internal/worker"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/kelseyhightower/envconfig"
 )
@@ -24,22 +31,82 @@ func main() {
 		log.Fatalf("Failed to process environment variables: %v", err)
 	}
 
-	// Connect to the database using the provided URL
-	pool, err := pgxpool.New(ctx, spec.DatabaseURL)
-	if err != nil {
-		log.Fatalf("Failed to connect to the database: %v", err)
+	// Create a new store instance
+	var store model.Store
+	switch spec.Store {
+	case app.StoreMemory:
+		log.Println("Using in-memory store, data is lost on shutdown")
+		store = memory.NewStore()
+	case app.StorePostgres:
+		if spec.DatabaseURL == "" {
+			log.Fatalf("API_DATABASE_URL is required for the %s store", app.StorePostgres)
+		}
+		secrets, err := secret.NewBox(spec.SecretKey)
+		if err != nil {
+			log.Fatalf("API_SECRET_KEY is invalid: %v", err)
+		}
+
+		// Connect to the database using the provided URL
+		pool, err := pgxpool.New(ctx, spec.DatabaseURL)
+		if err != nil {
+			log.Fatalf("Failed to connect to the database: %v", err)
+		}
+		defer pool.Close()
+
+		store, err = pg.NewStore(pool, secrets)
+		if err != nil {
+			log.Fatalf("Failed to create store: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown store %q", spec.Store)
 	}
-	defer pool.Close()
 
-	// Create a new store instance
-	store, err := pg.NewStore(pool)
-	if err != nil {
-		log.Fatalf("Failed to create store: %v", err)
+	// Create the sender of due emails
+	tracking := sender.Tracking{BaseURL: spec.TrackingURL}
+	var emailSender sender.Sender
+	switch spec.Sender {
+	case "":
+		log.Fatalf("API_SENDER is required, one of %s, %s or %s", app.SenderSMTP, app.SenderCapture, app.SenderLog)
+	case app.SenderLog:
+		log.Println("Using log sender, emails are marked sent without being sent")
+		emailSender = sender.LogSender{}
+	case app.SenderSMTP:
+		emailSender = sender.NewSMTPSender(sender.SMTPConfig{
+			Default: sender.SMTPServer{
+				Host:     spec.SMTPHost,
+				Port:     spec.SMTPPort,
+				Username: spec.SMTPUsername,
+				Password: spec.SMTPPassword,
+			},
+			RequireTLS: spec.SMTPRequireTLS,
+			Tracking:   tracking,
+		})
+	case app.SenderCapture:
+		if spec.CaptureDir == "" {
+			log.Println("Capturing emails in memory, they are lost on shutdown")
+		}
+		emailSender, err = sender.NewCaptureSender(spec.CaptureDir, tracking)
+		if err != nil {
+			log.Fatalf("Failed to create capture sender: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown sender %q", spec.Sender)
 	}
 
+	planner := scheduler.New(scheduler.Config{Store: store})
+	rescheduling := rescheduler.New(rescheduler.Config{
+		Store:        store,
+		Scheduler:    planner,
+		BatchSize:    spec.RescheduleBatchSize,
+		Throttle:     spec.RescheduleThrottle,
+		PollInterval: spec.ReschedulePollInterval,
+	})
+
 	// Create a new service instance with the store
 	srv := app.NewService(app.Config{
-		Store: store,
+		Store:    store,
+		Sender:   emailSender,
+		Tracking: tracking,
 	})
 
 	// Create an HTTP server with the service's handler
@@ -51,6 +118,27 @@ func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
+	// Plan, reschedule and send pending emails in the background until shutdown
+	jobsCtx, stopJobs := context.WithCancel(ctx)
+	defer stopJobs()
+	go planner.Start(jobsCtx, spec.SchedulerInterval)
+	go rescheduling.Run(jobsCtx)
+
+	workers := worker.New(worker.Config{
+		Store:        store,
+		Sender:       emailSender,
+		Concurrency:  spec.WorkerConcurrency,
+		PollInterval: spec.WorkerPollInterval,
+		Lease:        spec.WorkerLease,
+		MaxAttempts:  spec.WorkerMaxAttempts,
+		RetryBackoff: spec.WorkerRetryBackoff,
+	})
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Run(jobsCtx)
+		close(workersDone)
+	}()
+
 	go func() {
 		log.Println("Starting service on ", spec.Address)
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -60,6 +148,8 @@ func main() {
 
 	<-quit
 	log.Println("Shutting down...")
+	stopJobs()
+	<-workersDone
 	if err := httpServer.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sequences ADD COLUMN archived_at TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sequences DROP COLUMN IF EXISTS archived_at;
+-- +goose StatementEnd
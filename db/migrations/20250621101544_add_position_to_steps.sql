@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE steps ADD COLUMN position INTEGER;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE steps
+SET position = ranked.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY sequence_id ORDER BY id) AS position
+    FROM steps
+) AS ranked
+WHERE steps.id = ranked.id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE steps ALTER COLUMN position SET NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE steps
+    ADD CONSTRAINT steps_sequence_id_position_key
+    UNIQUE (sequence_id, position) DEFERRABLE INITIALLY DEFERRED;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE steps DROP CONSTRAINT IF EXISTS steps_sequence_id_position_key;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE steps DROP COLUMN IF EXISTS position;
+-- +goose StatementEnd
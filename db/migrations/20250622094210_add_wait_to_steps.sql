@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE steps
+    ADD COLUMN wait_days INTEGER NOT NULL DEFAULT 0 CHECK (wait_days >= 0),
+    ADD COLUMN wait_hours INTEGER NOT NULL DEFAULT 0 CHECK (wait_hours BETWEEN 0 AND 23);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE steps
+    DROP COLUMN IF EXISTS wait_days,
+    DROP COLUMN IF EXISTS wait_hours;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sequences
+    ADD COLUMN start_time TIME NOT NULL DEFAULT '09:00',
+    ADD COLUMN end_time TIME NOT NULL DEFAULT '17:00',
+    ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    ADD COLUMN weekdays SMALLINT[] NOT NULL DEFAULT '{1,2,3,4,5}',
+    ADD CONSTRAINT sequences_sending_window_check CHECK (end_time > start_time),
+    ADD CONSTRAINT sequences_weekdays_check CHECK (cardinality(weekdays) > 0);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sequences
+    DROP CONSTRAINT IF EXISTS sequences_weekdays_check,
+    DROP CONSTRAINT IF EXISTS sequences_sending_window_check,
+    DROP COLUMN IF EXISTS weekdays,
+    DROP COLUMN IF EXISTS timezone,
+    DROP COLUMN IF EXISTS end_time,
+    DROP COLUMN IF EXISTS start_time;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sequences ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE steps ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE steps DROP COLUMN IF EXISTS version;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE sequences DROP COLUMN IF EXISTS version;
+-- +goose StatementEnd
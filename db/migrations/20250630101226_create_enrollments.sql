@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE enrollments (
+    id SERIAL PRIMARY KEY,
+    sequence_id INTEGER NOT NULL REFERENCES sequences(id) ON DELETE CASCADE,
+    contact_id INTEGER NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    current_step_id INTEGER REFERENCES steps(id) ON DELETE SET NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'active',
+    enrolled_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX enrollments_active_key ON enrollments (sequence_id, contact_id) WHERE status = 'active';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX enrollments_contact_id_idx ON enrollments (contact_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS enrollments;
+-- +goose StatementEnd
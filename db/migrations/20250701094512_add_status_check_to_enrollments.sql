@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE enrollments
+    ADD CONSTRAINT enrollments_status_check
+    CHECK (status IN ('active', 'paused', 'completed', 'stopped', 'bounced', 'replied'));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP INDEX enrollments_active_key;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX enrollments_active_key ON enrollments (sequence_id, contact_id) WHERE status IN ('active', 'paused');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX enrollments_active_key;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX enrollments_active_key ON enrollments (sequence_id, contact_id) WHERE status = 'active';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE enrollments DROP CONSTRAINT enrollments_status_check;
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE mailboxes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    email VARCHAR(320) NOT NULL,
+    daily_capacity INTEGER NOT NULL CHECK (daily_capacity > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX mailboxes_user_id_email_key ON mailboxes (user_id, LOWER(email));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE sequence_mailboxes (
+    sequence_id INTEGER NOT NULL REFERENCES sequences(id) ON DELETE CASCADE,
+    mailbox_id INTEGER NOT NULL REFERENCES mailboxes(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (sequence_id, mailbox_id)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX sequence_mailboxes_mailbox_id_idx ON sequence_mailboxes (mailbox_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS sequence_mailboxes;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS mailboxes;
+-- +goose StatementEnd
@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE scheduled_emails (
+    id SERIAL PRIMARY KEY,
+    enrollment_id INTEGER NOT NULL REFERENCES enrollments(id) ON DELETE CASCADE,
+    step_id INTEGER NOT NULL REFERENCES steps(id) ON DELETE CASCADE,
+    mailbox_id INTEGER REFERENCES mailboxes(id) ON DELETE SET NULL,
+    send_at TIMESTAMP NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending'
+        CONSTRAINT scheduled_emails_status_check CHECK (status IN ('pending', 'sent', 'failed', 'canceled')),
+    sent_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE UNIQUE INDEX scheduled_emails_pending_key ON scheduled_emails (enrollment_id) WHERE status = 'pending';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX scheduled_emails_status_send_at_idx ON scheduled_emails (status, send_at);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX scheduled_emails_enrollment_id_idx ON scheduled_emails (enrollment_id);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX scheduled_emails_mailbox_id_idx ON scheduled_emails (mailbox_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS scheduled_emails;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE mailboxes
+    ADD COLUMN smtp_host VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN smtp_port INTEGER NOT NULL DEFAULT 587 CHECK (smtp_port BETWEEN 1 AND 65535),
+    ADD COLUMN smtp_username VARCHAR(320) NOT NULL DEFAULT '',
+    ADD COLUMN smtp_password TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE mailboxes
+    DROP COLUMN smtp_password,
+    DROP COLUMN smtp_username,
+    DROP COLUMN smtp_port,
+    DROP COLUMN smtp_host;
+-- +goose StatementEnd
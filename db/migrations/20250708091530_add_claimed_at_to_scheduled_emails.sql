@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE scheduled_emails ADD COLUMN claimed_at TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE scheduled_emails DROP CONSTRAINT scheduled_emails_status_check;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE scheduled_emails
+    ADD CONSTRAINT scheduled_emails_status_check
+    CHECK (status IN ('pending', 'sending', 'sent', 'failed', 'canceled'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE scheduled_emails SET status = 'pending' WHERE status = 'sending';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE scheduled_emails DROP CONSTRAINT scheduled_emails_status_check;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE scheduled_emails
+    ADD CONSTRAINT scheduled_emails_status_check
+    CHECK (status IN ('pending', 'sent', 'failed', 'canceled'));
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE scheduled_emails DROP COLUMN claimed_at;
+-- +goose StatementEnd
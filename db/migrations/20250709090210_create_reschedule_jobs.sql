@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE reschedule_jobs (
+    sequence_id INTEGER NOT NULL REFERENCES sequences(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL
+        CONSTRAINT reschedule_jobs_kind_check CHECK (kind IN ('steps', 'mailboxes')),
+    version INTEGER NOT NULL DEFAULT 1,
+    claimed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (sequence_id, kind)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS reschedule_jobs;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE scheduled_emails ALTER COLUMN step_id DROP NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE scheduled_emails DROP CONSTRAINT scheduled_emails_step_id_fkey;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE scheduled_emails
+    ADD CONSTRAINT scheduled_emails_step_id_fkey
+    FOREIGN KEY (step_id) REFERENCES steps(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM scheduled_emails WHERE step_id IS NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE scheduled_emails DROP CONSTRAINT scheduled_emails_step_id_fkey;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE scheduled_emails
+    ADD CONSTRAINT scheduled_emails_step_id_fkey
+    FOREIGN KEY (step_id) REFERENCES steps(id) ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE scheduled_emails ALTER COLUMN step_id SET NOT NULL;
+-- +goose StatementEnd
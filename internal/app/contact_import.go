@@ -0,0 +1,301 @@
+package app
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// importBatchSize is the number of valid rows written to the store at once.
+const importBatchSize = 1000
+
+// importContentType is the only request body format accepted by the import.
+const importContentType = "text/csv"
+
+// customFieldPrefix marks mapping targets that are stored as custom fields,
+// e.g. "customFields.title".
+const customFieldPrefix = "customFields."
+
+// contactFields lists the contact fields a CSV column can be mapped to.
+var contactFields = map[string]func(contact *model.Contact, value string){
+	"email":     func(c *model.Contact, v string) { c.Email = v },
+	"firstName": func(c *model.Contact, v string) { c.FirstName = v },
+	"lastName":  func(c *model.Contact, v string) { c.LastName = v },
+	"company":   func(c *model.Contact, v string) { c.Company = v },
+	"timezone":  func(c *model.Contact, v string) { c.Timezone = v },
+}
+
+type ImportContactsRequest struct {
+	OwnerID     uint64 `form:"ownerId" binding:"required"`
+	OnDuplicate string `form:"onDuplicate" binding:"omitempty,oneof=skip update"`
+}
+
+type ImportRowResult struct {
+	Row       int                `json:"row"`
+	Email     string             `json:"email,omitempty"`
+	Status    model.ImportStatus `json:"status"`
+	ContactID uint64             `json:"contactId,omitempty"`
+	Field     string             `json:"field,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+type ImportContactsResponse struct {
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Skipped int               `json:"skipped"`
+	Invalid int               `json:"invalid"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// importColumn maps a CSV column to a contact field.
+type importColumn struct {
+	index int
+	set   func(contact *model.Contact, value string)
+}
+
+// importContacts reads a CSV file from the request body. The first line holds
+// the column names, which are mapped to contact fields by the mapping query
+// parameters or, without them, by name. Rows are validated one by one and the
+// valid ones are stored in batches. A batch failing to be stored after others
+// were does not fail the request, its rows and the valid rows after it are
+// reported as failed.
+func (s *Service) importContacts(c *gin.Context) {
+	if c.ContentType() != importContentType {
+		c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, ErrorResponse{
+			Error: "content type must be " + importContentType,
+			Code:  CodeUnsupportedMediaType,
+		})
+		return
+	}
+
+	var data ImportContactsRequest
+	if err := c.ShouldBindQuery(&data); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	reader := csv.NewReader(c.Request.Body)
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = &model.Error{Kind: model.ErrValidation, Code: "empty_file", Message: "CSV file is empty"}
+		}
+		abortWithBindingError(c, err)
+		return
+	}
+	columns, err := mapImportColumns(header, c.QueryMap("mapping"))
+	if err != nil {
+		abortWithError(c, err, ErrInvalidRequest)
+		return
+	}
+
+	batch := &model.ContactImport{
+		OwnerID:        data.OwnerID,
+		UpdateExisting: data.OnDuplicate == "update",
+	}
+	var rows []ImportRowResult
+	// Indexes of the rows of the pending batch, in the order of its contacts.
+	var pending []int
+	// First row of every email seen so far, to skip repeated rows.
+	seen := make(map[string]int)
+
+	// Error of the first batch the store failed to import. Earlier batches
+	// stay stored, so the import goes on to report every row and the rows
+	// not stored from then on are marked failed. Without any stored batch
+	// there is nothing to report and the error is returned instead.
+	var importErr error
+	imported := false
+	flush := func() error {
+		if len(batch.Contacts) == 0 {
+			return nil
+		}
+		var statuses []model.ImportStatus
+		if importErr == nil {
+			statuses, importErr = s.store.ImportContacts(c.Request.Context(), batch)
+			switch {
+			case importErr == nil:
+				imported = true
+			case !imported:
+				return importErr
+			default:
+				log.Printf("%s %s: %v", c.Request.Method, c.FullPath(), importErr)
+			}
+		}
+		for i, index := range pending {
+			if importErr != nil {
+				rows[index].Status = model.ImportFailed
+				rows[index].Error = ErrResourceCreationFailed.Error()
+				continue
+			}
+			rows[index].Status = statuses[i]
+			rows[index].ContactID = batch.Contacts[i].ID
+		}
+		batch.Contacts, pending = nil, nil
+		return nil
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, ImportRowResult{
+				Row:    parseErr.StartLine,
+				Status: model.ImportInvalid,
+				Error:  parseErr.Err.Error(),
+			})
+			continue
+		}
+		if err != nil {
+			abortWithError(c, err, ErrResourceCreationFailed)
+			return
+		}
+
+		line, _ := reader.FieldPos(0)
+		contact := &model.Contact{CustomFields: map[string]string{}}
+		for _, column := range columns {
+			column.set(contact, record[column.index])
+		}
+		contact.Normalize()
+		result := ImportRowResult{Row: line, Email: contact.Email}
+
+		if err := contact.Validate(); err != nil {
+			result.Status = model.ImportInvalid
+			result.Error = err.Error()
+			var modelErr *model.Error
+			if errors.As(err, &modelErr) {
+				result.Field = modelErr.Field
+			}
+			rows = append(rows, result)
+			continue
+		}
+
+		email := strings.ToLower(contact.Email)
+		if first, ok := seen[email]; ok {
+			result.Status = model.ImportSkipped
+			result.Error = fmt.Sprintf("duplicate of row %d", first)
+			rows = append(rows, result)
+			continue
+		}
+		seen[email] = line
+
+		pending = append(pending, len(rows))
+		rows = append(rows, result)
+		batch.Contacts = append(batch.Contacts, contact)
+		if len(batch.Contacts) == importBatchSize {
+			if err := flush(); err != nil {
+				abortWithError(c, err, ErrResourceCreationFailed)
+				return
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		abortWithError(c, err, ErrResourceCreationFailed)
+		return
+	}
+
+	resp := ImportContactsResponse{Rows: rows}
+	if resp.Rows == nil {
+		resp.Rows = []ImportRowResult{}
+	}
+	for _, row := range rows {
+		switch row.Status {
+		case model.ImportCreated:
+			resp.Created++
+		case model.ImportUpdated:
+			resp.Updated++
+		case model.ImportSkipped:
+			resp.Skipped++
+		case model.ImportInvalid:
+			resp.Invalid++
+		case model.ImportFailed:
+			resp.Failed++
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// mapImportColumns resolves the contact field of every used CSV column.
+// Mapping keys are contact fields and values are column names. Without a
+// mapping, columns are matched to fields by name ignoring case, spaces and
+// punctuation, e.g. "First Name" is mapped to firstName.
+func mapImportColumns(header []string, mapping map[string]string) ([]importColumn, error) {
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	positions := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if _, ok := positions[name]; !ok {
+			positions[name] = i
+		}
+	}
+
+	if len(mapping) == 0 {
+		mapping = make(map[string]string)
+		for field := range contactFields {
+			for _, name := range header {
+				if normalizeColumnName(name) == strings.ToLower(field) {
+					mapping[field] = strings.TrimSpace(name)
+					break
+				}
+			}
+		}
+	}
+
+	if mapping["email"] == "" {
+		return nil, invalidMapping("email", "email column is required")
+	}
+
+	columns := make([]importColumn, 0, len(mapping))
+	for field, name := range mapping {
+		set, ok := contactFields[field]
+		if key, custom := strings.CutPrefix(field, customFieldPrefix); custom && key != "" {
+			set, ok = func(c *model.Contact, v string) {
+				if v = strings.TrimSpace(v); v != "" {
+					c.CustomFields[key] = v
+				}
+			}, true
+		}
+		if !ok {
+			return nil, invalidMapping(field, "unknown contact field")
+		}
+		index, ok := positions[strings.TrimSpace(name)]
+		if !ok {
+			return nil, invalidMapping(field, fmt.Sprintf("column %q not found", name))
+		}
+		columns = append(columns, importColumn{index: index, set: set})
+	}
+	return columns, nil
+}
+
+func normalizeColumnName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+func invalidMapping(field, message string) error {
+	return &model.Error{
+		Kind:    model.ErrValidation,
+		Code:    "invalid_mapping",
+		Field:   "mapping[" + field + "]",
+		Message: message,
+	}
+}
@@ -0,0 +1,188 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/model/memory"
+	"github.com/danikarik/salesforge/internal/model/mock"
+	"github.com/stretchr/testify/assert"
+	mocky "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func performImport(handler http.Handler, path, body string) *httptest.ResponseRecorder {
+	return performRequestWithHeaders(handler, "POST", path, body, map[string]string{"Content-Type": "text/csv"})
+}
+
+func TestImportContacts(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := memory.NewStore()
+		require.NoError(t, store.CreateContact(t.Context(), &model.Contact{OwnerID: 1, Email: "jane@example.com"}))
+
+		service := NewService(Config{Store: store})
+
+		csv := "\ufeffE-mail,First Name,Notes\n" +
+			"jane@example.com,Jane,\n" +
+			"john@example.com,John,\n" +
+			"not an email,Nobody,\n" +
+			"JOHN@example.com,Johnny,\n" +
+			"mary@example.com,Mary\n"
+		w := performImport(service.Handler(), "/contacts/import?ownerId=1", csv)
+		require.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), `"created":1,"updated":0,"skipped":2,"invalid":2`)
+		assert.Contains(t, w.Body.String(), `{"row":2,"email":"jane@example.com","status":"skipped","contactId":1}`)
+		assert.Contains(t, w.Body.String(), `{"row":3,"email":"john@example.com","status":"created","contactId":2}`)
+		assert.Contains(t, w.Body.String(), `{"row":4,"email":"not an email","status":"invalid","field":"email","error":"invalid email address"}`)
+		assert.Contains(t, w.Body.String(), `{"row":5,"email":"JOHN@example.com","status":"skipped","error":"duplicate of row 3"}`)
+		assert.Contains(t, w.Body.String(), `{"row":6,"status":"invalid","error":"wrong number of fields"}`)
+	})
+
+	t.Run("WithMapping", func(t *testing.T) {
+		store := memory.NewStore()
+		require.NoError(t, store.CreateContact(t.Context(), &model.Contact{OwnerID: 1, Email: "jane@example.com"}))
+
+		service := NewService(Config{Store: store})
+
+		csv := "Work Email,Job Title,Organization\n" +
+			"jane@example.com,CTO,Acme\n"
+		path := "/contacts/import?ownerId=1&onDuplicate=update" +
+			"&mapping[email]=Work+Email&mapping[company]=Organization&mapping[customFields.title]=Job+Title"
+		w := performImport(service.Handler(), path, csv)
+		require.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), `"created":0,"updated":1`)
+
+		contact, err := store.FetchContact(t.Context(), 1)
+		require.NoError(t, err)
+		assert.Equal(t, "Acme", contact.Company)
+		assert.Equal(t, map[string]string{"title": "CTO"}, contact.CustomFields)
+	})
+
+	t.Run("MissingEmailColumn", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performImport(service.Handler(), "/contacts/import?ownerId=1", "name\nJane\n")
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"invalid_mapping"`)
+		assert.Contains(t, w.Body.String(), `"field":"mapping[email]"`)
+	})
+
+	t.Run("UnknownField", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		path := "/contacts/import?ownerId=1&mapping[email]=email&mapping[phone]=phone"
+		w := performImport(service.Handler(), path, "email,phone\n")
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"mapping[phone]"`)
+	})
+
+	t.Run("UnsupportedContentType", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		body := "--boundary\r\nContent-Disposition: form-data; name=\"file\"; filename=\"contacts.csv\"\r\n\r\nemail\r\njane@example.com\r\n--boundary--\r\n"
+		w := performRequestWithHeaders(service.Handler(), "POST", "/contacts/import?ownerId=1", body, map[string]string{
+			"Content-Type": "multipart/form-data; boundary=boundary",
+		})
+		assert.Equal(t, 415, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"unsupported_media_type"`)
+		store.AssertNotCalled(t, "ImportContacts", mocky.Anything, mocky.Anything)
+	})
+
+	t.Run("EmptyFile", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performImport(service.Handler(), "/contacts/import?ownerId=1", "")
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"empty_file"`)
+	})
+
+	t.Run("FailedValidation", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performImport(service.Handler(), "/contacts/import", "email\n")
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"ownerId","message":"is required"}`)
+	})
+
+	t.Run("Batches", func(t *testing.T) {
+		store := &mock.MockStore{}
+		for _, size := range []int{importBatchSize, 1} {
+			statuses := make([]model.ImportStatus, size)
+			for i := range statuses {
+				statuses[i] = model.ImportCreated
+			}
+			store.On("ImportContacts", mocky.Anything, mocky.MatchedBy(func(batch *model.ContactImport) bool {
+				return len(batch.Contacts) == size
+			})).Return(statuses, nil).Once()
+		}
+
+		service := NewService(Config{Store: store})
+
+		csv := "email\n"
+		for i := range importBatchSize + 1 {
+			csv += fmt.Sprintf("contact%d@example.com\n", i)
+		}
+		w := performImport(service.Handler(), "/contacts/import?ownerId=1", csv)
+		require.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"created":%d`, importBatchSize+1))
+		store.AssertNumberOfCalls(t, "ImportContacts", 2)
+	})
+
+	t.Run("PartialFailure", func(t *testing.T) {
+		store := &mock.MockStore{}
+		statuses := make([]model.ImportStatus, importBatchSize)
+		for i := range statuses {
+			statuses[i] = model.ImportCreated
+		}
+		store.On("ImportContacts", mocky.Anything, mocky.Anything).Return(statuses, nil).Once()
+		store.On("ImportContacts", mocky.Anything, mocky.Anything).Return(nil, errors.New("import failed")).Once()
+
+		service := NewService(Config{Store: store})
+
+		csv := "email\n"
+		for i := range importBatchSize*2 + 1 {
+			csv += fmt.Sprintf("contact%d@example.com\n", i)
+		}
+		csv += "jane\n"
+		w := performImport(service.Handler(), "/contacts/import?ownerId=1", csv)
+		require.Equal(t, 200, w.Code)
+		store.AssertNumberOfCalls(t, "ImportContacts", 2)
+
+		var resp ImportContactsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, importBatchSize, resp.Created)
+		assert.Equal(t, importBatchSize+1, resp.Failed)
+		assert.Equal(t, 1, resp.Invalid)
+		require.Len(t, resp.Rows, importBatchSize*2+2)
+		assert.Equal(t, model.ImportCreated, resp.Rows[importBatchSize-1].Status)
+		assert.Equal(t, ImportRowResult{
+			Row:    importBatchSize + 2,
+			Email:  fmt.Sprintf("contact%d@example.com", importBatchSize),
+			Status: model.ImportFailed,
+			Error:  ErrResourceCreationFailed.Error(),
+		}, resp.Rows[importBatchSize])
+		assert.Equal(t, model.ImportFailed, resp.Rows[importBatchSize*2].Status)
+		assert.Equal(t, model.ImportInvalid, resp.Rows[importBatchSize*2+1].Status)
+	})
+
+	t.Run("WithError", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("ImportContacts", mocky.Anything, mocky.Anything).Return(nil, errors.New("import failed"))
+
+		service := NewService(Config{Store: store})
+
+		w := performImport(service.Handler(), "/contacts/import?ownerId=1", "email\njane@example.com\n")
+		assert.Equal(t, 500, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceCreationFailed.Error()))
+	})
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+type CreateContactRequest struct {
+	OwnerID      uint64            `json:"ownerId" binding:"required"`
+	Email        string            `json:"email" binding:"required,max=320"`
+	FirstName    string            `json:"firstName" binding:"max=255"`
+	LastName     string            `json:"lastName" binding:"max=255"`
+	Company      string            `json:"company" binding:"max=255"`
+	Timezone     string            `json:"timezone" binding:"max=64"`
+	CustomFields map[string]string `json:"customFields"`
+}
+
+func (s *Service) createContact(c *gin.Context) {
+	var data CreateContactRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	contact := &model.Contact{
+		OwnerID:      data.OwnerID,
+		Email:        data.Email,
+		FirstName:    data.FirstName,
+		LastName:     data.LastName,
+		Company:      data.Company,
+		Timezone:     data.Timezone,
+		CustomFields: data.CustomFields,
+	}
+	contact.Normalize()
+	if err := contact.Validate(); err != nil {
+		abortWithError(c, err, ErrInvalidRequest)
+		return
+	}
+
+	if err := s.store.CreateContact(c.Request.Context(), contact); err != nil {
+		abortWithError(c, err, ErrResourceCreationFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, contact)
+}
+
+func (s *Service) fetchContact(c *gin.Context) {
+	id, err := fetchResourceID(c, "id", "Invalid contact ID")
+	if err != nil {
+		return
+	}
+
+	contact, err := s.store.FetchContact(c.Request.Context(), id)
+	if err != nil {
+		abortWithError(c, err, ErrResourceFetchingFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, contact)
+}
+
+type ListContactsRequest struct {
+	Cursor  string `form:"cursor"`
+	Limit   uint64 `form:"limit" binding:"omitempty,min=1,max=100"`
+	OwnerID uint64 `form:"ownerId"`
+	Email   string `form:"email"`
+}
+
+type ListContactsResponse struct {
+	Contacts   []*model.Contact `json:"contacts"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+func (s *Service) listContacts(c *gin.Context) {
+	var data ListContactsRequest
+	if err := c.ShouldBindQuery(&data); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	params := &model.ListContactsParams{
+		Limit:   data.Limit,
+		OwnerID: data.OwnerID,
+		Email:   data.Email,
+	}
+	if params.Limit == 0 {
+		params.Limit = model.DefaultPageSize
+	}
+	if data.Cursor != "" {
+		cursor, err := model.DecodeCursor(data.Cursor)
+		if err != nil {
+			abortWithError(c, err, ErrInvalidRequest)
+			return
+		}
+		params.After = cursor
+	}
+
+	contacts, next, err := s.store.ListContacts(c.Request.Context(), params)
+	if err != nil {
+		abortWithError(c, err, ErrResourceFetchingFailed)
+		return
+	}
+
+	resp := ListContactsResponse{Contacts: contacts}
+	if resp.Contacts == nil {
+		resp.Contacts = []*model.Contact{}
+	}
+	if next != nil {
+		resp.NextCursor = next.Encode()
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+type PatchContactRequest struct {
+	Email        *string           `json:"email" binding:"omitempty,min=1,max=320"`
+	FirstName    *string           `json:"firstName" binding:"omitempty,max=255"`
+	LastName     *string           `json:"lastName" binding:"omitempty,max=255"`
+	Company      *string           `json:"company" binding:"omitempty,max=255"`
+	Timezone     *string           `json:"timezone" binding:"omitempty,max=64"`
+	CustomFields map[string]string `json:"customFields"`
+}
+
+func (s *Service) patchContact(c *gin.Context) {
+	id, err := fetchResourceID(c, "id", "Invalid contact ID")
+	if err != nil {
+		return
+	}
+
+	var data PatchContactRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	contact, err := s.store.UpdateContact(c.Request.Context(), id, &model.ContactPatch{
+		Email:        data.Email,
+		FirstName:    data.FirstName,
+		LastName:     data.LastName,
+		Company:      data.Company,
+		Timezone:     data.Timezone,
+		CustomFields: data.CustomFields,
+	})
+	if err != nil {
+		abortWithError(c, err, ErrResourceUpdateFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, contact)
+}
+
+func (s *Service) deleteContact(c *gin.Context) {
+	id, err := fetchResourceID(c, "id", "Invalid contact ID")
+	if err != nil {
+		return
+	}
+
+	if err := s.store.DeleteContact(c.Request.Context(), id); err != nil {
+		abortWithError(c, err, ErrResourceDeletionFailed)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,232 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/model/memory"
+	"github.com/danikarik/salesforge/internal/model/mock"
+	"github.com/stretchr/testify/assert"
+	mocky "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateContact(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("CreateContact", mocky.Anything, &model.Contact{
+			OwnerID:      1,
+			Email:        "jane@example.com",
+			FirstName:    "Jane",
+			CustomFields: map[string]string{},
+		}).Return(nil)
+
+		service := NewService(Config{Store: store})
+
+		req := `{"ownerId": 1, "email": " jane@example.com", "firstName": "Jane "}`
+		w := performRequest(service.Handler(), "POST", "/contacts", req)
+		assert.Equal(t, 201, w.Code)
+		assert.Contains(t, w.Body.String(), `"email":"jane@example.com"`)
+	})
+
+	t.Run("FailedValidation", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/contacts", `{"email": "jane@example.com"}`)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"ownerId","message":"is required"}`)
+	})
+
+	t.Run("InvalidEmail", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/contacts", `{"ownerId": 1, "email": "jane"}`)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"invalid_email"`)
+		assert.Contains(t, w.Body.String(), `"field":"email"`)
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("CreateContact", mocky.Anything, mocky.Anything).Return(model.ErrContactExists)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/contacts", `{"ownerId": 1, "email": "jane@example.com"}`)
+		assert.Equal(t, 409, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"contact_exists"`)
+	})
+
+	t.Run("WithError", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("CreateContact", mocky.Anything, mocky.Anything).Return(errors.New("create failed"))
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/contacts", `{"ownerId": 1, "email": "jane@example.com"}`)
+		assert.Equal(t, 500, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceCreationFailed.Error()))
+	})
+}
+
+func TestFetchContact(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("FetchContact", mocky.Anything, uint64(1)).Return(&model.Contact{
+			ID:    1,
+			Email: "jane@example.com",
+		}, nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/contacts/1", "")
+		assert.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), `"email":"jane@example.com"`)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("FetchContact", mocky.Anything, uint64(1)).Return(nil, model.ErrNotFound)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/contacts/1", "")
+		assert.Equal(t, 404, w.Code)
+	})
+
+	t.Run("InvalidID", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/contacts/abc", "")
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"id"`)
+	})
+}
+
+func TestListContacts(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("ListContacts", mocky.Anything, &model.ListContactsParams{Limit: 20}).
+			Return(nil, nil, nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/contacts", "")
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, `{"contacts":[]}`, w.Body.String())
+	})
+
+	t.Run("WithFilters", func(t *testing.T) {
+		cursor := &model.Cursor{ID: 5}
+
+		store := &mock.MockStore{}
+		store.On("ListContacts", mocky.Anything, &model.ListContactsParams{
+			After:   cursor,
+			Limit:   1,
+			OwnerID: 2,
+			Email:   "example.com",
+		}).Return([]*model.Contact{
+			{ID: 6, Email: "jane@example.com"},
+		}, &model.Cursor{ID: 6}, nil)
+
+		service := NewService(Config{Store: store})
+
+		path := "/contacts?limit=1&ownerId=2&email=example.com&cursor=" + cursor.Encode()
+		w := performRequest(service.Handler(), "GET", path, "")
+		assert.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"nextCursor":"%s"`, (&model.Cursor{ID: 6}).Encode()))
+	})
+
+	t.Run("FailedValidation", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/contacts?limit=500", "")
+		assert.Equal(t, 400, w.Code)
+	})
+}
+
+func TestPatchContact(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		company := "Acme"
+
+		store := &mock.MockStore{}
+		store.On("UpdateContact", mocky.Anything, uint64(1), &model.ContactPatch{
+			Company:      &company,
+			CustomFields: map[string]string{"title": "CTO"},
+		}).Return(&model.Contact{ID: 1, Email: "jane@example.com", Company: company}, nil)
+
+		service := NewService(Config{Store: store})
+
+		req := `{"company": "Acme", "customFields": {"title": "CTO"}}`
+		w := performRequest(service.Handler(), "PATCH", "/contacts/1", req)
+		assert.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), `"company":"Acme"`)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("UpdateContact", mocky.Anything, uint64(1), mocky.Anything).Return(nil, model.ErrNotFound)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "PATCH", "/contacts/1", `{"firstName": "Jane"}`)
+		assert.Equal(t, 404, w.Code)
+	})
+
+	t.Run("FailedValidation", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "PATCH", "/contacts/1", `{"email": ""}`)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"email"`)
+	})
+}
+
+func TestDeleteContact(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("DeleteContact", mocky.Anything, uint64(1)).Return(nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "DELETE", "/contacts/1", "")
+		assert.Equal(t, 204, w.Code)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("DeleteContact", mocky.Anything, uint64(1)).Return(model.ErrNotFound)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "DELETE", "/contacts/1", "")
+		assert.Equal(t, 404, w.Code)
+	})
+}
+
+func TestContactLifecycle(t *testing.T) {
+	service := NewService(Config{Store: memory.NewStore()})
+
+	w := performRequest(service.Handler(), "POST", "/contacts", `{"ownerId": 1, "email": "jane@example.com"}`)
+	require.Equal(t, 201, w.Code)
+
+	w = performRequest(service.Handler(), "POST", "/contacts", `{"ownerId": 1, "email": "Jane@Example.com"}`)
+	assert.Equal(t, 409, w.Code)
+
+	w = performRequest(service.Handler(), "PATCH", "/contacts/1", `{"lastName": "Doe"}`)
+	require.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"lastName":"Doe"`)
+
+	w = performRequest(service.Handler(), "DELETE", "/contacts/1", "")
+	require.Equal(t, 204, w.Code)
+
+	w = performRequest(service.Handler(), "GET", "/contacts/1", "")
+	assert.Equal(t, 404, w.Code)
+}
@@ -0,0 +1,183 @@
+package app
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+// enrollmentFilterPageSize is the number of contacts read at once when
+// enrolling the contacts matching a filter.
+const enrollmentFilterPageSize = 1000
+
+type ContactFilter struct {
+	OwnerID uint64 `json:"ownerId" binding:"required"`
+	Email   string `json:"email"`
+}
+
+type CreateEnrollmentsRequest struct {
+	ContactIDs []uint64       `json:"contactIds"`
+	Filter     *ContactFilter `json:"filter"`
+}
+
+type CreateEnrollmentsResponse struct {
+	Enrollments []*model.Enrollment `json:"enrollments"`
+}
+
+// createEnrollments enrolls the listed contacts, or the contacts matching the
+// filter, into the sequence. Every enrollment starts from the first step.
+func (s *Service) createEnrollments(c *gin.Context) {
+	id, err := fetchResourceID(c, "id", "Invalid sequence ID")
+	if err != nil {
+		return
+	}
+
+	var data CreateEnrollmentsRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+	if (len(data.ContactIDs) == 0) == (data.Filter == nil) {
+		abortWithError(c, &model.Error{
+			Kind:    model.ErrValidation,
+			Code:    "invalid_enrollment",
+			Field:   "contactIds",
+			Message: "either contactIds or filter must be provided",
+		}, ErrInvalidRequest)
+		return
+	}
+
+	ctx := c.Request.Context()
+	sequence, err := s.store.FetchSequence(ctx, id)
+	if err != nil {
+		abortWithError(c, err, ErrResourceFetchingFailed)
+		return
+	}
+	if sequence.ArchivedAt != nil {
+		abortWithError(c, model.ErrSequenceArchived, ErrInvalidRequest)
+		return
+	}
+	if len(sequence.Steps) == 0 {
+		abortWithError(c, model.ErrSequenceEmpty, ErrInvalidRequest)
+		return
+	}
+
+	contactIDs := data.ContactIDs
+	if data.Filter != nil {
+		params := &model.ListContactsParams{
+			Limit:   enrollmentFilterPageSize,
+			OwnerID: data.Filter.OwnerID,
+			Email:   data.Filter.Email,
+		}
+		for {
+			contacts, next, err := s.store.ListContacts(ctx, params)
+			if err != nil {
+				abortWithError(c, err, ErrResourceFetchingFailed)
+				return
+			}
+			for _, contact := range contacts {
+				contactIDs = append(contactIDs, contact.ID)
+			}
+			if next == nil {
+				break
+			}
+			params.After = next
+		}
+	}
+
+	enrollments, err := s.store.CreateEnrollments(ctx, id, sequence.Steps[0].ID, contactIDs, time.Now())
+	if err != nil {
+		abortWithError(c, err, ErrResourceCreationFailed)
+		return
+	}
+
+	resp := CreateEnrollmentsResponse{Enrollments: enrollments}
+	if resp.Enrollments == nil {
+		resp.Enrollments = []*model.Enrollment{}
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+func (s *Service) fetchEnrollment(c *gin.Context) {
+	id, err := fetchResourceID(c, "id", "Invalid enrollment ID")
+	if err != nil {
+		return
+	}
+
+	enrollment, err := s.store.FetchEnrollment(c.Request.Context(), id)
+	if err != nil {
+		abortWithError(c, err, ErrResourceFetchingFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+type ListScheduledEmailsResponse struct {
+	Emails []*model.ScheduledEmail `json:"emails"`
+}
+
+func (s *Service) listScheduledEmails(c *gin.Context) {
+	id, err := fetchResourceID(c, "id", "Invalid enrollment ID")
+	if err != nil {
+		return
+	}
+
+	emails, err := s.store.ListScheduledEmails(c.Request.Context(), id)
+	if err != nil {
+		abortWithError(c, err, ErrResourceFetchingFailed)
+		return
+	}
+
+	resp := ListScheduledEmailsResponse{Emails: emails}
+	if resp.Emails == nil {
+		resp.Emails = []*model.ScheduledEmail{}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// transitionEnrollment returns a handler moving a single enrollment to the
+// status, e.g. pausing it.
+func (s *Service) transitionEnrollment(status model.EnrollmentStatus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := fetchResourceID(c, "id", "Invalid enrollment ID")
+		if err != nil {
+			return
+		}
+
+		enrollment, err := s.store.TransitionEnrollment(c.Request.Context(), id, status, time.Now())
+		if err != nil {
+			abortWithError(c, err, ErrResourceUpdateFailed)
+			return
+		}
+
+		c.JSON(http.StatusOK, enrollment)
+	}
+}
+
+type TransitionEnrollmentsResponse struct {
+	Updated int `json:"updated"`
+}
+
+// transitionEnrollments returns a handler moving every enrollment of the
+// sequence that allows it to the status.
+func (s *Service) transitionEnrollments(status model.EnrollmentStatus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := fetchResourceID(c, "id", "Invalid sequence ID")
+		if err != nil {
+			return
+		}
+
+		updated, err := s.store.TransitionEnrollments(c.Request.Context(), id, status, time.Now())
+		if err != nil {
+			abortWithError(c, err, ErrResourceUpdateFailed)
+			return
+		}
+
+		c.JSON(http.StatusOK, TransitionEnrollmentsResponse{Updated: updated})
+	}
+}
@@ -0,0 +1,312 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/model/memory"
+	"github.com/danikarik/salesforge/internal/model/mock"
+	"github.com/stretchr/testify/assert"
+	mocky "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateEnrollments(t *testing.T) {
+	sequence := &model.Sequence{
+		ID: 1,
+		Steps: []*model.Step{
+			{ID: 7, Position: 1},
+			{ID: 3, Position: 2},
+		},
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		stepID := uint64(7)
+
+		store := &mock.MockStore{}
+		store.On("FetchSequence", mocky.Anything, uint64(1)).Return(sequence, nil)
+		store.On("CreateEnrollments", mocky.Anything, uint64(1), uint64(7), []uint64{2, 5}, mocky.Anything).Return([]*model.Enrollment{
+			{ID: 1, SequenceID: 1, ContactID: 2, Status: model.EnrollmentActive, CurrentStepID: &stepID},
+			{ID: 2, SequenceID: 1, ContactID: 5, Status: model.EnrollmentActive, CurrentStepID: &stepID},
+		}, nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/enrollments", `{"contactIds": [2, 5]}`)
+		assert.Equal(t, 201, w.Code)
+		assert.Contains(t, w.Body.String(), `"contactId":5,"status":"active","currentStepId":7`)
+	})
+
+	t.Run("WithFilter", func(t *testing.T) {
+		next := &model.Cursor{ID: 2}
+
+		store := &mock.MockStore{}
+		store.On("FetchSequence", mocky.Anything, uint64(1)).Return(sequence, nil)
+		store.On("ListContacts", mocky.Anything, &model.ListContactsParams{
+			Limit:   enrollmentFilterPageSize,
+			OwnerID: 4,
+			Email:   "acme.com",
+		}).Return([]*model.Contact{{ID: 1}, {ID: 2}}, next, nil).Once()
+		store.On("ListContacts", mocky.Anything, &model.ListContactsParams{
+			After:   next,
+			Limit:   enrollmentFilterPageSize,
+			OwnerID: 4,
+			Email:   "acme.com",
+		}).Return([]*model.Contact{{ID: 3}}, nil, nil).Once()
+		store.On("CreateEnrollments", mocky.Anything, uint64(1), uint64(7), []uint64{1, 2, 3}, mocky.Anything).Return(nil, nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/enrollments", `{"filter": {"ownerId": 4, "email": "acme.com"}}`)
+		assert.Equal(t, 201, w.Code)
+		assert.Equal(t, `{"enrollments":[]}`, w.Body.String())
+		store.AssertExpectations(t)
+	})
+
+	t.Run("MissingContacts", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/enrollments", `{"contactIds": []}`)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"invalid_enrollment"`)
+
+		w = performRequest(service.Handler(), "POST", "/sequences/1/enrollments", `{"contactIds": [1], "filter": {"ownerId": 1}}`)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"invalid_enrollment"`)
+	})
+
+	t.Run("FailedValidation", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/enrollments", `{"filter": {"email": "acme.com"}}`)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"filter.ownerId","message":"is required"}`)
+	})
+
+	t.Run("ArchivedSequence", func(t *testing.T) {
+		archivedAt := time.Now()
+
+		store := &mock.MockStore{}
+		store.On("FetchSequence", mocky.Anything, uint64(1)).Return(&model.Sequence{ID: 1, ArchivedAt: &archivedAt}, nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/enrollments", `{"contactIds": [2]}`)
+		assert.Equal(t, 409, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"sequence_archived"`)
+	})
+
+	t.Run("EmptySequence", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("FetchSequence", mocky.Anything, uint64(1)).Return(&model.Sequence{ID: 1}, nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/enrollments", `{"contactIds": [2]}`)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"sequence_empty"`)
+	})
+
+	t.Run("AlreadyEnrolled", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("FetchSequence", mocky.Anything, uint64(1)).Return(sequence, nil)
+		store.On("CreateEnrollments", mocky.Anything, uint64(1), uint64(7), []uint64{2}, mocky.Anything).Return(nil, model.ErrAlreadyEnrolled)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/enrollments", `{"contactIds": [2]}`)
+		assert.Equal(t, 409, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"already_enrolled"`)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("FetchSequence", mocky.Anything, uint64(1)).Return(nil, model.ErrNotFound)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/enrollments", `{"contactIds": [2]}`)
+		assert.Equal(t, 404, w.Code)
+	})
+
+	t.Run("WithError", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("FetchSequence", mocky.Anything, uint64(1)).Return(sequence, nil)
+		store.On("CreateEnrollments", mocky.Anything, uint64(1), uint64(7), []uint64{2}, mocky.Anything).Return(nil, errors.New("enroll failed"))
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/enrollments", `{"contactIds": [2]}`)
+		assert.Equal(t, 500, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceCreationFailed.Error()))
+	})
+}
+
+func TestFetchEnrollment(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("FetchEnrollment", mocky.Anything, uint64(1)).Return(&model.Enrollment{ID: 1, Status: model.EnrollmentPaused}, nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/enrollments/1", "")
+		assert.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), `"status":"paused"`)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("FetchEnrollment", mocky.Anything, uint64(1)).Return(nil, model.ErrNotFound)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/enrollments/1", "")
+		assert.Equal(t, 404, w.Code)
+	})
+}
+
+func TestListScheduledEmails(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		stepID := uint64(2)
+		store.On("ListScheduledEmails", mocky.Anything, uint64(1)).Return([]*model.ScheduledEmail{
+			{ID: 3, SequenceID: 4, EnrollmentID: 1, StepID: &stepID, Status: model.ScheduledEmailPending},
+		}, nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/enrollments/1/emails", "")
+		assert.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), `"id":3,"sequenceId":4,"enrollmentId":1,"stepId":2,"mailboxId":null`)
+		assert.Contains(t, w.Body.String(), `"status":"pending"`)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("ListScheduledEmails", mocky.Anything, uint64(1)).Return(nil, model.ErrNotFound)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/enrollments/1/emails", "")
+		assert.Equal(t, 404, w.Code)
+	})
+}
+
+func TestTransitionEnrollment(t *testing.T) {
+	for action, status := range map[string]model.EnrollmentStatus{
+		"pause":  model.EnrollmentPaused,
+		"resume": model.EnrollmentActive,
+		"stop":   model.EnrollmentStopped,
+	} {
+		t.Run(action, func(t *testing.T) {
+			store := &mock.MockStore{}
+			store.On("TransitionEnrollment", mocky.Anything, uint64(1), status, mocky.Anything).Return(&model.Enrollment{ID: 1, Status: status}, nil)
+
+			service := NewService(Config{Store: store})
+
+			w := performRequest(service.Handler(), "POST", "/enrollments/1/"+action, "")
+			assert.Equal(t, 200, w.Code)
+			assert.Contains(t, w.Body.String(), fmt.Sprintf(`"status":"%s"`, status))
+		})
+	}
+
+	t.Run("InvalidTransition", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("TransitionEnrollment", mocky.Anything, uint64(1), model.EnrollmentActive, mocky.Anything).Return(nil, model.ErrInvalidTransition)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/enrollments/1/resume", "")
+		assert.Equal(t, 409, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"invalid_transition"`)
+	})
+
+	t.Run("WithError", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("TransitionEnrollment", mocky.Anything, uint64(1), model.EnrollmentStopped, mocky.Anything).Return(nil, errors.New("stop failed"))
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/enrollments/1/stop", "")
+		assert.Equal(t, 500, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceUpdateFailed.Error()))
+	})
+}
+
+func TestTransitionEnrollments(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("TransitionEnrollments", mocky.Anything, uint64(1), model.EnrollmentPaused, mocky.Anything).Return(12, nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/enrollments/pause", "")
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, `{"updated":12}`, w.Body.String())
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("TransitionEnrollments", mocky.Anything, uint64(1), model.EnrollmentStopped, mocky.Anything).Return(0, model.ErrNotFound)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/enrollments/stop", "")
+		assert.Equal(t, 404, w.Code)
+	})
+}
+
+func TestEnrollmentLifecycle(t *testing.T) {
+	service := NewService(Config{Store: memory.NewStore()})
+
+	req := `{
+		"name": "Test Sequence",
+		"steps": [
+			{"subject": "Step 1", "content": "Content 1"},
+			{"subject": "Step 2", "content": "Content 2", "waitDays": 2}
+		]
+	}`
+	w := performRequest(service.Handler(), "POST", "/sequences", req)
+	require.Equal(t, 201, w.Code)
+
+	w = performRequest(service.Handler(), "PUT", "/sequences/1/steps/order", `{"stepIds": [2, 1]}`)
+	require.Equal(t, 200, w.Code)
+
+	w = performRequest(service.Handler(), "POST", "/contacts", `{"ownerId": 1, "email": "jane@example.com"}`)
+	require.Equal(t, 201, w.Code)
+
+	w = performRequest(service.Handler(), "POST", "/sequences/1/enrollments", `{"filter": {"ownerId": 1}}`)
+	require.Equal(t, 201, w.Code)
+	assert.Contains(t, w.Body.String(), `"contactId":1,"status":"active","currentStepId":2`)
+
+	w = performRequest(service.Handler(), "POST", "/sequences/1/enrollments", `{"contactIds": [1]}`)
+	assert.Equal(t, 409, w.Code)
+
+	w = performRequest(service.Handler(), "POST", "/sequences/1/enrollments", `{"contactIds": [2]}`)
+	assert.Equal(t, 400, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"unknown_contact"`)
+
+	w = performRequest(service.Handler(), "POST", "/enrollments/1/pause", "")
+	require.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"paused"`)
+
+	w = performRequest(service.Handler(), "POST", "/enrollments/1/pause", "")
+	assert.Equal(t, 409, w.Code)
+
+	w = performRequest(service.Handler(), "GET", "/enrollments/1/emails", "")
+	require.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"stepId":2`)
+	assert.Contains(t, w.Body.String(), `"status":"canceled"`)
+
+	w = performRequest(service.Handler(), "POST", "/sequences/1/enrollments/stop", "")
+	require.Equal(t, 200, w.Code)
+	assert.Equal(t, `{"updated":1}`, w.Body.String())
+
+	w = performRequest(service.Handler(), "POST", "/enrollments/1/resume", "")
+	assert.Equal(t, 409, w.Code)
+}
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	ErrResourceNotFound       = errors.New("resource not found")
+	ErrResourceCreationFailed = errors.New("resource creation failed")
+	ErrResourceFetchingFailed = errors.New("resource fetching failed")
+	ErrResourceUpdateFailed   = errors.New("resource update failed")
+	ErrResourceDeletionFailed = errors.New("resource deletion failed")
+	ErrInvalidRequest         = errors.New("invalid request")
+	ErrTestSendFailed         = errors.New("test send failed")
+)
+
+// Error codes of failures that are not described by a model.Error.
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeValidationFailed     = "validation_failed"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeUniqueViolation      = "unique_violation"
+	CodeInternal             = "internal_error"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+)
+
+// ErrorResponse is the body of every failed request.
+type ErrorResponse struct {
+	Error   string        `json:"error"`
+	Code    string        `json:"code"`
+	Details []ErrorDetail `json:"details,omitempty"`
+}
+
+// ErrorDetail points at a request field that caused the error.
+type ErrorDetail struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func init() {
+	// Report validation errors with the field names clients send.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(requestFieldName)
+	}
+}
+
+// abortWithError writes the response matching err. Errors unknown to the
+// model are logged and reported with the fallback message only.
+func abortWithError(c *gin.Context, err error, fallback error) {
+	status, resp := errorResponse(err)
+	if status == http.StatusInternalServerError {
+		log.Printf("%s %s: %v", c.Request.Method, c.FullPath(), err)
+		resp.Error = fallback.Error()
+	}
+	c.AbortWithStatusJSON(status, resp)
+}
+
+func errorResponse(err error) (int, ErrorResponse) {
+	var (
+		modelErr      *model.Error
+		validationErr validator.ValidationErrors
+		syntaxErr     *json.SyntaxError
+		typeErr       *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &validationErr):
+		resp := ErrorResponse{Error: model.ErrValidation.Error(), Code: CodeValidationFailed}
+		for _, fieldErr := range validationErr {
+			resp.Details = append(resp.Details, ErrorDetail{
+				Field:   fieldPath(fieldErr.Namespace()),
+				Message: validationMessage(fieldErr),
+			})
+		}
+		return http.StatusBadRequest, resp
+	case errors.As(err, &typeErr):
+		return http.StatusBadRequest, ErrorResponse{
+			Error:   ErrInvalidRequest.Error(),
+			Code:    CodeInvalidRequest,
+			Details: []ErrorDetail{{Field: typeErr.Field, Message: "must be a " + typeErr.Type.String()}},
+		}
+	case errors.As(err, &syntaxErr):
+		return http.StatusBadRequest, ErrorResponse{Error: syntaxErr.Error(), Code: CodeInvalidRequest}
+	case errors.As(err, &modelErr):
+		resp := ErrorResponse{Error: modelErr.Message, Code: modelErr.Code}
+		if modelErr.Field != "" {
+			resp.Details = []ErrorDetail{{Field: modelErr.Field, Message: modelErr.Message}}
+		}
+		return errorStatus(err), resp
+	case errors.Is(err, model.ErrNotFound):
+		return http.StatusNotFound, ErrorResponse{Error: ErrResourceNotFound.Error(), Code: CodeNotFound}
+	case errors.Is(err, model.ErrUniqueViolation):
+		return http.StatusConflict, ErrorResponse{Error: err.Error(), Code: CodeUniqueViolation}
+	case errors.Is(err, model.ErrConflict):
+		return http.StatusConflict, ErrorResponse{Error: err.Error(), Code: CodeConflict}
+	case errors.Is(err, model.ErrValidation):
+		return http.StatusBadRequest, ErrorResponse{Error: err.Error(), Code: CodeValidationFailed}
+	}
+
+	return http.StatusInternalServerError, ErrorResponse{Code: CodeInternal}
+}
+
+// abortWithBindingError writes the response for a request that could not be
+// bound, e.g. because of malformed JSON or failed validation.
+func abortWithBindingError(c *gin.Context, err error) {
+	status, resp := errorResponse(err)
+	if status == http.StatusInternalServerError {
+		status, resp = http.StatusBadRequest, ErrorResponse{Error: err.Error(), Code: CodeInvalidRequest}
+	}
+	c.AbortWithStatusJSON(status, resp)
+}
+
+// errorStatus returns the HTTP status of a model error.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, model.ErrVersionMismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, model.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, model.ErrUniqueViolation), errors.Is(err, model.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, model.ErrValidation):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// nestedFieldError relates a model error to a field of a nested request
+// object, e.g. "content" becomes "steps[1].content".
+func nestedFieldError(err error, parent string) error {
+	var modelErr *model.Error
+	if errors.As(err, &modelErr) && modelErr.Field != "" {
+		return modelErr.WithField(parent + "." + modelErr.Field)
+	}
+	return err
+}
+
+// requestFieldName names struct fields after their JSON or query keys.
+func requestFieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// fieldPath drops the request struct name from a validation namespace,
+// e.g. "CreateSequenceRequest.steps[0].subject" becomes "steps[0].subject".
+func fieldPath(namespace string) string {
+	_, path, found := strings.Cut(namespace, ".")
+	if !found {
+		return namespace
+	}
+	return path
+}
+
+func validationMessage(err validator.FieldError) string {
+	subject := "must be"
+	switch err.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		subject = "length must be"
+	}
+
+	switch err.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return fmt.Sprintf("%s at least %s", subject, err.Param())
+	case "max":
+		return fmt.Sprintf("%s at most %s", subject, err.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", err.Param())
+	}
+	return fmt.Sprintf("failed %q validation", err.Tag())
+}
@@ -0,0 +1,227 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+type CreateMailboxRequest struct {
+	UserID        uint64 `json:"userId" binding:"required"`
+	Email         string `json:"email" binding:"required,max=320"`
+	DailyCapacity int    `json:"dailyCapacity" binding:"required,min=1"`
+	SMTPHost      string `json:"smtpHost" binding:"max=255"`
+	SMTPPort      int    `json:"smtpPort" binding:"omitempty,min=1,max=65535"`
+	SMTPUsername  string `json:"smtpUsername" binding:"max=320"`
+	SMTPPassword  string `json:"smtpPassword"`
+}
+
+func (s *Service) createMailbox(c *gin.Context) {
+	var data CreateMailboxRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	mailbox := &model.Mailbox{
+		UserID:        data.UserID,
+		Email:         data.Email,
+		DailyCapacity: data.DailyCapacity,
+		SMTPHost:      data.SMTPHost,
+		SMTPPort:      data.SMTPPort,
+		SMTPUsername:  data.SMTPUsername,
+		SMTPPassword:  data.SMTPPassword,
+	}
+	mailbox.Normalize()
+	if err := mailbox.Validate(); err != nil {
+		abortWithError(c, err, ErrInvalidRequest)
+		return
+	}
+
+	if err := s.store.CreateMailbox(c.Request.Context(), mailbox); err != nil {
+		abortWithError(c, err, ErrResourceCreationFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, mailbox)
+}
+
+func (s *Service) fetchMailbox(c *gin.Context) {
+	id, err := fetchResourceID(c, "id", "Invalid mailbox ID")
+	if err != nil {
+		return
+	}
+
+	mailbox, err := s.store.FetchMailbox(c.Request.Context(), id)
+	if err != nil {
+		abortWithError(c, err, ErrResourceFetchingFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, mailbox)
+}
+
+type ListMailboxesRequest struct {
+	Cursor string `form:"cursor"`
+	Limit  uint64 `form:"limit" binding:"omitempty,min=1,max=100"`
+	UserID uint64 `form:"userId"`
+}
+
+type ListMailboxesResponse struct {
+	Mailboxes  []*model.Mailbox `json:"mailboxes"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+func (s *Service) listMailboxes(c *gin.Context) {
+	var data ListMailboxesRequest
+	if err := c.ShouldBindQuery(&data); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	params := &model.ListMailboxesParams{
+		Limit:  data.Limit,
+		UserID: data.UserID,
+	}
+	if params.Limit == 0 {
+		params.Limit = model.DefaultPageSize
+	}
+	if data.Cursor != "" {
+		cursor, err := model.DecodeCursor(data.Cursor)
+		if err != nil {
+			abortWithError(c, err, ErrInvalidRequest)
+			return
+		}
+		params.After = cursor
+	}
+
+	mailboxes, next, err := s.store.ListMailboxes(c.Request.Context(), params)
+	if err != nil {
+		abortWithError(c, err, ErrResourceFetchingFailed)
+		return
+	}
+
+	resp := ListMailboxesResponse{Mailboxes: mailboxes}
+	if resp.Mailboxes == nil {
+		resp.Mailboxes = []*model.Mailbox{}
+	}
+	if next != nil {
+		resp.NextCursor = next.Encode()
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+type PatchMailboxRequest struct {
+	Email         *string `json:"email" binding:"omitempty,min=1,max=320"`
+	DailyCapacity *int    `json:"dailyCapacity" binding:"omitempty,min=1"`
+	SMTPHost      *string `json:"smtpHost" binding:"omitempty,max=255"`
+	SMTPPort      *int    `json:"smtpPort" binding:"omitempty,min=1,max=65535"`
+	SMTPUsername  *string `json:"smtpUsername" binding:"omitempty,max=320"`
+	SMTPPassword  *string `json:"smtpPassword"`
+}
+
+func (s *Service) patchMailbox(c *gin.Context) {
+	id, err := fetchResourceID(c, "id", "Invalid mailbox ID")
+	if err != nil {
+		return
+	}
+
+	var data PatchMailboxRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	mailbox, err := s.store.UpdateMailbox(c.Request.Context(), id, &model.MailboxPatch{
+		Email:         data.Email,
+		DailyCapacity: data.DailyCapacity,
+		SMTPHost:      data.SMTPHost,
+		SMTPPort:      data.SMTPPort,
+		SMTPUsername:  data.SMTPUsername,
+		SMTPPassword:  data.SMTPPassword,
+	})
+	if err != nil {
+		abortWithError(c, err, ErrResourceUpdateFailed)
+		return
+	}
+
+	c.JSON(http.StatusOK, mailbox)
+}
+
+func (s *Service) deleteMailbox(c *gin.Context) {
+	id, err := fetchResourceID(c, "id", "Invalid mailbox ID")
+	if err != nil {
+		return
+	}
+
+	if err := s.store.DeleteMailbox(c.Request.Context(), id); err != nil {
+		abortWithError(c, err, ErrResourceDeletionFailed)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type ListSequenceMailboxesResponse struct {
+	Mailboxes []*model.Mailbox `json:"mailboxes"`
+}
+
+func (s *Service) listSequenceMailboxes(c *gin.Context) {
+	id, err := fetchResourceID(c, "id", "Invalid sequence ID")
+	if err != nil {
+		return
+	}
+
+	mailboxes, err := s.store.ListSequenceMailboxes(c.Request.Context(), id)
+	if err != nil {
+		abortWithError(c, err, ErrResourceFetchingFailed)
+		return
+	}
+
+	resp := ListSequenceMailboxesResponse{Mailboxes: mailboxes}
+	if resp.Mailboxes == nil {
+		resp.Mailboxes = []*model.Mailbox{}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Service) attachMailbox(c *gin.Context) {
+	id, err := fetchResourceID(c, "id", "Invalid sequence ID")
+	if err != nil {
+		return
+	}
+
+	mailboxID, err := fetchResourceID(c, "mailbox_id", "Invalid mailbox ID")
+	if err != nil {
+		return
+	}
+
+	if err := s.store.AttachMailbox(c.Request.Context(), id, mailboxID); err != nil {
+		abortWithError(c, err, ErrResourceUpdateFailed)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Service) detachMailbox(c *gin.Context) {
+	id, err := fetchResourceID(c, "id", "Invalid sequence ID")
+	if err != nil {
+		return
+	}
+
+	mailboxID, err := fetchResourceID(c, "mailbox_id", "Invalid mailbox ID")
+	if err != nil {
+		return
+	}
+
+	if err := s.store.DetachMailbox(c.Request.Context(), id, mailboxID); err != nil {
+		abortWithError(c, err, ErrResourceDeletionFailed)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
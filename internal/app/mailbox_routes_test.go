@@ -0,0 +1,224 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/model/memory"
+	"github.com/danikarik/salesforge/internal/model/mock"
+	"github.com/stretchr/testify/assert"
+	mocky "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateMailbox(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("CreateMailbox", mocky.Anything, &model.Mailbox{
+			UserID:        1,
+			Email:         "sales@example.com",
+			DailyCapacity: 50,
+			SMTPHost:      "smtp.example.com",
+			SMTPPort:      model.DefaultSMTPPort,
+			SMTPUsername:  "sales",
+			SMTPPassword:  "secret",
+		}).Return(nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/mailboxes", `{"userId": 1, "email": "sales@example.com", "dailyCapacity": 50, "smtpHost": "smtp.example.com", "smtpUsername": "sales", "smtpPassword": "secret"}`)
+		assert.Equal(t, 201, w.Code)
+		assert.Contains(t, w.Body.String(), `"dailyCapacity":50`)
+		assert.Contains(t, w.Body.String(), `"smtpPort":587`)
+		assert.NotContains(t, w.Body.String(), "secret")
+	})
+
+	t.Run("FailedValidation", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/mailboxes", `{"userId": 1, "email": "sales@example.com", "dailyCapacity": -1}`)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"dailyCapacity","message":"must be at least 1"}`)
+	})
+
+	t.Run("InvalidEmail", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/mailboxes", `{"userId": 1, "email": "sales", "dailyCapacity": 50}`)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"invalid_email"`)
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("CreateMailbox", mocky.Anything, mocky.Anything).Return(model.ErrMailboxExists)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/mailboxes", `{"userId": 1, "email": "sales@example.com", "dailyCapacity": 50}`)
+		assert.Equal(t, 409, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"mailbox_exists"`)
+	})
+}
+
+func TestFetchMailbox(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("FetchMailbox", mocky.Anything, uint64(1)).Return(&model.Mailbox{ID: 1, Email: "sales@example.com"}, nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/mailboxes/1", "")
+		assert.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), `"email":"sales@example.com"`)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("FetchMailbox", mocky.Anything, uint64(1)).Return(nil, model.ErrNotFound)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/mailboxes/1", "")
+		assert.Equal(t, 404, w.Code)
+	})
+}
+
+func TestListMailboxes(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("ListMailboxes", mocky.Anything, &model.ListMailboxesParams{Limit: 5, UserID: 1}).
+			Return([]*model.Mailbox{{ID: 1}}, &model.Cursor{ID: 1}, nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/mailboxes?limit=5&userId=1", "")
+		assert.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"nextCursor":"%s"`, (&model.Cursor{ID: 1}).Encode()))
+	})
+
+	t.Run("WithError", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("ListMailboxes", mocky.Anything, mocky.Anything).Return(nil, nil, errors.New("list failed"))
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/mailboxes", "")
+		assert.Equal(t, 500, w.Code)
+	})
+}
+
+func TestPatchMailbox(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		capacity := 80
+
+		store := &mock.MockStore{}
+		store.On("UpdateMailbox", mocky.Anything, uint64(1), &model.MailboxPatch{DailyCapacity: &capacity}).
+			Return(&model.Mailbox{ID: 1, DailyCapacity: capacity}, nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "PATCH", "/mailboxes/1", `{"dailyCapacity": 80}`)
+		assert.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), `"dailyCapacity":80`)
+	})
+
+	t.Run("FailedValidation", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "PATCH", "/mailboxes/1", `{"dailyCapacity": 0}`)
+		assert.Equal(t, 400, w.Code)
+	})
+}
+
+func TestDeleteMailbox(t *testing.T) {
+	store := &mock.MockStore{}
+	store.On("DeleteMailbox", mocky.Anything, uint64(1)).Return(nil)
+
+	service := NewService(Config{Store: store})
+
+	w := performRequest(service.Handler(), "DELETE", "/mailboxes/1", "")
+	assert.Equal(t, 204, w.Code)
+}
+
+func TestAttachMailbox(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("AttachMailbox", mocky.Anything, uint64(1), uint64(2)).Return(nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/mailboxes/2", "")
+		assert.Equal(t, 204, w.Code)
+	})
+
+	t.Run("InvalidID", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/mailboxes/abc", "")
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"mailbox_id"`)
+	})
+
+	t.Run("ArchivedSequence", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("AttachMailbox", mocky.Anything, uint64(1), uint64(2)).Return(model.ErrSequenceArchived)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/mailboxes/2", "")
+		assert.Equal(t, 409, w.Code)
+	})
+}
+
+func TestDetachMailbox(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("DetachMailbox", mocky.Anything, uint64(1), uint64(2)).Return(nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "DELETE", "/sequences/1/mailboxes/2", "")
+		assert.Equal(t, 204, w.Code)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("DetachMailbox", mocky.Anything, uint64(1), uint64(2)).Return(model.ErrNotFound)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "DELETE", "/sequences/1/mailboxes/2", "")
+		assert.Equal(t, 404, w.Code)
+	})
+}
+
+func TestSequenceMailboxes(t *testing.T) {
+	service := NewService(Config{Store: memory.NewStore()})
+
+	w := performRequest(service.Handler(), "POST", "/sequences", `{"name": "Test Sequence", "steps": [{"subject": "Step 1", "content": "Content 1"}]}`)
+	require.Equal(t, 201, w.Code)
+
+	w = performRequest(service.Handler(), "POST", "/mailboxes", `{"userId": 1, "email": "sales@example.com", "dailyCapacity": 50}`)
+	require.Equal(t, 201, w.Code)
+
+	w = performRequest(service.Handler(), "POST", "/sequences/1/mailboxes/1", "")
+	require.Equal(t, 204, w.Code)
+
+	w = performRequest(service.Handler(), "GET", "/sequences/1/mailboxes", "")
+	require.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"email":"sales@example.com"`)
+
+	w = performRequest(service.Handler(), "DELETE", "/sequences/1/mailboxes/1", "")
+	require.Equal(t, 204, w.Code)
+
+	w = performRequest(service.Handler(), "GET", "/sequences/1/mailboxes", "")
+	require.Equal(t, 200, w.Code)
+	assert.Equal(t, `{"mailboxes":[]}`, w.Body.String())
+}
@@ -1,41 +1,42 @@
 package app
 
 import (
+	"context"
 	"errors"
-	"log"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/sender"
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v5"
-)
-
-var (
-	ErrResourceNotFound       = errors.New("resource not found")
-	ErrResourceCreationFailed = errors.New("resource creation failed")
-	ErrResourceFetchingFailed = errors.New("resource fetching failed")
-	ErrResourceUpdateFailed   = errors.New("resource update failed")
-	ErrResourceDeletionFailed = errors.New("resource deletion failed")
 )
 
 type CreateStepRequest struct {
-	Subject string `json:"subject" binding:"required"`
-	Content string `json:"content" binding:"required"`
+	Subject   string `json:"subject" binding:"required"`
+	Content   string `json:"content" binding:"required"`
+	WaitDays  int    `json:"waitDays" binding:"min=0"`
+	WaitHours int    `json:"waitHours" binding:"min=0,max=23"`
 }
 
 type CreateSequenceRequest struct {
 	Name                 string              `json:"name" binding:"required"`
 	OpenTrackingEnabled  bool                `json:"openTrackingEnabled"`
 	ClickTrackingEnabled bool                `json:"clickTrackingEnabled"`
+	StartTime            string              `json:"startTime"`
+	EndTime              string              `json:"endTime"`
+	Timezone             string              `json:"timezone"`
+	Weekdays             []time.Weekday      `json:"weekdays"`
 	Steps                []CreateStepRequest `json:"steps" binding:"required,dive"`
 }
 
 func (s *Service) createSequence(c *gin.Context) {
 	var data CreateSequenceRequest
 	if err := c.ShouldBindJSON(&data); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithBindingError(c, err)
 		return
 	}
 
@@ -43,21 +44,40 @@ func (s *Service) createSequence(c *gin.Context) {
 		Name:                 data.Name,
 		OpenTrackingEnabled:  data.OpenTrackingEnabled,
 		ClickTrackingEnabled: data.ClickTrackingEnabled,
+		StartTime:            data.StartTime,
+		EndTime:              data.EndTime,
+		Timezone:             data.Timezone,
+		Weekdays:             data.Weekdays,
 		Steps:                make([]*model.Step, len(data.Steps)),
 	}
+	sequence.ApplySendingWindowDefaults()
+	if err := sequence.ValidateSendingWindow(); err != nil {
+		abortWithError(c, err, ErrInvalidRequest)
+		return
+	}
 	for i, step := range data.Steps {
 		sequence.Steps[i] = &model.Step{
-			Subject: step.Subject,
-			Content: step.Content,
+			Subject:   step.Subject,
+			Content:   step.Content,
+			WaitDays:  step.WaitDays,
+			WaitHours: step.WaitHours,
 		}
+		if err := sequence.Steps[i].ValidateTemplates(); err != nil {
+			abortWithError(c, nestedFieldError(err, fmt.Sprintf("steps[%d]", i)), ErrInvalidRequest)
+			return
+		}
+	}
+	if len(sequence.Steps) > 0 && sequence.Steps[0].HasDelay() {
+		abortWithError(c, model.ErrFirstStepDelay.WithField("steps[0].waitDays"), ErrInvalidRequest)
+		return
 	}
 
 	if err := s.store.CreateSequence(c.Request.Context(), sequence); err != nil {
-		log.Printf("Failed to create sequence: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrResourceCreationFailed.Error()})
+		abortWithError(c, err, ErrResourceCreationFailed)
 		return
 	}
 
+	setETag(c, sequence.Version)
 	c.JSON(http.StatusCreated, sequence)
 }
 
@@ -69,28 +89,95 @@ func (s *Service) fetchSequence(c *gin.Context) {
 
 	sequence, err := s.store.FetchSequence(c.Request.Context(), id)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			c.JSON(http.StatusNotFound, gin.H{"error": ErrResourceNotFound.Error()})
+		abortWithError(c, err, ErrResourceFetchingFailed)
+		return
+	}
+
+	setETag(c, sequence.Version)
+	c.JSON(http.StatusOK, sequence)
+}
+
+type ListSequencesRequest struct {
+	Cursor               string `form:"cursor"`
+	Limit                uint64 `form:"limit" binding:"omitempty,min=1,max=100"`
+	Name                 string `form:"name"`
+	OpenTrackingEnabled  *bool  `form:"openTrackingEnabled"`
+	ClickTrackingEnabled *bool  `form:"clickTrackingEnabled"`
+	Sort                 string `form:"sort" binding:"omitempty,oneof=id -id createdAt -createdAt"`
+}
+
+type ListSequencesResponse struct {
+	Sequences  []*model.Sequence `json:"sequences"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+func (s *Service) listSequences(c *gin.Context) {
+	var data ListSequencesRequest
+	if err := c.ShouldBindQuery(&data); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	params := &model.ListSequencesParams{
+		Limit:                data.Limit,
+		Name:                 data.Name,
+		OpenTrackingEnabled:  data.OpenTrackingEnabled,
+		ClickTrackingEnabled: data.ClickTrackingEnabled,
+		SortBy:               strings.TrimPrefix(data.Sort, "-"),
+		Descending:           strings.HasPrefix(data.Sort, "-"),
+	}
+	if params.Limit == 0 {
+		params.Limit = model.DefaultPageSize
+	}
+	if params.SortBy == "" {
+		params.SortBy = model.SortByID
+	}
+	if data.Cursor != "" {
+		cursor, err := model.DecodeCursor(data.Cursor)
+		if err != nil {
+			abortWithError(c, err, ErrInvalidRequest)
 			return
 		}
-		log.Printf("Failed to fetch sequence: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrResourceFetchingFailed.Error()})
+		params.After = cursor
+	}
+
+	sequences, next, err := s.store.ListSequences(c.Request.Context(), params)
+	if err != nil {
+		abortWithError(c, err, ErrResourceFetchingFailed)
 		return
 	}
 
-	c.JSON(http.StatusOK, sequence)
+	resp := ListSequencesResponse{Sequences: sequences}
+	if resp.Sequences == nil {
+		resp.Sequences = []*model.Sequence{}
+	}
+	if next != nil {
+		resp.NextCursor = next.Encode()
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
 type UpdateSequenceRequest struct {
-	OpenTrackingEnabled  bool `json:"openTrackingEnabled"`
-	ClickTrackingEnabled bool `json:"clickTrackingEnabled"`
+	OpenTrackingEnabled  bool           `json:"openTrackingEnabled"`
+	ClickTrackingEnabled bool           `json:"clickTrackingEnabled"`
+	StartTime            string         `json:"startTime"`
+	EndTime              string         `json:"endTime"`
+	Timezone             string         `json:"timezone"`
+	Weekdays             []time.Weekday `json:"weekdays"`
 }
 
 type UpdateSequenceResponse struct {
-	ID                   uint64    `json:"id"`
-	OpenTrackingEnabled  bool      `json:"openTrackingEnabled"`
-	ClickTrackingEnabled bool      `json:"clickTrackingEnabled"`
-	UpdatedAt            time.Time `json:"updatedAt"`
+	ID                   uint64         `json:"id"`
+	Name                 string         `json:"name"`
+	OpenTrackingEnabled  bool           `json:"openTrackingEnabled"`
+	ClickTrackingEnabled bool           `json:"clickTrackingEnabled"`
+	StartTime            string         `json:"startTime"`
+	EndTime              string         `json:"endTime"`
+	Timezone             string         `json:"timezone"`
+	Weekdays             []time.Weekday `json:"weekdays"`
+	Version              int            `json:"version"`
+	UpdatedAt            time.Time      `json:"updatedAt"`
 }
 
 func (s *Service) updateSequence(c *gin.Context) {
@@ -99,37 +186,216 @@ func (s *Service) updateSequence(c *gin.Context) {
 		return
 	}
 
+	version, err := fetchIfMatchVersion(c)
+	if err != nil {
+		return
+	}
+
 	var data UpdateSequenceRequest
 	if err := c.ShouldBindJSON(&data); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithBindingError(c, err)
 		return
 	}
 
+	// PUT replaces every setting, so omitted window settings fall back to defaults.
 	sequence := &model.Sequence{
+		StartTime: data.StartTime,
+		EndTime:   data.EndTime,
+		Timezone:  data.Timezone,
+		Weekdays:  data.Weekdays,
+	}
+	sequence.ApplySendingWindowDefaults()
+	if err := sequence.ValidateSendingWindow(); err != nil {
+		abortWithError(c, err, ErrInvalidRequest)
+		return
+	}
+
+	s.saveSequencePatch(c, id, &model.SequencePatch{
+		Version:              version,
+		OpenTrackingEnabled:  &data.OpenTrackingEnabled,
+		ClickTrackingEnabled: &data.ClickTrackingEnabled,
+		StartTime:            &sequence.StartTime,
+		EndTime:              &sequence.EndTime,
+		Timezone:             &sequence.Timezone,
+		Weekdays:             sequence.Weekdays,
+	})
+}
+
+type PatchSequenceRequest struct {
+	Name                 *string        `json:"name" binding:"omitempty,min=1,max=255"`
+	OpenTrackingEnabled  *bool          `json:"openTrackingEnabled"`
+	ClickTrackingEnabled *bool          `json:"clickTrackingEnabled"`
+	StartTime            *string        `json:"startTime"`
+	EndTime              *string        `json:"endTime"`
+	Timezone             *string        `json:"timezone"`
+	Weekdays             []time.Weekday `json:"weekdays"`
+}
+
+func (s *Service) patchSequence(c *gin.Context) {
+	id, err := fetchResourceID(c, "id", "Invalid sequence ID")
+	if err != nil {
+		return
+	}
+
+	version, err := fetchIfMatchVersion(c)
+	if err != nil {
+		return
+	}
+
+	var data PatchSequenceRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	s.saveSequencePatch(c, id, &model.SequencePatch{
+		Version:              version,
+		Name:                 data.Name,
 		OpenTrackingEnabled:  data.OpenTrackingEnabled,
 		ClickTrackingEnabled: data.ClickTrackingEnabled,
-	}
-	if err := s.store.UpdateSequence(c.Request.Context(), id, sequence); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			c.JSON(http.StatusNotFound, gin.H{"error": ErrResourceNotFound.Error()})
-			return
-		}
-		log.Printf("Failed to update sequence: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrResourceUpdateFailed.Error()})
+		StartTime:            data.StartTime,
+		EndTime:              data.EndTime,
+		Timezone:             data.Timezone,
+		Weekdays:             data.Weekdays,
+	})
+}
+
+func (s *Service) saveSequencePatch(c *gin.Context, id uint64, patch *model.SequencePatch) {
+	sequence, err := s.store.UpdateSequence(c.Request.Context(), id, patch)
+	if err != nil {
+		abortWithError(c, err, ErrResourceUpdateFailed)
 		return
 	}
 
+	setETag(c, sequence.Version)
 	c.JSON(http.StatusOK, UpdateSequenceResponse{
 		ID:                   sequence.ID,
+		Name:                 sequence.Name,
 		OpenTrackingEnabled:  sequence.OpenTrackingEnabled,
 		ClickTrackingEnabled: sequence.ClickTrackingEnabled,
+		StartTime:            sequence.StartTime,
+		EndTime:              sequence.EndTime,
+		Timezone:             sequence.Timezone,
+		Weekdays:             sequence.Weekdays,
+		Version:              sequence.Version,
 		UpdatedAt:            sequence.UpdatedAt,
 	})
 }
 
+type DeleteSequenceRequest struct {
+	Archive bool `form:"archive"`
+}
+
+func (s *Service) deleteSequence(c *gin.Context) {
+	id, err := fetchResourceID(c, "id", "Invalid sequence ID")
+	if err != nil {
+		return
+	}
+
+	version, err := fetchIfMatchVersion(c)
+	if err != nil {
+		return
+	}
+
+	var data DeleteSequenceRequest
+	if err := c.ShouldBindQuery(&data); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	if data.Archive {
+		err = s.store.ArchiveSequence(c.Request.Context(), id, version)
+	} else {
+		err = s.store.DeleteSequence(c.Request.Context(), id, version)
+	}
+	if err != nil {
+		abortWithError(c, err, ErrResourceDeletionFailed)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type AddStepRequest struct {
+	Subject   string `json:"subject" binding:"required"`
+	Content   string `json:"content" binding:"required"`
+	Position  int    `json:"position" binding:"omitempty,min=1"`
+	WaitDays  int    `json:"waitDays" binding:"min=0"`
+	WaitHours int    `json:"waitHours" binding:"min=0,max=23"`
+}
+
+func (s *Service) createStep(c *gin.Context) {
+	sequenceID, err := fetchResourceID(c, "id", "Invalid sequence ID")
+	if err != nil {
+		return
+	}
+
+	var data AddStepRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	step := &model.Step{
+		SequenceID: sequenceID,
+		Position:   data.Position,
+		Subject:    data.Subject,
+		Content:    data.Content,
+		WaitDays:   data.WaitDays,
+		WaitHours:  data.WaitHours,
+	}
+	if err := step.ValidateTemplates(); err != nil {
+		abortWithError(c, err, ErrInvalidRequest)
+		return
+	}
+	if err := s.store.CreateStep(c.Request.Context(), step); err != nil {
+		abortWithError(c, err, ErrResourceCreationFailed)
+		return
+	}
+
+	c.JSON(http.StatusCreated, step)
+}
+
+type ReorderStepsRequest struct {
+	StepIDs []uint64 `json:"stepIds" binding:"required,min=1"`
+}
+
+type ReorderStepsResponse struct {
+	Steps []*model.Step `json:"steps"`
+}
+
+func (s *Service) reorderSteps(c *gin.Context) {
+	sequenceID, err := fetchResourceID(c, "id", "Invalid sequence ID")
+	if err != nil {
+		return
+	}
+
+	version, err := fetchIfMatchVersion(c)
+	if err != nil {
+		return
+	}
+
+	var data ReorderStepsRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+
+	sequence, err := s.store.ReorderSteps(c.Request.Context(), sequenceID, version, data.StepIDs)
+	if err != nil {
+		abortWithError(c, err, ErrResourceUpdateFailed)
+		return
+	}
+
+	setETag(c, sequence.Version)
+	c.JSON(http.StatusOK, ReorderStepsResponse{Steps: sequence.Steps})
+}
+
 type UpdateStepRequest struct {
-	Subject string `json:"subject" binding:"required"`
-	Content string `json:"content" binding:"required"`
+	Subject   string `json:"subject" binding:"required"`
+	Content   string `json:"content" binding:"required"`
+	WaitDays  int    `json:"waitDays" binding:"min=0"`
+	WaitHours int    `json:"waitHours" binding:"min=0,max=23"`
 }
 
 func (s *Service) updateStep(c *gin.Context) {
@@ -142,9 +408,14 @@ func (s *Service) updateStep(c *gin.Context) {
 		return
 	}
 
+	version, err := fetchIfMatchVersion(c)
+	if err != nil {
+		return
+	}
+
 	var data UpdateStepRequest
 	if err := c.ShouldBindJSON(&data); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithBindingError(c, err)
 		return
 	}
 
@@ -152,17 +423,20 @@ func (s *Service) updateStep(c *gin.Context) {
 		SequenceID: sequenceID,
 		Subject:    data.Subject,
 		Content:    data.Content,
+		WaitDays:   data.WaitDays,
+		WaitHours:  data.WaitHours,
+		Version:    version,
+	}
+	if err := step.ValidateTemplates(); err != nil {
+		abortWithError(c, err, ErrInvalidRequest)
+		return
 	}
 	if err := s.store.UpdateStep(c.Request.Context(), id, step); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			c.JSON(http.StatusNotFound, gin.H{"error": ErrResourceNotFound.Error()})
-			return
-		}
-		log.Printf("Failed to update step: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrResourceUpdateFailed.Error()})
+		abortWithError(c, err, ErrResourceUpdateFailed)
 		return
 	}
 
+	setETag(c, step.Version)
 	c.JSON(http.StatusOK, step)
 }
 
@@ -176,25 +450,227 @@ func (s *Service) deleteStep(c *gin.Context) {
 		return
 	}
 
-	step := &model.Step{SequenceID: sequenceID}
+	version, err := fetchIfMatchVersion(c)
+	if err != nil {
+		return
+	}
+
+	step := &model.Step{SequenceID: sequenceID, Version: version}
 	if err := s.store.DeleteStep(c.Request.Context(), id, step); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			c.JSON(http.StatusNotFound, gin.H{"error": ErrResourceNotFound.Error()})
+		abortWithError(c, err, ErrResourceDeletionFailed)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type PreviewContactRequest struct {
+	Email        string            `json:"email" binding:"max=320"`
+	FirstName    string            `json:"firstName" binding:"max=255"`
+	LastName     string            `json:"lastName" binding:"max=255"`
+	Company      string            `json:"company" binding:"max=255"`
+	CustomFields map[string]string `json:"customFields"`
+}
+
+// previewSender is the sender shown in previews of sequences without
+// mailboxes.
+const previewSender = "mailbox@example.com"
+
+type PreviewStepRequest struct {
+	// Stored contact to render the step for. Contact is used when zero.
+	ContactID uint64                 `json:"contactId"`
+	Contact   *PreviewContactRequest `json:"contact"`
+	// Mailbox the preview is sent from. Defaults to the first mailbox of the
+	// sequence, which only test sends require.
+	MailboxID uint64 `json:"mailboxId"`
+	// Address to send the preview to through the configured sender, if any.
+	TestSendTo string `json:"testSendTo"`
+	// Enrollment whose spintax variant is rendered.
+	EnrollmentID uint64 `json:"enrollmentId"`
+}
+
+type PreviewStepResponse struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+	// The whole message in RFC 5322 format.
+	MIME string `json:"mime"`
+	// Number of spintax variants of the step.
+	Permutations uint64 `json:"permutations"`
+	TestSentTo   string `json:"testSentTo,omitempty"`
+}
+
+func (s *Service) previewStep(c *gin.Context) {
+	sequenceID, err := fetchResourceID(c, "id", "Invalid sequence ID")
+	if err != nil {
+		return
+	}
+	id, err := fetchResourceID(c, "step_id", "Invalid step ID")
+	if err != nil {
+		return
+	}
+
+	var data PreviewStepRequest
+	if err := c.ShouldBindJSON(&data); err != nil {
+		abortWithBindingError(c, err)
+		return
+	}
+	if data.ContactID == 0 && data.Contact == nil {
+		abortWithError(c, &model.Error{
+			Kind:    model.ErrValidation,
+			Code:    CodeValidationFailed,
+			Field:   "contactId",
+			Message: "contactId or contact is required",
+		}, ErrInvalidRequest)
+		return
+	}
+	if data.TestSendTo != "" {
+		if err := model.ValidateEmail(data.TestSendTo); err != nil {
+			abortWithError(c, model.ErrInvalidEmail.WithField("testSendTo"), ErrInvalidRequest)
 			return
 		}
-		log.Printf("Failed to delete step: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrResourceDeletionFailed.Error()})
+	}
+
+	ctx := c.Request.Context()
+	sequence, err := s.store.FetchSequence(ctx, sequenceID)
+	if err != nil {
+		abortWithError(c, err, ErrResourceFetchingFailed)
 		return
 	}
+	i := slices.IndexFunc(sequence.Steps, func(step *model.Step) bool { return step.ID == id })
+	if i < 0 {
+		abortWithError(c, model.ErrNotFound, ErrResourceFetchingFailed)
+		return
+	}
+	step := sequence.Steps[i]
 
-	c.Status(http.StatusNoContent)
+	contact, err := s.previewContact(ctx, &data)
+	if err != nil {
+		abortWithError(c, err, ErrResourceFetchingFailed)
+		return
+	}
+	mailbox, err := s.previewMailbox(ctx, sequenceID, data.MailboxID)
+	if errors.Is(err, model.ErrNoMailbox) && data.TestSendTo == "" {
+		// Only test emails need a mailbox to be sent from.
+		mailbox, err = &model.Mailbox{Email: previewSender}, nil
+	}
+	if err != nil {
+		abortWithError(c, err, ErrResourceFetchingFailed)
+		return
+	}
+
+	delivery := &model.Delivery{
+		Email:    &model.ScheduledEmail{SequenceID: sequenceID, EnrollmentID: data.EnrollmentID, StepID: &step.ID},
+		Mailbox:  mailbox,
+		Contact:  contact,
+		Step:     step,
+		Sequence: sequence,
+	}
+	// Steps saved before templates were supported may not parse, which is
+	// reported here although they are sent as literal text.
+	permutations, err := step.Permutations()
+	if err != nil {
+		abortWithError(c, err, ErrInvalidRequest)
+		return
+	}
+	message := sender.NewMessage(delivery, time.Now(), s.tracking)
+	resp := PreviewStepResponse{
+		Subject:      message.Subject,
+		Text:         message.Text,
+		HTML:         message.HTML,
+		MIME:         string(message.Bytes()),
+		Permutations: permutations,
+	}
+
+	if data.TestSendTo != "" {
+		// The test email is rendered for the same contact at another address.
+		// It is not a scheduled email, so it has no ID to track opens and
+		// clicks with.
+		recipient := *contact
+		recipient.Email = data.TestSendTo
+		delivery.Contact = &recipient
+		untracked := *sequence
+		untracked.OpenTrackingEnabled, untracked.ClickTrackingEnabled = false, false
+		delivery.Sequence = &untracked
+		if err := s.sender.Send(ctx, delivery); err != nil {
+			abortWithError(c, err, ErrTestSendFailed)
+			return
+		}
+		resp.TestSentTo = data.TestSendTo
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// previewContact returns the stored contact of the request or the one it
+// supplies.
+func (s *Service) previewContact(ctx context.Context, data *PreviewStepRequest) (*model.Contact, error) {
+	if data.ContactID == 0 {
+		contact := &model.Contact{
+			Email:        data.Contact.Email,
+			FirstName:    data.Contact.FirstName,
+			LastName:     data.Contact.LastName,
+			Company:      data.Contact.Company,
+			CustomFields: data.Contact.CustomFields,
+		}
+		contact.Normalize()
+		return contact, nil
+	}
+
+	contact, err := s.store.FetchContact(ctx, data.ContactID)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, model.ErrUnknownContact.WithField("contactId")
+	}
+	return contact, err
+}
+
+// previewMailbox returns the requested mailbox or the first mailbox of the
+// sequence.
+func (s *Service) previewMailbox(ctx context.Context, sequenceID, mailboxID uint64) (*model.Mailbox, error) {
+	if mailboxID != 0 {
+		return s.store.FetchMailbox(ctx, mailboxID)
+	}
+
+	mailboxes, err := s.store.ListSequenceMailboxes(ctx, sequenceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(mailboxes) == 0 {
+		return nil, model.ErrNoMailbox
+	}
+	return mailboxes[0], nil
+}
+
+// fetchIfMatchVersion reads the expected resource version from the If-Match
+// header. A missing header or "*" yields zero, which skips the version check.
+func fetchIfMatchVersion(c *gin.Context) (int, error) {
+	raw := strings.TrimSpace(c.GetHeader("If-Match"))
+	if raw == "" || raw == "*" {
+		return 0, nil
+	}
+
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(raw, "W/"), `"`))
+	if err != nil || version < 1 {
+		abortWithError(c, model.ErrVersionMismatch, ErrInvalidRequest)
+		return 0, model.ErrVersionMismatch
+	}
+	return version, nil
+}
+
+func setETag(c *gin.Context, version int) {
+	c.Header("ETag", strconv.Quote(strconv.Itoa(version)))
 }
 
 func fetchResourceID(c *gin.Context, param, errorMessage string) (uint64, error) {
 	raw := c.Param(param)
 	id, err := strconv.ParseUint(raw, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": errorMessage})
+		abortWithError(c, &model.Error{
+			Kind:    model.ErrValidation,
+			Code:    "invalid_parameter",
+			Field:   param,
+			Message: errorMessage,
+		}, ErrInvalidRequest)
 		return 0, err
 	}
 	return uint64(id), nil
@@ -1,23 +1,34 @@
 package app
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/model/memory"
 	"github.com/danikarik/salesforge/internal/model/mock"
-	"github.com/jackc/pgx/v5"
+	"github.com/danikarik/salesforge/internal/sender"
 	"github.com/stretchr/testify/assert"
 	mocky "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func performRequest(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	return performRequestWithHeaders(handler, method, path, body, nil)
+}
+
+func performRequestWithHeaders(handler http.Handler, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
 	req, _ := http.NewRequest(method, path, strings.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
 	w := httptest.NewRecorder()
 	handler.ServeHTTP(w, req)
 	return w
@@ -30,9 +41,13 @@ func TestCreateSequence(t *testing.T) {
 			Name:                 "Test Sequence",
 			OpenTrackingEnabled:  true,
 			ClickTrackingEnabled: false,
+			StartTime:            model.DefaultStartTime,
+			EndTime:              model.DefaultEndTime,
+			Timezone:             model.DefaultTimezone,
+			Weekdays:             model.DefaultWeekdays(),
 			Steps: []*model.Step{
 				{Subject: "Step 1", Content: "Content 1"},
-				{Subject: "Step 2", Content: "Content 2"},
+				{Subject: "Step 2", Content: "Content 2", WaitDays: 2, WaitHours: 4},
 			},
 		}).Return(nil)
 
@@ -44,7 +59,7 @@ func TestCreateSequence(t *testing.T) {
 			"clickTrackingEnabled": false,
 			"steps": [
 				{"subject": "Step 1", "content": "Content 1"},
-				{"subject": "Step 2", "content": "Content 2"}
+				{"subject": "Step 2", "content": "Content 2", "waitDays": 2, "waitHours": 4}
 			]
 		}`
 
@@ -64,6 +79,105 @@ func TestCreateSequence(t *testing.T) {
 
 		w := performRequest(service.Handler(), "POST", "/sequences", req)
 		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"validation_failed"`)
+		assert.Contains(t, w.Body.String(), `{"field":"steps","message":"is required"}`)
+	})
+
+	t.Run("InvalidTimezone", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"name": "Test Sequence",
+			"timezone": "Mars/Olympus_Mons",
+			"steps": [
+				{"subject": "Step 1", "content": "Content 1"}
+			]
+		}`
+
+		w := performRequest(service.Handler(), "POST", "/sequences", req)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, model.ErrInvalidTimezone.Error()))
+		assert.Contains(t, w.Body.String(), `"code":"invalid_timezone"`)
+		assert.Contains(t, w.Body.String(), `"field":"timezone"`)
+	})
+
+	t.Run("InvalidWeekdays", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"name": "Test Sequence",
+			"weekdays": [1, 1, 7],
+			"steps": [
+				{"subject": "Step 1", "content": "Content 1"}
+			]
+		}`
+
+		w := performRequest(service.Handler(), "POST", "/sequences", req)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, model.ErrInvalidWeekdays.Error()))
+	})
+
+	t.Run("FirstStepDelay", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"name": "Test Sequence",
+			"steps": [
+				{"subject": "Step 1", "content": "Content 1", "waitDays": 1},
+				{"subject": "Step 2", "content": "Content 2", "waitDays": 2}
+			]
+		}`
+
+		w := performRequest(service.Handler(), "POST", "/sequences", req)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, model.ErrFirstStepDelay.Error()))
+	})
+
+	t.Run("NegativeDelay", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"name": "Test Sequence",
+			"steps": [
+				{"subject": "Step 1", "content": "Content 1"},
+				{"subject": "Step 2", "content": "Content 2", "waitDays": -2}
+			]
+		}`
+
+		w := performRequest(service.Handler(), "POST", "/sequences", req)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"steps[1].waitDays","message":"must be at least 0"}`)
+	})
+
+	t.Run("InvalidTemplate", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"name": "Test Sequence",
+			"steps": [
+				{"subject": "Hi {{first_name}}", "content": "Content 1"},
+				{"subject": "Step 2", "content": "Hello {{ frist_name }}", "waitDays": 2}
+			]
+		}`
+
+		w := performRequest(service.Handler(), "POST", "/sequences", req)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"unknown_variable"`)
+		assert.Contains(t, w.Body.String(), `{"field":"steps[1].content","message":"unknown variable \"frist_name\" at line 1, column 10"}`)
+	})
+
+	t.Run("MalformedJSON", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "POST", "/sequences", `{"name": `)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"invalid_request"`)
 	})
 
 	t.Run("WithError", func(t *testing.T) {
@@ -72,6 +186,10 @@ func TestCreateSequence(t *testing.T) {
 			Name:                 "Test Sequence",
 			OpenTrackingEnabled:  true,
 			ClickTrackingEnabled: false,
+			StartTime:            model.DefaultStartTime,
+			EndTime:              model.DefaultEndTime,
+			Timezone:             model.DefaultTimezone,
+			Weekdays:             model.DefaultWeekdays(),
 			Steps: []*model.Step{
 				{Subject: "Step 1", Content: "Content 1"},
 				{Subject: "Step 2", Content: "Content 2"},
@@ -93,6 +211,7 @@ func TestCreateSequence(t *testing.T) {
 		w := performRequest(service.Handler(), "POST", "/sequences", req)
 		assert.Equal(t, 500, w.Code)
 		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceCreationFailed.Error()))
+		assert.Contains(t, w.Body.String(), `"code":"internal_error"`)
 	})
 }
 
@@ -104,6 +223,7 @@ func TestFetchSequence(t *testing.T) {
 			Name:                 "Test Sequence",
 			OpenTrackingEnabled:  true,
 			ClickTrackingEnabled: false,
+			Version:              3,
 			Steps: []*model.Step{
 				{ID: 1, Subject: "Step 1", Content: "Content 1"},
 				{ID: 2, Subject: "Step 2", Content: "Content 2"},
@@ -114,18 +234,29 @@ func TestFetchSequence(t *testing.T) {
 
 		w := performRequest(service.Handler(), "GET", "/sequences/1", "")
 		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, `"3"`, w.Header().Get("ETag"))
 		assert.Contains(t, w.Body.String(), `"name":"Test Sequence"`)
 	})
 
 	t.Run("NotFound", func(t *testing.T) {
 		store := &mock.MockStore{}
-		store.On("FetchSequence", mocky.Anything, uint64(1)).Return(nil, pgx.ErrNoRows)
+		store.On("FetchSequence", mocky.Anything, uint64(1)).Return(nil, model.ErrNotFound)
 
 		service := NewService(Config{Store: store})
 
 		w := performRequest(service.Handler(), "GET", "/sequences/1", "")
 		assert.Equal(t, 404, w.Code)
 		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceNotFound.Error()))
+		assert.Contains(t, w.Body.String(), `"code":"not_found"`)
+	})
+
+	t.Run("InvalidID", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/sequences/abc", "")
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"id"`)
 	})
 
 	t.Run("WithError", func(t *testing.T) {
@@ -140,28 +271,126 @@ func TestFetchSequence(t *testing.T) {
 	})
 }
 
+func TestListSequences(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("ListSequences", mocky.Anything, &model.ListSequencesParams{
+			Limit:  20,
+			SortBy: model.SortByID,
+		}).Return([]*model.Sequence{
+			{ID: 1, Name: "Test Sequence"},
+		}, nil, nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/sequences", "")
+		assert.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), `"name":"Test Sequence"`)
+		assert.NotContains(t, w.Body.String(), `"nextCursor"`)
+	})
+
+	t.Run("WithFilters", func(t *testing.T) {
+		openTracking := true
+		cursor := &model.Cursor{ID: 5}
+
+		store := &mock.MockStore{}
+		store.On("ListSequences", mocky.Anything, &model.ListSequencesParams{
+			After:               cursor,
+			Limit:               2,
+			Name:                "test",
+			OpenTrackingEnabled: &openTracking,
+			SortBy:              model.SortByCreatedAt,
+			Descending:          true,
+		}).Return([]*model.Sequence{
+			{ID: 4, Name: "Test Sequence 4"},
+			{ID: 3, Name: "Test Sequence 3"},
+		}, &model.Cursor{ID: 3}, nil)
+
+		service := NewService(Config{Store: store})
+
+		path := "/sequences?limit=2&name=test&openTrackingEnabled=true&sort=-createdAt&cursor=" + cursor.Encode()
+		w := performRequest(service.Handler(), "GET", path, "")
+		assert.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"nextCursor":"%s"`, (&model.Cursor{ID: 3}).Encode()))
+	})
+
+	t.Run("InvalidCursor", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/sequences?cursor=invalid", "")
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, model.ErrInvalidCursor.Error()))
+	})
+
+	t.Run("FailedValidation", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/sequences?sort=name", "")
+		assert.Equal(t, 400, w.Code)
+	})
+
+	t.Run("WithError", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("ListSequences", mocky.Anything, mocky.Anything).Return(nil, nil, errors.New("list failed"))
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "GET", "/sequences", "")
+		assert.Equal(t, 500, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceFetchingFailed.Error()))
+	})
+}
+
 func TestUpdateSequence(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
+		openTracking, clickTracking := true, false
+		startTime, endTime, timezone := "08:30", "18:00", "Europe/Berlin"
+
 		store := &mock.MockStore{}
-		store.On("UpdateSequence", mocky.Anything, uint64(1), &model.Sequence{
-			OpenTrackingEnabled:  true,
-			ClickTrackingEnabled: false,
-		}).Return(nil)
+		store.On("UpdateSequence", mocky.Anything, uint64(1), &model.SequencePatch{
+			OpenTrackingEnabled:  &openTracking,
+			ClickTrackingEnabled: &clickTracking,
+			StartTime:            &startTime,
+			EndTime:              &endTime,
+			Timezone:             &timezone,
+			Weekdays:             []time.Weekday{time.Monday, time.Wednesday},
+		}).Return(&model.Sequence{ID: 1, Name: "Test Sequence"}, nil)
 
 		service := NewService(Config{Store: store})
 
 		req := `{
 			"openTrackingEnabled": true,
-			"clickTrackingEnabled": false
+			"clickTrackingEnabled": false,
+			"startTime": "08:30",
+			"endTime": "18:00",
+			"timezone": "Europe/Berlin",
+			"weekdays": [1, 3]
 		}`
 
 		w := performRequest(service.Handler(), "PUT", "/sequences/1", req)
 		assert.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), `"name":"Test Sequence"`)
+	})
+
+	t.Run("InvalidSendingWindow", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"startTime": "17:00",
+			"endTime": "09:00"
+		}`
+
+		w := performRequest(service.Handler(), "PUT", "/sequences/1", req)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, model.ErrInvalidSendingWindow.Error()))
 	})
 
 	t.Run("NotFound", func(t *testing.T) {
 		store := &mock.MockStore{}
-		store.On("UpdateSequence", mocky.Anything, uint64(1), mocky.Anything).Return(pgx.ErrNoRows)
+		store.On("UpdateSequence", mocky.Anything, uint64(1), mocky.Anything).Return(nil, model.ErrNotFound)
 
 		service := NewService(Config{Store: store})
 
@@ -177,7 +406,7 @@ func TestUpdateSequence(t *testing.T) {
 
 	t.Run("WithError", func(t *testing.T) {
 		store := &mock.MockStore{}
-		store.On("UpdateSequence", mocky.Anything, uint64(1), mocky.Anything).Return(errors.New("update failed"))
+		store.On("UpdateSequence", mocky.Anything, uint64(1), mocky.Anything).Return(nil, errors.New("update failed"))
 
 		service := NewService(Config{Store: store})
 
@@ -190,6 +419,299 @@ func TestUpdateSequence(t *testing.T) {
 		assert.Equal(t, 500, w.Code)
 		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceUpdateFailed.Error()))
 	})
+
+	t.Run("Archived", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("UpdateSequence", mocky.Anything, uint64(1), mocky.Anything).Return(nil, model.ErrSequenceArchived)
+
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"openTrackingEnabled": true,
+			"clickTrackingEnabled": false
+		}`
+
+		w := performRequest(service.Handler(), "PUT", "/sequences/1", req)
+		assert.Equal(t, 409, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, model.ErrSequenceArchived.Error()))
+	})
+}
+
+func TestPatchSequence(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		name, clickTracking := "Renamed Sequence", true
+
+		store := &mock.MockStore{}
+		store.On("UpdateSequence", mocky.Anything, uint64(1), &model.SequencePatch{
+			Name:                 &name,
+			ClickTrackingEnabled: &clickTracking,
+		}).Return(&model.Sequence{
+			ID:                   1,
+			Name:                 name,
+			OpenTrackingEnabled:  true,
+			ClickTrackingEnabled: true,
+		}, nil)
+
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"name": "Renamed Sequence",
+			"clickTrackingEnabled": true
+		}`
+
+		w := performRequest(service.Handler(), "PATCH", "/sequences/1", req)
+		assert.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), `"name":"Renamed Sequence"`)
+		assert.Contains(t, w.Body.String(), `"openTrackingEnabled":true`)
+	})
+
+	t.Run("FailedValidation", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "PATCH", "/sequences/1", `{"name": ""}`)
+		assert.Equal(t, 400, w.Code)
+	})
+
+	t.Run("InvalidSendingWindow", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("UpdateSequence", mocky.Anything, uint64(1), mocky.Anything).Return(nil, model.ErrInvalidSendingWindow)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "PATCH", "/sequences/1", `{"endTime": "08:00"}`)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, model.ErrInvalidSendingWindow.Error()))
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("UpdateSequence", mocky.Anything, uint64(1), mocky.Anything).Return(nil, model.ErrNotFound)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "PATCH", "/sequences/1", `{"openTrackingEnabled": false}`)
+		assert.Equal(t, 404, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceNotFound.Error()))
+	})
+}
+
+func TestDeleteSequence(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("DeleteSequence", mocky.Anything, uint64(1), 0).Return(nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "DELETE", "/sequences/1", "")
+		assert.Equal(t, 204, w.Code)
+		store.AssertNotCalled(t, "ArchiveSequence", mocky.Anything, mocky.Anything, mocky.Anything)
+	})
+
+	t.Run("Archive", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("ArchiveSequence", mocky.Anything, uint64(1), 0).Return(nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "DELETE", "/sequences/1?archive=true", "")
+		assert.Equal(t, 204, w.Code)
+		store.AssertNotCalled(t, "DeleteSequence", mocky.Anything, mocky.Anything, mocky.Anything)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("DeleteSequence", mocky.Anything, uint64(1), 0).Return(model.ErrNotFound)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "DELETE", "/sequences/1", "")
+		assert.Equal(t, 404, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceNotFound.Error()))
+	})
+
+	t.Run("WithError", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("ArchiveSequence", mocky.Anything, uint64(1), 0).Return(errors.New("archive failed"))
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "DELETE", "/sequences/1?archive=true", "")
+		assert.Equal(t, 500, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceDeletionFailed.Error()))
+	})
+
+	t.Run("IfMatch", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("DeleteSequence", mocky.Anything, uint64(1), 2).Return(nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequestWithHeaders(service.Handler(), "DELETE", "/sequences/1", "", map[string]string{"If-Match": `"2"`})
+		assert.Equal(t, 204, w.Code)
+	})
+
+	t.Run("PreconditionFailed", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("DeleteSequence", mocky.Anything, uint64(1), 2).Return(model.ErrVersionMismatch)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequestWithHeaders(service.Handler(), "DELETE", "/sequences/1", "", map[string]string{"If-Match": `W/"2"`})
+		assert.Equal(t, 412, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, model.ErrVersionMismatch.Error()))
+	})
+
+	t.Run("MalformedIfMatch", func(t *testing.T) {
+		store := &mock.MockStore{}
+
+		service := NewService(Config{Store: store})
+
+		w := performRequestWithHeaders(service.Handler(), "DELETE", "/sequences/1", "", map[string]string{"If-Match": `"abc"`})
+		assert.Equal(t, 412, w.Code)
+		store.AssertNotCalled(t, "DeleteSequence", mocky.Anything, mocky.Anything, mocky.Anything)
+	})
+}
+
+func TestCreateStep(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("CreateStep", mocky.Anything, &model.Step{
+			SequenceID: 1,
+			Position:   2,
+			Subject:    "New Step",
+			Content:    "New Content",
+		}).Return(nil)
+
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"subject": "New Step",
+			"content": "New Content",
+			"position": 2
+		}`
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/steps", req)
+		assert.Equal(t, 201, w.Code)
+	})
+
+	t.Run("FailedValidation", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"subject": "New Step",
+			"content": "New Content",
+			"position": -1
+		}`
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/steps", req)
+		assert.Equal(t, 400, w.Code)
+	})
+
+	t.Run("InvalidSpintax", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"subject": "{Hi|Hello {{first_name}}",
+			"content": "New Content"
+		}`
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/steps", req)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"subject","message":"unclosed spintax group, expected } at line 1, column 1"}`)
+		store.AssertNotCalled(t, "CreateStep", mocky.Anything, mocky.Anything)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("CreateStep", mocky.Anything, mocky.Anything).Return(model.ErrNotFound)
+
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"subject": "New Step",
+			"content": "New Content"
+		}`
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/steps", req)
+		assert.Equal(t, 404, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceNotFound.Error()))
+	})
+
+	t.Run("WithError", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("CreateStep", mocky.Anything, mocky.Anything).Return(errors.New("creation failed"))
+
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"subject": "New Step",
+			"content": "New Content"
+		}`
+
+		w := performRequest(service.Handler(), "POST", "/sequences/1/steps", req)
+		assert.Equal(t, 500, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceCreationFailed.Error()))
+	})
+}
+
+func TestReorderSteps(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("ReorderSteps", mocky.Anything, uint64(1), 3, []uint64{2, 1}).Return(&model.Sequence{ID: 1, Version: 4, Steps: []*model.Step{
+			{ID: 2, Position: 1, Subject: "Step 2", Content: "Content 2"},
+			{ID: 1, Position: 2, Subject: "Step 1", Content: "Content 1"},
+		}}, nil)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequestWithHeaders(service.Handler(), "PUT", "/sequences/1/steps/order", `{"stepIds": [2, 1]}`, map[string]string{"If-Match": `"3"`})
+		assert.Equal(t, 200, w.Code)
+		assert.Contains(t, w.Body.String(), `"position":2`)
+		assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+	})
+
+	t.Run("VersionMismatch", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("ReorderSteps", mocky.Anything, uint64(1), 3, mocky.Anything).Return(nil, model.ErrVersionMismatch)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequestWithHeaders(service.Handler(), "PUT", "/sequences/1/steps/order", `{"stepIds": [2, 1]}`, map[string]string{"If-Match": `"3"`})
+		assert.Equal(t, 412, w.Code)
+	})
+
+	t.Run("InvalidOrder", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("ReorderSteps", mocky.Anything, uint64(1), 0, mocky.Anything).Return(nil, model.ErrInvalidStepOrder)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "PUT", "/sequences/1/steps/order", `{"stepIds": [2]}`)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, model.ErrInvalidStepOrder.Error()))
+	})
+
+	t.Run("FailedValidation", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "PUT", "/sequences/1/steps/order", `{"stepIds": []}`)
+		assert.Equal(t, 400, w.Code)
+	})
+
+	t.Run("WithError", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("ReorderSteps", mocky.Anything, uint64(1), 0, mocky.Anything).Return(nil, errors.New("reorder failed"))
+
+		service := NewService(Config{Store: store})
+
+		w := performRequest(service.Handler(), "PUT", "/sequences/1/steps/order", `{"stepIds": [2, 1]}`)
+		assert.Equal(t, 500, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceUpdateFailed.Error()))
+	})
 }
 
 func TestUpdateStep(t *testing.T) {
@@ -214,7 +736,7 @@ func TestUpdateStep(t *testing.T) {
 
 	t.Run("NotFound", func(t *testing.T) {
 		store := &mock.MockStore{}
-		store.On("UpdateStep", mocky.Anything, uint64(1), mocky.Anything).Return(pgx.ErrNoRows)
+		store.On("UpdateStep", mocky.Anything, uint64(1), mocky.Anything).Return(model.ErrNotFound)
 
 		service := NewService(Config{Store: store})
 
@@ -243,6 +765,97 @@ func TestUpdateStep(t *testing.T) {
 		assert.Equal(t, 500, w.Code)
 		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceUpdateFailed.Error()))
 	})
+
+	t.Run("InvalidTemplate", func(t *testing.T) {
+		store := &mock.MockStore{}
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"subject": "Hi {{first_name | default:there}}",
+			"content": "Updated Content"
+		}`
+
+		w := performRequest(service.Handler(), "PUT", "/sequences/1/steps/1", req)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `{"field":"subject","message":"expected a quoted string at line 1, column 27"}`)
+	})
+
+	t.Run("FirstStepDelay", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("UpdateStep", mocky.Anything, uint64(1), &model.Step{
+			SequenceID: 1,
+			Subject:    "Updated Step",
+			Content:    "Updated Content",
+			WaitDays:   3,
+		}).Return(model.ErrFirstStepDelay)
+
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"subject": "Updated Step",
+			"content": "Updated Content",
+			"waitDays": 3
+		}`
+
+		w := performRequest(service.Handler(), "PUT", "/sequences/1/steps/1", req)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, model.ErrFirstStepDelay.Error()))
+	})
+
+	t.Run("Archived", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("UpdateStep", mocky.Anything, uint64(1), mocky.Anything).Return(model.ErrSequenceArchived)
+
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"subject": "Updated Step",
+			"content": "Updated Content"
+		}`
+
+		w := performRequest(service.Handler(), "PUT", "/sequences/1/steps/1", req)
+		assert.Equal(t, 409, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, model.ErrSequenceArchived.Error()))
+	})
+
+	t.Run("IfMatch", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("UpdateStep", mocky.Anything, uint64(1), &model.Step{
+			SequenceID: 1,
+			Subject:    "Updated Step",
+			Content:    "Updated Content",
+			Version:    4,
+		}).Run(func(args mocky.Arguments) {
+			args.Get(2).(*model.Step).Version = 5
+		}).Return(nil)
+
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"subject": "Updated Step",
+			"content": "Updated Content"
+		}`
+
+		w := performRequestWithHeaders(service.Handler(), "PUT", "/sequences/1/steps/1", req, map[string]string{"If-Match": `"4"`})
+		assert.Equal(t, 200, w.Code)
+		assert.Equal(t, `"5"`, w.Header().Get("ETag"))
+	})
+
+	t.Run("PreconditionFailed", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("UpdateStep", mocky.Anything, uint64(1), mocky.Anything).Return(model.ErrVersionMismatch)
+
+		service := NewService(Config{Store: store})
+
+		req := `{
+			"subject": "Updated Step",
+			"content": "Updated Content"
+		}`
+
+		w := performRequestWithHeaders(service.Handler(), "PUT", "/sequences/1/steps/1", req, map[string]string{"If-Match": `"4"`})
+		assert.Equal(t, 412, w.Code)
+		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, model.ErrVersionMismatch.Error()))
+	})
 }
 
 func TestDeleteStep(t *testing.T) {
@@ -258,7 +871,7 @@ func TestDeleteStep(t *testing.T) {
 
 	t.Run("NotFound", func(t *testing.T) {
 		store := &mock.MockStore{}
-		store.On("DeleteStep", mocky.Anything, uint64(1), mocky.Anything).Return(pgx.ErrNoRows)
+		store.On("DeleteStep", mocky.Anything, uint64(1), mocky.Anything).Return(model.ErrNotFound)
 
 		service := NewService(Config{Store: store})
 
@@ -277,4 +890,194 @@ func TestDeleteStep(t *testing.T) {
 		assert.Equal(t, 500, w.Code)
 		assert.Contains(t, w.Body.String(), fmt.Sprintf(`"error":"%s"`, ErrResourceDeletionFailed.Error()))
 	})
+
+	t.Run("PreconditionFailed", func(t *testing.T) {
+		store := &mock.MockStore{}
+		store.On("DeleteStep", mocky.Anything, uint64(1), &model.Step{SequenceID: 1, Version: 2}).Return(model.ErrVersionMismatch)
+
+		service := NewService(Config{Store: store})
+
+		w := performRequestWithHeaders(service.Handler(), "DELETE", "/sequences/1/steps/1", "", map[string]string{"If-Match": `"2"`})
+		assert.Equal(t, 412, w.Code)
+	})
+}
+
+func TestPreviewStep(t *testing.T) {
+	// setup creates a tracked sequence with a mailbox and a contact.
+	setup := func(t *testing.T, emailSender sender.Sender) http.Handler {
+		t.Helper()
+		service := NewService(Config{
+			Store:    memory.NewStore(),
+			Sender:   emailSender,
+			Tracking: sender.Tracking{BaseURL: "https://t.example.com"},
+		})
+		handler := service.Handler()
+
+		requests := []struct{ method, path, body string }{
+			{"POST", "/sequences", `{"name": "Test Sequence", "openTrackingEnabled": true, "clickTrackingEnabled": true, "steps": [
+				{"subject": "Hi {{first_name}}", "content": "Pricing for {{company | default:\"your team\"}}: https://example.com/pricing"}
+			]}`},
+			{"POST", "/mailboxes", `{"userId": 1, "email": "sales@example.com", "dailyCapacity": 50}`},
+			{"POST", "/sequences/1/mailboxes/1", ""},
+			{"POST", "/contacts", `{"ownerId": 1, "email": "jane@example.com", "firstName": "Jane", "company": "Acme"}`},
+		}
+		for _, r := range requests {
+			w := performRequest(handler, r.method, r.path, r.body)
+			require.Less(t, w.Code, 300, w.Body.String())
+		}
+		return handler
+	}
+
+	t.Run("StoredContact", func(t *testing.T) {
+		handler := setup(t, nil)
+
+		w := performRequest(handler, "POST", "/sequences/1/steps/1/preview", `{"contactId": 1}`)
+		require.Equal(t, 200, w.Code, w.Body.String())
+
+		var resp PreviewStepResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "Hi Jane", resp.Subject)
+		assert.Equal(t, "Pricing for Acme: https://t.example.com/c/0?url=https%3A%2F%2Fexample.com%2Fpricing", resp.Text)
+		assert.Contains(t, resp.HTML, `<a href="https://t.example.com/c/0?url=https%3A%2F%2Fexample.com%2Fpricing">https://example.com/pricing</a>`)
+		assert.Contains(t, resp.HTML, `<img src="https://t.example.com/o/0.gif"`)
+		assert.Contains(t, resp.MIME, "From: <sales@example.com>\r\n")
+		assert.Contains(t, resp.MIME, "Content-Type: multipart/alternative;")
+		assert.Equal(t, uint64(1), resp.Permutations)
+		assert.Empty(t, resp.TestSentTo)
+	})
+
+	t.Run("Spintax", func(t *testing.T) {
+		handler := setup(t, nil)
+		w := performRequest(handler, "PUT", "/sequences/1/steps/1", `{"subject": "{Hi|Hello|Hey} {{first_name}}", "content": "{Quick|Short} question"}`)
+		require.Equal(t, 200, w.Code, w.Body.String())
+
+		preview := func(enrollmentID int) PreviewStepResponse {
+			w := performRequest(handler, "POST", "/sequences/1/steps/1/preview", fmt.Sprintf(`{"contactId": 1, "enrollmentId": %d}`, enrollmentID))
+			require.Equal(t, 200, w.Code, w.Body.String())
+			var resp PreviewStepResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			return resp
+		}
+
+		resp := preview(42)
+		assert.Equal(t, uint64(6), resp.Permutations)
+		assert.Regexp(t, `^(Hi|Hello|Hey) Jane$`, resp.Subject)
+		assert.Equal(t, resp.Subject, preview(42).Subject)
+		assert.Equal(t, resp.Text, preview(42).Text)
+	})
+
+	t.Run("SuppliedContact", func(t *testing.T) {
+		handler := setup(t, nil)
+
+		w := performRequest(handler, "POST", "/sequences/1/steps/1/preview", `{"contact": {"email": "john@example.com", "firstName": "John"}}`)
+		require.Equal(t, 200, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"subject":"Hi John"`)
+		assert.Contains(t, w.Body.String(), "Pricing for your team")
+	})
+
+	t.Run("TestSend", func(t *testing.T) {
+		capture, err := sender.NewCaptureSender("", sender.Tracking{BaseURL: "https://t.example.com"})
+		require.NoError(t, err)
+		handler := setup(t, capture)
+
+		w := performRequest(handler, "POST", "/sequences/1/steps/1/preview", `{"contactId": 1, "testSendTo": "rep@example.com"}`)
+		require.Equal(t, 200, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"testSentTo":"rep@example.com"`)
+
+		messages := capture.Messages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "sales@example.com", messages[0].From)
+		assert.Equal(t, "rep@example.com", messages[0].To)
+		assert.Contains(t, string(messages[0].Data), "Subject: Hi Jane\r\n")
+		assert.NotContains(t, string(messages[0].Data), "t.example.com", "Expected test emails not to be tracked")
+		assert.Contains(t, string(messages[0].Data), "Pricing for Acme: https://example.com/pricing\r\n")
+	})
+
+	t.Run("InvalidTestAddress", func(t *testing.T) {
+		handler := setup(t, nil)
+
+		w := performRequest(handler, "POST", "/sequences/1/steps/1/preview", `{"contactId": 1, "testSendTo": "rep"}`)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"testSendTo"`)
+	})
+
+	t.Run("MissingContact", func(t *testing.T) {
+		handler := setup(t, nil)
+
+		w := performRequest(handler, "POST", "/sequences/1/steps/1/preview", `{}`)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"field":"contactId"`)
+
+		w = performRequest(handler, "POST", "/sequences/1/steps/1/preview", `{"contactId": 99}`)
+		assert.Equal(t, 400, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"unknown_contact"`)
+	})
+
+	t.Run("UnknownStep", func(t *testing.T) {
+		handler := setup(t, nil)
+
+		w := performRequest(handler, "POST", "/sequences/1/steps/2/preview", `{"contactId": 1}`)
+		assert.Equal(t, 404, w.Code)
+	})
+
+	t.Run("NoMailbox", func(t *testing.T) {
+		handler := setup(t, nil)
+		w := performRequest(handler, "DELETE", "/sequences/1/mailboxes/1", "")
+		require.Equal(t, 204, w.Code)
+
+		// Previews show a placeholder sender, test sends need a mailbox.
+		w = performRequest(handler, "POST", "/sequences/1/steps/1/preview", `{"contactId": 1}`)
+		require.Equal(t, 200, w.Code, w.Body.String())
+		var resp PreviewStepResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Contains(t, resp.MIME, "From: <mailbox@example.com>\r\n")
+
+		w = performRequest(handler, "POST", "/sequences/1/steps/1/preview", `{"contactId": 1, "testSendTo": "rep@example.com"}`)
+		assert.Equal(t, 409, w.Code)
+		assert.Contains(t, w.Body.String(), `"code":"no_mailbox"`)
+	})
+}
+
+func TestSequenceLifecycle(t *testing.T) {
+	service := NewService(Config{Store: memory.NewStore()})
+
+	req := `{
+		"name": "Test Sequence",
+		"steps": [
+			{"subject": "Step 1", "content": "Content 1"},
+			{"subject": "Step 2", "content": "Content 2", "waitDays": 2}
+		]
+	}`
+	w := performRequest(service.Handler(), "POST", "/sequences", req)
+	require.Equal(t, 201, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	w = performRequestWithHeaders(service.Handler(), "PUT", "/sequences/1/steps/order", `{"stepIds": [2, 1]}`, map[string]string{"If-Match": `"1"`})
+	require.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":2,"position":1,"waitDays":0`)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	w = performRequestWithHeaders(service.Handler(), "PUT", "/sequences/1/steps/order", `{"stepIds": [1, 2]}`, map[string]string{"If-Match": `"1"`})
+	assert.Equal(t, 412, w.Code)
+
+	w = performRequestWithHeaders(service.Handler(), "PATCH", "/sequences/1", `{"name": "Renamed"}`, map[string]string{"If-Match": `"2"`})
+	require.Equal(t, 200, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	w = performRequestWithHeaders(service.Handler(), "PATCH", "/sequences/1", `{"name": "Stale"}`, map[string]string{"If-Match": `"2"`})
+	assert.Equal(t, 412, w.Code)
+
+	w = performRequest(service.Handler(), "DELETE", "/sequences/1/steps/2", "")
+	require.Equal(t, 204, w.Code)
+
+	w = performRequest(service.Handler(), "GET", "/sequences/1", "")
+	require.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Renamed"`)
+	assert.Contains(t, w.Body.String(), `"id":1,"position":1,"waitDays":0`)
+
+	w = performRequest(service.Handler(), "DELETE", "/sequences/1", "")
+	require.Equal(t, 204, w.Code)
+
+	w = performRequest(service.Handler(), "GET", "/sequences/1", "")
+	assert.Equal(t, 404, w.Code)
 }
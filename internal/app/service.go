@@ -4,29 +4,68 @@ import (
 	"net/http"
 
 	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/sender"
 	"github.com/gin-gonic/gin"
 )
 
 type Service struct {
-	mux   *gin.Engine
-	store model.SequenceStore
+	mux      *gin.Engine
+	store    model.Store
+	sender   sender.Sender
+	tracking sender.Tracking
 }
 
 type Config struct {
-	Store model.SequenceStore
+	Store model.Store
+	// Sends test emails of step previews. Defaults to sender.LogSender.
+	Sender sender.Sender
+	// Tracking applied to step previews, the same as the workers use.
+	Tracking sender.Tracking
 	// Additional configuration options can be added here in the future.
 }
 
 // NewService creates a new Service instance with the provided options.
 func NewService(cfg Config) *Service {
-	srv := &Service{store: cfg.Store}
+	srv := &Service{store: cfg.Store, sender: cfg.Sender, tracking: cfg.Tracking}
+	if srv.sender == nil {
+		srv.sender = sender.LogSender{}
+	}
 
 	r := gin.Default()
 	r.POST("/sequences", srv.createSequence)
+	r.GET("/sequences", srv.listSequences)
 	r.GET("/sequences/:id", srv.fetchSequence)
 	r.PUT("/sequences/:id", srv.updateSequence)
+	r.PATCH("/sequences/:id", srv.patchSequence)
+	r.DELETE("/sequences/:id", srv.deleteSequence)
+	r.POST("/sequences/:id/steps", srv.createStep)
+	r.PUT("/sequences/:id/steps/order", srv.reorderSteps)
 	r.PUT("/sequences/:id/steps/:step_id", srv.updateStep)
 	r.DELETE("/sequences/:id/steps/:step_id", srv.deleteStep)
+	r.POST("/sequences/:id/steps/:step_id/preview", srv.previewStep)
+	r.POST("/sequences/:id/enrollments", srv.createEnrollments)
+	r.POST("/sequences/:id/enrollments/pause", srv.transitionEnrollments(model.EnrollmentPaused))
+	r.POST("/sequences/:id/enrollments/resume", srv.transitionEnrollments(model.EnrollmentActive))
+	r.POST("/sequences/:id/enrollments/stop", srv.transitionEnrollments(model.EnrollmentStopped))
+	r.GET("/sequences/:id/mailboxes", srv.listSequenceMailboxes)
+	r.POST("/sequences/:id/mailboxes/:mailbox_id", srv.attachMailbox)
+	r.DELETE("/sequences/:id/mailboxes/:mailbox_id", srv.detachMailbox)
+	r.GET("/enrollments/:id", srv.fetchEnrollment)
+	r.GET("/enrollments/:id/emails", srv.listScheduledEmails)
+	r.POST("/enrollments/:id/pause", srv.transitionEnrollment(model.EnrollmentPaused))
+	r.POST("/enrollments/:id/resume", srv.transitionEnrollment(model.EnrollmentActive))
+	r.POST("/enrollments/:id/stop", srv.transitionEnrollment(model.EnrollmentStopped))
+	r.POST("/contacts", srv.createContact)
+	r.GET("/contacts", srv.listContacts)
+	r.POST("/contacts/import", srv.importContacts)
+	r.GET("/contacts/:id", srv.fetchContact)
+	r.PATCH("/contacts/:id", srv.patchContact)
+	r.DELETE("/contacts/:id", srv.deleteContact)
+	r.POST("/mailboxes", srv.createMailbox)
+	r.GET("/mailboxes", srv.listMailboxes)
+	r.GET("/mailboxes/:id", srv.fetchMailbox)
+	r.PATCH("/mailboxes/:id", srv.patchMailbox)
+	r.DELETE("/mailboxes/:id", srv.deleteMailbox)
 
 	srv.mux = r
 	return srv
@@ -1,7 +1,58 @@
 package app
 
+import "time"
+
+const (
+	StorePostgres = "postgres"
+	StoreMemory   = "memory"
+
+	SenderLog     = "log"
+	SenderSMTP    = "smtp"
+	SenderCapture = "capture"
+)
+
 // Specification holds the configuration for the application.
 type Specification struct {
-	Address     string `envconfig:"address" default:":8080"`
-	DatabaseURL string `envconfig:"database_url" required:"true"`
+	Address string `envconfig:"address" default:":8080"`
+	// Either StorePostgres or StoreMemory. The memory store keeps no data
+	// between restarts and needs no database.
+	Store       string `envconfig:"store" default:"postgres"`
+	DatabaseURL string `envconfig:"database_url"`
+	// Base64 encoded 32 byte key encrypting the SMTP passwords of mailboxes
+	// in the database, see the secret package.
+	SecretKey string `envconfig:"secret_key"`
+	// How often pending emails are planned, see the scheduler package.
+	SchedulerInterval time.Duration `envconfig:"scheduler_interval" default:"1h"`
+	// Number of emails sent at the same time, see the worker package.
+	WorkerConcurrency  int           `envconfig:"worker_concurrency" default:"4"`
+	WorkerPollInterval time.Duration `envconfig:"worker_poll_interval" default:"5s"`
+	WorkerLease        time.Duration `envconfig:"worker_lease" default:"10m"`
+	// Attempts of an email before its enrollment is paused and the pause
+	// before the first retry, doubled for every further one.
+	WorkerMaxAttempts  int           `envconfig:"worker_max_attempts" default:"5"`
+	WorkerRetryBackoff time.Duration `envconfig:"worker_retry_backoff" default:"5m"`
+	// Enrollments rescheduled per transaction after steps change and the
+	// pause between such batches, see the rescheduler package.
+	RescheduleBatchSize int           `envconfig:"reschedule_batch_size" default:"500"`
+	RescheduleThrottle  time.Duration `envconfig:"reschedule_throttle" default:"100ms"`
+	// How often idle reschedulers look for queued sequences.
+	ReschedulePollInterval time.Duration `envconfig:"reschedule_poll_interval" default:"5s"`
+	// One of SenderLog, SenderSMTP or SenderCapture, see the sender package.
+	// Required, so emails are never marked sent without being sent by
+	// mistake.
+	Sender string `envconfig:"sender"`
+	// SMTP server of mailboxes without their own.
+	SMTPHost     string `envconfig:"smtp_host"`
+	SMTPPort     int    `envconfig:"smtp_port" default:"587"`
+	SMTPUsername string `envconfig:"smtp_username"`
+	SMTPPassword string `envconfig:"smtp_password"`
+	// Refuse to send through servers without STARTTLS. Port 465 always
+	// speaks TLS from the start.
+	SMTPRequireTLS bool `envconfig:"smtp_require_tls" default:"true"`
+	// Directory the capture sender writes .eml files to. Messages are kept
+	// in memory when empty.
+	CaptureDir string `envconfig:"capture_dir"`
+	// Base URL of the open and click tracking links of sequences with
+	// tracking enabled. Nothing is tracked when empty.
+	TrackingURL string `envconfig:"tracking_url"`
 }
@@ -0,0 +1,57 @@
+package model
+
+import "maps"
+
+type ImportStatus string
+
+const (
+	ImportCreated ImportStatus = "created"
+	ImportUpdated ImportStatus = "updated"
+	ImportSkipped ImportStatus = "skipped"
+	ImportInvalid ImportStatus = "invalid"
+	// ImportFailed marks a valid row that was not stored because its batch
+	// or an earlier one failed.
+	ImportFailed ImportStatus = "failed"
+)
+
+// ContactImport is a batch of contacts imported for one owner.
+type ContactImport struct {
+	OwnerID  uint64
+	Contacts []*Contact
+	// Merge the batch into existing contacts with the same email instead of
+	// skipping them.
+	UpdateExisting bool
+}
+
+// Merge copies the non-empty fields of other onto the contact and reports
+// whether anything changed. Custom fields are merged by key. The email is
+// kept, so a case change alone does not count as an update.
+func (c *Contact) Merge(other *Contact) bool {
+	changed := false
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&c.FirstName, other.FirstName},
+		{&c.LastName, other.LastName},
+		{&c.Company, other.Company},
+		{&c.Timezone, other.Timezone},
+	} {
+		if field.src != "" && field.src != *field.dst {
+			*field.dst = field.src
+			changed = true
+		}
+	}
+
+	merged := maps.Clone(c.CustomFields)
+	if merged == nil {
+		merged = make(map[string]string, len(other.CustomFields))
+	}
+	maps.Copy(merged, other.CustomFields)
+	if !maps.Equal(merged, c.CustomFields) {
+		c.CustomFields = merged
+		changed = true
+	}
+
+	return changed
+}
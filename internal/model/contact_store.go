@@ -0,0 +1,149 @@
+package model
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidEmail  = newError(ErrValidation, "invalid_email", "email", "invalid email address")
+	ErrContactExists = newError(ErrUniqueViolation, "contact_exists", "email", "contact with this email already exists")
+	ErrFieldTooLong  = newError(ErrValidation, "field_too_long", "", "value is too long")
+)
+
+// Column sizes of the contacts table.
+const (
+	MaxEmailLength    = 320
+	MaxNameLength     = 255
+	MaxTimezoneLength = 64
+)
+
+type Contact struct {
+	ID           uint64            `json:"id"`
+	OwnerID      uint64            `json:"ownerId"`
+	Email        string            `json:"email"`
+	FirstName    string            `json:"firstName"`
+	LastName     string            `json:"lastName"`
+	Company      string            `json:"company"`
+	Timezone     string            `json:"timezone"`
+	CustomFields map[string]string `json:"customFields"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
+}
+
+// Normalize trims surrounding whitespace from the contact fields.
+func (c *Contact) Normalize() {
+	c.Email = strings.TrimSpace(c.Email)
+	c.FirstName = strings.TrimSpace(c.FirstName)
+	c.LastName = strings.TrimSpace(c.LastName)
+	c.Company = strings.TrimSpace(c.Company)
+	c.Timezone = strings.TrimSpace(c.Timezone)
+	if c.CustomFields == nil {
+		c.CustomFields = map[string]string{}
+	}
+}
+
+// Validate checks the email address, the field lengths and the optional
+// timezone.
+func (c *Contact) Validate() error {
+	if err := ValidateEmail(c.Email); err != nil {
+		return err
+	}
+	for _, field := range []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"firstName", c.FirstName, MaxNameLength},
+		{"lastName", c.LastName, MaxNameLength},
+		{"company", c.Company, MaxNameLength},
+		{"timezone", c.Timezone, MaxTimezoneLength},
+	} {
+		if utf8.RuneCountInString(field.value) > field.max {
+			return ErrFieldTooLong.WithField(field.name)
+		}
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return ErrInvalidTimezone
+		}
+	}
+	return nil
+}
+
+// ValidateEmail accepts bare addresses like "jane@example.com" only, display
+// names and angle brackets are rejected.
+func ValidateEmail(email string) error {
+	if utf8.RuneCountInString(email) > MaxEmailLength {
+		return ErrInvalidEmail
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+type ListContactsParams struct {
+	// Return contacts that come after the cursor.
+	After *Cursor
+	// Maximum number of contacts to return, DefaultPageSize when zero.
+	Limit uint64
+	// Filter by owner when set.
+	OwnerID uint64
+	// Case-insensitive substring of the email address.
+	Email string
+}
+
+// ContactPatch holds contact fields to update. Nil fields are left untouched,
+// custom fields are replaced as a whole.
+type ContactPatch struct {
+	Email        *string
+	FirstName    *string
+	LastName     *string
+	Company      *string
+	Timezone     *string
+	CustomFields map[string]string
+}
+
+// Apply copies the provided fields onto the contact.
+func (p *ContactPatch) Apply(contact *Contact) {
+	if p.Email != nil {
+		contact.Email = *p.Email
+	}
+	if p.FirstName != nil {
+		contact.FirstName = *p.FirstName
+	}
+	if p.LastName != nil {
+		contact.LastName = *p.LastName
+	}
+	if p.Company != nil {
+		contact.Company = *p.Company
+	}
+	if p.Timezone != nil {
+		contact.Timezone = *p.Timezone
+	}
+	if p.CustomFields != nil {
+		contact.CustomFields = p.CustomFields
+	}
+}
+
+type ContactStore interface {
+	// Create a contact. Emails are unique per owner regardless of case.
+	CreateContact(ctx context.Context, contact *Contact) error
+	// Fetch a contact by ID.
+	FetchContact(ctx context.Context, id uint64) (*Contact, error)
+	// List contacts ordered by ID. The returned cursor is nil on the last page.
+	ListContacts(ctx context.Context, params *ListContactsParams) ([]*Contact, *Cursor, error)
+	// Update the provided contact fields. The resulting contact is validated.
+	UpdateContact(ctx context.Context, id uint64, patch *ContactPatch) (*Contact, error)
+	// Delete a contact.
+	DeleteContact(ctx context.Context, id uint64) error
+	// Import a batch of validated contacts with distinct emails. Statuses
+	// follow the order of the batch contacts, which receive their stored
+	// values.
+	ImportContacts(ctx context.Context, batch *ContactImport) ([]ImportStatus, error)
+}
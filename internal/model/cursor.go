@@ -0,0 +1,48 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+var ErrInvalidCursor = newError(ErrValidation, "invalid_cursor", "cursor", "invalid cursor")
+
+// DefaultPageSize is the page size of listings without a limit.
+const DefaultPageSize = 20
+
+// PageLimit returns the page size of a listing, zero limit meaning
+// DefaultPageSize.
+func PageLimit(limit uint64) uint64 {
+	if limit == 0 {
+		return DefaultPageSize
+	}
+	return limit
+}
+
+// Cursor points at the last row of a page in keyset pagination.
+type Cursor struct {
+	ID        uint64    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Encode returns an opaque token that can be passed back by clients.
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a token produced by Cursor.Encode.
+func DecodeCursor(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+var (
+	ErrSequenceEmpty     = newError(ErrValidation, "sequence_empty", "", "sequence has no steps")
+	ErrUnknownContact    = newError(ErrValidation, "unknown_contact", "contactIds", "contact does not exist")
+	ErrAlreadyEnrolled   = newError(ErrUniqueViolation, "already_enrolled", "contactIds", "contact is already enrolled in the sequence")
+	ErrFirstStepChanged  = newError(ErrConflict, "first_step_changed", "", "first step of the sequence has changed")
+	ErrInvalidTransition = newError(ErrConflict, "invalid_transition", "", "enrollment cannot move to the requested status")
+)
+
+type EnrollmentStatus string
+
+const (
+	EnrollmentActive    EnrollmentStatus = "active"
+	EnrollmentPaused    EnrollmentStatus = "paused"
+	EnrollmentCompleted EnrollmentStatus = "completed"
+	EnrollmentStopped   EnrollmentStatus = "stopped"
+	EnrollmentBounced   EnrollmentStatus = "bounced"
+	EnrollmentReplied   EnrollmentStatus = "replied"
+)
+
+// enrollmentTransitions lists the statuses every status can move to. Statuses
+// without transitions are final.
+var enrollmentTransitions = map[EnrollmentStatus][]EnrollmentStatus{
+	EnrollmentActive: {EnrollmentPaused, EnrollmentCompleted, EnrollmentStopped, EnrollmentBounced, EnrollmentReplied},
+	EnrollmentPaused: {EnrollmentActive, EnrollmentStopped, EnrollmentBounced, EnrollmentReplied},
+}
+
+// CanTransition reports whether an enrollment may move from the status to
+// the given one.
+func (s EnrollmentStatus) CanTransition(to EnrollmentStatus) bool {
+	return slices.Contains(enrollmentTransitions[s], to)
+}
+
+// Final reports whether the enrollment is over.
+func (s EnrollmentStatus) Final() bool {
+	return len(enrollmentTransitions[s]) == 0
+}
+
+// TransitionSources returns the statuses that may move to the given one,
+// in a stable order.
+func TransitionSources(to EnrollmentStatus) []EnrollmentStatus {
+	var sources []EnrollmentStatus
+	for _, from := range []EnrollmentStatus{EnrollmentActive, EnrollmentPaused} {
+		if from.CanTransition(to) {
+			sources = append(sources, from)
+		}
+	}
+	return sources
+}
+
+type Enrollment struct {
+	ID         uint64           `json:"id"`
+	SequenceID uint64           `json:"sequenceId"`
+	ContactID  uint64           `json:"contactId"`
+	Status     EnrollmentStatus `json:"status"`
+	// Step that is sent next, or the last sent step once the enrollment is
+	// completed. Nil when the step has been deleted.
+	CurrentStepID *uint64    `json:"currentStepId"`
+	EnrolledAt    time.Time  `json:"enrolledAt"`
+	CompletedAt   *time.Time `json:"completedAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+type EnrollmentStore interface {
+	// Enroll contacts into a sequence starting from its first step. The step
+	// is checked to still be the first one. Contacts with an active
+	// enrollment in the sequence are rejected. Every enrollment gets a
+	// pending email for the first step at the next slot of the sending
+	// window after now. Enrollments are returned ordered by contact ID,
+	// repeated contacts are enrolled once.
+	CreateEnrollments(ctx context.Context, sequenceID, firstStepID uint64, contactIDs []uint64, now time.Time) ([]*Enrollment, error)
+	// Fetch an enrollment by ID.
+	FetchEnrollment(ctx context.Context, id uint64) (*Enrollment, error)
+	// Move an enrollment to the status. Illegal transitions are rejected,
+	// final statuses set the completion time. Leaving the active status
+	// cancels the pending email, resuming schedules the current step again
+	// no earlier than now and the time it was planned for.
+	TransitionEnrollment(ctx context.Context, id uint64, status EnrollmentStatus, now time.Time) (*Enrollment, error)
+	// Move every enrollment of the sequence that may move to the status and
+	// return their number. Other enrollments are left untouched.
+	TransitionEnrollments(ctx context.Context, sequenceID uint64, status EnrollmentStatus, now time.Time) (int, error)
+}
@@ -0,0 +1,47 @@
+package model
+
+import "errors"
+
+// Kinds of errors returned by stores. Specific errors wrap one of them, so
+// callers can handle a whole class of failures without knowing the storage.
+var (
+	ErrNotFound        = errors.New("resource not found")
+	ErrConflict        = errors.New("resource conflict")
+	ErrValidation      = errors.New("validation failed")
+	ErrUniqueViolation = errors.New("resource already exists")
+)
+
+// Error is a domain error of one of the kinds above. Field names the input
+// the error relates to, if any.
+type Error struct {
+	Kind    error
+	Code    string
+	Field   string
+	Message string
+}
+
+func newError(kind error, code, field, message string) *Error {
+	return &Error{Kind: kind, Code: code, Field: field, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// Is matches errors by code, so a copy bound to another field still equals
+// the original error.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithField returns a copy of the error related to the given input field.
+func (e *Error) WithField(field string) *Error {
+	err := *e
+	err.Field = field
+	return &err
+}
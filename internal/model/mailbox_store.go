@@ -0,0 +1,137 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrMailboxExists        = newError(ErrUniqueViolation, "mailbox_exists", "email", "mailbox with this email already exists")
+	ErrInvalidDailyCapacity = newError(ErrValidation, "invalid_daily_capacity", "dailyCapacity", "daily capacity must be positive")
+	ErrInvalidSMTPPort      = newError(ErrValidation, "invalid_smtp_port", "smtpPort", "SMTP port must be between 1 and 65535")
+	ErrNoMailbox            = newError(ErrConflict, "no_mailbox", "mailboxId", "sequence has no mailboxes")
+)
+
+// DefaultSMTPPort is the submission port used unless configured otherwise.
+const DefaultSMTPPort = 587
+
+// Column sizes of the mailboxes table.
+const MaxHostLength = 255
+
+type Mailbox struct {
+	ID     uint64 `json:"id"`
+	UserID uint64 `json:"userId"`
+	Email  string `json:"email"`
+	// Maximum number of emails the mailbox sends a day.
+	DailyCapacity int `json:"dailyCapacity"`
+	// SMTP server and credentials the mailbox sends with. Mailboxes without
+	// a host use the server of the sender. The password is never returned.
+	SMTPHost     string    `json:"smtpHost"`
+	SMTPPort     int       `json:"smtpPort"`
+	SMTPUsername string    `json:"smtpUsername"`
+	SMTPPassword string    `json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// Normalize trims surrounding whitespace from the mailbox email and SMTP
+// settings and applies the default SMTP port.
+func (m *Mailbox) Normalize() {
+	m.Email = strings.TrimSpace(m.Email)
+	m.SMTPHost = strings.TrimSpace(m.SMTPHost)
+	m.SMTPUsername = strings.TrimSpace(m.SMTPUsername)
+	if m.SMTPPort == 0 {
+		m.SMTPPort = DefaultSMTPPort
+	}
+}
+
+// Validate checks the email address, the daily capacity and the SMTP
+// settings.
+func (m *Mailbox) Validate() error {
+	if err := ValidateEmail(m.Email); err != nil {
+		return err
+	}
+	if m.DailyCapacity < 1 {
+		return ErrInvalidDailyCapacity
+	}
+	if m.SMTPPort < 1 || m.SMTPPort > 65535 {
+		return ErrInvalidSMTPPort
+	}
+	for _, field := range []struct {
+		name  string
+		value string
+		max   int
+	}{
+		{"smtpHost", m.SMTPHost, MaxHostLength},
+		{"smtpUsername", m.SMTPUsername, MaxEmailLength},
+	} {
+		if utf8.RuneCountInString(field.value) > field.max {
+			return ErrFieldTooLong.WithField(field.name)
+		}
+	}
+	return nil
+}
+
+type ListMailboxesParams struct {
+	// Return mailboxes that come after the cursor.
+	After *Cursor
+	// Maximum number of mailboxes to return, DefaultPageSize when zero.
+	Limit uint64
+	// Filter by user when set.
+	UserID uint64
+}
+
+// MailboxPatch holds mailbox fields to update. Nil fields are left untouched.
+type MailboxPatch struct {
+	Email         *string
+	DailyCapacity *int
+	SMTPHost      *string
+	SMTPPort      *int
+	SMTPUsername  *string
+	SMTPPassword  *string
+}
+
+// Apply copies the provided fields onto the mailbox.
+func (p *MailboxPatch) Apply(mailbox *Mailbox) {
+	if p.Email != nil {
+		mailbox.Email = *p.Email
+	}
+	if p.DailyCapacity != nil {
+		mailbox.DailyCapacity = *p.DailyCapacity
+	}
+	if p.SMTPHost != nil {
+		mailbox.SMTPHost = *p.SMTPHost
+	}
+	if p.SMTPPort != nil {
+		mailbox.SMTPPort = *p.SMTPPort
+	}
+	if p.SMTPUsername != nil {
+		mailbox.SMTPUsername = *p.SMTPUsername
+	}
+	if p.SMTPPassword != nil {
+		mailbox.SMTPPassword = *p.SMTPPassword
+	}
+}
+
+type MailboxStore interface {
+	// Create a mailbox. Emails are unique per user regardless of case.
+	CreateMailbox(ctx context.Context, mailbox *Mailbox) error
+	// Fetch a mailbox by ID.
+	FetchMailbox(ctx context.Context, id uint64) (*Mailbox, error)
+	// List mailboxes ordered by ID. The returned cursor is nil on the last page.
+	ListMailboxes(ctx context.Context, params *ListMailboxesParams) ([]*Mailbox, *Cursor, error)
+	// Update the provided mailbox fields. The resulting mailbox is validated.
+	UpdateMailbox(ctx context.Context, id uint64, patch *MailboxPatch) (*Mailbox, error)
+	// Delete a mailbox and detach it from its sequences, queueing a
+	// RebalanceMailboxes job for each of them.
+	DeleteMailbox(ctx context.Context, id uint64) error
+	// Let a sequence send from the mailbox. Attaching twice is a no-op.
+	// Attaching and detaching queue a RebalanceMailboxes job for the sequence.
+	AttachMailbox(ctx context.Context, sequenceID, mailboxID uint64) error
+	// Stop a sequence from sending from the mailbox.
+	DetachMailbox(ctx context.Context, sequenceID, mailboxID uint64) error
+	// List the mailboxes of a sequence ordered by ID.
+	ListSequenceMailboxes(ctx context.Context, sequenceID uint64) ([]*Mailbox, error)
+}
@@ -0,0 +1,180 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+func (s *MemoryStore) CreateContact(ctx context.Context, contact *model.Contact) error {
+	contact.Normalize()
+	if err := contact.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.emailTaken(contact.OwnerID, contact.Email, 0) {
+		return model.ErrContactExists
+	}
+
+	now := now()
+	s.lastContactID++
+	contact.ID = s.lastContactID
+	contact.CreatedAt = now
+	contact.UpdatedAt = now
+	s.contacts[contact.ID] = copyContact(contact)
+
+	return nil
+}
+
+func (s *MemoryStore) FetchContact(ctx context.Context, id uint64) (*model.Contact, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	contact, ok := s.contacts[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	return copyContact(contact), nil
+}
+
+func (s *MemoryStore) ListContacts(ctx context.Context, params *model.ListContactsParams) ([]*model.Contact, *model.Cursor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	limit := model.PageLimit(params.Limit)
+	email := strings.ToLower(params.Email)
+	var matched []*model.Contact
+	for _, contact := range s.contacts {
+		if params.After != nil && contact.ID <= params.After.ID {
+			continue
+		}
+		if params.OwnerID != 0 && contact.OwnerID != params.OwnerID {
+			continue
+		}
+		if email != "" && !strings.Contains(strings.ToLower(contact.Email), email) {
+			continue
+		}
+		matched = append(matched, contact)
+	}
+	slices.SortFunc(matched, func(a, b *model.Contact) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	var next *model.Cursor
+	if uint64(len(matched)) > limit {
+		matched = matched[:limit]
+		last := matched[len(matched)-1]
+		next = &model.Cursor{ID: last.ID, CreatedAt: last.CreatedAt}
+	}
+
+	contacts := make([]*model.Contact, len(matched))
+	for i, contact := range matched {
+		contacts[i] = copyContact(contact)
+	}
+
+	return contacts, next, nil
+}
+
+func (s *MemoryStore) UpdateContact(ctx context.Context, id uint64, patch *model.ContactPatch) (*model.Contact, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.contacts[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	contact := copyContact(stored)
+	patch.Apply(contact)
+	contact.Normalize()
+	if err := contact.Validate(); err != nil {
+		return nil, err
+	}
+	if s.emailTaken(contact.OwnerID, contact.Email, id) {
+		return nil, model.ErrContactExists
+	}
+	contact.CustomFields = maps.Clone(contact.CustomFields)
+	contact.UpdatedAt = now()
+	s.contacts[id] = contact
+
+	return copyContact(contact), nil
+}
+
+func (s *MemoryStore) DeleteContact(ctx context.Context, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.contacts[id]; !ok {
+		return model.ErrNotFound
+	}
+	delete(s.contacts, id)
+	for _, enrollment := range s.enrollments {
+		if enrollment.ContactID == id {
+			s.deleteEnrollment(enrollment.ID)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) ImportContacts(ctx context.Context, batch *model.ContactImport) ([]model.ImportStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := now()
+	statuses := make([]model.ImportStatus, len(batch.Contacts))
+	for i, contact := range batch.Contacts {
+		stored := s.findByEmail(batch.OwnerID, contact.Email)
+		if stored == nil {
+			s.lastContactID++
+			contact.ID = s.lastContactID
+			contact.OwnerID = batch.OwnerID
+			contact.CreatedAt = now
+			contact.UpdatedAt = now
+			s.contacts[contact.ID] = copyContact(contact)
+			statuses[i] = model.ImportCreated
+			continue
+		}
+
+		statuses[i] = model.ImportSkipped
+		if batch.UpdateExisting && stored.Merge(contact) {
+			stored.UpdatedAt = now
+			statuses[i] = model.ImportUpdated
+		}
+		*contact = *copyContact(stored)
+	}
+
+	return statuses, nil
+}
+
+// findByEmail returns the stored contact of the owner with the email,
+// ignoring case. The caller must hold the lock.
+func (s *MemoryStore) findByEmail(ownerID uint64, email string) *model.Contact {
+	for _, contact := range s.contacts {
+		if contact.OwnerID == ownerID && strings.EqualFold(contact.Email, email) {
+			return contact
+		}
+	}
+	return nil
+}
+
+// emailTaken reports whether another contact of the owner uses the email,
+// ignoring case. The caller must hold the lock.
+func (s *MemoryStore) emailTaken(ownerID uint64, email string, exceptID uint64) bool {
+	contact := s.findByEmail(ownerID, email)
+	return contact != nil && contact.ID != exceptID
+}
+
+func copyContact(contact *model.Contact) *model.Contact {
+	c := *contact
+	c.CustomFields = maps.Clone(contact.CustomFields)
+	return &c
+}
@@ -0,0 +1,157 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+func (s *MemoryStore) CreateEnrollments(ctx context.Context, sequenceID, firstStepID uint64, contactIDs []uint64, now time.Time) ([]*model.Enrollment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sequence, err := s.lockSequence(sequenceID)
+	if err != nil {
+		return nil, err
+	}
+	window, err := sequence.SendingWindow()
+	if err != nil {
+		return nil, err
+	}
+	steps := s.sequenceSteps(sequenceID)
+	if len(steps) == 0 {
+		return nil, model.ErrSequenceEmpty
+	}
+	if steps[0].ID != firstStepID {
+		return nil, model.ErrFirstStepChanged
+	}
+
+	contactIDs = slices.Compact(slices.Sorted(slices.Values(contactIDs)))
+	for _, contactID := range contactIDs {
+		if _, ok := s.contacts[contactID]; !ok {
+			return nil, model.ErrUnknownContact
+		}
+		if s.activeEnrollment(sequenceID, contactID) != nil {
+			return nil, model.ErrAlreadyEnrolled
+		}
+	}
+
+	now = now.UTC().Truncate(time.Microsecond)
+	enrollments := make([]*model.Enrollment, len(contactIDs))
+	for i, contactID := range contactIDs {
+		s.lastEnrollmentID++
+		stepID := firstStepID
+		enrollment := &model.Enrollment{
+			ID:            s.lastEnrollmentID,
+			SequenceID:    sequenceID,
+			ContactID:     contactID,
+			Status:        model.EnrollmentActive,
+			CurrentStepID: &stepID,
+			EnrolledAt:    now,
+			UpdatedAt:     now,
+		}
+		s.enrollments[enrollment.ID] = enrollment
+		s.scheduleEmail(enrollment, window, now)
+		enrollments[i] = copyEnrollment(enrollment)
+	}
+
+	return enrollments, nil
+}
+
+func (s *MemoryStore) FetchEnrollment(ctx context.Context, id uint64) (*model.Enrollment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	enrollment, ok := s.enrollments[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	return copyEnrollment(enrollment), nil
+}
+
+func (s *MemoryStore) TransitionEnrollment(ctx context.Context, id uint64, status model.EnrollmentStatus, now time.Time) (*model.Enrollment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	enrollment, ok := s.enrollments[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	if !enrollment.Status.CanTransition(status) {
+		return nil, model.ErrInvalidTransition
+	}
+	window, err := s.sequences[enrollment.SequenceID].SendingWindow()
+	if err != nil {
+		return nil, err
+	}
+	s.transition(enrollment, status, window, now.UTC().Truncate(time.Microsecond))
+
+	return copyEnrollment(enrollment), nil
+}
+
+func (s *MemoryStore) TransitionEnrollments(ctx context.Context, sequenceID uint64, status model.EnrollmentStatus, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sequence, ok := s.sequences[sequenceID]
+	if !ok {
+		return 0, model.ErrNotFound
+	}
+	window, err := sequence.SendingWindow()
+	if err != nil {
+		return 0, err
+	}
+
+	now = now.UTC().Truncate(time.Microsecond)
+	count := 0
+	for _, enrollment := range s.enrollments {
+		if enrollment.SequenceID == sequenceID && enrollment.Status.CanTransition(status) {
+			s.transition(enrollment, status, window, now)
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// transition moves the enrollment to the status and updates its pending
+// email. The caller must hold the write lock.
+func (s *MemoryStore) transition(enrollment *model.Enrollment, status model.EnrollmentStatus, window *model.SendingWindow, now time.Time) {
+	enrollment.Status = status
+	enrollment.UpdatedAt = now
+	if status.Final() {
+		enrollment.CompletedAt = &now
+	}
+	if status == model.EnrollmentActive {
+		s.scheduleEmail(enrollment, window, now)
+	} else {
+		s.cancelEmails(enrollment.ID, now)
+	}
+}
+
+// activeEnrollment returns the enrollment of the contact in the sequence
+// that is not over yet, if any. The caller must hold the lock.
+func (s *MemoryStore) activeEnrollment(sequenceID, contactID uint64) *model.Enrollment {
+	for _, enrollment := range s.enrollments {
+		if enrollment.SequenceID == sequenceID && enrollment.ContactID == contactID && !enrollment.Status.Final() {
+			return enrollment
+		}
+	}
+	return nil
+}
+
+func copyEnrollment(enrollment *model.Enrollment) *model.Enrollment {
+	c := *enrollment
+	if enrollment.CurrentStepID != nil {
+		stepID := *enrollment.CurrentStepID
+		c.CurrentStepID = &stepID
+	}
+	if enrollment.CompletedAt != nil {
+		completedAt := *enrollment.CompletedAt
+		c.CompletedAt = &completedAt
+	}
+	return &c
+}
@@ -0,0 +1,202 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+func (s *MemoryStore) CreateMailbox(ctx context.Context, mailbox *model.Mailbox) error {
+	mailbox.Normalize()
+	if err := mailbox.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.mailboxTaken(mailbox.UserID, mailbox.Email, 0) {
+		return model.ErrMailboxExists
+	}
+
+	now := now()
+	s.lastMailboxID++
+	mailbox.ID = s.lastMailboxID
+	mailbox.CreatedAt = now
+	mailbox.UpdatedAt = now
+	s.mailboxes[mailbox.ID] = copyMailbox(mailbox)
+
+	return nil
+}
+
+func (s *MemoryStore) FetchMailbox(ctx context.Context, id uint64) (*model.Mailbox, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	mailbox, ok := s.mailboxes[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	return copyMailbox(mailbox), nil
+}
+
+func (s *MemoryStore) ListMailboxes(ctx context.Context, params *model.ListMailboxesParams) ([]*model.Mailbox, *model.Cursor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	limit := model.PageLimit(params.Limit)
+	var matched []*model.Mailbox
+	for _, mailbox := range s.mailboxes {
+		if params.After != nil && mailbox.ID <= params.After.ID {
+			continue
+		}
+		if params.UserID != 0 && mailbox.UserID != params.UserID {
+			continue
+		}
+		matched = append(matched, mailbox)
+	}
+	slices.SortFunc(matched, func(a, b *model.Mailbox) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	var next *model.Cursor
+	if uint64(len(matched)) > limit {
+		matched = matched[:limit]
+		last := matched[len(matched)-1]
+		next = &model.Cursor{ID: last.ID, CreatedAt: last.CreatedAt}
+	}
+
+	mailboxes := make([]*model.Mailbox, len(matched))
+	for i, mailbox := range matched {
+		mailboxes[i] = copyMailbox(mailbox)
+	}
+
+	return mailboxes, next, nil
+}
+
+func (s *MemoryStore) UpdateMailbox(ctx context.Context, id uint64, patch *model.MailboxPatch) (*model.Mailbox, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.mailboxes[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	mailbox := copyMailbox(stored)
+	patch.Apply(mailbox)
+	mailbox.Normalize()
+	if err := mailbox.Validate(); err != nil {
+		return nil, err
+	}
+	if s.mailboxTaken(mailbox.UserID, mailbox.Email, id) {
+		return nil, model.ErrMailboxExists
+	}
+	mailbox.UpdatedAt = now()
+	s.mailboxes[id] = mailbox
+
+	return copyMailbox(mailbox), nil
+}
+
+func (s *MemoryStore) DeleteMailbox(ctx context.Context, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.mailboxes[id]; !ok {
+		return model.ErrNotFound
+	}
+	delete(s.mailboxes, id)
+	for sequenceID, mailboxIDs := range s.sequenceMailboxes {
+		if _, ok := mailboxIDs[id]; ok {
+			delete(mailboxIDs, id)
+			s.queueRescheduleJob(sequenceID, model.RebalanceMailboxes)
+		}
+	}
+	for _, email := range s.scheduledEmails {
+		if email.MailboxID != nil && *email.MailboxID == id {
+			email.MailboxID = nil
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) AttachMailbox(ctx context.Context, sequenceID, mailboxID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.lockSequence(sequenceID); err != nil {
+		return err
+	}
+	if _, ok := s.mailboxes[mailboxID]; !ok {
+		return model.ErrNotFound
+	}
+
+	if s.sequenceMailboxes[sequenceID] == nil {
+		s.sequenceMailboxes[sequenceID] = make(map[uint64]bool)
+	}
+	s.sequenceMailboxes[sequenceID][mailboxID] = true
+	s.queueRescheduleJob(sequenceID, model.RebalanceMailboxes)
+
+	return nil
+}
+
+func (s *MemoryStore) DetachMailbox(ctx context.Context, sequenceID, mailboxID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.lockSequence(sequenceID); err != nil {
+		return err
+	}
+	if !s.sequenceMailboxes[sequenceID][mailboxID] {
+		return model.ErrNotFound
+	}
+	delete(s.sequenceMailboxes[sequenceID], mailboxID)
+	s.queueRescheduleJob(sequenceID, model.RebalanceMailboxes)
+
+	return nil
+}
+
+func (s *MemoryStore) ListSequenceMailboxes(ctx context.Context, sequenceID uint64) ([]*model.Mailbox, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.sequences[sequenceID]; !ok {
+		return nil, model.ErrNotFound
+	}
+
+	return s.attachedMailboxes(sequenceID), nil
+}
+
+// attachedMailboxes returns copies of the mailboxes of a sequence ordered by
+// ID. The caller must hold the lock.
+func (s *MemoryStore) attachedMailboxes(sequenceID uint64) []*model.Mailbox {
+	mailboxes := make([]*model.Mailbox, 0, len(s.sequenceMailboxes[sequenceID]))
+	for mailboxID := range s.sequenceMailboxes[sequenceID] {
+		mailboxes = append(mailboxes, copyMailbox(s.mailboxes[mailboxID]))
+	}
+	slices.SortFunc(mailboxes, func(a, b *model.Mailbox) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return mailboxes
+}
+
+// mailboxTaken reports whether another mailbox of the user uses the email,
+// ignoring case. The caller must hold the lock.
+func (s *MemoryStore) mailboxTaken(userID uint64, email string, exceptID uint64) bool {
+	for _, mailbox := range s.mailboxes {
+		if mailbox.ID != exceptID && mailbox.UserID == userID && strings.EqualFold(mailbox.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+func copyMailbox(mailbox *model.Mailbox) *model.Mailbox {
+	c := *mailbox
+	return &c
+}
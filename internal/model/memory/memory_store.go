@@ -0,0 +1,489 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+var _ model.Store = (*MemoryStore)(nil)
+
+// MemoryStore keeps everything in process memory. It behaves like the
+// Postgres store and is meant for local development and tests.
+type MemoryStore struct {
+	mu                sync.RWMutex
+	sequences         map[uint64]*model.Sequence
+	steps             map[uint64]*model.Step
+	contacts          map[uint64]*model.Contact
+	enrollments       map[uint64]*model.Enrollment
+	mailboxes         map[uint64]*model.Mailbox
+	sequenceMailboxes map[uint64]map[uint64]bool
+	scheduledEmails   map[uint64]*model.ScheduledEmail
+	// Claim times of the emails being sent.
+	claimedEmails        map[uint64]time.Time
+	rescheduleJobs       map[rescheduleJobKey]*rescheduleJob
+	lastSequenceID       uint64
+	lastStepID           uint64
+	lastContactID        uint64
+	lastEnrollmentID     uint64
+	lastMailboxID        uint64
+	lastScheduledEmailID uint64
+}
+
+func NewStore() *MemoryStore {
+	return &MemoryStore{
+		sequences:         make(map[uint64]*model.Sequence),
+		steps:             make(map[uint64]*model.Step),
+		contacts:          make(map[uint64]*model.Contact),
+		enrollments:       make(map[uint64]*model.Enrollment),
+		mailboxes:         make(map[uint64]*model.Mailbox),
+		sequenceMailboxes: make(map[uint64]map[uint64]bool),
+		scheduledEmails:   make(map[uint64]*model.ScheduledEmail),
+		claimedEmails:     make(map[uint64]time.Time),
+		rescheduleJobs:    make(map[rescheduleJobKey]*rescheduleJob),
+	}
+}
+
+func (s *MemoryStore) CreateSequence(ctx context.Context, sequence *model.Sequence) error {
+	if len(sequence.Steps) > 0 && sequence.Steps[0].HasDelay() {
+		return model.ErrFirstStepDelay
+	}
+	sequence.ApplySendingWindowDefaults()
+	if err := sequence.ValidateSendingWindow(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := now()
+	s.lastSequenceID++
+	sequence.ID = s.lastSequenceID
+	sequence.Version = 1
+	sequence.CreatedAt = now
+	sequence.UpdatedAt = now
+	sequence.ArchivedAt = nil
+
+	s.sequences[sequence.ID] = copySequence(sequence)
+
+	if len(sequence.Steps) == 0 {
+		return nil
+	}
+
+	inserted := make([]*model.Step, len(sequence.Steps))
+	for i, step := range sequence.Steps {
+		s.lastStepID++
+		stored := &model.Step{
+			ID:         s.lastStepID,
+			SequenceID: sequence.ID,
+			Position:   i + 1,
+			WaitDays:   step.WaitDays,
+			WaitHours:  step.WaitHours,
+			Subject:    step.Subject,
+			Content:    step.Content,
+			Version:    1,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		s.steps[stored.ID] = stored
+		inserted[i] = copyStep(stored)
+	}
+	sequence.Steps = inserted
+
+	return nil
+}
+
+func (s *MemoryStore) FetchSequence(ctx context.Context, id uint64) (*model.Sequence, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.sequences[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	return s.withSteps(stored), nil
+}
+
+func (s *MemoryStore) ListSequences(ctx context.Context, params *model.ListSequencesParams) ([]*model.Sequence, *model.Cursor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	limit := model.PageLimit(params.Limit)
+	name := strings.ToLower(params.Name)
+	var matched []*model.Sequence
+	for _, sequence := range s.sequences {
+		if sequence.ArchivedAt != nil {
+			continue
+		}
+		if name != "" && !strings.Contains(strings.ToLower(sequence.Name), name) {
+			continue
+		}
+		if params.OpenTrackingEnabled != nil && sequence.OpenTrackingEnabled != *params.OpenTrackingEnabled {
+			continue
+		}
+		if params.ClickTrackingEnabled != nil && sequence.ClickTrackingEnabled != *params.ClickTrackingEnabled {
+			continue
+		}
+		matched = append(matched, sequence)
+	}
+
+	compare := func(a, b *model.Sequence) int {
+		return cmp.Compare(a.ID, b.ID)
+	}
+	var after *model.Sequence
+	if params.After != nil {
+		after = &model.Sequence{ID: params.After.ID, CreatedAt: params.After.CreatedAt}
+	}
+	if params.SortBy == model.SortByCreatedAt {
+		compare = func(a, b *model.Sequence) int {
+			if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.ID, b.ID)
+		}
+	}
+	if params.Descending {
+		ascending := compare
+		compare = func(a, b *model.Sequence) int {
+			return ascending(b, a)
+		}
+	}
+
+	slices.SortFunc(matched, compare)
+
+	sequences := make([]*model.Sequence, 0, len(matched))
+	for _, sequence := range matched {
+		if after != nil && compare(sequence, after) <= 0 {
+			continue
+		}
+		if uint64(len(sequences)) == limit {
+			last := sequences[len(sequences)-1]
+			return sequences, &model.Cursor{ID: last.ID, CreatedAt: last.CreatedAt}, nil
+		}
+		sequences = append(sequences, s.withSteps(sequence))
+	}
+
+	return sequences, nil, nil
+}
+
+func (s *MemoryStore) DeleteSequence(ctx context.Context, id uint64, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sequence, ok := s.sequences[id]
+	if !ok {
+		return model.ErrNotFound
+	}
+	if version != 0 && version != sequence.Version {
+		return model.ErrVersionMismatch
+	}
+
+	for _, step := range s.sequenceSteps(id) {
+		delete(s.steps, step.ID)
+	}
+	for _, enrollment := range s.enrollments {
+		if enrollment.SequenceID == id {
+			s.deleteEnrollment(enrollment.ID)
+		}
+	}
+	delete(s.sequenceMailboxes, id)
+	delete(s.rescheduleJobs, rescheduleJobKey{sequenceID: id, kind: model.RescheduleSteps})
+	delete(s.rescheduleJobs, rescheduleJobKey{sequenceID: id, kind: model.RebalanceMailboxes})
+	delete(s.sequences, id)
+
+	return nil
+}
+
+func (s *MemoryStore) ArchiveSequence(ctx context.Context, id uint64, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sequence, ok := s.sequences[id]
+	if !ok {
+		return model.ErrNotFound
+	}
+	if version != 0 && version != sequence.Version {
+		return model.ErrVersionMismatch
+	}
+
+	// Archiving twice is a no-op.
+	if sequence.ArchivedAt == nil {
+		archivedAt := now()
+		sequence.ArchivedAt = &archivedAt
+		sequence.Version++
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) UpdateSequence(ctx context.Context, id uint64, patch *model.SequencePatch) (*model.Sequence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.lockSequence(id)
+	if err != nil {
+		return nil, err
+	}
+	if patch.Version != 0 && patch.Version != stored.Version {
+		return nil, model.ErrVersionMismatch
+	}
+
+	sequence := copySequence(stored)
+	patch.Apply(sequence)
+	if err := sequence.ValidateSendingWindow(); err != nil {
+		return nil, err
+	}
+	sequence.Version++
+	sequence.UpdatedAt = now()
+	s.sequences[id] = sequence
+
+	return copySequence(sequence), nil
+}
+
+func (s *MemoryStore) CreateStep(ctx context.Context, step *model.Step) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sequence, err := s.lockSequence(step.SequenceID)
+	if err != nil {
+		return err
+	}
+
+	steps := s.sequenceSteps(step.SequenceID)
+	position := step.Position
+	if position < 1 || position > len(steps)+1 {
+		position = len(steps) + 1
+	}
+	if position == 1 && step.HasDelay() {
+		return model.ErrFirstStepDelay
+	}
+
+	// Make room for the new step by moving the following steps down.
+	for _, existing := range steps {
+		if existing.Position >= position {
+			existing.Position++
+			existing.Version++
+		}
+	}
+
+	now := now()
+	s.lastStepID++
+	stored := &model.Step{
+		ID:         s.lastStepID,
+		SequenceID: step.SequenceID,
+		Position:   position,
+		WaitDays:   step.WaitDays,
+		WaitHours:  step.WaitHours,
+		Subject:    step.Subject,
+		Content:    step.Content,
+		Version:    1,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	s.steps[stored.ID] = stored
+	*step = *copyStep(stored)
+	s.bumpSequenceVersion(sequence)
+	s.queueRescheduleJob(step.SequenceID, model.RescheduleSteps)
+
+	return nil
+}
+
+func (s *MemoryStore) ReorderSteps(ctx context.Context, sequenceID uint64, version int, stepIDs []uint64) (*model.Sequence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sequence, err := s.lockSequence(sequenceID)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && version != sequence.Version {
+		return nil, model.ErrVersionMismatch
+	}
+
+	steps := s.sequenceSteps(sequenceID)
+	if len(stepIDs) == 0 || len(stepIDs) != len(steps) {
+		return nil, model.ErrInvalidStepOrder
+	}
+	positions := make(map[uint64]int, len(stepIDs))
+	for i, id := range stepIDs {
+		step, ok := s.steps[id]
+		if !ok || step.SequenceID != sequenceID {
+			return nil, model.ErrInvalidStepOrder
+		}
+		if _, seen := positions[id]; seen {
+			return nil, model.ErrInvalidStepOrder
+		}
+		positions[id] = i + 1
+	}
+
+	// Whichever step ends up first loses its delay.
+	now := now()
+	for _, step := range steps {
+		step.Position = positions[step.ID]
+		if step.Position == 1 {
+			step.WaitDays, step.WaitHours = 0, 0
+		}
+		step.Version++
+		step.UpdatedAt = now
+	}
+	s.bumpSequenceVersion(sequence)
+	s.queueRescheduleJob(sequenceID, model.RescheduleSteps)
+
+	return s.withSteps(sequence), nil
+}
+
+func (s *MemoryStore) UpdateStep(ctx context.Context, id uint64, step *model.Step) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sequence, err := s.lockSequence(step.SequenceID)
+	if err != nil {
+		return err
+	}
+
+	stored, ok := s.steps[id]
+	if !ok || stored.SequenceID != step.SequenceID {
+		return model.ErrNotFound
+	}
+	if step.Version != 0 && step.Version != stored.Version {
+		return model.ErrVersionMismatch
+	}
+	if stored.Position == 1 && step.HasDelay() {
+		return model.ErrFirstStepDelay
+	}
+
+	stored.Subject = step.Subject
+	stored.Content = step.Content
+	stored.WaitDays = step.WaitDays
+	stored.WaitHours = step.WaitHours
+	stored.Version++
+	stored.UpdatedAt = now()
+	*step = *copyStep(stored)
+	s.bumpSequenceVersion(sequence)
+	s.queueRescheduleJob(step.SequenceID, model.RescheduleSteps)
+
+	return nil
+}
+
+func (s *MemoryStore) DeleteStep(ctx context.Context, id uint64, step *model.Step) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sequence, err := s.lockSequence(step.SequenceID)
+	if err != nil {
+		return err
+	}
+
+	stored, ok := s.steps[id]
+	if !ok || stored.SequenceID != step.SequenceID {
+		return model.ErrNotFound
+	}
+	if step.Version != 0 && step.Version != stored.Version {
+		return model.ErrVersionMismatch
+	}
+	// Emails of the step are kept, only the pending ones are canceled.
+	now := now()
+	delete(s.steps, id)
+	for _, email := range s.scheduledEmails {
+		if email.StepID == nil || *email.StepID != id {
+			continue
+		}
+		email.StepID = nil
+		if email.Status == model.ScheduledEmailPending {
+			email.Status = model.ScheduledEmailCanceled
+			email.UpdatedAt = now
+		}
+	}
+	for _, enrollment := range s.enrollments {
+		if enrollment.CurrentStepID != nil && *enrollment.CurrentStepID == id {
+			enrollment.CurrentStepID = nil
+		}
+	}
+
+	// Close the gap left by the deleted step. The step that becomes first
+	// is sent right away, so its delay is dropped.
+	for _, following := range s.sequenceSteps(step.SequenceID) {
+		if following.Position < stored.Position {
+			continue
+		}
+		following.Position--
+		if following.Position == 1 {
+			following.WaitDays, following.WaitHours = 0, 0
+		}
+		following.Version++
+	}
+	s.bumpSequenceVersion(sequence)
+	s.queueRescheduleJob(step.SequenceID, model.RescheduleSteps)
+
+	return nil
+}
+
+// bumpSequenceVersion marks a change of the sequence steps, so that the
+// sequence ETag changes with them. The caller must hold the write lock.
+func (s *MemoryStore) bumpSequenceVersion(sequence *model.Sequence) {
+	sequence.Version++
+	sequence.UpdatedAt = now()
+}
+
+// lockSequence returns the stored sequence and makes sure it has not been
+// archived. The caller must hold the write lock.
+func (s *MemoryStore) lockSequence(id uint64) (*model.Sequence, error) {
+	sequence, ok := s.sequences[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	if sequence.ArchivedAt != nil {
+		return nil, model.ErrSequenceArchived
+	}
+	return sequence, nil
+}
+
+// sequenceSteps returns the stored steps of a sequence ordered by position.
+func (s *MemoryStore) sequenceSteps(sequenceID uint64) []*model.Step {
+	var steps []*model.Step
+	for _, step := range s.steps {
+		if step.SequenceID == sequenceID {
+			steps = append(steps, step)
+		}
+	}
+	slices.SortFunc(steps, func(a, b *model.Step) int {
+		return a.Position - b.Position
+	})
+	return steps
+}
+
+// withSteps returns a copy of the stored sequence with copies of its steps.
+func (s *MemoryStore) withSteps(stored *model.Sequence) *model.Sequence {
+	sequence := copySequence(stored)
+	for _, step := range s.sequenceSteps(stored.ID) {
+		sequence.Steps = append(sequence.Steps, copyStep(step))
+	}
+	return sequence
+}
+
+func copySequence(sequence *model.Sequence) *model.Sequence {
+	c := *sequence
+	c.Weekdays = slices.Clone(sequence.Weekdays)
+	if sequence.ArchivedAt != nil {
+		archivedAt := *sequence.ArchivedAt
+		c.ArchivedAt = &archivedAt
+	}
+	c.Steps = nil
+	return &c
+}
+
+func copyStep(step *model.Step) *model.Step {
+	c := *step
+	return &c
+}
+
+// now returns the current time with the precision Postgres keeps.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
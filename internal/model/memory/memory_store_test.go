@@ -0,0 +1,106 @@
+package memory_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/model/memory"
+	"github.com/danikarik/salesforge/internal/model/storetest"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSequence() *model.Sequence {
+	return &model.Sequence{
+		Name:                 "Test Sequence",
+		OpenTrackingEnabled:  true,
+		ClickTrackingEnabled: true,
+		Steps: []*model.Step{
+			{
+				Subject: "Step 1 Subject",
+				Content: "Step 1 Content",
+			},
+			{
+				Subject:  "Step 2 Subject",
+				Content:  "Step 2 Content",
+				WaitDays: 2,
+			},
+		},
+	}
+}
+
+func TestCreateSequence(t *testing.T) {
+	ctx := t.Context()
+	store := memory.NewStore()
+
+	sequence := newTestSequence()
+	err := store.CreateSequence(ctx, sequence)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), sequence.ID)
+	require.Equal(t, 1, sequence.Version)
+	require.False(t, sequence.CreatedAt.IsZero())
+	require.Equal(t, model.DefaultTimezone, sequence.Timezone)
+	require.Len(t, sequence.Steps, 2)
+	require.Equal(t, 2, sequence.Steps[1].Position)
+
+	fetchedSequence, err := store.FetchSequence(ctx, sequence.ID)
+	require.NoError(t, err)
+	require.Equal(t, sequence, fetchedSequence)
+}
+
+func TestFetchSequenceReturnsCopy(t *testing.T) {
+	ctx := t.Context()
+	store := memory.NewStore()
+
+	sequence := newTestSequence()
+	err := store.CreateSequence(ctx, sequence)
+	require.NoError(t, err)
+
+	fetchedSequence, err := store.FetchSequence(ctx, sequence.ID)
+	require.NoError(t, err)
+	fetchedSequence.Name = "Changed"
+	fetchedSequence.Steps[0].Subject = "Changed"
+
+	fetchedSequence, err = store.FetchSequence(ctx, sequence.ID)
+	require.NoError(t, err)
+	require.Equal(t, "Test Sequence", fetchedSequence.Name)
+	require.Equal(t, "Step 1 Subject", fetchedSequence.Steps[0].Subject)
+}
+
+func TestConcurrentCreateStep(t *testing.T) {
+	ctx := t.Context()
+	store := memory.NewStore()
+
+	sequence := newTestSequence()
+	err := store.CreateSequence(ctx, sequence)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := store.CreateStep(ctx, &model.Step{
+				SequenceID: sequence.ID,
+				Subject:    "Subject",
+				Content:    "Content",
+				WaitHours:  1,
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	fetchedSequence, err := store.FetchSequence(ctx, sequence.ID)
+	require.NoError(t, err)
+	require.Len(t, fetchedSequence.Steps, 52)
+	for i, step := range fetchedSequence.Steps {
+		require.Equal(t, i+1, step.Position, "Expected positions without gaps")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storetest.RunConformance(t, func(t *testing.T) model.Store {
+		return memory.NewStore()
+	})
+}
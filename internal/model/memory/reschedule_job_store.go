@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+type rescheduleJobKey struct {
+	sequenceID uint64
+	kind       model.RescheduleJobKind
+}
+
+type rescheduleJob struct {
+	model.RescheduleJob
+	claimedAt *time.Time
+}
+
+func (s *MemoryStore) ClaimRescheduleJob(ctx context.Context, now time.Time, lease time.Duration) (*model.RescheduleJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now = now.UTC().Truncate(time.Microsecond)
+	var claimed *rescheduleJob
+	for _, job := range s.rescheduleJobs {
+		if job.claimedAt != nil && job.claimedAt.After(now.Add(-lease)) {
+			continue
+		}
+		if claimed == nil || compareRescheduleJobs(job, claimed) < 0 {
+			claimed = job
+		}
+	}
+	if claimed == nil {
+		return nil, nil
+	}
+
+	claimed.claimedAt = &now
+	job := claimed.RescheduleJob
+	return &job, nil
+}
+
+func (s *MemoryStore) FinishRescheduleJob(ctx context.Context, job *model.RescheduleJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := rescheduleJobKey{sequenceID: job.SequenceID, kind: job.Kind}
+	stored, ok := s.rescheduleJobs[key]
+	if !ok {
+		return nil
+	}
+	if stored.Version == job.Version {
+		delete(s.rescheduleJobs, key)
+		return nil
+	}
+
+	// The job was queued again while it ran.
+	stored.claimedAt = nil
+	return nil
+}
+
+// queueRescheduleJob queues the sequence for the rescheduler, or bumps the
+// version of its queued job so that a run in progress goes once more. The
+// caller must hold the write lock.
+func (s *MemoryStore) queueRescheduleJob(sequenceID uint64, kind model.RescheduleJobKind) {
+	key := rescheduleJobKey{sequenceID: sequenceID, kind: kind}
+	if job, ok := s.rescheduleJobs[key]; ok {
+		job.Version++
+		return
+	}
+	s.rescheduleJobs[key] = &rescheduleJob{
+		RescheduleJob: model.RescheduleJob{SequenceID: sequenceID, Kind: kind, Version: 1, CreatedAt: now()},
+	}
+}
+
+// compareRescheduleJobs orders jobs by creation time, sequence and kind.
+func compareRescheduleJobs(a, b *rescheduleJob) int {
+	return cmp.Or(
+		a.CreatedAt.Compare(b.CreatedAt),
+		cmp.Compare(a.SequenceID, b.SequenceID),
+		cmp.Compare(a.Kind, b.Kind),
+	)
+}
@@ -0,0 +1,461 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+func (s *MemoryStore) ListScheduledEmails(ctx context.Context, enrollmentID uint64) ([]*model.ScheduledEmail, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.enrollments[enrollmentID]; !ok {
+		return nil, model.ErrNotFound
+	}
+
+	emails := []*model.ScheduledEmail{}
+	for _, email := range s.scheduledEmails {
+		if email.EnrollmentID == enrollmentID {
+			emails = append(emails, s.withSequence(email))
+		}
+	}
+	slices.SortFunc(emails, func(a, b *model.ScheduledEmail) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return emails, nil
+}
+
+func (s *MemoryStore) ListUnplannedEmails(ctx context.Context, until time.Time) ([]*model.ScheduledEmail, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	emails := []*model.ScheduledEmail{}
+	for _, email := range s.scheduledEmails {
+		if email.Status == model.ScheduledEmailPending && email.MailboxID == nil && email.SendAt.Before(until) {
+			emails = append(emails, s.withSequence(email))
+		}
+	}
+	slices.SortFunc(emails, func(a, b *model.ScheduledEmail) int {
+		return cmp.Or(a.SendAt.Compare(b.SendAt), cmp.Compare(a.ID, b.ID))
+	})
+
+	return emails, nil
+}
+
+func (s *MemoryStore) CountMailboxEmails(ctx context.Context, mailboxIDs []uint64, from, to time.Time) (map[uint64]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.countMailboxEmails(mailboxIDs, from, to), nil
+}
+
+func (s *MemoryStore) PlanScheduledEmails(ctx context.Context, plans []*model.ScheduledEmailPlan) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.planScheduledEmails(plans), nil
+}
+
+func (s *MemoryStore) PlanMailboxEmails(ctx context.Context, mailboxIDs []uint64, from, to time.Time, plan model.PlanFunc) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.planScheduledEmails(plan(s.countMailboxEmails(mailboxIDs, from, to))), nil
+}
+
+// countMailboxEmails counts the planned emails of the mailboxes within
+// [from, to). The caller must hold the lock.
+func (s *MemoryStore) countMailboxEmails(mailboxIDs []uint64, from, to time.Time) map[uint64]int {
+	counts := make(map[uint64]int)
+	for _, email := range s.scheduledEmails {
+		if email.MailboxID == nil || !slices.Contains(mailboxIDs, *email.MailboxID) {
+			continue
+		}
+		if !slices.Contains(model.PlannedEmailStatuses, email.Status) {
+			continue
+		}
+		if email.SendAt.Before(from) || !email.SendAt.Before(to) {
+			continue
+		}
+		counts[*email.MailboxID]++
+	}
+	return counts
+}
+
+// planScheduledEmails applies the plans to emails that are still pending
+// without a mailbox and returns their number. The caller must hold the write
+// lock.
+func (s *MemoryStore) planScheduledEmails(plans []*model.ScheduledEmailPlan) int {
+	now := now()
+	planned := 0
+	for _, plan := range plans {
+		email, ok := s.scheduledEmails[plan.ID]
+		if !ok || email.Status != model.ScheduledEmailPending || email.MailboxID != nil {
+			continue
+		}
+		if plan.MailboxID != nil {
+			mailboxID := *plan.MailboxID
+			email.MailboxID = &mailboxID
+		}
+		email.SendAt = plan.SendAt.UTC().Truncate(time.Microsecond)
+		email.UpdatedAt = now
+		planned++
+	}
+	return planned
+}
+
+func (s *MemoryStore) UnplanScheduledEmails(ctx context.Context, sequenceID uint64, after time.Time) ([]*model.ScheduledEmail, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := now()
+	emails := []*model.ScheduledEmail{}
+	for _, email := range s.scheduledEmails {
+		if email.Status != model.ScheduledEmailPending || email.MailboxID == nil || !email.SendAt.After(after) {
+			continue
+		}
+		if s.enrollments[email.EnrollmentID].SequenceID != sequenceID {
+			continue
+		}
+		emails = append(emails, s.withSequence(email))
+		email.MailboxID = nil
+		email.UpdatedAt = now
+	}
+	slices.SortFunc(emails, func(a, b *model.ScheduledEmail) int {
+		return cmp.Or(a.SendAt.Compare(b.SendAt), cmp.Compare(a.ID, b.ID))
+	})
+
+	return emails, nil
+}
+
+func (s *MemoryStore) ClaimDueEmail(ctx context.Context, now time.Time, lease time.Duration) (*model.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now = now.UTC().Truncate(time.Microsecond)
+	var due *model.ScheduledEmail
+	for _, email := range s.scheduledEmails {
+		if email.MailboxID == nil || email.StepID == nil || email.SendAt.After(now) || s.enrollments[email.EnrollmentID].Status != model.EnrollmentActive {
+			continue
+		}
+		switch email.Status {
+		case model.ScheduledEmailPending:
+		case model.ScheduledEmailSending:
+			if s.claimedEmails[email.ID].After(now.Add(-lease)) {
+				continue
+			}
+		default:
+			continue
+		}
+		if due == nil || cmp.Or(email.SendAt.Compare(due.SendAt), cmp.Compare(email.ID, due.ID)) < 0 {
+			due = email
+		}
+	}
+	if due == nil {
+		return nil, nil
+	}
+	due.Status = model.ScheduledEmailSending
+	due.UpdatedAt = now
+	s.claimedEmails[due.ID] = now
+
+	enrollment := s.enrollments[due.EnrollmentID]
+	return &model.Delivery{
+		Email:    s.withSequence(due),
+		Mailbox:  copyMailbox(s.mailboxes[*due.MailboxID]),
+		Contact:  copyContact(s.contacts[enrollment.ContactID]),
+		Step:     copyStep(s.steps[*due.StepID]),
+		Sequence: copySequence(s.sequences[enrollment.SequenceID]),
+	}, nil
+}
+
+func (s *MemoryStore) FinishDelivery(ctx context.Context, id uint64, result *model.DeliveryResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email, ok := s.scheduledEmails[id]
+	if !ok || email.Status != model.ScheduledEmailSending {
+		return nil
+	}
+	delete(s.claimedEmails, id)
+
+	now := now()
+	email.UpdatedAt = now
+	if !result.SentAt.IsZero() {
+		sentAt := result.SentAt.UTC().Truncate(time.Microsecond)
+		email.Status = model.ScheduledEmailSent
+		email.SentAt = &sentAt
+		s.scheduleNextStep(email, sentAt)
+		return nil
+	}
+
+	email.Error = result.Error
+	email.Attempts++
+	enrollment := s.enrollments[email.EnrollmentID]
+	if !result.RetryAt.IsZero() {
+		// A paused enrollment keeps the time as canceled, resuming plans the
+		// step no earlier.
+		email.Status = model.ScheduledEmailCanceled
+		email.SendAt = result.RetryAt.UTC().Truncate(time.Microsecond)
+		if enrollment.Status == model.EnrollmentActive {
+			window, _ := s.sequences[enrollment.SequenceID].SendingWindow()
+			email.Status = model.ScheduledEmailPending
+			email.SendAt = window.Next(email.SendAt).Truncate(time.Microsecond)
+		}
+		return nil
+	}
+	email.Status = model.ScheduledEmailFailed
+	switch {
+	case result.Rejected && enrollment.Status.CanTransition(model.EnrollmentBounced):
+		s.transition(enrollment, model.EnrollmentBounced, nil, now)
+	case !result.Rejected && enrollment.Status == model.EnrollmentActive:
+		s.transition(enrollment, model.EnrollmentPaused, nil, now)
+	}
+
+	return nil
+}
+
+// scheduleNextStep moves the enrollment of a sent email to the first step it
+// has not been sent yet and schedules it, or completes the enrollment when
+// every step has been sent. Enrollments paused while the email was sent move
+// on without an email, resuming schedules the step. The caller must hold the
+// write lock.
+func (s *MemoryStore) scheduleNextStep(email *model.ScheduledEmail, sentAt time.Time) {
+	enrollment := s.enrollments[email.EnrollmentID]
+	if enrollment.Status.Final() {
+		return
+	}
+
+	now := now()
+	next := model.NextStep(s.sequenceSteps(enrollment.SequenceID), s.progress(enrollment).Sent)
+	if next == nil {
+		s.transition(enrollment, model.EnrollmentCompleted, nil, now)
+		return
+	}
+	stepID := next.ID
+	enrollment.CurrentStepID = &stepID
+	enrollment.UpdatedAt = now
+	if enrollment.Status != model.EnrollmentActive {
+		return
+	}
+
+	window, _ := s.sequences[enrollment.SequenceID].SendingWindow()
+	capacity := 0
+	for mailboxID := range s.sequenceMailboxes[enrollment.SequenceID] {
+		capacity += s.mailboxes[mailboxID].DailyCapacity
+	}
+	sendAt, _ := window.NextFreeSlot(next.DueAfter(sentAt), capacity, func(from, to time.Time) (int, error) {
+		return s.countPlannedEmails(enrollment.SequenceID, from, to), nil
+	})
+
+	s.insertEmail(enrollment.ID, next.ID, sendAt, now)
+}
+
+func (s *MemoryStore) RescheduleEnrollments(ctx context.Context, sequenceID, after uint64, limit int, now time.Time) (*model.RescheduleResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sequence, ok := s.sequences[sequenceID]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	window, err := sequence.SendingWindow()
+	if err != nil {
+		return nil, err
+	}
+
+	var enrollments []*model.Enrollment
+	for _, enrollment := range s.enrollments {
+		if enrollment.SequenceID == sequenceID && enrollment.ID > after &&
+			(enrollment.Status == model.EnrollmentActive || enrollment.Status == model.EnrollmentPaused) {
+			enrollments = append(enrollments, enrollment)
+		}
+	}
+	slices.SortFunc(enrollments, func(a, b *model.Enrollment) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	if len(enrollments) > limit {
+		enrollments = enrollments[:limit]
+	}
+
+	steps := s.sequenceSteps(sequenceID)
+	now = now.UTC().Truncate(time.Microsecond)
+	result := &model.RescheduleResult{}
+	for _, enrollment := range enrollments {
+		result.LastID = enrollment.ID
+		replan := s.progress(enrollment).Replan(steps, window, now)
+		if replan == nil {
+			continue
+		}
+
+		if replan.CancelID != 0 {
+			email := s.scheduledEmails[replan.CancelID]
+			email.Status = model.ScheduledEmailCanceled
+			email.UpdatedAt = now
+		}
+		if replan.Complete {
+			s.transition(enrollment, model.EnrollmentCompleted, nil, now)
+			result.Completed++
+			continue
+		}
+		enrollment.CurrentStepID = nil
+		if replan.Step != nil {
+			stepID := replan.Step.ID
+			enrollment.CurrentStepID = &stepID
+		}
+		enrollment.UpdatedAt = now
+		if !replan.SendAt.IsZero() {
+			s.insertEmail(enrollment.ID, replan.Step.ID, replan.SendAt, now)
+		}
+		result.Rescheduled++
+	}
+
+	return result, nil
+}
+
+// progress returns what has been sent to the enrollment and its pending
+// email or the one being sent. The caller must hold the lock.
+func (s *MemoryStore) progress(enrollment *model.Enrollment) *model.Progress {
+	progress := &model.Progress{
+		Enrollment: enrollment,
+		Sent:       make(map[uint64]time.Time),
+	}
+	for _, email := range s.scheduledEmails {
+		if email.EnrollmentID != enrollment.ID {
+			continue
+		}
+		switch email.Status {
+		case model.ScheduledEmailSent:
+			if email.SentAt.After(progress.LastSent) {
+				progress.LastSent = *email.SentAt
+			}
+			if email.StepID == nil {
+				continue
+			}
+			if sentAt, ok := progress.Sent[*email.StepID]; !ok || email.SentAt.After(sentAt) {
+				progress.Sent[*email.StepID] = *email.SentAt
+			}
+		case model.ScheduledEmailPending, model.ScheduledEmailSending:
+			progress.Pending = email
+		}
+	}
+	return progress
+}
+
+// countPlannedEmails returns the number of emails planned within [from, to)
+// that take up the capacity of the sequence mailboxes: the pending, sending
+// and sent emails of the mailboxes and the pending emails of the sequence
+// waiting for a mailbox. The caller must hold the lock.
+func (s *MemoryStore) countPlannedEmails(sequenceID uint64, from, to time.Time) int {
+	count := 0
+	for _, email := range s.scheduledEmails {
+		if email.SendAt.Before(from) || !email.SendAt.Before(to) {
+			continue
+		}
+		if email.MailboxID == nil {
+			if email.Status == model.ScheduledEmailPending && s.enrollments[email.EnrollmentID].SequenceID == sequenceID {
+				count++
+			}
+			continue
+		}
+		if s.sequenceMailboxes[sequenceID][*email.MailboxID] && slices.Contains(model.PlannedEmailStatuses, email.Status) {
+			count++
+		}
+	}
+	return count
+}
+
+// scheduleEmail queues a pending email for the current step of the
+// enrollment. It is sent at the next slot of the window after the later of
+// now and the time the step was planned for before the enrollment was
+// paused. Enrollments without a current step are skipped, and so are
+// enrollments with an email being sent, finishing it schedules the next step.
+// The caller must hold the write lock.
+func (s *MemoryStore) scheduleEmail(enrollment *model.Enrollment, window *model.SendingWindow, now time.Time) {
+	if enrollment.CurrentStepID == nil {
+		return
+	}
+
+	sendAt := now
+	for _, email := range s.scheduledEmails {
+		if email.EnrollmentID != enrollment.ID {
+			continue
+		}
+		if email.Status == model.ScheduledEmailSending {
+			return
+		}
+		if email.StepID != nil && *email.StepID == *enrollment.CurrentStepID &&
+			email.Status == model.ScheduledEmailCanceled &&
+			email.SendAt.After(sendAt) {
+			sendAt = email.SendAt
+		}
+	}
+
+	s.insertEmail(enrollment.ID, *enrollment.CurrentStepID, window.Next(sendAt), now)
+}
+
+// insertEmail stores a pending email of the step. The caller must hold the
+// write lock.
+func (s *MemoryStore) insertEmail(enrollmentID, stepID uint64, sendAt, now time.Time) {
+	s.lastScheduledEmailID++
+	s.scheduledEmails[s.lastScheduledEmailID] = &model.ScheduledEmail{
+		ID:           s.lastScheduledEmailID,
+		EnrollmentID: enrollmentID,
+		StepID:       &stepID,
+		SendAt:       sendAt.Truncate(time.Microsecond),
+		Status:       model.ScheduledEmailPending,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+}
+
+// cancelEmails cancels the pending email of the enrollment. The caller must
+// hold the write lock.
+func (s *MemoryStore) cancelEmails(enrollmentID uint64, now time.Time) {
+	for _, email := range s.scheduledEmails {
+		if email.EnrollmentID == enrollmentID && email.Status == model.ScheduledEmailPending {
+			email.Status = model.ScheduledEmailCanceled
+			email.UpdatedAt = now
+		}
+	}
+}
+
+// deleteEnrollment deletes the enrollment with its scheduled emails. The
+// caller must hold the write lock.
+func (s *MemoryStore) deleteEnrollment(id uint64) {
+	for _, email := range s.scheduledEmails {
+		if email.EnrollmentID == id {
+			delete(s.scheduledEmails, email.ID)
+		}
+	}
+	delete(s.enrollments, id)
+}
+
+// withSequence returns a copy of the email with the sequence of its
+// enrollment. The caller must hold the lock.
+func (s *MemoryStore) withSequence(email *model.ScheduledEmail) *model.ScheduledEmail {
+	c := copyScheduledEmail(email)
+	c.SequenceID = s.enrollments[email.EnrollmentID].SequenceID
+	return c
+}
+
+func copyScheduledEmail(email *model.ScheduledEmail) *model.ScheduledEmail {
+	c := *email
+	if email.MailboxID != nil {
+		mailboxID := *email.MailboxID
+		c.MailboxID = &mailboxID
+	}
+	if email.StepID != nil {
+		stepID := *email.StepID
+		c.StepID = &stepID
+	}
+	if email.SentAt != nil {
+		sentAt := *email.SentAt
+		c.SentAt = &sentAt
+	}
+	return &c
+}
@@ -0,0 +1,66 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+func (m *MockStore) CreateContact(ctx context.Context, contact *model.Contact) error {
+	args := m.Called(ctx, contact)
+	return args.Error(0)
+}
+
+func (m *MockStore) FetchContact(ctx context.Context, id uint64) (*model.Contact, error) {
+	args := m.Called(ctx, id)
+
+	var contact *model.Contact
+	if args.Get(0) != nil {
+		contact = args.Get(0).(*model.Contact)
+	}
+
+	return contact, args.Error(1)
+}
+
+func (m *MockStore) ListContacts(ctx context.Context, params *model.ListContactsParams) ([]*model.Contact, *model.Cursor, error) {
+	args := m.Called(ctx, params)
+
+	var contacts []*model.Contact
+	if args.Get(0) != nil {
+		contacts = args.Get(0).([]*model.Contact)
+	}
+
+	var cursor *model.Cursor
+	if args.Get(1) != nil {
+		cursor = args.Get(1).(*model.Cursor)
+	}
+
+	return contacts, cursor, args.Error(2)
+}
+
+func (m *MockStore) UpdateContact(ctx context.Context, id uint64, patch *model.ContactPatch) (*model.Contact, error) {
+	args := m.Called(ctx, id, patch)
+
+	var contact *model.Contact
+	if args.Get(0) != nil {
+		contact = args.Get(0).(*model.Contact)
+	}
+
+	return contact, args.Error(1)
+}
+
+func (m *MockStore) DeleteContact(ctx context.Context, id uint64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockStore) ImportContacts(ctx context.Context, batch *model.ContactImport) ([]model.ImportStatus, error) {
+	args := m.Called(ctx, batch)
+
+	var statuses []model.ImportStatus
+	if args.Get(0) != nil {
+		statuses = args.Get(0).([]model.ImportStatus)
+	}
+
+	return statuses, args.Error(1)
+}
@@ -0,0 +1,46 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+func (m *MockStore) CreateEnrollments(ctx context.Context, sequenceID, firstStepID uint64, contactIDs []uint64, now time.Time) ([]*model.Enrollment, error) {
+	args := m.Called(ctx, sequenceID, firstStepID, contactIDs, now)
+
+	var enrollments []*model.Enrollment
+	if args.Get(0) != nil {
+		enrollments = args.Get(0).([]*model.Enrollment)
+	}
+
+	return enrollments, args.Error(1)
+}
+
+func (m *MockStore) FetchEnrollment(ctx context.Context, id uint64) (*model.Enrollment, error) {
+	args := m.Called(ctx, id)
+
+	var enrollment *model.Enrollment
+	if args.Get(0) != nil {
+		enrollment = args.Get(0).(*model.Enrollment)
+	}
+
+	return enrollment, args.Error(1)
+}
+
+func (m *MockStore) TransitionEnrollment(ctx context.Context, id uint64, status model.EnrollmentStatus, now time.Time) (*model.Enrollment, error) {
+	args := m.Called(ctx, id, status, now)
+
+	var enrollment *model.Enrollment
+	if args.Get(0) != nil {
+		enrollment = args.Get(0).(*model.Enrollment)
+	}
+
+	return enrollment, args.Error(1)
+}
+
+func (m *MockStore) TransitionEnrollments(ctx context.Context, sequenceID uint64, status model.EnrollmentStatus, now time.Time) (int, error) {
+	args := m.Called(ctx, sequenceID, status, now)
+	return args.Int(0), args.Error(1)
+}
@@ -0,0 +1,76 @@
+package mock
+
+import (
+	"context"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+func (m *MockStore) CreateMailbox(ctx context.Context, mailbox *model.Mailbox) error {
+	args := m.Called(ctx, mailbox)
+	return args.Error(0)
+}
+
+func (m *MockStore) FetchMailbox(ctx context.Context, id uint64) (*model.Mailbox, error) {
+	args := m.Called(ctx, id)
+
+	var mailbox *model.Mailbox
+	if args.Get(0) != nil {
+		mailbox = args.Get(0).(*model.Mailbox)
+	}
+
+	return mailbox, args.Error(1)
+}
+
+func (m *MockStore) ListMailboxes(ctx context.Context, params *model.ListMailboxesParams) ([]*model.Mailbox, *model.Cursor, error) {
+	args := m.Called(ctx, params)
+
+	var mailboxes []*model.Mailbox
+	if args.Get(0) != nil {
+		mailboxes = args.Get(0).([]*model.Mailbox)
+	}
+
+	var cursor *model.Cursor
+	if args.Get(1) != nil {
+		cursor = args.Get(1).(*model.Cursor)
+	}
+
+	return mailboxes, cursor, args.Error(2)
+}
+
+func (m *MockStore) UpdateMailbox(ctx context.Context, id uint64, patch *model.MailboxPatch) (*model.Mailbox, error) {
+	args := m.Called(ctx, id, patch)
+
+	var mailbox *model.Mailbox
+	if args.Get(0) != nil {
+		mailbox = args.Get(0).(*model.Mailbox)
+	}
+
+	return mailbox, args.Error(1)
+}
+
+func (m *MockStore) DeleteMailbox(ctx context.Context, id uint64) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockStore) AttachMailbox(ctx context.Context, sequenceID, mailboxID uint64) error {
+	args := m.Called(ctx, sequenceID, mailboxID)
+	return args.Error(0)
+}
+
+func (m *MockStore) DetachMailbox(ctx context.Context, sequenceID, mailboxID uint64) error {
+	args := m.Called(ctx, sequenceID, mailboxID)
+	return args.Error(0)
+}
+
+func (m *MockStore) ListSequenceMailboxes(ctx context.Context, sequenceID uint64) ([]*model.Mailbox, error) {
+	args := m.Called(ctx, sequenceID)
+
+	var mailboxes []*model.Mailbox
+	if args.Get(0) != nil {
+		mailboxes = args.Get(0).([]*model.Mailbox)
+	}
+
+	return mailboxes, args.Error(1)
+}
@@ -7,7 +7,7 @@ import (
 	mocky "github.com/stretchr/testify/mock"
 )
 
-var _ model.SequenceStore = (*MockStore)(nil)
+var _ model.Store = (*MockStore)(nil)
 
 type MockStore struct {
 	mocky.Mock
@@ -29,11 +29,59 @@ func (m *MockStore) FetchSequence(ctx context.Context, id uint64) (*model.Sequen
 	return sequence, args.Error(1)
 }
 
-func (m *MockStore) UpdateSequence(ctx context.Context, id uint64, sequence *model.Sequence) error {
-	args := m.Called(ctx, id, sequence)
+func (m *MockStore) ListSequences(ctx context.Context, params *model.ListSequencesParams) ([]*model.Sequence, *model.Cursor, error) {
+	args := m.Called(ctx, params)
+
+	var sequences []*model.Sequence
+	if args.Get(0) != nil {
+		sequences = args.Get(0).([]*model.Sequence)
+	}
+
+	var cursor *model.Cursor
+	if args.Get(1) != nil {
+		cursor = args.Get(1).(*model.Cursor)
+	}
+
+	return sequences, cursor, args.Error(2)
+}
+
+func (m *MockStore) DeleteSequence(ctx context.Context, id uint64, version int) error {
+	args := m.Called(ctx, id, version)
+	return args.Error(0)
+}
+
+func (m *MockStore) ArchiveSequence(ctx context.Context, id uint64, version int) error {
+	args := m.Called(ctx, id, version)
+	return args.Error(0)
+}
+
+func (m *MockStore) UpdateSequence(ctx context.Context, id uint64, patch *model.SequencePatch) (*model.Sequence, error) {
+	args := m.Called(ctx, id, patch)
+
+	var sequence *model.Sequence
+	if args.Get(0) != nil {
+		sequence = args.Get(0).(*model.Sequence)
+	}
+
+	return sequence, args.Error(1)
+}
+
+func (m *MockStore) CreateStep(ctx context.Context, step *model.Step) error {
+	args := m.Called(ctx, step)
 	return args.Error(0)
 }
 
+func (m *MockStore) ReorderSteps(ctx context.Context, sequenceID uint64, version int, stepIDs []uint64) (*model.Sequence, error) {
+	args := m.Called(ctx, sequenceID, version, stepIDs)
+
+	var sequence *model.Sequence
+	if args.Get(0) != nil {
+		sequence = args.Get(0).(*model.Sequence)
+	}
+
+	return sequence, args.Error(1)
+}
+
 func (m *MockStore) UpdateStep(ctx context.Context, id uint64, step *model.Step) error {
 	args := m.Called(ctx, id, step)
 	return args.Error(0)
@@ -0,0 +1,24 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+func (m *MockStore) ClaimRescheduleJob(ctx context.Context, now time.Time, lease time.Duration) (*model.RescheduleJob, error) {
+	args := m.Called(ctx, now, lease)
+
+	var job *model.RescheduleJob
+	if args.Get(0) != nil {
+		job = args.Get(0).(*model.RescheduleJob)
+	}
+
+	return job, args.Error(1)
+}
+
+func (m *MockStore) FinishRescheduleJob(ctx context.Context, job *model.RescheduleJob) error {
+	args := m.Called(ctx, job)
+	return args.Error(0)
+}
@@ -0,0 +1,89 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+func (m *MockStore) ListScheduledEmails(ctx context.Context, enrollmentID uint64) ([]*model.ScheduledEmail, error) {
+	args := m.Called(ctx, enrollmentID)
+
+	var emails []*model.ScheduledEmail
+	if args.Get(0) != nil {
+		emails = args.Get(0).([]*model.ScheduledEmail)
+	}
+
+	return emails, args.Error(1)
+}
+
+func (m *MockStore) ListUnplannedEmails(ctx context.Context, until time.Time) ([]*model.ScheduledEmail, error) {
+	args := m.Called(ctx, until)
+
+	var emails []*model.ScheduledEmail
+	if args.Get(0) != nil {
+		emails = args.Get(0).([]*model.ScheduledEmail)
+	}
+
+	return emails, args.Error(1)
+}
+
+func (m *MockStore) CountMailboxEmails(ctx context.Context, mailboxIDs []uint64, from, to time.Time) (map[uint64]int, error) {
+	args := m.Called(ctx, mailboxIDs, from, to)
+
+	var counts map[uint64]int
+	if args.Get(0) != nil {
+		counts = args.Get(0).(map[uint64]int)
+	}
+
+	return counts, args.Error(1)
+}
+
+func (m *MockStore) PlanScheduledEmails(ctx context.Context, plans []*model.ScheduledEmailPlan) (int, error) {
+	args := m.Called(ctx, plans)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStore) PlanMailboxEmails(ctx context.Context, mailboxIDs []uint64, from, to time.Time, plan model.PlanFunc) (int, error) {
+	args := m.Called(ctx, mailboxIDs, from, to, plan)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStore) UnplanScheduledEmails(ctx context.Context, sequenceID uint64, after time.Time) ([]*model.ScheduledEmail, error) {
+	args := m.Called(ctx, sequenceID, after)
+
+	var emails []*model.ScheduledEmail
+	if args.Get(0) != nil {
+		emails = args.Get(0).([]*model.ScheduledEmail)
+	}
+
+	return emails, args.Error(1)
+}
+
+func (m *MockStore) ClaimDueEmail(ctx context.Context, now time.Time, lease time.Duration) (*model.Delivery, error) {
+	args := m.Called(ctx, now, lease)
+
+	var delivery *model.Delivery
+	if args.Get(0) != nil {
+		delivery = args.Get(0).(*model.Delivery)
+	}
+
+	return delivery, args.Error(1)
+}
+
+func (m *MockStore) FinishDelivery(ctx context.Context, id uint64, result *model.DeliveryResult) error {
+	args := m.Called(ctx, id, result)
+	return args.Error(0)
+}
+
+func (m *MockStore) RescheduleEnrollments(ctx context.Context, sequenceID, after uint64, limit int, now time.Time) (*model.RescheduleResult, error) {
+	args := m.Called(ctx, sequenceID, after, limit, now)
+
+	var result *model.RescheduleResult
+	if args.Get(0) != nil {
+		result = args.Get(0).(*model.RescheduleResult)
+	}
+
+	return result, args.Error(1)
+}
@@ -0,0 +1,364 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var contactColumns = []string{
+	"id",
+	"owner_id",
+	"email",
+	"first_name",
+	"last_name",
+	"company",
+	"timezone",
+	"custom_fields",
+	"created_at",
+	"updated_at",
+}
+
+func scanContact(row pgx.Row, contact *model.Contact) error {
+	return row.Scan(
+		&contact.ID,
+		&contact.OwnerID,
+		&contact.Email,
+		&contact.FirstName,
+		&contact.LastName,
+		&contact.Company,
+		&contact.Timezone,
+		&contact.CustomFields,
+		&contact.CreatedAt,
+		&contact.UpdatedAt,
+	)
+}
+
+func (s *PGStore) CreateContact(ctx context.Context, contact *model.Contact) (err error) {
+	defer translateError(&err)
+
+	contact.Normalize()
+	if err := contact.Validate(); err != nil {
+		return err
+	}
+
+	sql, args, err := s.builder.
+		Insert("contacts").
+		Columns("owner_id", "email", "first_name", "last_name", "company", "timezone", "custom_fields").
+		Values(
+			contact.OwnerID,
+			contact.Email,
+			contact.FirstName,
+			contact.LastName,
+			contact.Company,
+			contact.Timezone,
+			contact.CustomFields,
+		).
+		Suffix("RETURNING " + strings.Join(contactColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	return scanContact(s.pool.QueryRow(ctx, sql, args...), contact)
+}
+
+func (s *PGStore) FetchContact(ctx context.Context, id uint64) (_ *model.Contact, err error) {
+	defer translateError(&err)
+
+	sql, args, err := s.builder.
+		Select(contactColumns...).
+		From("contacts").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var contact model.Contact
+	if err := scanContact(s.pool.QueryRow(ctx, sql, args...), &contact); err != nil {
+		return nil, err
+	}
+
+	return &contact, nil
+}
+
+func (s *PGStore) ListContacts(ctx context.Context, params *model.ListContactsParams) (_ []*model.Contact, _ *model.Cursor, err error) {
+	defer translateError(&err)
+
+	limit := model.PageLimit(params.Limit)
+	query := s.builder.
+		Select(contactColumns...).
+		From("contacts").
+		OrderBy("id ASC").
+		Limit(limit + 1)
+	if params.After != nil {
+		query = query.Where(sq.Gt{"id": params.After.ID})
+	}
+	if params.OwnerID != 0 {
+		query = query.Where(sq.Eq{"owner_id": params.OwnerID})
+	}
+	if params.Email != "" {
+		query = query.Where(sq.ILike{"email": "%" + escapeLike(params.Email) + "%"})
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	contacts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*model.Contact, error) {
+		contact := &model.Contact{}
+		return contact, scanContact(row, contact)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *model.Cursor
+	if uint64(len(contacts)) > limit {
+		contacts = contacts[:limit]
+		last := contacts[len(contacts)-1]
+		next = &model.Cursor{ID: last.ID, CreatedAt: last.CreatedAt}
+	}
+
+	return contacts, next, nil
+}
+
+func (s *PGStore) UpdateContact(ctx context.Context, id uint64, patch *model.ContactPatch) (_ *model.Contact, err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := s.builder.
+		Select(contactColumns...).
+		From("contacts").
+		Where(sq.Eq{"id": id}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var contact model.Contact
+	if err := scanContact(tx.QueryRow(ctx, sql, args...), &contact); err != nil {
+		return nil, err
+	}
+	patch.Apply(&contact)
+	contact.Normalize()
+	if err := contact.Validate(); err != nil {
+		return nil, err
+	}
+
+	sql, args, err = s.builder.
+		Update("contacts").
+		Set("email", contact.Email).
+		Set("first_name", contact.FirstName).
+		Set("last_name", contact.LastName).
+		Set("company", contact.Company).
+		Set("timezone", contact.Timezone).
+		Set("custom_fields", contact.CustomFields).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": id}).
+		Suffix("RETURNING " + strings.Join(contactColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := scanContact(tx.QueryRow(ctx, sql, args...), &contact); err != nil {
+		return nil, err
+	}
+
+	return &contact, tx.Commit(ctx)
+}
+
+func (s *PGStore) DeleteContact(ctx context.Context, id uint64) (err error) {
+	defer translateError(&err)
+
+	sql, args, err := s.builder.
+		Delete("contacts").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	cmd, err := s.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// importAttempts is the number of times a contact import batch is tried when
+// contacts with its emails are created concurrently.
+const importAttempts = 3
+
+func (s *PGStore) ImportContacts(ctx context.Context, batch *model.ContactImport) (_ []model.ImportStatus, err error) {
+	defer translateError(&err)
+
+	// A contact created by a concurrent import after the batch looked up the
+	// existing ones fails the COPY. Another attempt finds it like any other
+	// existing contact, so its row is skipped or merged.
+	for attempt := 1; ; attempt++ {
+		statuses, err := s.importContacts(ctx, batch)
+		var pgErr *pgconn.PgError
+		if attempt < importAttempts && errors.As(err, &pgErr) && pgErr.ConstraintName == "contacts_owner_id_email_key" {
+			continue
+		}
+		return statuses, err
+	}
+}
+
+// importContacts imports the batch in one transaction. The batch contacts are
+// only filled with the stored ones once every statement succeeded, so that a
+// failed attempt can be retried with the same input.
+func (s *PGStore) importContacts(ctx context.Context, batch *model.ContactImport) ([]model.ImportStatus, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	emails := make([]string, len(batch.Contacts))
+	for i, contact := range batch.Contacts {
+		emails[i] = strings.ToLower(contact.Email)
+	}
+	existing, err := s.fetchContactsByEmail(ctx, tx, batch.OwnerID, emails, true)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]model.ImportStatus, len(batch.Contacts))
+	updates := &pgx.Batch{}
+	var createdEmails []string
+	var rows [][]any
+	for i, contact := range batch.Contacts {
+		stored, ok := existing[emails[i]]
+		if !ok {
+			statuses[i] = model.ImportCreated
+			createdEmails = append(createdEmails, emails[i])
+			rows = append(rows, []any{
+				batch.OwnerID,
+				contact.Email,
+				contact.FirstName,
+				contact.LastName,
+				contact.Company,
+				contact.Timezone,
+				contact.CustomFields,
+			})
+			continue
+		}
+
+		statuses[i] = model.ImportSkipped
+		if batch.UpdateExisting && stored.Merge(contact) {
+			statuses[i] = model.ImportUpdated
+
+			sql, args, err := s.builder.
+				Update("contacts").
+				Set("first_name", stored.FirstName).
+				Set("last_name", stored.LastName).
+				Set("company", stored.Company).
+				Set("timezone", stored.Timezone).
+				Set("custom_fields", stored.CustomFields).
+				Set("updated_at", sq.Expr("NOW()")).
+				Where(sq.Eq{"id": stored.ID}).
+				Suffix("RETURNING " + strings.Join(contactColumns, ", ")).
+				ToSql()
+			if err != nil {
+				return nil, err
+			}
+			updates.Queue(sql, args...).QueryRow(func(row pgx.Row) error {
+				return scanContact(row, stored)
+			})
+		}
+	}
+
+	if updates.Len() > 0 {
+		if err := tx.SendBatch(ctx, updates).Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(rows) > 0 {
+		_, err := tx.CopyFrom(ctx,
+			pgx.Identifier{"contacts"},
+			[]string{"owner_id", "email", "first_name", "last_name", "company", "timezone", "custom_fields"},
+			pgx.CopyFromRows(rows),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		// COPY does not return rows, so read back the generated columns.
+		inserted, err := s.fetchContactsByEmail(ctx, tx, batch.OwnerID, createdEmails, false)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(existing, inserted)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	for i, contact := range batch.Contacts {
+		*contact = *existing[emails[i]]
+	}
+
+	return statuses, nil
+}
+
+// fetchContactsByEmail returns the contacts of the owner keyed by their
+// lowercased email.
+func (s *PGStore) fetchContactsByEmail(ctx context.Context, tx pgx.Tx, ownerID uint64, emails []string, forUpdate bool) (map[string]*model.Contact, error) {
+	query := s.builder.
+		Select(contactColumns...).
+		From("contacts").
+		Where(sq.Eq{"owner_id": ownerID}).
+		Where("LOWER(email) = ANY(?)", emails)
+	if forUpdate {
+		query = query.Suffix("FOR UPDATE")
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	contacts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*model.Contact, error) {
+		contact := &model.Contact{}
+		return contact, scanContact(row, contact)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byEmail := make(map[string]*model.Contact, len(contacts))
+	for _, contact := range contacts {
+		byEmail[strings.ToLower(contact.Email)] = contact
+	}
+	return byEmail, nil
+}
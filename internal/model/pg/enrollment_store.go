@@ -0,0 +1,288 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+var enrollmentColumns = []string{
+	"id",
+	"sequence_id",
+	"contact_id",
+	"status",
+	"current_step_id",
+	"enrolled_at",
+	"completed_at",
+	"updated_at",
+}
+
+func scanEnrollment(row pgx.Row, enrollment *model.Enrollment) error {
+	return row.Scan(
+		&enrollment.ID,
+		&enrollment.SequenceID,
+		&enrollment.ContactID,
+		&enrollment.Status,
+		&enrollment.CurrentStepID,
+		&enrollment.EnrolledAt,
+		&enrollment.CompletedAt,
+		&enrollment.UpdatedAt,
+	)
+}
+
+// enrollmentChunkSize bounds the contacts stored by a single statement when
+// enrolling, all chunks are still committed together.
+const enrollmentChunkSize = 5000
+
+func (s *PGStore) CreateEnrollments(ctx context.Context, sequenceID, firstStepID uint64, contactIDs []uint64, now time.Time) (_ []*model.Enrollment, err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Locking the sequence keeps its steps in place until the enrollments
+	// are stored.
+	sequence, err := s.lockSequence(ctx, tx, sequenceID)
+	if err != nil {
+		return nil, err
+	}
+	window, err := sequence.SendingWindow()
+	if err != nil {
+		return nil, err
+	}
+
+	sql, args, err := s.builder.
+		Select("id").
+		From("steps").
+		Where(sq.Eq{"sequence_id": sequenceID}).
+		OrderBy("position ASC").
+		Limit(1).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var stepID uint64
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&stepID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrSequenceEmpty
+		}
+		return nil, err
+	}
+	if stepID != firstStepID {
+		return nil, model.ErrFirstStepChanged
+	}
+
+	contactIDs = slices.Compact(slices.Sorted(slices.Values(contactIDs)))
+	if len(contactIDs) == 0 {
+		return []*model.Enrollment{}, tx.Commit(ctx)
+	}
+
+	enrollments := make([]*model.Enrollment, 0, len(contactIDs))
+	for chunk := range slices.Chunk(contactIDs, enrollmentChunkSize) {
+		created, err := s.insertEnrollments(ctx, tx, sequenceID, firstStepID, chunk)
+		if err != nil {
+			return nil, err
+		}
+		enrollmentIDs := make([]uint64, len(created))
+		for i, enrollment := range created {
+			enrollmentIDs[i] = enrollment.ID
+		}
+		if err := s.scheduleEmails(ctx, tx, window, enrollmentIDs, now); err != nil {
+			return nil, err
+		}
+		enrollments = append(enrollments, created...)
+	}
+
+	return enrollments, tx.Commit(ctx)
+}
+
+// insertEnrollments stores active enrollments of the sorted contacts and
+// returns them in the same order.
+func (s *PGStore) insertEnrollments(ctx context.Context, tx pgx.Tx, sequenceID, firstStepID uint64, contactIDs []uint64) ([]*model.Enrollment, error) {
+	sql, args, err := s.builder.
+		Select("COUNT(*)").
+		From("contacts").
+		Where("id = ANY(?)", contactIDs).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var count int
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&count); err != nil {
+		return nil, err
+	}
+	if count != len(contactIDs) {
+		return nil, model.ErrUnknownContact
+	}
+
+	rows := make([][]any, len(contactIDs))
+	for i, contactID := range contactIDs {
+		rows[i] = []any{sequenceID, contactID, firstStepID}
+	}
+	if _, err := tx.CopyFrom(ctx,
+		pgx.Identifier{"enrollments"},
+		[]string{"sequence_id", "contact_id", "current_step_id"},
+		pgx.CopyFromRows(rows),
+	); err != nil {
+		return nil, err
+	}
+
+	// COPY does not return rows, so read back the generated columns.
+	sql, args, err = s.builder.
+		Select(enrollmentColumns...).
+		From("enrollments").
+		Where(sq.Eq{"sequence_id": sequenceID, "status": model.EnrollmentActive}).
+		Where("contact_id = ANY(?)", contactIDs).
+		OrderBy("contact_id ASC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	result, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(result, func(row pgx.CollectableRow) (*model.Enrollment, error) {
+		enrollment := &model.Enrollment{}
+		return enrollment, scanEnrollment(row, enrollment)
+	})
+}
+
+func (s *PGStore) FetchEnrollment(ctx context.Context, id uint64) (_ *model.Enrollment, err error) {
+	defer translateError(&err)
+
+	sql, args, err := s.builder.
+		Select(enrollmentColumns...).
+		From("enrollments").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var enrollment model.Enrollment
+	if err := scanEnrollment(s.pool.QueryRow(ctx, sql, args...), &enrollment); err != nil {
+		return nil, err
+	}
+
+	return &enrollment, nil
+}
+
+func (s *PGStore) TransitionEnrollment(ctx context.Context, id uint64, status model.EnrollmentStatus, now time.Time) (_ *model.Enrollment, err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := s.builder.
+		Select("sequence_id", "status").
+		From("enrollments").
+		Where(sq.Eq{"id": id}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		sequenceID uint64
+		current    model.EnrollmentStatus
+	)
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&sequenceID, &current); err != nil {
+		return nil, err
+	}
+	if !current.CanTransition(status) {
+		return nil, model.ErrInvalidTransition
+	}
+
+	sql, args, err = s.transitionQuery(status).
+		Where(sq.Eq{"id": id}).
+		Suffix("RETURNING " + strings.Join(enrollmentColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var enrollment model.Enrollment
+	if err := scanEnrollment(tx.QueryRow(ctx, sql, args...), &enrollment); err != nil {
+		return nil, err
+	}
+	if err := s.rescheduleEmails(ctx, tx, sequenceID, status, []uint64{id}, now); err != nil {
+		return nil, err
+	}
+
+	return &enrollment, tx.Commit(ctx)
+}
+
+func (s *PGStore) TransitionEnrollments(ctx context.Context, sequenceID uint64, status model.EnrollmentStatus, now time.Time) (_ int, err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.checkSequence(ctx, tx, sequenceID); err != nil {
+		return 0, err
+	}
+
+	sql, args, err := s.transitionQuery(status).
+		Where(sq.Eq{"sequence_id": sequenceID, "status": model.TransitionSources(status)}).
+		Suffix("RETURNING id").
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uint64])
+	if err != nil {
+		return 0, err
+	}
+	if err := s.rescheduleEmails(ctx, tx, sequenceID, status, ids, now); err != nil {
+		return 0, err
+	}
+
+	return len(ids), tx.Commit(ctx)
+}
+
+// rescheduleEmails updates the pending emails of enrollments that moved to
+// the status: resumed enrollments are scheduled again, the others no longer
+// send anything.
+func (s *PGStore) rescheduleEmails(ctx context.Context, tx pgx.Tx, sequenceID uint64, status model.EnrollmentStatus, enrollmentIDs []uint64, now time.Time) error {
+	if status != model.EnrollmentActive {
+		return s.cancelEmails(ctx, tx, enrollmentIDs)
+	}
+
+	window, err := s.sendingWindow(ctx, tx, sequenceID)
+	if err != nil {
+		return err
+	}
+	return s.scheduleEmails(ctx, tx, window, enrollmentIDs, now)
+}
+
+// transitionQuery returns the update moving enrollments to the status.
+func (s *PGStore) transitionQuery(status model.EnrollmentStatus) sq.UpdateBuilder {
+	query := s.builder.
+		Update("enrollments").
+		Set("status", status).
+		Set("updated_at", sq.Expr("NOW()"))
+	if status.Final() {
+		query = query.Set("completed_at", sq.Expr("NOW()"))
+	}
+	return query
+}
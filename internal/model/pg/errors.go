@@ -0,0 +1,81 @@
+package pg
+
+import (
+	"errors"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PostgreSQL error codes, see
+// https://www.postgresql.org/docs/current/errcodes-appendix.html.
+const (
+	codeNotNullViolation     = "23502"
+	codeForeignKeyViolation  = "23503"
+	codeUniqueViolation      = "23505"
+	codeCheckViolation       = "23514"
+	codeSerializationFailure = "40001"
+	codeDeadlockDetected     = "40P01"
+)
+
+// constraintErrors maps constraint names to the model errors reported when
+// they are violated.
+var constraintErrors = map[string]*model.Error{
+	"contacts_owner_id_email_key": model.ErrContactExists,
+	"enrollments_active_key":      model.ErrAlreadyEnrolled,
+	"mailboxes_user_id_email_key": model.ErrMailboxExists,
+}
+
+// constraintFields maps constraint names to the input fields they guard.
+var constraintFields = map[string]string{
+	"sequences_sending_window_check": "endTime",
+	"sequences_weekdays_check":       "weekdays",
+	"steps_wait_days_check":          "waitDays",
+	"steps_wait_hours_check":         "waitHours",
+	"steps_sequence_id_position_key": "position",
+	"mailboxes_daily_capacity_check": "dailyCapacity",
+	"mailboxes_smtp_port_check":      "smtpPort",
+}
+
+// translateError replaces the driver error pointed to by errp with its model
+// counterpart. It is meant to be deferred by exported store methods.
+func translateError(errp *error) {
+	if *errp != nil {
+		*errp = modelError(*errp)
+	}
+}
+
+// modelError returns the model counterpart of a driver error. Errors without
+// a counterpart are returned as is.
+func modelError(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	if constraintErr, ok := constraintErrors[pgErr.ConstraintName]; ok {
+		return constraintErr
+	}
+
+	field := constraintFields[pgErr.ConstraintName]
+	switch pgErr.Code {
+	case codeUniqueViolation:
+		return &model.Error{Kind: model.ErrUniqueViolation, Code: "unique_violation", Field: field, Message: model.ErrUniqueViolation.Error()}
+	case codeCheckViolation, codeNotNullViolation:
+		if field == "" {
+			field = pgErr.ColumnName
+		}
+		return &model.Error{Kind: model.ErrValidation, Code: "constraint_violation", Field: field, Message: "value violates a constraint"}
+	case codeForeignKeyViolation:
+		return &model.Error{Kind: model.ErrConflict, Code: "foreign_key_violation", Field: field, Message: "resource is referenced by or references a missing resource"}
+	case codeSerializationFailure, codeDeadlockDetected:
+		return &model.Error{Kind: model.ErrConflict, Code: "concurrent_update", Message: "resource is being modified concurrently, retry the request"}
+	}
+
+	return err
+}
@@ -0,0 +1,410 @@
+package pg
+
+import (
+	"context"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/secret"
+	"github.com/jackc/pgx/v5"
+)
+
+var mailboxColumns = []string{
+	"id",
+	"user_id",
+	"email",
+	"daily_capacity",
+	"smtp_host",
+	"smtp_port",
+	"smtp_username",
+	"smtp_password",
+	"created_at",
+	"updated_at",
+}
+
+// scanMailbox scans a mailbox and decrypts its SMTP password.
+func (s *PGStore) scanMailbox(row pgx.Row, mailbox *model.Mailbox) error {
+	var password string
+	if err := row.Scan(
+		&mailbox.ID,
+		&mailbox.UserID,
+		&mailbox.Email,
+		&mailbox.DailyCapacity,
+		&mailbox.SMTPHost,
+		&mailbox.SMTPPort,
+		&mailbox.SMTPUsername,
+		&password,
+		&mailbox.CreatedAt,
+		&mailbox.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	var err error
+	mailbox.SMTPPassword, err = s.secrets.Open(password)
+	return err
+}
+
+func (s *PGStore) collectMailboxes(rows pgx.Rows) ([]*model.Mailbox, error) {
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*model.Mailbox, error) {
+		mailbox := &model.Mailbox{}
+		return mailbox, s.scanMailbox(row, mailbox)
+	})
+}
+
+func (s *PGStore) CreateMailbox(ctx context.Context, mailbox *model.Mailbox) (err error) {
+	defer translateError(&err)
+
+	mailbox.Normalize()
+	if err := mailbox.Validate(); err != nil {
+		return err
+	}
+
+	sql, args, err := s.builder.
+		Insert("mailboxes").
+		Columns("user_id", "email", "daily_capacity", "smtp_host", "smtp_port", "smtp_username", "smtp_password").
+		Values(mailbox.UserID, mailbox.Email, mailbox.DailyCapacity, mailbox.SMTPHost, mailbox.SMTPPort, mailbox.SMTPUsername, s.secrets.Seal(mailbox.SMTPPassword)).
+		Suffix("RETURNING " + strings.Join(mailboxColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	return s.scanMailbox(s.pool.QueryRow(ctx, sql, args...), mailbox)
+}
+
+func (s *PGStore) FetchMailbox(ctx context.Context, id uint64) (_ *model.Mailbox, err error) {
+	defer translateError(&err)
+
+	sql, args, err := s.builder.
+		Select(mailboxColumns...).
+		From("mailboxes").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var mailbox model.Mailbox
+	if err := s.scanMailbox(s.pool.QueryRow(ctx, sql, args...), &mailbox); err != nil {
+		return nil, err
+	}
+
+	return &mailbox, nil
+}
+
+func (s *PGStore) ListMailboxes(ctx context.Context, params *model.ListMailboxesParams) (_ []*model.Mailbox, _ *model.Cursor, err error) {
+	defer translateError(&err)
+
+	limit := model.PageLimit(params.Limit)
+	query := s.builder.
+		Select(mailboxColumns...).
+		From("mailboxes").
+		OrderBy("id ASC").
+		Limit(limit + 1)
+	if params.After != nil {
+		query = query.Where(sq.Gt{"id": params.After.ID})
+	}
+	if params.UserID != 0 {
+		query = query.Where(sq.Eq{"user_id": params.UserID})
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	mailboxes, err := s.collectMailboxes(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *model.Cursor
+	if uint64(len(mailboxes)) > limit {
+		mailboxes = mailboxes[:limit]
+		last := mailboxes[len(mailboxes)-1]
+		next = &model.Cursor{ID: last.ID, CreatedAt: last.CreatedAt}
+	}
+
+	return mailboxes, next, nil
+}
+
+func (s *PGStore) UpdateMailbox(ctx context.Context, id uint64, patch *model.MailboxPatch) (_ *model.Mailbox, err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := s.builder.
+		Select(mailboxColumns...).
+		From("mailboxes").
+		Where(sq.Eq{"id": id}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var mailbox model.Mailbox
+	if err := s.scanMailbox(tx.QueryRow(ctx, sql, args...), &mailbox); err != nil {
+		return nil, err
+	}
+	patch.Apply(&mailbox)
+	mailbox.Normalize()
+	if err := mailbox.Validate(); err != nil {
+		return nil, err
+	}
+
+	sql, args, err = s.builder.
+		Update("mailboxes").
+		Set("email", mailbox.Email).
+		Set("daily_capacity", mailbox.DailyCapacity).
+		Set("smtp_host", mailbox.SMTPHost).
+		Set("smtp_port", mailbox.SMTPPort).
+		Set("smtp_username", mailbox.SMTPUsername).
+		Set("smtp_password", s.secrets.Seal(mailbox.SMTPPassword)).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": id}).
+		Suffix("RETURNING " + strings.Join(mailboxColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.scanMailbox(tx.QueryRow(ctx, sql, args...), &mailbox); err != nil {
+		return nil, err
+	}
+
+	return &mailbox, tx.Commit(ctx)
+}
+
+func (s *PGStore) DeleteMailbox(ctx context.Context, id uint64) (err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Sequences are locked before the mailbox, as attaching does, so the two
+	// never wait on each other.
+	sql, args, err := s.builder.
+		Select("s.id").
+		From("sequences s").
+		Join("sequence_mailboxes sm ON sm.sequence_id = s.id").
+		Where(sq.Eq{"sm.mailbox_id": id}).
+		OrderBy("s.id").
+		Suffix("FOR UPDATE OF s").
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return err
+	}
+
+	sql, args, err = s.builder.
+		Delete("sequence_mailboxes").
+		Where(sq.Eq{"mailbox_id": id}).
+		Suffix("RETURNING sequence_id").
+		ToSql()
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	sequenceIDs, err := pgx.CollectRows(rows, pgx.RowTo[uint64])
+	if err != nil {
+		return err
+	}
+
+	sql, args, err = s.builder.
+		Delete("mailboxes").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	cmd, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	for _, sequenceID := range sequenceIDs {
+		if err := s.queueRescheduleJob(ctx, tx, sequenceID, model.RebalanceMailboxes); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *PGStore) AttachMailbox(ctx context.Context, sequenceID, mailboxID uint64) (err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := s.lockSequence(ctx, tx, sequenceID); err != nil {
+		return err
+	}
+
+	sql, args, err := s.builder.
+		Select("1").
+		From("mailboxes").
+		Where(sq.Eq{"id": mailboxID}).
+		Suffix("FOR SHARE").
+		ToSql()
+	if err != nil {
+		return err
+	}
+	var exists int
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&exists); err != nil {
+		return err
+	}
+
+	sql, args, err = s.builder.
+		Insert("sequence_mailboxes").
+		Columns("sequence_id", "mailbox_id").
+		Values(sequenceID, mailboxID).
+		Suffix("ON CONFLICT DO NOTHING").
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return err
+	}
+
+	if err := s.queueRescheduleJob(ctx, tx, sequenceID, model.RebalanceMailboxes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *PGStore) DetachMailbox(ctx context.Context, sequenceID, mailboxID uint64) (err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := s.lockSequence(ctx, tx, sequenceID); err != nil {
+		return err
+	}
+
+	sql, args, err := s.builder.
+		Delete("sequence_mailboxes").
+		Where(sq.Eq{"sequence_id": sequenceID, "mailbox_id": mailboxID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	cmd, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	if err := s.queueRescheduleJob(ctx, tx, sequenceID, model.RebalanceMailboxes); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *PGStore) ListSequenceMailboxes(ctx context.Context, sequenceID uint64) (_ []*model.Mailbox, err error) {
+	defer translateError(&err)
+
+	if err := s.checkSequence(ctx, s.pool, sequenceID); err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, len(mailboxColumns))
+	for i, column := range mailboxColumns {
+		columns[i] = "mailboxes." + column
+	}
+	sql, args, err := s.builder.
+		Select(columns...).
+		From("mailboxes").
+		Join("sequence_mailboxes ON sequence_mailboxes.mailbox_id = mailboxes.id").
+		Where(sq.Eq{"sequence_mailboxes.sequence_id": sequenceID}).
+		OrderBy("mailboxes.id ASC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return s.collectMailboxes(rows)
+}
+
+// sealPasswords encrypts the SMTP passwords stored in plaintext. Passwords
+// changed meanwhile are left to their update.
+func (s *PGStore) sealPasswords(ctx context.Context) (err error) {
+	defer translateError(&err)
+
+	sql, args, err := s.builder.
+		Select("id", "smtp_password").
+		From("mailboxes").
+		Where(sq.NotEq{"smtp_password": ""}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	type storedPassword struct {
+		ID       uint64
+		Password string
+	}
+	passwords, err := pgx.CollectRows(rows, pgx.RowToStructByPos[storedPassword])
+	if err != nil {
+		return err
+	}
+
+	for _, stored := range passwords {
+		if secret.IsSealed(stored.Password) {
+			continue
+		}
+		sql, args, err := s.builder.
+			Update("mailboxes").
+			Set("smtp_password", s.secrets.Seal(stored.Password)).
+			Where(sq.Eq{"id": stored.ID, "smtp_password": stored.Password}).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err := s.pool.Exec(ctx, sql, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
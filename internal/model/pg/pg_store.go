@@ -2,34 +2,135 @@ package pg
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/secret"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-var _ model.SequenceStore = (*PGStore)(nil)
+var _ model.Store = (*PGStore)(nil)
 
 type PGStore struct {
 	pool    *pgxpool.Pool
 	builder sq.StatementBuilderType
+	// Encrypts the SMTP passwords of mailboxes.
+	secrets *secret.Box
 }
 
-func NewStore(pool *pgxpool.Pool) (*PGStore, error) {
+var sequenceColumns = []string{
+	"id",
+	"name",
+	"open_tracking_enabled",
+	"click_tracking_enabled",
+	"start_time",
+	"end_time",
+	"timezone",
+	"weekdays",
+	"version",
+	"created_at",
+	"updated_at",
+	"archived_at",
+}
+
+func scanSequence(row pgx.Row, sequence *model.Sequence) error {
+	var (
+		startTime pgtype.Time
+		endTime   pgtype.Time
+		weekdays  []int16
+	)
+	if err := row.Scan(
+		&sequence.ID,
+		&sequence.Name,
+		&sequence.OpenTrackingEnabled,
+		&sequence.ClickTrackingEnabled,
+		&startTime,
+		&endTime,
+		&sequence.Timezone,
+		&weekdays,
+		&sequence.Version,
+		&sequence.CreatedAt,
+		&sequence.UpdatedAt,
+		&sequence.ArchivedAt,
+	); err != nil {
+		return err
+	}
+
+	sequence.StartTime = formatTimeOfDay(startTime)
+	sequence.EndTime = formatTimeOfDay(endTime)
+	sequence.Weekdays = make([]time.Weekday, len(weekdays))
+	for i, day := range weekdays {
+		sequence.Weekdays[i] = time.Weekday(day)
+	}
+
+	return nil
+}
+
+var stepColumns = []string{
+	"id",
+	"sequence_id",
+	"position",
+	"wait_days",
+	"wait_hours",
+	"subject",
+	"content",
+	"version",
+	"created_at",
+	"updated_at",
+}
+
+func scanStep(row pgx.Row, step *model.Step) error {
+	return row.Scan(
+		&step.ID,
+		&step.SequenceID,
+		&step.Position,
+		&step.WaitDays,
+		&step.WaitHours,
+		&step.Subject,
+		&step.Content,
+		&step.Version,
+		&step.CreatedAt,
+		&step.UpdatedAt,
+	)
+}
+
+// NewStore returns a store that encrypts SMTP passwords with the box.
+// Passwords stored in plaintext by earlier versions are encrypted on the way.
+func NewStore(pool *pgxpool.Pool, secrets *secret.Box) (*PGStore, error) {
 	// Check if the pool is valid and can connect to the database
 	// This is a simple ping to ensure the connection is alive.
 	if err := pool.Ping(context.Background()); err != nil {
 		return nil, err
 	}
 
-	return &PGStore{
+	s := &PGStore{
 		pool:    pool,
 		builder: sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
-	}, nil
+		secrets: secrets,
+	}
+	if err := s.sealPasswords(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
-func (s *PGStore) CreateSequence(ctx context.Context, sequence *model.Sequence) error {
+func (s *PGStore) CreateSequence(ctx context.Context, sequence *model.Sequence) (err error) {
+	defer translateError(&err)
+
+	if len(sequence.Steps) > 0 && sequence.Steps[0].HasDelay() {
+		return model.ErrFirstStepDelay
+	}
+	sequence.ApplySendingWindowDefaults()
+	if err := sequence.ValidateSendingWindow(); err != nil {
+		return err
+	}
+
 	tx, err := s.pool.Begin(ctx)
 	if err != nil {
 		return err
@@ -38,9 +139,25 @@ func (s *PGStore) CreateSequence(ctx context.Context, sequence *model.Sequence)
 
 	sql, args, err := s.builder.
 		Insert("sequences").
-		Columns("name", "open_tracking_enabled", "click_tracking_enabled").
-		Values(sequence.Name, sequence.OpenTrackingEnabled, sequence.ClickTrackingEnabled).
-		Suffix("RETURNING id, created_at, updated_at").
+		Columns(
+			"name",
+			"open_tracking_enabled",
+			"click_tracking_enabled",
+			"start_time",
+			"end_time",
+			"timezone",
+			"weekdays",
+		).
+		Values(
+			sequence.Name,
+			sequence.OpenTrackingEnabled,
+			sequence.ClickTrackingEnabled,
+			sequence.StartTime,
+			sequence.EndTime,
+			sequence.Timezone,
+			weekdaysToSmallints(sequence.Weekdays),
+		).
+		Suffix("RETURNING id, version, created_at, updated_at").
 		ToSql()
 	if err != nil {
 		return err
@@ -48,6 +165,7 @@ func (s *PGStore) CreateSequence(ctx context.Context, sequence *model.Sequence)
 
 	if err := tx.QueryRow(ctx, sql, args...).Scan(
 		&sequence.ID,
+		&sequence.Version,
 		&sequence.CreatedAt,
 		&sequence.UpdatedAt,
 	); err != nil {
@@ -57,10 +175,10 @@ func (s *PGStore) CreateSequence(ctx context.Context, sequence *model.Sequence)
 	if len(sequence.Steps) > 0 {
 		builder := s.builder.
 			Insert("steps").
-			Columns("sequence_id", "subject", "content").
-			Suffix("RETURNING id, subject, content, created_at, updated_at")
-		for _, step := range sequence.Steps {
-			builder = builder.Values(sequence.ID, step.Subject, step.Content)
+			Columns("sequence_id", "position", "wait_days", "wait_hours", "subject", "content").
+			Suffix("RETURNING " + strings.Join(stepColumns, ", "))
+		for i, step := range sequence.Steps {
+			builder = builder.Values(sequence.ID, i+1, step.WaitDays, step.WaitHours, step.Subject, step.Content)
 		}
 		sql, args, err = builder.ToSql()
 		if err != nil {
@@ -75,34 +193,26 @@ func (s *PGStore) CreateSequence(ctx context.Context, sequence *model.Sequence)
 
 		var inserted []*model.Step
 		for rows.Next() {
-			step := &model.Step{SequenceID: sequence.ID}
-			if err := rows.Scan(
-				&step.ID,
-				&step.Subject,
-				&step.Content,
-				&step.CreatedAt,
-				&step.UpdatedAt,
-			); err != nil {
+			step := &model.Step{}
+			if err := scanStep(rows, step); err != nil {
 				return err
 			}
 			inserted = append(inserted, step)
 		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
 		sequence.Steps = inserted
 	}
 
 	return tx.Commit(ctx)
 }
 
-func (s *PGStore) FetchSequence(ctx context.Context, id uint64) (*model.Sequence, error) {
+func (s *PGStore) FetchSequence(ctx context.Context, id uint64) (_ *model.Sequence, err error) {
+	defer translateError(&err)
+
 	sql, args, err := s.builder.
-		Select(
-			"id",
-			"name",
-			"open_tracking_enabled",
-			"click_tracking_enabled",
-			"created_at",
-			"updated_at",
-		).
+		Select(sequenceColumns...).
 		Where(sq.Eq{"id": id}).
 		From("sequences").
 		ToSql()
@@ -111,29 +221,15 @@ func (s *PGStore) FetchSequence(ctx context.Context, id uint64) (*model.Sequence
 	}
 
 	var sequence model.Sequence
-	if err := s.pool.QueryRow(ctx, sql, args...).Scan(
-		&sequence.ID,
-		&sequence.Name,
-		&sequence.OpenTrackingEnabled,
-		&sequence.ClickTrackingEnabled,
-		&sequence.CreatedAt,
-		&sequence.UpdatedAt,
-	); err != nil {
+	if err := scanSequence(s.pool.QueryRow(ctx, sql, args...), &sequence); err != nil {
 		return nil, err
 	}
 
 	sql, args, err = s.builder.
-		Select(
-			"id",
-			"sequence_id",
-			"subject",
-			"content",
-			"created_at",
-			"updated_at",
-		).
+		Select(stepColumns...).
 		Where(sq.Eq{"sequence_id": id}).
 		From("steps").
-		OrderBy("id ASC").
+		OrderBy("position ASC").
 		ToSql()
 	if err != nil {
 		return nil, err
@@ -145,87 +241,678 @@ func (s *PGStore) FetchSequence(ctx context.Context, id uint64) (*model.Sequence
 	defer rows.Close()
 
 	for rows.Next() {
-		step := &model.Step{SequenceID: sequence.ID}
-		if err := rows.Scan(
-			&step.ID,
-			&step.SequenceID,
-			&step.Subject,
-			&step.Content,
-			&step.CreatedAt,
-			&step.UpdatedAt,
-		); err != nil {
+		step := &model.Step{}
+		if err := scanStep(rows, step); err != nil {
 			return nil, err
 		}
 		sequence.Steps = append(sequence.Steps, step)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return &sequence, nil
 }
 
-func (s *PGStore) UpdateSequence(ctx context.Context, id uint64, sequence *model.Sequence) error {
+func (s *PGStore) ListSequences(ctx context.Context, params *model.ListSequencesParams) (_ []*model.Sequence, _ *model.Cursor, err error) {
+	defer translateError(&err)
+
+	limit := model.PageLimit(params.Limit)
+	query := s.builder.
+		Select(sequenceColumns...).
+		From("sequences").
+		Where("archived_at IS NULL").
+		Limit(limit + 1)
+
+	if params.Name != "" {
+		query = query.Where(sq.ILike{"name": "%" + escapeLike(params.Name) + "%"})
+	}
+	if params.OpenTrackingEnabled != nil {
+		query = query.Where(sq.Eq{"open_tracking_enabled": *params.OpenTrackingEnabled})
+	}
+	if params.ClickTrackingEnabled != nil {
+		query = query.Where(sq.Eq{"click_tracking_enabled": *params.ClickTrackingEnabled})
+	}
+
+	op, dir := ">", "ASC"
+	if params.Descending {
+		op, dir = "<", "DESC"
+	}
+	switch params.SortBy {
+	case model.SortByCreatedAt:
+		if params.After != nil {
+			query = query.Where(sq.Expr("(created_at, id) "+op+" (?, ?)", params.After.CreatedAt, params.After.ID))
+		}
+		query = query.OrderBy("created_at "+dir, "id "+dir)
+	default:
+		if params.After != nil {
+			query = query.Where(sq.Expr("id "+op+" ?", params.After.ID))
+		}
+		query = query.OrderBy("id " + dir)
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var sequences []*model.Sequence
+	for rows.Next() {
+		sequence := &model.Sequence{}
+		if err := scanSequence(rows, sequence); err != nil {
+			return nil, nil, err
+		}
+		sequences = append(sequences, sequence)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *model.Cursor
+	if uint64(len(sequences)) > limit {
+		sequences = sequences[:limit]
+		last := sequences[len(sequences)-1]
+		next = &model.Cursor{ID: last.ID, CreatedAt: last.CreatedAt}
+	}
+
+	if err := s.fetchSteps(ctx, sequences); err != nil {
+		return nil, nil, err
+	}
+
+	return sequences, next, nil
+}
+
+// fetchSteps loads steps of the given sequences with a single query.
+func (s *PGStore) fetchSteps(ctx context.Context, sequences []*model.Sequence) error {
+	if len(sequences) == 0 {
+		return nil
+	}
+
+	byID := make(map[uint64]*model.Sequence, len(sequences))
+	ids := make([]uint64, len(sequences))
+	for i, sequence := range sequences {
+		byID[sequence.ID] = sequence
+		ids[i] = sequence.ID
+	}
+
+	sql, args, err := s.builder.
+		Select(stepColumns...).
+		Where("sequence_id = ANY(?)", ids).
+		From("steps").
+		OrderBy("sequence_id ASC", "position ASC").
+		ToSql()
+	if err != nil {
+		return err
+	}
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		step := &model.Step{}
+		if err := scanStep(rows, step); err != nil {
+			return err
+		}
+		sequence := byID[step.SequenceID]
+		sequence.Steps = append(sequence.Steps, step)
+	}
+
+	return rows.Err()
+}
+
+func (s *PGStore) DeleteSequence(ctx context.Context, id uint64, version int) (err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.checkVersion(ctx, tx, "sequences", sq.Eq{"id": id}, version); err != nil {
+		return err
+	}
+
+	sql, args, err := s.builder.
+		Delete("steps").
+		Where(sq.Eq{"sequence_id": id}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return err
+	}
+
+	sql, args, err = s.builder.
+		Delete("sequences").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	cmd, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return model.ErrNotFound
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *PGStore) ArchiveSequence(ctx context.Context, id uint64, version int) (err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.checkVersion(ctx, tx, "sequences", sq.Eq{"id": id}, version); err != nil {
+		return err
+	}
+
+	// Archiving twice is a no-op.
 	sql, args, err := s.builder.
 		Update("sequences").
-		Set("open_tracking_enabled", sequence.OpenTrackingEnabled).
-		Set("click_tracking_enabled", sequence.ClickTrackingEnabled).
+		Set("archived_at", sq.Expr("NOW()")).
+		Set("version", sq.Expr("version + 1")).
+		Where(sq.Eq{"id": id, "archived_at": nil}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *PGStore) UpdateSequence(ctx context.Context, id uint64, patch *model.SequencePatch) (_ *model.Sequence, err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	sequence, err := s.lockSequence(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if patch.Version != 0 && patch.Version != sequence.Version {
+		return nil, model.ErrVersionMismatch
+	}
+	patch.Apply(sequence)
+	if err := sequence.ValidateSendingWindow(); err != nil {
+		return nil, err
+	}
+
+	query := s.builder.
+		Update("sequences").
+		Set("version", sq.Expr("version + 1")).
 		Set("updated_at", "NOW()").
 		Where(sq.Eq{"id": id}).
-		Suffix("RETURNING id, created_at, updated_at").
+		Suffix("RETURNING " + strings.Join(sequenceColumns, ", "))
+	if patch.Name != nil {
+		query = query.Set("name", *patch.Name)
+	}
+	if patch.OpenTrackingEnabled != nil {
+		query = query.Set("open_tracking_enabled", *patch.OpenTrackingEnabled)
+	}
+	if patch.ClickTrackingEnabled != nil {
+		query = query.Set("click_tracking_enabled", *patch.ClickTrackingEnabled)
+	}
+	if patch.StartTime != nil {
+		query = query.Set("start_time", *patch.StartTime)
+	}
+	if patch.EndTime != nil {
+		query = query.Set("end_time", *patch.EndTime)
+	}
+	if patch.Timezone != nil {
+		query = query.Set("timezone", *patch.Timezone)
+	}
+	if patch.Weekdays != nil {
+		query = query.Set("weekdays", weekdaysToSmallints(patch.Weekdays))
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := scanSequence(tx.QueryRow(ctx, sql, args...), sequence); err != nil {
+		return nil, err
+	}
+
+	return sequence, tx.Commit(ctx)
+}
+
+func (s *PGStore) CreateStep(ctx context.Context, step *model.Step) (err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sequence, err := s.lockSequence(ctx, tx, step.SequenceID)
+	if err != nil {
+		return err
+	}
+
+	sql, args, err := s.builder.
+		Select("COUNT(*)").
+		From("steps").
+		Where(sq.Eq{"sequence_id": step.SequenceID}).
 		ToSql()
 	if err != nil {
 		return err
 	}
 
-	if err := s.pool.QueryRow(ctx, sql, args...).Scan(
-		&sequence.ID,
-		&sequence.CreatedAt,
-		&sequence.UpdatedAt,
-	); err != nil {
+	var count int
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&count); err != nil {
 		return err
 	}
 
-	return nil
+	position := step.Position
+	if position < 1 || position > count+1 {
+		position = count + 1
+	}
+	if position == 1 && step.HasDelay() {
+		return model.ErrFirstStepDelay
+	}
+
+	// Make room for the new step by moving the following steps down.
+	sql, args, err = s.builder.
+		Update("steps").
+		Set("position", sq.Expr("position + 1")).
+		Set("version", sq.Expr("version + 1")).
+		Where(sq.Eq{"sequence_id": step.SequenceID}).
+		Where(sq.GtOrEq{"position": position}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return err
+	}
+
+	sql, args, err = s.builder.
+		Insert("steps").
+		Columns("sequence_id", "position", "wait_days", "wait_hours", "subject", "content").
+		Values(step.SequenceID, position, step.WaitDays, step.WaitHours, step.Subject, step.Content).
+		Suffix("RETURNING " + strings.Join(stepColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if err := scanStep(tx.QueryRow(ctx, sql, args...), step); err != nil {
+		return err
+	}
+
+	if err := s.bumpSequenceVersion(ctx, tx, sequence); err != nil {
+		return err
+	}
+	if err := s.queueRescheduleJob(ctx, tx, step.SequenceID, model.RescheduleSteps); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (s *PGStore) UpdateStep(ctx context.Context, id uint64, step *model.Step) error {
+func (s *PGStore) ReorderSteps(ctx context.Context, sequenceID uint64, version int, stepIDs []uint64) (_ *model.Sequence, err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	sequence, err := s.lockSequence(ctx, tx, sequenceID)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && version != sequence.Version {
+		return nil, model.ErrVersionMismatch
+	}
+
+	sql, args, err := s.builder.
+		Select("id").
+		From("steps").
+		Where(sq.Eq{"sequence_id": sequenceID}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(stepIDs))
+	for i, id := range stepIDs {
+		ids[i] = int64(id)
+	}
+	if len(ids) == 0 || !sameElements(ids, existing) {
+		return nil, model.ErrInvalidStepOrder
+	}
+
+	// The unique constraint on positions is deferred, so all steps can be
+	// renumbered with a single statement. Whichever step ends up first
+	// loses its delay.
+	sql, args, err = s.builder.
+		Update("steps").
+		Set("position", sq.Expr("ARRAY_POSITION(?::INTEGER[], id)", ids)).
+		Set("wait_days", sq.Expr("CASE WHEN id = ? THEN 0 ELSE wait_days END", ids[0])).
+		Set("wait_hours", sq.Expr("CASE WHEN id = ? THEN 0 ELSE wait_hours END", ids[0])).
+		Set("version", sq.Expr("version + 1")).
+		Set("updated_at", "NOW()").
+		Where(sq.Eq{"sequence_id": sequenceID}).
+		Suffix("RETURNING " + strings.Join(stepColumns, ", ")).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*model.Step, error) {
+		step := &model.Step{}
+		return step, scanStep(row, step)
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(steps, func(a, b *model.Step) int {
+		return a.Position - b.Position
+	})
+	sequence.Steps = steps
+
+	if err := s.bumpSequenceVersion(ctx, tx, sequence); err != nil {
+		return nil, err
+	}
+	if err := s.queueRescheduleJob(ctx, tx, sequenceID, model.RescheduleSteps); err != nil {
+		return nil, err
+	}
+
+	return sequence, tx.Commit(ctx)
+}
+
+func (s *PGStore) UpdateStep(ctx context.Context, id uint64, step *model.Step) (err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sequence, err := s.lockSequence(ctx, tx, step.SequenceID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkVersion(ctx, tx, "steps", sq.Eq{"id": id, "sequence_id": step.SequenceID}, step.Version); err != nil {
+		return err
+	}
+
 	sql, args, err := s.builder.
 		Update("steps").
 		Set("subject", step.Subject).
 		Set("content", step.Content).
+		Set("wait_days", step.WaitDays).
+		Set("wait_hours", step.WaitHours).
+		Set("version", sq.Expr("version + 1")).
 		Set("updated_at", "NOW()").
 		Where(sq.Eq{"id": id, "sequence_id": step.SequenceID}).
-		Suffix("RETURNING id, created_at, updated_at").
+		Suffix("RETURNING " + strings.Join(stepColumns, ", ")).
 		ToSql()
 	if err != nil {
 		return err
 	}
 
-	if err := s.pool.QueryRow(ctx, sql, args...).Scan(
-		&step.ID,
-		&step.CreatedAt,
-		&step.UpdatedAt,
-	); err != nil {
+	if err := scanStep(tx.QueryRow(ctx, sql, args...), step); err != nil {
 		return err
 	}
+	if step.Position == 1 && step.HasDelay() {
+		return model.ErrFirstStepDelay
+	}
 
-	return nil
+	if err := s.bumpSequenceVersion(ctx, tx, sequence); err != nil {
+		return err
+	}
+	if err := s.queueRescheduleJob(ctx, tx, step.SequenceID, model.RescheduleSteps); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func (s *PGStore) DeleteStep(ctx context.Context, id uint64, step *model.Step) error {
+func (s *PGStore) DeleteStep(ctx context.Context, id uint64, step *model.Step) (err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sequence, err := s.lockSequence(ctx, tx, step.SequenceID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkVersion(ctx, tx, "steps", sq.Eq{"id": id, "sequence_id": step.SequenceID}, step.Version); err != nil {
+		return err
+	}
+
+	// Emails of the step are kept with their step unset, only the pending
+	// ones are canceled.
 	sql, args, err := s.builder.
+		Update("scheduled_emails").
+		Set("status", model.ScheduledEmailCanceled).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"step_id": id, "status": model.ScheduledEmailPending}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return err
+	}
+
+	sql, args, err = s.builder.
 		Delete("steps").
 		Where(sq.Eq{"id": id, "sequence_id": step.SequenceID}).
+		Suffix("RETURNING position").
 		ToSql()
 	if err != nil {
 		return err
 	}
 
-	cmd, err := s.pool.Exec(ctx, sql, args...)
+	var position int
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&position); err != nil {
+		return err
+	}
+
+	// Close the gap left by the deleted step. The step that becomes first
+	// is sent right away, so its delay is dropped.
+	sql, args, err = s.builder.
+		Update("steps").
+		Set("position", sq.Expr("position - 1")).
+		Set("wait_days", sq.Expr("CASE WHEN position = 2 THEN 0 ELSE wait_days END")).
+		Set("wait_hours", sq.Expr("CASE WHEN position = 2 THEN 0 ELSE wait_hours END")).
+		Set("version", sq.Expr("version + 1")).
+		Where(sq.Eq{"sequence_id": step.SequenceID}).
+		Where(sq.Gt{"position": position}).
+		ToSql()
 	if err != nil {
 		return err
 	}
-	if cmd.RowsAffected() == 0 {
-		return pgx.ErrNoRows
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return err
+	}
+
+	if err := s.bumpSequenceVersion(ctx, tx, sequence); err != nil {
+		return err
+	}
+	if err := s.queueRescheduleJob(ctx, tx, step.SequenceID, model.RescheduleSteps); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// lockSequence locks the sequence row until the end of the transaction
+// and makes sure it has not been archived.
+func (s *PGStore) lockSequence(ctx context.Context, tx pgx.Tx, id uint64) (*model.Sequence, error) {
+	sql, args, err := s.builder.
+		Select(sequenceColumns...).
+		From("sequences").
+		Where(sq.Eq{"id": id}).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var sequence model.Sequence
+	if err := scanSequence(tx.QueryRow(ctx, sql, args...), &sequence); err != nil {
+		return nil, err
+	}
+	if sequence.ArchivedAt != nil {
+		return nil, model.ErrSequenceArchived
+	}
+
+	return &sequence, nil
+}
+
+// bumpSequenceVersion marks a change of the sequence steps, so that the
+// sequence ETag changes with them.
+func (s *PGStore) bumpSequenceVersion(ctx context.Context, tx pgx.Tx, sequence *model.Sequence) error {
+	sql, args, err := s.builder.
+		Update("sequences").
+		Set("version", sq.Expr("version + 1")).
+		Set("updated_at", "NOW()").
+		Where(sq.Eq{"id": sequence.ID}).
+		Suffix("RETURNING version, updated_at").
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	return tx.QueryRow(ctx, sql, args...).Scan(&sequence.Version, &sequence.UpdatedAt)
+}
+
+// rowQuerier is implemented by both pools and transactions.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// querier is implemented by both pools and transactions.
+type querier interface {
+	rowQuerier
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// checkSequence makes sure the sequence exists, archived or not.
+func (s *PGStore) checkSequence(ctx context.Context, q rowQuerier, id uint64) error {
+	sql, args, err := s.builder.
+		Select("1").
+		From("sequences").
+		Where(sq.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	var exists int
+	return q.QueryRow(ctx, sql, args...).Scan(&exists)
+}
+
+// checkVersion locks the row matching the predicate until the end of the
+// transaction and compares its version with the expected one. Zero version
+// skips the comparison.
+func (s *PGStore) checkVersion(ctx context.Context, tx pgx.Tx, table string, pred sq.Eq, version int) error {
+	sql, args, err := s.builder.
+		Select("version").
+		From(table).
+		Where(pred).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	var current int
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&current); err != nil {
+		return err
+	}
+	if version != 0 && version != current {
+		return model.ErrVersionMismatch
 	}
 
 	return nil
 }
+
+// sameElements reports whether both slices hold the same set of unique IDs.
+func sameElements(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	seen := make(map[int64]bool, len(b))
+	for _, id := range b {
+		seen[id] = true
+	}
+	for _, id := range a {
+		if !seen[id] {
+			return false
+		}
+		delete(seen, id)
+	}
+
+	return true
+}
+
+// formatTimeOfDay renders a TIME value in the model.TimeOfDayLayout format.
+func formatTimeOfDay(t pgtype.Time) string {
+	minutes := t.Microseconds / int64(time.Minute/time.Microsecond)
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+func weekdaysToSmallints(weekdays []time.Weekday) []int16 {
+	days := make([]int16, len(weekdays))
+	for i, day := range weekdays {
+		days[i] = int16(day)
+	}
+	return days
+}
+
+// escapeLike escapes LIKE wildcards so the pattern matches literally.
+func escapeLike(pattern string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(pattern)
+}
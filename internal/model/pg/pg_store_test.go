@@ -2,24 +2,38 @@ package pg_test
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/danikarik/salesforge/internal/model"
 	"github.com/danikarik/salesforge/internal/model/pg"
+	"github.com/danikarik/salesforge/internal/model/storetest"
+	"github.com/danikarik/salesforge/internal/secret"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/stretchr/testify/require"
 )
 
 var testPool *pgxpool.Pool
 
+// testSecrets encrypts the SMTP passwords of test stores.
+var testSecrets *secret.Box
+
 func TestMain(m *testing.M) {
 	ctx := context.Background()
 
+	box, err := secret.NewBox("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err != nil {
+		log.Fatal(err)
+	}
+	testSecrets = box
+
 	connString, ok := os.LookupEnv("TEST_DATABASE_URL")
 	if !ok {
-		os.Exit(0)
+		os.Exit(m.Run())
 	}
 
 	pool, err := pgxpool.New(ctx, connString)
@@ -33,9 +47,35 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
+// requireDB skips the test when no test database is configured.
+func requireDB(t *testing.T) {
+	t.Helper()
+
+	if testPool == nil {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	requireDB(t)
+
+	storetest.RunConformance(t, func(t *testing.T) model.Store {
+		cleanDB(t.Context())
+
+		store, err := pg.NewStore(testPool, testSecrets)
+		require.NoError(t, err)
+		return store
+	})
+}
+
 func cleanDB(ctx context.Context) {
+	testPool.Exec(ctx, "DELETE FROM scheduled_emails")
+	testPool.Exec(ctx, "DELETE FROM enrollments")
+	testPool.Exec(ctx, "DELETE FROM reschedule_jobs")
 	testPool.Exec(ctx, "DELETE FROM steps")
 	testPool.Exec(ctx, "DELETE FROM sequences")
+	testPool.Exec(ctx, "DELETE FROM contacts")
+	testPool.Exec(ctx, "DELETE FROM mailboxes")
 }
 
 func assertDifference(t *testing.T, tableName string, diff int64, fn func()) {
@@ -64,17 +104,19 @@ var testSequence = &model.Sequence{
 			Content: "Step 1 Content",
 		},
 		{
-			Subject: "Step 2 Subject",
-			Content: "Step 2 Content",
+			Subject:  "Step 2 Subject",
+			Content:  "Step 2 Content",
+			WaitDays: 2,
 		},
 	},
 }
 
 func TestCreateSequence(t *testing.T) {
 	ctx := t.Context()
+	requireDB(t)
 	cleanDB(ctx)
 
-	store, err := pg.NewStore(testPool)
+	store, err := pg.NewStore(testPool, testSecrets)
 	require.NoError(t, err)
 
 	assertDifference(t, "sequences", 1, func() {
@@ -85,9 +127,10 @@ func TestCreateSequence(t *testing.T) {
 
 func TestFetchSequence(t *testing.T) {
 	ctx := t.Context()
+	requireDB(t)
 	cleanDB(ctx)
 
-	store, err := pg.NewStore(testPool)
+	store, err := pg.NewStore(testPool, testSecrets)
 	require.NoError(t, err)
 
 	err = store.CreateSequence(ctx, testSequence)
@@ -96,35 +139,218 @@ func TestFetchSequence(t *testing.T) {
 	fetchedSequence, err := store.FetchSequence(ctx, testSequence.ID)
 	require.NoError(t, err)
 	require.Equal(t, testSequence, fetchedSequence)
+
+	_, err = store.FetchSequence(ctx, testSequence.ID+1)
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestListSequences(t *testing.T) {
+	ctx := t.Context()
+	requireDB(t)
+	cleanDB(ctx)
+
+	store, err := pg.NewStore(testPool, testSecrets)
+	require.NoError(t, err)
+
+	for _, name := range []string{"Alpha", "Beta", "Gamma"} {
+		err = store.CreateSequence(ctx, &model.Sequence{
+			Name:                name,
+			OpenTrackingEnabled: name != "Beta",
+			Steps:               []*model.Step{{Subject: "Subject", Content: "Content"}},
+		})
+		require.NoError(t, err)
+	}
+
+	firstPage, next, err := store.ListSequences(ctx, &model.ListSequencesParams{Limit: 2, SortBy: model.SortByID})
+	require.NoError(t, err)
+	require.Len(t, firstPage, 2)
+	require.NotNil(t, next)
+	require.Equal(t, "Alpha", firstPage[0].Name)
+	require.Len(t, firstPage[0].Steps, 1)
+
+	secondPage, next, err := store.ListSequences(ctx, &model.ListSequencesParams{Limit: 2, SortBy: model.SortByID, After: next})
+	require.NoError(t, err)
+	require.Len(t, secondPage, 1)
+	require.Nil(t, next)
+	require.Equal(t, "Gamma", secondPage[0].Name)
+
+	descending, _, err := store.ListSequences(ctx, &model.ListSequencesParams{Limit: 10, SortBy: model.SortByCreatedAt, Descending: true})
+	require.NoError(t, err)
+	require.Len(t, descending, 3)
+	require.Equal(t, "Gamma", descending[0].Name)
+
+	openTracking := true
+	filtered, _, err := store.ListSequences(ctx, &model.ListSequencesParams{Limit: 10, Name: "a", OpenTrackingEnabled: &openTracking})
+	require.NoError(t, err)
+	require.Len(t, filtered, 2)
 }
 
 func TestUpdateSequence(t *testing.T) {
 	ctx := t.Context()
+	requireDB(t)
 	cleanDB(ctx)
 
-	store, err := pg.NewStore(testPool)
+	store, err := pg.NewStore(testPool, testSecrets)
 	require.NoError(t, err)
 
 	err = store.CreateSequence(ctx, testSequence)
 	require.NoError(t, err)
 
-	err = store.UpdateSequence(ctx, testSequence.ID, &model.Sequence{
-		OpenTrackingEnabled:  false,
-		ClickTrackingEnabled: false,
+	openTracking, startTime, endTime, timezone := false, "08:30", "18:15", "Europe/Berlin"
+	updatedSequence, err := store.UpdateSequence(ctx, testSequence.ID, &model.SequencePatch{
+		OpenTrackingEnabled: &openTracking,
+		StartTime:           &startTime,
+		EndTime:             &endTime,
+		Timezone:            &timezone,
+		Weekdays:            []time.Weekday{time.Saturday, time.Sunday},
 	})
 	require.NoError(t, err)
+	require.Equal(t, testSequence.Name, updatedSequence.Name)
 
 	fetchedSequence, err := store.FetchSequence(ctx, testSequence.ID)
 	require.NoError(t, err)
+	require.Equal(t, testSequence.Name, fetchedSequence.Name)
 	require.False(t, fetchedSequence.OpenTrackingEnabled)
-	require.False(t, fetchedSequence.ClickTrackingEnabled)
+	require.True(t, fetchedSequence.ClickTrackingEnabled, "Expected omitted fields to stay unchanged")
+	require.Equal(t, "08:30", fetchedSequence.StartTime)
+	require.Equal(t, "18:15", fetchedSequence.EndTime)
+	require.Equal(t, "Europe/Berlin", fetchedSequence.Timezone)
+	require.Equal(t, []time.Weekday{time.Saturday, time.Sunday}, fetchedSequence.Weekdays)
+
+	earlyEnd := "08:00"
+	_, err = store.UpdateSequence(ctx, testSequence.ID, &model.SequencePatch{EndTime: &earlyEnd})
+	require.ErrorIs(t, err, model.ErrInvalidSendingWindow)
+
+	name := "Renamed Sequence"
+	updatedSequence, err = store.UpdateSequence(ctx, testSequence.ID, &model.SequencePatch{Name: &name})
+	require.NoError(t, err)
+	require.Equal(t, name, updatedSequence.Name)
+	require.Equal(t, "08:30", updatedSequence.StartTime)
+}
+
+func TestDeleteSequence(t *testing.T) {
+	ctx := t.Context()
+	requireDB(t)
+	cleanDB(ctx)
+
+	store, err := pg.NewStore(testPool, testSecrets)
+	require.NoError(t, err)
+
+	err = store.CreateSequence(ctx, testSequence)
+	require.NoError(t, err)
+
+	assertDifference(t, "steps", -2, func() {
+		assertDifference(t, "sequences", -1, func() {
+			err := store.DeleteSequence(ctx, testSequence.ID, 0)
+			require.NoError(t, err)
+		})
+	})
+
+	err = store.DeleteSequence(ctx, testSequence.ID, 0)
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestArchiveSequence(t *testing.T) {
+	ctx := t.Context()
+	requireDB(t)
+	cleanDB(ctx)
+
+	store, err := pg.NewStore(testPool, testSecrets)
+	require.NoError(t, err)
+
+	err = store.CreateSequence(ctx, testSequence)
+	require.NoError(t, err)
+
+	err = store.ArchiveSequence(ctx, testSequence.ID, 0)
+	require.NoError(t, err)
+
+	fetchedSequence, err := store.FetchSequence(ctx, testSequence.ID)
+	require.NoError(t, err)
+	require.NotNil(t, fetchedSequence.ArchivedAt)
+
+	sequences, _, err := store.ListSequences(ctx, &model.ListSequencesParams{Limit: 10})
+	require.NoError(t, err)
+	require.Empty(t, sequences)
+
+	_, err = store.UpdateSequence(ctx, testSequence.ID, &model.SequencePatch{})
+	require.ErrorIs(t, err, model.ErrSequenceArchived)
+
+	err = store.UpdateStep(ctx, testSequence.Steps[0].ID, &model.Step{
+		SequenceID: testSequence.ID,
+		Subject:    "Updated Step 1 Subject",
+		Content:    "Updated Step 1 Content",
+	})
+	require.ErrorIs(t, err, model.ErrSequenceArchived)
+}
+
+func TestCreateStep(t *testing.T) {
+	ctx := t.Context()
+	requireDB(t)
+	cleanDB(ctx)
+
+	store, err := pg.NewStore(testPool, testSecrets)
+	require.NoError(t, err)
+
+	err = store.CreateSequence(ctx, testSequence)
+	require.NoError(t, err)
+
+	appended := &model.Step{SequenceID: testSequence.ID, Subject: "Last Subject", Content: "Last Content"}
+	err = store.CreateStep(ctx, appended)
+	require.NoError(t, err)
+	require.Equal(t, 3, appended.Position)
+
+	inserted := &model.Step{SequenceID: testSequence.ID, Position: 1, Subject: "First Subject", Content: "First Content"}
+	err = store.CreateStep(ctx, inserted)
+	require.NoError(t, err)
+	require.Equal(t, 1, inserted.Position)
+
+	fetchedSequence, err := store.FetchSequence(ctx, testSequence.ID)
+	require.NoError(t, err)
+	require.Len(t, fetchedSequence.Steps, 4)
+	require.Equal(t, inserted.ID, fetchedSequence.Steps[0].ID)
+	require.Equal(t, testSequence.Steps[0].ID, fetchedSequence.Steps[1].ID)
+	require.Equal(t, appended.ID, fetchedSequence.Steps[3].ID)
+	for i, step := range fetchedSequence.Steps {
+		require.Equal(t, i+1, step.Position)
+	}
+}
+
+func TestReorderSteps(t *testing.T) {
+	ctx := t.Context()
+	requireDB(t)
+	cleanDB(ctx)
+
+	store, err := pg.NewStore(testPool, testSecrets)
+	require.NoError(t, err)
+
+	err = store.CreateSequence(ctx, testSequence)
+	require.NoError(t, err)
+
+	first, second := testSequence.Steps[0], testSequence.Steps[1]
+	sequence, err := store.ReorderSteps(ctx, testSequence.ID, testSequence.Version, []uint64{second.ID, first.ID})
+	require.NoError(t, err)
+	steps := sequence.Steps
+	require.Equal(t, second.ID, steps[0].ID)
+	require.Equal(t, 1, steps[0].Position)
+	require.Equal(t, first.ID, steps[1].ID)
+	require.Equal(t, 2, steps[1].Position)
+
+	require.False(t, steps[0].HasDelay(), "Expected first step delay to be dropped")
+	require.Zero(t, steps[1].WaitDays)
+
+	_, err = store.ReorderSteps(ctx, testSequence.ID, 0, []uint64{first.ID})
+	require.ErrorIs(t, err, model.ErrInvalidStepOrder)
+
+	_, err = store.ReorderSteps(ctx, testSequence.ID, 0, []uint64{first.ID, first.ID})
+	require.ErrorIs(t, err, model.ErrInvalidStepOrder)
 }
 
 func TestUpdateStep(t *testing.T) {
 	ctx := t.Context()
+	requireDB(t)
 	cleanDB(ctx)
 
-	store, err := pg.NewStore(testPool)
+	store, err := pg.NewStore(testPool, testSecrets)
 	require.NoError(t, err)
 
 	err = store.CreateSequence(ctx, testSequence)
@@ -142,13 +368,60 @@ func TestUpdateStep(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "Updated Step 1 Subject", fetchedSequence.Steps[0].Subject)
 	require.Equal(t, "Updated Step 1 Content", fetchedSequence.Steps[0].Content)
+
+	err = store.UpdateStep(ctx, testStep.ID, &model.Step{
+		SequenceID: testSequence.ID,
+		Subject:    "Updated Step 1 Subject",
+		Content:    "Updated Step 1 Content",
+		WaitDays:   1,
+	})
+	require.ErrorIs(t, err, model.ErrFirstStepDelay)
+}
+
+func TestVersionMismatch(t *testing.T) {
+	ctx := t.Context()
+	requireDB(t)
+	cleanDB(ctx)
+
+	store, err := pg.NewStore(testPool, testSecrets)
+	require.NoError(t, err)
+
+	err = store.CreateSequence(ctx, testSequence)
+	require.NoError(t, err)
+	require.Equal(t, 1, testSequence.Version)
+
+	name := "Versioned Sequence"
+	updatedSequence, err := store.UpdateSequence(ctx, testSequence.ID, &model.SequencePatch{Version: 1, Name: &name})
+	require.NoError(t, err)
+	require.Equal(t, 2, updatedSequence.Version)
+
+	_, err = store.UpdateSequence(ctx, testSequence.ID, &model.SequencePatch{Version: 1, Name: &name})
+	require.ErrorIs(t, err, model.ErrVersionMismatch)
+
+	err = store.ArchiveSequence(ctx, testSequence.ID, 1)
+	require.ErrorIs(t, err, model.ErrVersionMismatch)
+
+	testStep := testSequence.Steps[1]
+	step := &model.Step{
+		SequenceID: testSequence.ID,
+		Subject:    "Updated Step 2 Subject",
+		Content:    "Updated Step 2 Content",
+		Version:    1,
+	}
+	err = store.UpdateStep(ctx, testStep.ID, step)
+	require.NoError(t, err)
+	require.Equal(t, 2, step.Version)
+
+	err = store.DeleteStep(ctx, testStep.ID, &model.Step{SequenceID: testSequence.ID, Version: 1})
+	require.ErrorIs(t, err, model.ErrVersionMismatch)
 }
 
 func TestDeleteStep(t *testing.T) {
 	ctx := t.Context()
+	requireDB(t)
 	cleanDB(ctx)
 
-	store, err := pg.NewStore(testPool)
+	store, err := pg.NewStore(testPool, testSecrets)
 	require.NoError(t, err)
 
 	err = store.CreateSequence(ctx, testSequence)
@@ -163,4 +436,114 @@ func TestDeleteStep(t *testing.T) {
 	fetchedSequence, err := store.FetchSequence(ctx, testSequence.ID)
 	require.NoError(t, err)
 	require.Len(t, fetchedSequence.Steps, 1, "Expected 1 step after deletion")
+	require.Equal(t, 1, fetchedSequence.Steps[0].Position, "Expected positions without gaps")
+	require.False(t, fetchedSequence.Steps[0].HasDelay(), "Expected first step delay to be dropped")
+}
+
+func TestImportContactsConcurrently(t *testing.T) {
+	ctx := t.Context()
+	requireDB(t)
+	cleanDB(ctx)
+
+	store, err := pg.NewStore(testPool, testSecrets)
+	require.NoError(t, err)
+
+	const imports, count = 4, 200
+	statuses := make([][]model.ImportStatus, imports)
+	errs := make([]error, imports)
+	var wg sync.WaitGroup
+	for i := range imports {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			batch := &model.ContactImport{OwnerID: 1, Contacts: make([]*model.Contact, count)}
+			for j := range batch.Contacts {
+				batch.Contacts[j] = &model.Contact{Email: fmt.Sprintf("contact%d@example.com", j)}
+			}
+			statuses[i], errs[i] = store.ImportContacts(ctx, batch)
+		}()
+	}
+	wg.Wait()
+
+	created := 0
+	for i := range imports {
+		require.NoError(t, errs[i])
+		for _, status := range statuses[i] {
+			if status == model.ImportCreated {
+				created++
+			}
+		}
+	}
+	require.Equal(t, count, created, "Expected every contact to be created once")
+}
+
+func TestCreateManyEnrollments(t *testing.T) {
+	ctx := t.Context()
+	requireDB(t)
+	cleanDB(ctx)
+
+	store, err := pg.NewStore(testPool, testSecrets)
+	require.NoError(t, err)
+
+	// More contacts than a statement takes as separate parameters.
+	const count = 70000
+	batch := &model.ContactImport{OwnerID: 1, Contacts: make([]*model.Contact, count)}
+	for i := range batch.Contacts {
+		batch.Contacts[i] = &model.Contact{Email: fmt.Sprintf("contact%d@example.com", i)}
+	}
+	_, err = store.ImportContacts(ctx, batch)
+	require.NoError(t, err)
+
+	contactIDs := make([]uint64, count)
+	for i, contact := range batch.Contacts {
+		contactIDs[i] = contact.ID
+	}
+	sequence := &model.Sequence{Name: "Test Sequence", Steps: []*model.Step{{Subject: "Subject", Content: "Content"}}}
+	require.NoError(t, store.CreateSequence(ctx, sequence))
+
+	assertDifference(t, "scheduled_emails", count, func() {
+		enrollments, err := store.CreateEnrollments(ctx, sequence.ID, sequence.Steps[0].ID, contactIDs, time.Now())
+		require.NoError(t, err)
+		require.Len(t, enrollments, count)
+	})
+
+	_, err = store.TransitionEnrollments(ctx, sequence.ID, model.EnrollmentPaused, time.Now())
+	require.NoError(t, err)
+}
+
+func TestMailboxPasswords(t *testing.T) {
+	ctx := t.Context()
+	requireDB(t)
+	cleanDB(ctx)
+
+	var legacyID uint64
+	err := testPool.QueryRow(ctx, `INSERT INTO mailboxes (user_id, email, daily_capacity, smtp_password)
+		VALUES (1, 'legacy@example.com', 10, 'hunter2') RETURNING id`).Scan(&legacyID)
+	require.NoError(t, err)
+
+	storedPassword := func(id uint64) string {
+		var password string
+		err := testPool.QueryRow(ctx, "SELECT smtp_password FROM mailboxes WHERE id = $1", id).Scan(&password)
+		require.NoError(t, err)
+		return password
+	}
+
+	// Plaintext passwords are encrypted when the store starts.
+	store, err := pg.NewStore(testPool, testSecrets)
+	require.NoError(t, err)
+	require.True(t, secret.IsSealed(storedPassword(legacyID)))
+	legacy, err := store.FetchMailbox(ctx, legacyID)
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", legacy.SMTPPassword)
+
+	mailbox := &model.Mailbox{UserID: 1, Email: "sales@example.com", DailyCapacity: 10, SMTPPassword: "secret"}
+	require.NoError(t, store.CreateMailbox(ctx, mailbox))
+	require.Equal(t, "secret", mailbox.SMTPPassword)
+	require.NotContains(t, storedPassword(mailbox.ID), "secret")
+
+	password := "changed"
+	updated, err := store.UpdateMailbox(ctx, mailbox.ID, &model.MailboxPatch{SMTPPassword: &password})
+	require.NoError(t, err)
+	require.Equal(t, "changed", updated.SMTPPassword)
+	require.NotContains(t, storedPassword(mailbox.ID), "changed")
 }
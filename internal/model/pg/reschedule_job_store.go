@@ -0,0 +1,106 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *PGStore) ClaimRescheduleJob(ctx context.Context, now time.Time, lease time.Duration) (_ *model.RescheduleJob, err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := s.builder.
+		Select("sequence_id", "kind", "version", "created_at").
+		From("reschedule_jobs").
+		Where(sq.Or{
+			sq.Eq{"claimed_at": nil},
+			sq.LtOrEq{"claimed_at": now.Add(-lease).UTC()},
+		}).
+		OrderBy("created_at ASC", "sequence_id ASC", "kind ASC").
+		Limit(1).
+		Suffix("FOR UPDATE SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var job model.RescheduleJob
+	err = tx.QueryRow(ctx, sql, args...).Scan(&job.SequenceID, &job.Kind, &job.Version, &job.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sql, args, err = s.builder.
+		Update("reschedule_jobs").
+		Set("claimed_at", now.UTC()).
+		Where(sq.Eq{"sequence_id": job.SequenceID, "kind": job.Kind}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return nil, err
+	}
+
+	return &job, tx.Commit(ctx)
+}
+
+func (s *PGStore) FinishRescheduleJob(ctx context.Context, job *model.RescheduleJob) (err error) {
+	defer translateError(&err)
+
+	sql, args, err := s.builder.
+		Delete("reschedule_jobs").
+		Where(sq.Eq{"sequence_id": job.SequenceID, "kind": job.Kind, "version": job.Version}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	cmd, err := s.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() > 0 {
+		return nil
+	}
+
+	// The job was queued again while it ran, or the sequence is gone.
+	sql, args, err = s.builder.
+		Update("reschedule_jobs").
+		Set("claimed_at", nil).
+		Where(sq.Eq{"sequence_id": job.SequenceID, "kind": job.Kind}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.pool.Exec(ctx, sql, args...)
+	return err
+}
+
+// queueRescheduleJob queues the sequence for the rescheduler, or bumps the
+// version of its queued job so that a run in progress goes once more.
+func (s *PGStore) queueRescheduleJob(ctx context.Context, tx pgx.Tx, sequenceID uint64, kind model.RescheduleJobKind) error {
+	sql, args, err := s.builder.
+		Insert("reschedule_jobs").
+		Columns("sequence_id", "kind").
+		Values(sequenceID, kind).
+		Suffix("ON CONFLICT (sequence_id, kind) DO UPDATE SET version = reschedule_jobs.version + 1").
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, sql, args...)
+	return err
+}
@@ -0,0 +1,942 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// scheduledEmailColumns are selected from scheduled_emails joined with
+// enrollments, see selectScheduledEmails.
+var scheduledEmailColumns = []string{
+	"se.id",
+	"e.sequence_id",
+	"se.enrollment_id",
+	"se.step_id",
+	"se.mailbox_id",
+	"se.send_at",
+	"se.status",
+	"se.sent_at",
+	"se.error",
+	"se.attempts",
+	"se.created_at",
+	"se.updated_at",
+}
+
+func scanScheduledEmail(row pgx.Row, email *model.ScheduledEmail) error {
+	return row.Scan(
+		&email.ID,
+		&email.SequenceID,
+		&email.EnrollmentID,
+		&email.StepID,
+		&email.MailboxID,
+		&email.SendAt,
+		&email.Status,
+		&email.SentAt,
+		&email.Error,
+		&email.Attempts,
+		&email.CreatedAt,
+		&email.UpdatedAt,
+	)
+}
+
+func (s *PGStore) ListScheduledEmails(ctx context.Context, enrollmentID uint64) (_ []*model.ScheduledEmail, err error) {
+	defer translateError(&err)
+
+	sql, args, err := s.builder.
+		Select("1").
+		From("enrollments").
+		Where(sq.Eq{"id": enrollmentID}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	var exists int
+	if err := s.pool.QueryRow(ctx, sql, args...).Scan(&exists); err != nil {
+		return nil, err
+	}
+
+	sql, args, err = s.selectScheduledEmails().
+		Where(sq.Eq{"se.enrollment_id": enrollmentID}).
+		OrderBy("se.id ASC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectScheduledEmails(rows)
+}
+
+func (s *PGStore) ListUnplannedEmails(ctx context.Context, until time.Time) (_ []*model.ScheduledEmail, err error) {
+	defer translateError(&err)
+
+	sql, args, err := s.selectScheduledEmails().
+		Where(sq.Eq{"se.status": model.ScheduledEmailPending, "se.mailbox_id": nil}).
+		Where(sq.Lt{"se.send_at": until.UTC()}).
+		OrderBy("se.send_at ASC", "se.id ASC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectScheduledEmails(rows)
+}
+
+func (s *PGStore) CountMailboxEmails(ctx context.Context, mailboxIDs []uint64, from, to time.Time) (_ map[uint64]int, err error) {
+	defer translateError(&err)
+
+	return s.countMailboxEmails(ctx, s.pool, mailboxIDs, from, to)
+}
+
+func (s *PGStore) PlanScheduledEmails(ctx context.Context, plans []*model.ScheduledEmailPlan) (_ int, err error) {
+	defer translateError(&err)
+
+	if len(plans) == 0 {
+		return 0, nil
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	planned, err := s.planScheduledEmails(ctx, tx, plans)
+	if err != nil {
+		return 0, err
+	}
+
+	return planned, tx.Commit(ctx)
+}
+
+func (s *PGStore) PlanMailboxEmails(ctx context.Context, mailboxIDs []uint64, from, to time.Time, plan model.PlanFunc) (_ int, err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Mailboxes are locked in ID order, so planners sharing some wait for
+	// each other without deadlocking. The lock does not block inserts that
+	// reference the mailboxes.
+	sql, args, err := s.builder.
+		Select("id").
+		From("mailboxes").
+		Where("id = ANY(?)", mailboxIDs).
+		OrderBy("id ASC").
+		Suffix("FOR NO KEY UPDATE").
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return 0, err
+	}
+
+	used, err := s.countMailboxEmails(ctx, tx, mailboxIDs, from, to)
+	if err != nil {
+		return 0, err
+	}
+	planned, err := s.planScheduledEmails(ctx, tx, plan(used))
+	if err != nil {
+		return 0, err
+	}
+
+	return planned, tx.Commit(ctx)
+}
+
+func (s *PGStore) countMailboxEmails(ctx context.Context, q querier, mailboxIDs []uint64, from, to time.Time) (map[uint64]int, error) {
+	sql, args, err := s.builder.
+		Select("mailbox_id", "COUNT(*)").
+		From("scheduled_emails").
+		Where("mailbox_id = ANY(?)", mailboxIDs).
+		Where(sq.Eq{"status": model.PlannedEmailStatuses}).
+		Where(sq.GtOrEq{"send_at": from.UTC()}).
+		Where(sq.Lt{"send_at": to.UTC()}).
+		GroupBy("mailbox_id").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[uint64]int)
+	for rows.Next() {
+		var (
+			mailboxID uint64
+			count     int
+		)
+		if err := rows.Scan(&mailboxID, &count); err != nil {
+			return nil, err
+		}
+		counts[mailboxID] = count
+	}
+	return counts, rows.Err()
+}
+
+// planScheduledEmails applies the plans to emails that are still pending
+// without a mailbox and returns their number.
+func (s *PGStore) planScheduledEmails(ctx context.Context, tx pgx.Tx, plans []*model.ScheduledEmailPlan) (int, error) {
+	if len(plans) == 0 {
+		return 0, nil
+	}
+
+	batch := &pgx.Batch{}
+	planned := 0
+	for _, plan := range plans {
+		sql, args, err := s.builder.
+			Update("scheduled_emails").
+			Set("mailbox_id", plan.MailboxID).
+			Set("send_at", plan.SendAt.UTC()).
+			Set("updated_at", sq.Expr("NOW()")).
+			Where(sq.Eq{"id": plan.ID, "status": model.ScheduledEmailPending, "mailbox_id": nil}).
+			ToSql()
+		if err != nil {
+			return 0, err
+		}
+		batch.Queue(sql, args...).Exec(func(cmd pgconn.CommandTag) error {
+			planned += int(cmd.RowsAffected())
+			return nil
+		})
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return 0, err
+	}
+	return planned, nil
+}
+
+func (s *PGStore) UnplanScheduledEmails(ctx context.Context, sequenceID uint64, after time.Time) (_ []*model.ScheduledEmail, err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := s.selectScheduledEmails().
+		Where(sq.Eq{"e.sequence_id": sequenceID, "se.status": model.ScheduledEmailPending}).
+		Where(sq.NotEq{"se.mailbox_id": nil}).
+		Where(sq.Gt{"se.send_at": after.UTC()}).
+		OrderBy("se.send_at ASC", "se.id ASC").
+		Suffix("FOR UPDATE OF se SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	emails, err := collectScheduledEmails(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(emails) == 0 {
+		return emails, tx.Commit(ctx)
+	}
+
+	ids := make([]uint64, len(emails))
+	for i, email := range emails {
+		ids[i] = email.ID
+	}
+	sql, args, err = s.builder.
+		Update("scheduled_emails").
+		Set("mailbox_id", nil).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where("id = ANY(?)", ids).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return nil, err
+	}
+
+	return emails, tx.Commit(ctx)
+}
+
+func (s *PGStore) ClaimDueEmail(ctx context.Context, now time.Time, lease time.Duration) (_ *model.Delivery, err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The enrollment is locked as well, so an email is never claimed while
+	// the enrollment is being paused. Rows locked by other workers or
+	// transitions are skipped rather than waited for.
+	sql, args, err := s.selectScheduledEmails().
+		Column("e.contact_id").
+		Where(sq.Or{
+			sq.Eq{"se.status": model.ScheduledEmailPending},
+			sq.And{
+				sq.Eq{"se.status": model.ScheduledEmailSending},
+				sq.LtOrEq{"se.claimed_at": now.Add(-lease).UTC()},
+			},
+		}).
+		Where(sq.Eq{"e.status": model.EnrollmentActive}).
+		Where(sq.NotEq{"se.mailbox_id": nil, "se.step_id": nil}).
+		Where(sq.LtOrEq{"se.send_at": now.UTC()}).
+		OrderBy("se.send_at ASC", "se.id ASC").
+		Limit(1).
+		Suffix("FOR UPDATE OF se, e SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		email     model.ScheduledEmail
+		contactID uint64
+	)
+	err = tx.QueryRow(ctx, sql, args...).Scan(
+		&email.ID,
+		&email.SequenceID,
+		&email.EnrollmentID,
+		&email.StepID,
+		&email.MailboxID,
+		&email.SendAt,
+		&email.Status,
+		&email.SentAt,
+		&email.Error,
+		&email.Attempts,
+		&email.CreatedAt,
+		&email.UpdatedAt,
+		&contactID,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sql, args, err = s.builder.
+		Update("scheduled_emails").
+		Set("status", model.ScheduledEmailSending).
+		Set("claimed_at", now.UTC()).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": email.ID}).
+		Suffix("RETURNING updated_at").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&email.UpdatedAt); err != nil {
+		return nil, err
+	}
+	email.Status = model.ScheduledEmailSending
+
+	delivery, err := s.fetchDelivery(ctx, tx, &email, contactID)
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, tx.Commit(ctx)
+}
+
+func (s *PGStore) FinishDelivery(ctx context.Context, id uint64, result *model.DeliveryResult) (err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := s.selectScheduledEmails().
+		Column("e.status").
+		Where(sq.Eq{"se.id": id, "se.status": model.ScheduledEmailSending}).
+		Suffix("FOR UPDATE OF se, e").
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	var (
+		email  model.ScheduledEmail
+		status model.EnrollmentStatus
+	)
+	err = tx.QueryRow(ctx, sql, args...).Scan(
+		&email.ID,
+		&email.SequenceID,
+		&email.EnrollmentID,
+		&email.StepID,
+		&email.MailboxID,
+		&email.SendAt,
+		&email.Status,
+		&email.SentAt,
+		&email.Error,
+		&email.Attempts,
+		&email.CreatedAt,
+		&email.UpdatedAt,
+		&status,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	update := s.builder.
+		Update("scheduled_emails").
+		Set("claimed_at", nil).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": email.ID})
+	switch {
+	case !result.SentAt.IsZero():
+		update = update.
+			Set("status", model.ScheduledEmailSent).
+			Set("sent_at", result.SentAt.UTC())
+	case !result.RetryAt.IsZero():
+		// A paused enrollment keeps the time as canceled, resuming plans
+		// the step no earlier.
+		retryStatus := model.ScheduledEmailCanceled
+		sendAt := result.RetryAt.UTC()
+		if status == model.EnrollmentActive {
+			window, err := s.sendingWindow(ctx, tx, email.SequenceID)
+			if err != nil {
+				return err
+			}
+			retryStatus, sendAt = model.ScheduledEmailPending, window.Next(sendAt)
+		}
+		update = update.
+			Set("status", retryStatus).
+			Set("send_at", sendAt).
+			Set("error", result.Error).
+			Set("attempts", sq.Expr("attempts + 1"))
+	default:
+		update = update.
+			Set("status", model.ScheduledEmailFailed).
+			Set("error", result.Error).
+			Set("attempts", sq.Expr("attempts + 1"))
+	}
+	sql, args, err = update.ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return err
+	}
+
+	switch {
+	case status.Final():
+	case !result.SentAt.IsZero():
+		if err := s.scheduleNextStep(ctx, tx, &email, status, result.SentAt); err != nil {
+			return err
+		}
+	case result.RetryAt.IsZero() && (result.Rejected || status == model.EnrollmentActive):
+		next := model.EnrollmentPaused
+		if result.Rejected {
+			next = model.EnrollmentBounced
+		}
+		sql, args, err := s.transitionQuery(next).
+			Where(sq.Eq{"id": email.EnrollmentID}).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, sql, args...); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// scheduleNextStep moves the enrollment of a sent email to the first step it
+// has not been sent yet and schedules it, or completes the enrollment when
+// every step has been sent. Enrollments paused while the email was sent move
+// on without an email, resuming schedules the step. The enrollment must be
+// locked.
+func (s *PGStore) scheduleNextStep(ctx context.Context, tx pgx.Tx, email *model.ScheduledEmail, status model.EnrollmentStatus, sentAt time.Time) error {
+	steps, err := s.sequenceSteps(ctx, tx, email.SequenceID)
+	if err != nil {
+		return err
+	}
+	progress, err := s.fetchProgress(ctx, tx, []*model.Enrollment{{ID: email.EnrollmentID}})
+	if err != nil {
+		return err
+	}
+	next := model.NextStep(steps, progress[0].Sent)
+	if next == nil {
+		sql, args, err := s.transitionQuery(model.EnrollmentCompleted).
+			Where(sq.Eq{"id": email.EnrollmentID}).
+			ToSql()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, sql, args...)
+		return err
+	}
+
+	sql, args, err := s.builder.
+		Update("enrollments").
+		Set("current_step_id", next.ID).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where(sq.Eq{"id": email.EnrollmentID}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return err
+	}
+	if status != model.EnrollmentActive {
+		return nil
+	}
+
+	window, err := s.sendingWindow(ctx, tx, email.SequenceID)
+	if err != nil {
+		return err
+	}
+	capacity, err := s.sequenceCapacity(ctx, tx, email.SequenceID)
+	if err != nil {
+		return err
+	}
+	sendAt, err := window.NextFreeSlot(next.DueAfter(sentAt.UTC()), capacity, func(from, to time.Time) (int, error) {
+		return s.countPlannedEmails(ctx, tx, email.SequenceID, from, to)
+	})
+	if err != nil {
+		return err
+	}
+
+	sql, args, err = s.builder.
+		Insert("scheduled_emails").
+		Columns("enrollment_id", "step_id", "send_at").
+		Values(email.EnrollmentID, next.ID, sendAt).
+		ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, sql, args...)
+	return err
+}
+
+func (s *PGStore) RescheduleEnrollments(ctx context.Context, sequenceID, after uint64, limit int, now time.Time) (_ *model.RescheduleResult, err error) {
+	defer translateError(&err)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	window, err := s.sendingWindow(ctx, tx, sequenceID)
+	if err != nil {
+		return nil, err
+	}
+	steps, err := s.sequenceSteps(ctx, tx, sequenceID)
+	if err != nil {
+		return nil, err
+	}
+
+	sql, args, err := s.builder.
+		Select(enrollmentColumns...).
+		From("enrollments").
+		Where(sq.Eq{
+			"sequence_id": sequenceID,
+			"status":      []model.EnrollmentStatus{model.EnrollmentActive, model.EnrollmentPaused},
+		}).
+		Where(sq.Gt{"id": after}).
+		OrderBy("id ASC").
+		Limit(uint64(limit)).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	enrollments, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*model.Enrollment, error) {
+		enrollment := &model.Enrollment{}
+		return enrollment, scanEnrollment(row, enrollment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := &model.RescheduleResult{}
+	if len(enrollments) == 0 {
+		return result, tx.Commit(ctx)
+	}
+	result.LastID = enrollments[len(enrollments)-1].ID
+
+	progress, err := s.fetchProgress(ctx, tx, enrollments)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		canceled  []uint64
+		completed []uint64
+		emails    [][]any
+		batch     = &pgx.Batch{}
+	)
+	now = now.UTC()
+	for _, p := range progress {
+		replan := p.Replan(steps, window, now)
+		if replan == nil {
+			continue
+		}
+		if replan.CancelID != 0 {
+			canceled = append(canceled, replan.CancelID)
+		}
+		if replan.Complete {
+			completed = append(completed, p.Enrollment.ID)
+			continue
+		}
+
+		var stepID *uint64
+		if replan.Step != nil {
+			stepID = &replan.Step.ID
+		}
+		sql, args, err := s.builder.
+			Update("enrollments").
+			Set("current_step_id", stepID).
+			Set("updated_at", sq.Expr("NOW()")).
+			Where(sq.Eq{"id": p.Enrollment.ID}).
+			ToSql()
+		if err != nil {
+			return nil, err
+		}
+		batch.Queue(sql, args...)
+		if !replan.SendAt.IsZero() {
+			emails = append(emails, []any{p.Enrollment.ID, replan.Step.ID, replan.SendAt.UTC()})
+		}
+		result.Rescheduled++
+	}
+	result.Completed = len(completed)
+
+	// Pending emails are canceled before the new ones are inserted, an
+	// enrollment has at most one.
+	if len(canceled) > 0 {
+		sql, args, err := s.builder.
+			Update("scheduled_emails").
+			Set("status", model.ScheduledEmailCanceled).
+			Set("updated_at", sq.Expr("NOW()")).
+			Where("id = ANY(?)", canceled).
+			ToSql()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx, sql, args...); err != nil {
+			return nil, err
+		}
+	}
+	if len(completed) > 0 {
+		sql, args, err := s.transitionQuery(model.EnrollmentCompleted).
+			Where("id = ANY(?)", completed).
+			ToSql()
+		if err != nil {
+			return nil, err
+		}
+		batch.Queue(sql, args...)
+	}
+	if batch.Len() > 0 {
+		if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+			return nil, err
+		}
+	}
+	if len(emails) > 0 {
+		_, err := tx.CopyFrom(ctx,
+			pgx.Identifier{"scheduled_emails"},
+			[]string{"enrollment_id", "step_id", "send_at"},
+			pgx.CopyFromRows(emails),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, tx.Commit(ctx)
+}
+
+// fetchProgress returns what has been sent to each of the enrollments and
+// their pending emails or the ones being sent, in the order of the
+// enrollments.
+func (s *PGStore) fetchProgress(ctx context.Context, tx pgx.Tx, enrollments []*model.Enrollment) ([]*model.Progress, error) {
+	ids := make([]uint64, len(enrollments))
+	progress := make([]*model.Progress, len(enrollments))
+	byID := make(map[uint64]*model.Progress, len(enrollments))
+	for i, enrollment := range enrollments {
+		ids[i] = enrollment.ID
+		progress[i] = &model.Progress{
+			Enrollment: enrollment,
+			Sent:       make(map[uint64]time.Time),
+		}
+		byID[enrollment.ID] = progress[i]
+	}
+
+	sql, args, err := s.selectScheduledEmails().
+		Where("se.enrollment_id = ANY(?)", ids).
+		Where(sq.Eq{"se.status": model.PlannedEmailStatuses}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	emails, err := collectScheduledEmails(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, email := range emails {
+		p := byID[email.EnrollmentID]
+		if email.Status != model.ScheduledEmailSent {
+			p.Pending = email
+			continue
+		}
+		if email.SentAt.After(p.LastSent) {
+			p.LastSent = *email.SentAt
+		}
+		if email.StepID == nil {
+			continue
+		}
+		if sentAt, ok := p.Sent[*email.StepID]; !ok || email.SentAt.After(sentAt) {
+			p.Sent[*email.StepID] = *email.SentAt
+		}
+	}
+
+	return progress, nil
+}
+
+// sequenceSteps returns the steps of the sequence ordered by position.
+func (s *PGStore) sequenceSteps(ctx context.Context, tx pgx.Tx, sequenceID uint64) ([]*model.Step, error) {
+	sql, args, err := s.builder.
+		Select(stepColumns...).
+		From("steps").
+		Where(sq.Eq{"sequence_id": sequenceID}).
+		OrderBy("position ASC").
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*model.Step, error) {
+		step := &model.Step{}
+		return step, scanStep(row, step)
+	})
+}
+
+// sequenceCapacity returns the number of emails the mailboxes of the sequence
+// send a day.
+func (s *PGStore) sequenceCapacity(ctx context.Context, q rowQuerier, sequenceID uint64) (int, error) {
+	sql, args, err := s.builder.
+		Select("COALESCE(SUM(m.daily_capacity), 0)").
+		From("mailboxes m").
+		Join("sequence_mailboxes sm ON sm.mailbox_id = m.id").
+		Where(sq.Eq{"sm.sequence_id": sequenceID}).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var capacity int
+	return capacity, q.QueryRow(ctx, sql, args...).Scan(&capacity)
+}
+
+// countPlannedEmails returns the number of emails planned within [from, to)
+// that take up the capacity of the sequence mailboxes: the pending, sending
+// and sent emails of the mailboxes and the pending emails of the sequence
+// waiting for a mailbox.
+func (s *PGStore) countPlannedEmails(ctx context.Context, q rowQuerier, sequenceID uint64, from, to time.Time) (int, error) {
+	sql, args, err := s.builder.
+		Select("COUNT(*)").
+		From("scheduled_emails se").
+		Join("enrollments e ON e.id = se.enrollment_id").
+		Where(sq.GtOrEq{"se.send_at": from.UTC()}).
+		Where(sq.Lt{"se.send_at": to.UTC()}).
+		Where(sq.Or{
+			sq.And{
+				sq.Eq{"se.status": model.PlannedEmailStatuses},
+				sq.Expr("se.mailbox_id IN (SELECT mailbox_id FROM sequence_mailboxes WHERE sequence_id = ?)", sequenceID),
+			},
+			sq.Eq{"se.status": model.ScheduledEmailPending, "se.mailbox_id": nil, "e.sequence_id": sequenceID},
+		}).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	return count, q.QueryRow(ctx, sql, args...).Scan(&count)
+}
+
+// fetchDelivery loads the mailbox, contact, step and sequence of the email.
+func (s *PGStore) fetchDelivery(ctx context.Context, tx pgx.Tx, email *model.ScheduledEmail, contactID uint64) (*model.Delivery, error) {
+	delivery := &model.Delivery{
+		Email:    email,
+		Mailbox:  &model.Mailbox{},
+		Contact:  &model.Contact{},
+		Step:     &model.Step{},
+		Sequence: &model.Sequence{},
+	}
+
+	batch := &pgx.Batch{}
+	for _, query := range []struct {
+		table   string
+		columns []string
+		id      uint64
+		scan    func(row pgx.Row) error
+	}{
+		{"mailboxes", mailboxColumns, *email.MailboxID, func(row pgx.Row) error { return s.scanMailbox(row, delivery.Mailbox) }},
+		{"contacts", contactColumns, contactID, func(row pgx.Row) error { return scanContact(row, delivery.Contact) }},
+		{"steps", stepColumns, *email.StepID, func(row pgx.Row) error { return scanStep(row, delivery.Step) }},
+		{"sequences", sequenceColumns, email.SequenceID, func(row pgx.Row) error { return scanSequence(row, delivery.Sequence) }},
+	} {
+		sql, args, err := s.builder.
+			Select(query.columns...).
+			From(query.table).
+			Where(sq.Eq{"id": query.id}).
+			ToSql()
+		if err != nil {
+			return nil, err
+		}
+		batch.Queue(sql, args...).QueryRow(query.scan)
+	}
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// selectScheduledEmails returns a query selecting scheduledEmailColumns.
+func (s *PGStore) selectScheduledEmails() sq.SelectBuilder {
+	return s.builder.
+		Select(scheduledEmailColumns...).
+		From("scheduled_emails se").
+		Join("enrollments e ON e.id = se.enrollment_id")
+}
+
+func collectScheduledEmails(rows pgx.Rows) ([]*model.ScheduledEmail, error) {
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*model.ScheduledEmail, error) {
+		email := &model.ScheduledEmail{}
+		return email, scanScheduledEmail(row, email)
+	})
+}
+
+// sendingWindow returns the sending window of the sequence.
+func (s *PGStore) sendingWindow(ctx context.Context, q rowQuerier, sequenceID uint64) (*model.SendingWindow, error) {
+	sql, args, err := s.builder.
+		Select(sequenceColumns...).
+		From("sequences").
+		Where(sq.Eq{"id": sequenceID}).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var sequence model.Sequence
+	if err := scanSequence(q.QueryRow(ctx, sql, args...), &sequence); err != nil {
+		return nil, err
+	}
+	return sequence.SendingWindow()
+}
+
+// scheduleEmails queues a pending email for the current step of every
+// enrollment. Emails are sent at the next slot of the window after the later
+// of now and the time the step was planned for before the enrollment was
+// paused. Enrollments without a current step are skipped, and so are
+// enrollments with an email being sent, finishing it schedules the next step.
+func (s *PGStore) scheduleEmails(ctx context.Context, tx pgx.Tx, window *model.SendingWindow, enrollmentIDs []uint64, now time.Time) error {
+	if len(enrollmentIDs) == 0 {
+		return nil
+	}
+
+	sql, args, err := s.builder.
+		Select("e.id", "e.current_step_id", "MAX(se.send_at)").
+		From("enrollments e").
+		LeftJoin("scheduled_emails se ON se.enrollment_id = e.id AND se.step_id = e.current_step_id AND se.status = ?", model.ScheduledEmailCanceled).
+		Where("e.id = ANY(?)", enrollmentIDs).
+		Where(sq.NotEq{"e.current_step_id": nil}).
+		Where("NOT EXISTS (SELECT 1 FROM scheduled_emails sending WHERE sending.enrollment_id = e.id AND sending.status = ?)", model.ScheduledEmailSending).
+		GroupBy("e.id", "e.current_step_id").
+		ToSql()
+	if err != nil {
+		return err
+	}
+	rows, err := tx.Query(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	now = now.UTC()
+	emails, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) ([]any, error) {
+		var (
+			enrollmentID, stepID uint64
+			plannedAt            *time.Time
+		)
+		if err := row.Scan(&enrollmentID, &stepID, &plannedAt); err != nil {
+			return nil, err
+		}
+		sendAt := now
+		if plannedAt != nil && plannedAt.After(now) {
+			sendAt = *plannedAt
+		}
+		return []any{enrollmentID, stepID, window.Next(sendAt)}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"scheduled_emails"},
+		[]string{"enrollment_id", "step_id", "send_at"},
+		pgx.CopyFromRows(emails),
+	)
+	return err
+}
+
+// cancelEmails cancels the pending emails of the enrollments.
+func (s *PGStore) cancelEmails(ctx context.Context, tx pgx.Tx, enrollmentIDs []uint64) error {
+	if len(enrollmentIDs) == 0 {
+		return nil
+	}
+
+	sql, args, err := s.builder.
+		Update("scheduled_emails").
+		Set("status", model.ScheduledEmailCanceled).
+		Set("updated_at", sq.Expr("NOW()")).
+		Where("enrollment_id = ANY(?)", enrollmentIDs).
+		Where(sq.Eq{"status": model.ScheduledEmailPending}).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, sql, args...)
+	return err
+}
@@ -0,0 +1,90 @@
+package model
+
+import "time"
+
+// NextStep returns the first step in order that has not been sent, or nil
+// when every step has been sent. sent holds the send times by step ID.
+func NextStep(steps []*Step, sent map[uint64]time.Time) *Step {
+	for _, step := range steps {
+		if _, ok := sent[step.ID]; !ok {
+			return step
+		}
+	}
+	return nil
+}
+
+// Progress is what an active or paused enrollment has been sent so far.
+type Progress struct {
+	Enrollment *Enrollment
+	// Send times of the sent steps by step ID.
+	Sent map[uint64]time.Time
+	// Time of the last sent email, including emails of deleted steps.
+	LastSent time.Time
+	// Pending email or the email being sent, nil for paused enrollments.
+	Pending *ScheduledEmail
+}
+
+// Replan holds the changes that bring an enrollment in line with the steps
+// of its sequence.
+type Replan struct {
+	// Step the enrollment moves to. Nil when every step has been sent or the
+	// sequence has no steps.
+	Step *Step
+	// Pending email to cancel, zero for none.
+	CancelID uint64
+	// Send time of the new pending email of Step, zero for none.
+	SendAt time.Time
+	// Whether the enrollment is completed.
+	Complete bool
+}
+
+// Replan returns the changes that make the enrollment send the first step
+// it has not been sent yet, in the order and with the waits of steps, or
+// nil when nothing changes. A step follows the last sent email by its wait,
+// even one of a deleted step, and the first step keeps its planned time. Emails that are due or being sent
+// already are left to be sent, and so are emails moved within their sending day, so
+// their mailbox stays assigned.
+func (p *Progress) Replan(steps []*Step, window *SendingWindow, now time.Time) *Replan {
+	if p.Pending != nil && (p.Pending.Status == ScheduledEmailSending || !p.Pending.SendAt.After(now)) {
+		return nil
+	}
+
+	replan := &Replan{Step: NextStep(steps, p.Sent)}
+	if p.Pending != nil {
+		replan.CancelID = p.Pending.ID
+	}
+	if replan.Step == nil {
+		replan.Complete = len(p.Sent) > 0
+		if replan.CancelID == 0 && !replan.Complete && p.Enrollment.CurrentStepID == nil {
+			return nil
+		}
+		return replan
+	}
+
+	if p.Enrollment.Status == EnrollmentActive {
+		due := now
+		if !p.LastSent.IsZero() {
+			due = replan.Step.DueAfter(p.LastSent)
+		} else if p.Pending != nil {
+			due = p.Pending.SendAt
+		}
+		if due.Before(now) {
+			due = now
+		}
+		replan.SendAt = window.Next(due)
+
+		if p.Pending != nil && p.Pending.StepID != nil && *p.Pending.StepID == replan.Step.ID {
+			pendingDay, _, _ := window.Day(p.Pending.SendAt)
+			day, _, _ := window.Day(replan.SendAt)
+			if pendingDay.Equal(day) {
+				replan.CancelID, replan.SendAt = 0, time.Time{}
+			}
+		}
+	}
+
+	current := p.Enrollment.CurrentStepID
+	if replan.CancelID == 0 && replan.SendAt.IsZero() && current != nil && *current == replan.Step.ID {
+		return nil
+	}
+	return replan
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressReplan(t *testing.T) {
+	sequence := &Sequence{}
+	sequence.ApplySendingWindowDefaults()
+	window, err := sequence.SendingWindow()
+	require.NoError(t, err)
+
+	steps := []*Step{{ID: 1}, {ID: 3, WaitHours: 5}, {ID: 2, WaitDays: 2}}
+	monday := time.Date(2030, time.January, 7, 10, 0, 0, 0, time.UTC)
+	now := monday.Add(time.Hour)
+	stepID := func(id uint64) *uint64 { return &id }
+	progress := func(status EnrollmentStatus, current uint64, pending *ScheduledEmail) *Progress {
+		return &Progress{
+			Enrollment: &Enrollment{Status: status, CurrentStepID: stepID(current)},
+			Sent:       map[uint64]time.Time{1: monday},
+			LastSent:   monday,
+			Pending:    pending,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		progress *Progress
+		want     *Replan
+	}{
+		{
+			"moves to the first step not sent",
+			progress(EnrollmentActive, 2, &ScheduledEmail{ID: 7, StepID: stepID(2), SendAt: monday.AddDate(0, 0, 2)}),
+			&Replan{Step: steps[1], CancelID: 7, SendAt: monday.Add(5 * time.Hour)},
+		},
+		{
+			"keeps an email planned on the same day",
+			progress(EnrollmentActive, 3, &ScheduledEmail{ID: 7, StepID: stepID(3), SendAt: monday.Add(6 * time.Hour)}),
+			nil,
+		},
+		{
+			"leaves due emails alone",
+			progress(EnrollmentActive, 2, &ScheduledEmail{ID: 7, StepID: stepID(2), SendAt: now}),
+			nil,
+		},
+		{
+			"leaves emails being sent alone",
+			progress(EnrollmentPaused, 2, &ScheduledEmail{ID: 7, StepID: stepID(2), SendAt: monday.AddDate(0, 0, 2), Status: ScheduledEmailSending}),
+			nil,
+		},
+		{
+			"only moves paused enrollments",
+			progress(EnrollmentPaused, 2, nil),
+			&Replan{Step: steps[1]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.progress.Replan(steps, window, now))
+		})
+	}
+
+	// A step follows the last sent email even when its step was deleted.
+	deleted := progress(EnrollmentActive, 2, nil)
+	deleted.LastSent = monday.Add(time.Hour)
+	require.Equal(t, &Replan{Step: steps[1], SendAt: monday.Add(6 * time.Hour)}, deleted.Replan(steps, window, now))
+
+	done := progress(EnrollmentActive, 2, nil)
+	done.Sent[2], done.Sent[3] = monday, monday
+	require.Equal(t, &Replan{Complete: true}, done.Replan(steps, window, now))
+}
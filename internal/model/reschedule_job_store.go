@@ -0,0 +1,36 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+type RescheduleJobKind string
+
+const (
+	// Bring pending emails in line with changed steps.
+	RescheduleSteps RescheduleJobKind = "steps"
+	// Share pending emails between changed mailboxes.
+	RebalanceMailboxes RescheduleJobKind = "mailboxes"
+)
+
+// RescheduleJob is a sequence queued for the rescheduler. Step and mailbox
+// changes queue it in the same transaction, so a job is never lost when the
+// process stops before running it. A sequence has at most one job of every
+// kind, queueing it again bumps the version.
+type RescheduleJob struct {
+	SequenceID uint64
+	Kind       RescheduleJobKind
+	Version    int
+	CreatedAt  time.Time
+}
+
+type RescheduleJobStore interface {
+	// Claim the oldest job that is not claimed, or was claimed longer than
+	// lease ago, so concurrent calls skip it. Returns nil when no job is
+	// left.
+	ClaimRescheduleJob(ctx context.Context, now time.Time, lease time.Duration) (*RescheduleJob, error)
+	// Remove a finished job. A job queued again since it was claimed is
+	// released to run once more instead.
+	FinishRescheduleJob(ctx context.Context, job *RescheduleJob) error
+}
@@ -0,0 +1,135 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+type ScheduledEmailStatus string
+
+const (
+	ScheduledEmailPending ScheduledEmailStatus = "pending"
+	// Claimed by a worker that is sending it.
+	ScheduledEmailSending  ScheduledEmailStatus = "sending"
+	ScheduledEmailSent     ScheduledEmailStatus = "sent"
+	ScheduledEmailFailed   ScheduledEmailStatus = "failed"
+	ScheduledEmailCanceled ScheduledEmailStatus = "canceled"
+)
+
+// PlannedEmailStatuses are the statuses of emails that take up the capacity
+// of their mailbox.
+var PlannedEmailStatuses = []ScheduledEmailStatus{ScheduledEmailPending, ScheduledEmailSending, ScheduledEmailSent}
+
+// ScheduledEmail is a single send of a step to an enrolled contact. An
+// active enrollment has at most one pending email, the one of its current
+// step.
+type ScheduledEmail struct {
+	ID           uint64 `json:"id"`
+	SequenceID   uint64 `json:"sequenceId"`
+	EnrollmentID uint64 `json:"enrollmentId"`
+	// Step the email sends. Nil once the step is deleted, sent emails are
+	// kept to count against their mailbox and time the following steps.
+	StepID *uint64 `json:"stepId"`
+	// Mailbox the email is sent from. Nil until the scheduler assigns one.
+	MailboxID *uint64 `json:"mailboxId"`
+	// Planned send time, always inside the sending window of the sequence.
+	SendAt time.Time            `json:"sendAt"`
+	Status ScheduledEmailStatus `json:"status"`
+	SentAt *time.Time           `json:"sentAt"`
+	// Reason the email failed, or the last attempt when it is retried.
+	Error string `json:"error,omitempty"`
+	// Number of failed attempts to send the email.
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Delivery holds everything needed to send a scheduled email.
+type Delivery struct {
+	Email   *ScheduledEmail
+	Mailbox *Mailbox
+	Contact *Contact
+	Step    *Step
+	// Sequence of the email without its steps.
+	Sequence *Sequence
+}
+
+// DeliveryResult is the outcome of sending a claimed email.
+type DeliveryResult struct {
+	// Time the email was sent, zero when sending failed.
+	SentAt time.Time
+	// Reason sending failed.
+	Error string
+	// Time to send the email again after a transient failure, zero to give
+	// up.
+	RetryAt time.Time
+	// Whether the recipient or the message was refused for good.
+	Rejected bool
+}
+
+// ScheduledEmailPlan assigns a pending email to a mailbox and a send time.
+// Postponed emails have no mailbox.
+type ScheduledEmailPlan struct {
+	ID        uint64
+	MailboxID *uint64
+	SendAt    time.Time
+}
+
+// PlanFunc returns the plans of emails given the number of emails every
+// mailbox has planned already.
+type PlanFunc func(used map[uint64]int) []*ScheduledEmailPlan
+
+// RescheduleResult counts the enrollments changed by a rescheduling batch.
+type RescheduleResult struct {
+	// ID of the last enrollment of the batch, zero when none were left.
+	LastID uint64 `json:"lastId"`
+	// Enrollments that moved to another step or send time.
+	Rescheduled int `json:"rescheduled"`
+	// Enrollments completed because every step has been sent.
+	Completed int `json:"completed"`
+}
+
+type ScheduledEmailStore interface {
+	// List the scheduled emails of an enrollment ordered by ID, including
+	// sent and canceled ones.
+	ListScheduledEmails(ctx context.Context, enrollmentID uint64) ([]*ScheduledEmail, error)
+	// List pending emails without a mailbox planned before the time,
+	// ordered by send time and ID.
+	ListUnplannedEmails(ctx context.Context, until time.Time) ([]*ScheduledEmail, error)
+	// Count the pending, sending and sent emails of every mailbox planned within
+	// [from, to). Mailboxes without emails are left out.
+	CountMailboxEmails(ctx context.Context, mailboxIDs []uint64, from, to time.Time) (map[uint64]int, error)
+	// Apply the plans to emails that are still pending without a mailbox and
+	// return their number. Other emails are left untouched.
+	PlanScheduledEmails(ctx context.Context, plans []*ScheduledEmailPlan) (int, error)
+	// Count the emails of the mailboxes like CountMailboxEmails, pass the
+	// counts to plan and apply the plans it returns like PlanScheduledEmails,
+	// all while holding the mailboxes. Concurrent calls sharing a mailbox
+	// run one after another, so together they never exceed its capacity.
+	// plan must not call the store.
+	PlanMailboxEmails(ctx context.Context, mailboxIDs []uint64, from, to time.Time, plan PlanFunc) (int, error)
+	// Take the mailbox away from the pending emails of the sequence planned
+	// after the time, so they can be planned again. Emails being delivered
+	// are skipped. Returns the emails as they were, ordered by send time and
+	// ID.
+	UnplanScheduledEmails(ctx context.Context, sequenceID uint64, after time.Time) ([]*ScheduledEmail, error)
+	// Claim the earliest pending email with a mailbox of an active
+	// enrollment that is due at the time and mark it sending, so concurrent
+	// calls skip it. Emails claimed longer than lease ago are claimed again,
+	// their worker is assumed gone. Returns nil when no email is due.
+	ClaimDueEmail(ctx context.Context, now time.Time, lease time.Duration) (*Delivery, error)
+	// Record the result of sending a claimed email. A sent email moves its
+	// enrollment to the first step it has not been sent yet and schedules it
+	// after the wait of the step, or completes the enrollment when every step
+	// has been sent. An email to retry is pending again at the next slot of
+	// the sending window after the retry time, or canceled when the
+	// enrollment is no longer active. Otherwise the email fails: a rejected
+	// email bounces the enrollment, any other failure pauses an active one so
+	// resuming sends the step again. Emails that are not being sent are left
+	// untouched.
+	FinishDelivery(ctx context.Context, id uint64, result *DeliveryResult) error
+	// Bring up to limit active and paused enrollments of the sequence with
+	// IDs greater than after in line with its steps, see Progress.Replan.
+	// Enrollments are taken in ID order and locked for the batch only.
+	RescheduleEnrollments(ctx context.Context, sequenceID, after uint64, limit int, now time.Time) (*RescheduleResult, error)
+}
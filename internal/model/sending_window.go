@@ -0,0 +1,150 @@
+package model
+
+import "time"
+
+const (
+	DefaultStartTime = "09:00"
+	DefaultEndTime   = "17:00"
+	DefaultTimezone  = "UTC"
+
+	// Layout of the sending window boundaries.
+	TimeOfDayLayout = "15:04"
+
+	// How many sending days NextFreeSlot looks ahead for free capacity.
+	maxPostponedDays = 31
+)
+
+var (
+	ErrInvalidTimeOfDay     = newError(ErrValidation, "invalid_time_of_day", "", "sending window times must be formatted as HH:MM")
+	ErrInvalidSendingWindow = newError(ErrValidation, "invalid_sending_window", "endTime", "sending window must end after it starts")
+	ErrInvalidTimezone      = newError(ErrValidation, "invalid_timezone", "timezone", "unknown timezone")
+	ErrInvalidWeekdays      = newError(ErrValidation, "invalid_weekdays", "weekdays", "weekdays must be unique values from 0 (Sunday) to 6 (Saturday)")
+)
+
+// DefaultWeekdays are the days emails are sent on unless configured otherwise.
+func DefaultWeekdays() []time.Weekday {
+	return []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+}
+
+// ApplySendingWindowDefaults fills sending window settings left empty.
+func (s *Sequence) ApplySendingWindowDefaults() {
+	if s.StartTime == "" {
+		s.StartTime = DefaultStartTime
+	}
+	if s.EndTime == "" {
+		s.EndTime = DefaultEndTime
+	}
+	if s.Timezone == "" {
+		s.Timezone = DefaultTimezone
+	}
+	if len(s.Weekdays) == 0 {
+		s.Weekdays = DefaultWeekdays()
+	}
+}
+
+// ValidateSendingWindow checks that the sequence can be scheduled.
+func (s *Sequence) ValidateSendingWindow() error {
+	start, err := time.Parse(TimeOfDayLayout, s.StartTime)
+	if err != nil {
+		return ErrInvalidTimeOfDay.WithField("startTime")
+	}
+	end, err := time.Parse(TimeOfDayLayout, s.EndTime)
+	if err != nil {
+		return ErrInvalidTimeOfDay.WithField("endTime")
+	}
+	if !end.After(start) {
+		return ErrInvalidSendingWindow
+	}
+
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return ErrInvalidTimezone
+	}
+
+	if len(s.Weekdays) == 0 {
+		return ErrInvalidWeekdays
+	}
+	var seen [7]bool
+	for _, day := range s.Weekdays {
+		if day < time.Sunday || day > time.Saturday || seen[day] {
+			return ErrInvalidWeekdays
+		}
+		seen[day] = true
+	}
+
+	return nil
+}
+
+// SendingWindow is a parsed sequence sending window.
+type SendingWindow struct {
+	start    time.Time
+	end      time.Time
+	location *time.Location
+	weekdays [7]bool
+}
+
+// SendingWindow parses the sending window settings of the sequence.
+func (s *Sequence) SendingWindow() (*SendingWindow, error) {
+	if err := s.ValidateSendingWindow(); err != nil {
+		return nil, err
+	}
+
+	w := &SendingWindow{}
+	w.start, _ = time.Parse(TimeOfDayLayout, s.StartTime)
+	w.end, _ = time.Parse(TimeOfDayLayout, s.EndTime)
+	w.location, _ = time.LoadLocation(s.Timezone)
+	for _, day := range s.Weekdays {
+		w.weekdays[day] = true
+	}
+	return w, nil
+}
+
+// Day returns the boundaries of the window on the calendar day of t in the
+// window timezone, and whether emails are sent on that day.
+func (w *SendingWindow) Day(t time.Time) (start, end time.Time, ok bool) {
+	t = t.In(w.location)
+	year, month, day := t.Date()
+	start = time.Date(year, month, day, w.start.Hour(), w.start.Minute(), 0, 0, w.location)
+	end = time.Date(year, month, day, w.end.Hour(), w.end.Minute(), 0, 0, w.location)
+	return start.UTC(), end.UTC(), w.weekdays[t.Weekday()]
+}
+
+// Next returns the earliest moment at or after t inside the window.
+func (w *SendingWindow) Next(t time.Time) time.Time {
+	day := t.In(w.location)
+	for range 8 {
+		start, end, ok := w.Day(day)
+		if ok && t.Before(end) {
+			if t.Before(start) {
+				return start
+			}
+			return t.UTC()
+		}
+		year, month, date := day.Date()
+		day = time.Date(year, month, date+1, 0, 0, 0, 0, w.location)
+	}
+	// Unreachable for a validated window, which has at least one weekday.
+	return t.UTC()
+}
+
+// NextFreeSlot returns the earliest moment at or after t inside the window on
+// a day the mailboxes have capacity left. used returns the number of emails
+// planned for the mailboxes within [from, to). Without capacity, e.g. when no
+// mailboxes are attached, it is the same as Next.
+func (w *SendingWindow) NextFreeSlot(t time.Time, capacity int, used func(from, to time.Time) (int, error)) (time.Time, error) {
+	slot := w.Next(t)
+	if capacity == 0 {
+		return slot, nil
+	}
+	for range maxPostponedDays {
+		start, end, _ := w.Day(slot)
+		count, err := used(start, end)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if count < capacity {
+			return slot, nil
+		}
+		slot = w.Next(end)
+	}
+	return slot, nil
+}
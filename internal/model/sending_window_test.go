@@ -0,0 +1,82 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendingWindowNext(t *testing.T) {
+	sequence := &Sequence{Timezone: "America/New_York"}
+	sequence.ApplySendingWindowDefaults()
+	window, err := sequence.SendingWindow()
+	require.NoError(t, err)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, time.July, day, hour, minute, 0, 0, newYork)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"inside the window", at(1, 10, 30), at(1, 10, 30)},
+		{"before the window", at(1, 6, 0), at(1, 9, 0)},
+		{"at the end of the window", at(1, 17, 0), at(2, 9, 0)},
+		{"after the window on Friday", at(4, 18, 0), at(7, 9, 0)},
+		{"on Saturday", at(5, 12, 0), at(7, 9, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := window.Next(tt.t)
+			require.True(t, tt.want.Equal(got), "Expected %s, got %s", tt.want, got)
+			require.Equal(t, time.UTC, got.Location())
+		})
+	}
+}
+
+func TestSendingWindowDay(t *testing.T) {
+	sequence := &Sequence{Timezone: "Europe/Berlin", Weekdays: []time.Weekday{time.Sunday}}
+	sequence.ApplySendingWindowDefaults()
+	window, err := sequence.SendingWindow()
+	require.NoError(t, err)
+
+	// Clocks go back on the last Sunday of October, the window keeps its
+	// local hours.
+	start, end, ok := window.Day(time.Date(2025, time.October, 26, 12, 0, 0, 0, time.UTC))
+	require.True(t, ok)
+	require.Equal(t, time.Date(2025, time.October, 26, 8, 0, 0, 0, time.UTC), start)
+	require.Equal(t, time.Date(2025, time.October, 26, 16, 0, 0, 0, time.UTC), end)
+
+	_, _, ok = window.Day(time.Date(2025, time.October, 27, 12, 0, 0, 0, time.UTC))
+	require.False(t, ok)
+}
+
+func TestSendingWindowNextFreeSlot(t *testing.T) {
+	sequence := &Sequence{}
+	sequence.ApplySendingWindowDefaults()
+	window, err := sequence.SendingWindow()
+	require.NoError(t, err)
+
+	// Thursday is full, Friday has room left.
+	friday := time.Date(2025, time.July, 4, 9, 0, 0, 0, time.UTC)
+	used := func(from, to time.Time) (int, error) {
+		if from.Before(friday) {
+			return 2, nil
+		}
+		return 1, nil
+	}
+	thursday := time.Date(2025, time.July, 3, 12, 0, 0, 0, time.UTC)
+
+	slot, err := window.NextFreeSlot(thursday, 2, used)
+	require.NoError(t, err)
+	require.Equal(t, friday, slot)
+
+	slot, err = window.NextFreeSlot(thursday, 0, used)
+	require.NoError(t, err)
+	require.Equal(t, thursday, slot)
+}
@@ -5,34 +5,136 @@ import (
 	"time"
 )
 
+var (
+	ErrSequenceArchived = newError(ErrConflict, "sequence_archived", "", "sequence is archived")
+	ErrInvalidStepOrder = newError(ErrValidation, "invalid_step_order", "stepIds", "step order must list every step of the sequence exactly once")
+	ErrFirstStepDelay   = newError(ErrValidation, "first_step_delay", "waitDays", "first step cannot wait after enrollment")
+	ErrVersionMismatch  = newError(ErrConflict, "version_mismatch", "", "resource has been modified")
+)
+
 type Sequence struct {
-	ID                   uint64    `json:"id"`
-	Name                 string    `json:"name"`
-	OpenTrackingEnabled  bool      `json:"openTrackingEnabled"`
-	ClickTrackingEnabled bool      `json:"clickTrackingEnabled"`
-	CreatedAt            time.Time `json:"createdAt"`
-	UpdatedAt            time.Time `json:"updatedAt"`
-	Steps                []*Step   `json:"steps"`
+	ID                   uint64         `json:"id"`
+	Name                 string         `json:"name"`
+	OpenTrackingEnabled  bool           `json:"openTrackingEnabled"`
+	ClickTrackingEnabled bool           `json:"clickTrackingEnabled"`
+	StartTime            string         `json:"startTime"`
+	EndTime              string         `json:"endTime"`
+	Timezone             string         `json:"timezone"`
+	Weekdays             []time.Weekday `json:"weekdays"`
+	Version              int            `json:"version"`
+	CreatedAt            time.Time      `json:"createdAt"`
+	UpdatedAt            time.Time      `json:"updatedAt"`
+	ArchivedAt           *time.Time     `json:"archivedAt,omitempty"`
+	Steps                []*Step        `json:"steps"`
 }
 
 type Step struct {
 	ID         uint64    `json:"id"`
 	SequenceID uint64    `json:"-"`
+	Position   int       `json:"position"`
+	WaitDays   int       `json:"waitDays"`
+	WaitHours  int       `json:"waitHours"`
 	Subject    string    `json:"subject"`
 	Content    string    `json:"content"`
+	Version    int       `json:"version"`
 	CreatedAt  time.Time `json:"createdAt"`
 	UpdatedAt  time.Time `json:"updatedAt"`
 }
 
+const (
+	SortByID        = "id"
+	SortByCreatedAt = "createdAt"
+)
+
+type ListSequencesParams struct {
+	// Return sequences that come after the cursor.
+	After *Cursor
+	// Maximum number of sequences to return, DefaultPageSize when zero.
+	Limit uint64
+	// Case-insensitive substring of the sequence name.
+	Name string
+	// Filter by tracking flags when set.
+	OpenTrackingEnabled  *bool
+	ClickTrackingEnabled *bool
+	// Either SortByID or SortByCreatedAt.
+	SortBy     string
+	Descending bool
+}
+
+// SequencePatch holds sequence fields to update. Nil fields are left untouched.
+type SequencePatch struct {
+	// Expected current version of the sequence, zero skips the check.
+	Version              int
+	Name                 *string
+	OpenTrackingEnabled  *bool
+	ClickTrackingEnabled *bool
+	StartTime            *string
+	EndTime              *string
+	Timezone             *string
+	Weekdays             []time.Weekday
+}
+
+// Apply copies the provided fields onto the sequence.
+func (p *SequencePatch) Apply(sequence *Sequence) {
+	if p.Name != nil {
+		sequence.Name = *p.Name
+	}
+	if p.OpenTrackingEnabled != nil {
+		sequence.OpenTrackingEnabled = *p.OpenTrackingEnabled
+	}
+	if p.ClickTrackingEnabled != nil {
+		sequence.ClickTrackingEnabled = *p.ClickTrackingEnabled
+	}
+	if p.StartTime != nil {
+		sequence.StartTime = *p.StartTime
+	}
+	if p.EndTime != nil {
+		sequence.EndTime = *p.EndTime
+	}
+	if p.Timezone != nil {
+		sequence.Timezone = *p.Timezone
+	}
+	if p.Weekdays != nil {
+		sequence.Weekdays = p.Weekdays
+	}
+}
+
+// HasDelay reports whether the step waits after the previous one.
+func (s *Step) HasDelay() bool {
+	return s.WaitDays > 0 || s.WaitHours > 0
+}
+
+// DueAfter returns when the step is due if the previous one was sent at t.
+func (s *Step) DueAfter(t time.Time) time.Time {
+	return t.AddDate(0, 0, s.WaitDays).Add(time.Duration(s.WaitHours) * time.Hour)
+}
+
 type SequenceStore interface {
-	// Creates a sequence with steps.
+	// Creates a sequence with steps. The first step must not have a delay.
 	CreateSequence(ctx context.Context, sequence *Sequence) error
 	// Fetch a sequence by ID.
 	FetchSequence(ctx context.Context, id uint64) (*Sequence, error)
-	// Update sequence open or click tracking.
-	UpdateSequence(ctx context.Context, id uint64, sequence *Sequence) error
+	// List sequences page by page. The returned cursor is nil on the last page.
+	ListSequences(ctx context.Context, params *ListSequencesParams) ([]*Sequence, *Cursor, error)
+	// Delete a sequence together with its steps.
+	// A non-zero version must match the current sequence version.
+	DeleteSequence(ctx context.Context, id uint64, version int) error
+	// Archive a sequence, hiding it from listings and rejecting further edits.
+	// A non-zero version must match the current sequence version.
+	ArchiveSequence(ctx context.Context, id uint64, version int) error
+	// Update the provided sequence fields. The resulting sending window is validated.
+	UpdateSequence(ctx context.Context, id uint64, patch *SequencePatch) (*Sequence, error)
+	// Create a step at the given position, or append it when the position is not set.
+	// Every step change bumps the sequence version and queues a RescheduleSteps
+	// job for the sequence.
+	CreateStep(ctx context.Context, step *Step) error
+	// Renumber steps of a sequence in the given order and return the sequence.
+	// A non-zero version must match the current sequence version.
+	ReorderSteps(ctx context.Context, sequenceID uint64, version int, stepIDs []uint64) (*Sequence, error)
 	// Update a sequence step (new subject or content).
+	// A non-zero step version must match the current step version.
 	UpdateStep(ctx context.Context, id uint64, step *Step) error
-	// Delete a sequence step.
+	// Delete a sequence step and shift the following steps up.
+	// A non-zero step version must match the current step version.
 	DeleteStep(ctx context.Context, id uint64, step *Step) error
 }
@@ -0,0 +1,11 @@
+package model
+
+// Store combines every store the application depends on.
+type Store interface {
+	SequenceStore
+	ContactStore
+	EnrollmentStore
+	MailboxStore
+	ScheduledEmailStore
+	RescheduleJobStore
+}
@@ -0,0 +1,206 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func createContact(t *testing.T, store model.Store, ownerID uint64, email string) *model.Contact {
+	t.Helper()
+
+	contact := &model.Contact{OwnerID: ownerID, Email: email}
+	require.NoError(t, store.CreateContact(t.Context(), contact))
+	return contact
+}
+
+func contactIDs(contacts []*model.Contact) []uint64 {
+	ids := make([]uint64, len(contacts))
+	for i, contact := range contacts {
+		ids[i] = contact.ID
+	}
+	return ids
+}
+
+func testCreateContact(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	contact := &model.Contact{
+		OwnerID:      1,
+		Email:        " jane@example.com ",
+		FirstName:    "Jane",
+		Company:      "Acme",
+		Timezone:     "Europe/Berlin",
+		CustomFields: map[string]string{"title": "CTO"},
+	}
+	require.NoError(t, store.CreateContact(ctx, contact))
+	require.NotZero(t, contact.ID)
+	require.Equal(t, "jane@example.com", contact.Email)
+	require.False(t, contact.CreatedAt.IsZero())
+	require.Equal(t, contact.CreatedAt, contact.UpdatedAt)
+
+	fetched, err := store.FetchContact(ctx, contact.ID)
+	require.NoError(t, err)
+	require.Equal(t, contact, fetched)
+
+	// Emails are unique per owner regardless of case.
+	err = store.CreateContact(ctx, &model.Contact{OwnerID: 1, Email: "JANE@example.com"})
+	require.ErrorIs(t, err, model.ErrContactExists)
+	require.ErrorIs(t, err, model.ErrUniqueViolation)
+
+	other := createContact(t, store, 2, "jane@example.com")
+	require.NotEqual(t, contact.ID, other.ID)
+	require.Empty(t, other.CustomFields)
+	require.NotNil(t, other.CustomFields)
+
+	err = store.CreateContact(ctx, &model.Contact{OwnerID: 1, Email: "Jane <jane@example.org>"})
+	require.ErrorIs(t, err, model.ErrInvalidEmail)
+
+	err = store.CreateContact(ctx, &model.Contact{OwnerID: 1, Email: "john@example.com", Timezone: "Mars/Olympus"})
+	require.ErrorIs(t, err, model.ErrInvalidTimezone)
+
+	_, err = store.FetchContact(ctx, other.ID+1000)
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func testListContacts(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	first := createContact(t, store, 1, "alice@example.com")
+	second := createContact(t, store, 1, "bob@acme.com")
+	third := createContact(t, store, 1, "carol@example.com")
+	foreign := createContact(t, store, 2, "dave@example.com")
+
+	contacts, next, err := store.ListContacts(ctx, &model.ListContactsParams{Limit: 2, OwnerID: 1})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{first.ID, second.ID}, contactIDs(contacts))
+	require.NotNil(t, next)
+
+	contacts, next, err = store.ListContacts(ctx, &model.ListContactsParams{After: next, Limit: 2, OwnerID: 1})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{third.ID}, contactIDs(contacts))
+	require.Nil(t, next)
+
+	contacts, _, err = store.ListContacts(ctx, &model.ListContactsParams{Limit: 10, Email: "EXAMPLE.com"})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{first.ID, third.ID, foreign.ID}, contactIDs(contacts))
+
+	// Wildcards in the filter are matched literally.
+	contacts, _, err = store.ListContacts(ctx, &model.ListContactsParams{Limit: 10, Email: "%"})
+	require.NoError(t, err)
+	require.Empty(t, contacts)
+}
+
+func testUpdateContact(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	contact := createContact(t, store, 1, "jane@example.com")
+	createContact(t, store, 1, "john@example.com")
+
+	firstName := " Jane "
+	updated, err := store.UpdateContact(ctx, contact.ID, &model.ContactPatch{
+		FirstName:    &firstName,
+		CustomFields: map[string]string{"title": "CTO"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Jane", updated.FirstName)
+	require.Equal(t, "jane@example.com", updated.Email)
+	require.Equal(t, map[string]string{"title": "CTO"}, updated.CustomFields)
+	require.Equal(t, contact.CreatedAt, updated.CreatedAt)
+	require.False(t, updated.UpdatedAt.Before(contact.UpdatedAt))
+
+	fetched, err := store.FetchContact(ctx, contact.ID)
+	require.NoError(t, err)
+	require.Equal(t, updated, fetched)
+
+	email := "John@example.com"
+	_, err = store.UpdateContact(ctx, contact.ID, &model.ContactPatch{Email: &email})
+	require.ErrorIs(t, err, model.ErrContactExists)
+
+	// Changing the case of the own email is not a conflict.
+	email = "JANE@example.com"
+	updated, err = store.UpdateContact(ctx, contact.ID, &model.ContactPatch{Email: &email})
+	require.NoError(t, err)
+	require.Equal(t, email, updated.Email)
+
+	email = "not an email"
+	_, err = store.UpdateContact(ctx, contact.ID, &model.ContactPatch{Email: &email})
+	require.ErrorIs(t, err, model.ErrInvalidEmail)
+
+	_, err = store.UpdateContact(ctx, contact.ID+1000, &model.ContactPatch{FirstName: &firstName})
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func testDeleteContact(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	contact := createContact(t, store, 1, "jane@example.com")
+	other := createContact(t, store, 1, "john@example.com")
+
+	require.NoError(t, store.DeleteContact(ctx, contact.ID))
+
+	_, err := store.FetchContact(ctx, contact.ID)
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	err = store.DeleteContact(ctx, contact.ID)
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	fetched, err := store.FetchContact(ctx, other.ID)
+	require.NoError(t, err)
+	require.Equal(t, other, fetched)
+
+	// The email can be reused once the contact is gone.
+	createContact(t, store, 1, "jane@example.com")
+}
+
+func testImportContacts(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	existing := createContact(t, store, 1, "jane@example.com")
+	foreign := createContact(t, store, 2, "john@example.com")
+
+	batch := &model.ContactImport{
+		OwnerID: 1,
+		Contacts: []*model.Contact{
+			{Email: "JANE@example.com", FirstName: "Jane", CustomFields: map[string]string{}},
+			{Email: "john@example.com", FirstName: "John", CustomFields: map[string]string{"title": "CEO"}},
+		},
+	}
+	statuses, err := store.ImportContacts(ctx, batch)
+	require.NoError(t, err)
+	require.Equal(t, []model.ImportStatus{model.ImportSkipped, model.ImportCreated}, statuses)
+	require.Equal(t, existing, batch.Contacts[0])
+	require.NotEqual(t, foreign.ID, batch.Contacts[1].ID)
+	require.Equal(t, uint64(1), batch.Contacts[1].OwnerID)
+	require.False(t, batch.Contacts[1].CreatedAt.IsZero())
+
+	created, err := store.FetchContact(ctx, batch.Contacts[1].ID)
+	require.NoError(t, err)
+	require.Equal(t, batch.Contacts[1], created)
+
+	batch = &model.ContactImport{
+		OwnerID:        1,
+		UpdateExisting: true,
+		Contacts: []*model.Contact{
+			{Email: "Jane@Example.com", LastName: "Doe", CustomFields: map[string]string{}},
+			{Email: "john@example.com", CustomFields: map[string]string{"title": "CEO"}},
+		},
+	}
+	statuses, err = store.ImportContacts(ctx, batch)
+	require.NoError(t, err)
+	// Nothing changes for John, so the row is skipped.
+	require.Equal(t, []model.ImportStatus{model.ImportUpdated, model.ImportSkipped}, statuses)
+	require.Equal(t, existing.ID, batch.Contacts[0].ID)
+	require.Equal(t, "jane@example.com", batch.Contacts[0].Email)
+	require.Equal(t, "Doe", batch.Contacts[0].LastName)
+	require.Equal(t, created, batch.Contacts[1])
+
+	updated, err := store.FetchContact(ctx, existing.ID)
+	require.NoError(t, err)
+	require.Equal(t, batch.Contacts[0], updated)
+
+	contacts, _, err := store.ListContacts(ctx, &model.ListContactsParams{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, contacts, 3)
+}
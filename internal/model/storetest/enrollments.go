@@ -0,0 +1,162 @@
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func testCreateEnrollments(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	first := createContact(t, store, 1, "jane@example.com")
+	second := createContact(t, store, 1, "john@example.com")
+	firstStepID := sequence.Steps[0].ID
+
+	enrollments, err := store.CreateEnrollments(ctx, sequence.ID, firstStepID, []uint64{second.ID, first.ID, second.ID}, time.Now())
+	require.NoError(t, err)
+	require.Len(t, enrollments, 2)
+	for i, contact := range []*model.Contact{first, second} {
+		enrollment := enrollments[i]
+		require.NotZero(t, enrollment.ID)
+		require.Equal(t, sequence.ID, enrollment.SequenceID)
+		require.Equal(t, contact.ID, enrollment.ContactID)
+		require.Equal(t, model.EnrollmentActive, enrollment.Status)
+		require.Equal(t, &firstStepID, enrollment.CurrentStepID)
+		require.False(t, enrollment.EnrolledAt.IsZero())
+		require.Nil(t, enrollment.CompletedAt)
+
+		fetched, err := store.FetchEnrollment(ctx, enrollment.ID)
+		require.NoError(t, err)
+		require.Equal(t, enrollment, fetched)
+	}
+
+	third := createContact(t, store, 1, "mary@example.com")
+	_, err = store.CreateEnrollments(ctx, sequence.ID, firstStepID, []uint64{third.ID, first.ID}, time.Now())
+	require.ErrorIs(t, err, model.ErrAlreadyEnrolled)
+
+	_, err = store.CreateEnrollments(ctx, sequence.ID, firstStepID, []uint64{third.ID + 1000}, time.Now())
+	require.ErrorIs(t, err, model.ErrUnknownContact)
+
+	_, err = store.CreateEnrollments(ctx, sequence.ID, sequence.Steps[1].ID, []uint64{third.ID}, time.Now())
+	require.ErrorIs(t, err, model.ErrFirstStepChanged)
+
+	// Nothing is stored when the batch is rejected.
+	enrollments, err = store.CreateEnrollments(ctx, sequence.ID, firstStepID, []uint64{third.ID}, time.Now())
+	require.NoError(t, err)
+	require.Len(t, enrollments, 1)
+
+	// The same contact may be enrolled into another sequence.
+	other := createSequence(t, store, "Other Sequence")
+	_, err = store.CreateEnrollments(ctx, other.ID, other.Steps[0].ID, []uint64{first.ID}, time.Now())
+	require.NoError(t, err)
+
+	empty := &model.Sequence{Name: "Empty Sequence"}
+	require.NoError(t, store.CreateSequence(ctx, empty))
+	_, err = store.CreateEnrollments(ctx, empty.ID, firstStepID, []uint64{first.ID}, time.Now())
+	require.ErrorIs(t, err, model.ErrSequenceEmpty)
+
+	require.NoError(t, store.ArchiveSequence(ctx, other.ID, 0))
+	_, err = store.CreateEnrollments(ctx, other.ID, other.Steps[0].ID, []uint64{second.ID}, time.Now())
+	require.ErrorIs(t, err, model.ErrSequenceArchived)
+
+	_, err = store.CreateEnrollments(ctx, sequence.ID+1000, firstStepID, []uint64{first.ID}, time.Now())
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	_, err = store.FetchEnrollment(ctx, enrollments[0].ID+1000)
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func testTransitionEnrollment(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	contact := createContact(t, store, 1, "jane@example.com")
+	enrollment := Enroll(t, store, sequence, contact)[0]
+
+	paused, err := store.TransitionEnrollment(ctx, enrollment.ID, model.EnrollmentPaused, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, model.EnrollmentPaused, paused.Status)
+	require.Nil(t, paused.CompletedAt)
+	require.Equal(t, enrollment.EnrolledAt, paused.EnrolledAt)
+
+	_, err = store.TransitionEnrollment(ctx, enrollment.ID, model.EnrollmentPaused, time.Now())
+	require.ErrorIs(t, err, model.ErrInvalidTransition)
+
+	// A paused enrollment still counts as active.
+	_, err = store.CreateEnrollments(ctx, sequence.ID, sequence.Steps[0].ID, []uint64{contact.ID}, time.Now())
+	require.ErrorIs(t, err, model.ErrAlreadyEnrolled)
+
+	resumed, err := store.TransitionEnrollment(ctx, enrollment.ID, model.EnrollmentActive, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, model.EnrollmentActive, resumed.Status)
+
+	stopped, err := store.TransitionEnrollment(ctx, enrollment.ID, model.EnrollmentStopped, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, model.EnrollmentStopped, stopped.Status)
+	require.NotNil(t, stopped.CompletedAt)
+
+	fetched, err := store.FetchEnrollment(ctx, enrollment.ID)
+	require.NoError(t, err)
+	require.Equal(t, stopped, fetched)
+
+	for _, status := range []model.EnrollmentStatus{model.EnrollmentActive, model.EnrollmentPaused, model.EnrollmentReplied} {
+		_, err = store.TransitionEnrollment(ctx, enrollment.ID, status, time.Now())
+		require.ErrorIs(t, err, model.ErrInvalidTransition, "Expected %s to be rejected", status)
+	}
+
+	// Once stopped, the contact may be enrolled again.
+	Enroll(t, store, sequence, contact)
+
+	_, err = store.TransitionEnrollment(ctx, enrollment.ID+1000, model.EnrollmentPaused, time.Now())
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func testTransitionEnrollments(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	other := createSequence(t, store, "Other Sequence")
+	first := createContact(t, store, 1, "jane@example.com")
+	second := createContact(t, store, 1, "john@example.com")
+	third := createContact(t, store, 1, "mary@example.com")
+	enrollments := Enroll(t, store, sequence, first, second, third)
+	foreign := Enroll(t, store, other, first)[0]
+
+	_, err := store.TransitionEnrollment(ctx, enrollments[0].ID, model.EnrollmentPaused, time.Now())
+	require.NoError(t, err)
+	_, err = store.TransitionEnrollment(ctx, enrollments[1].ID, model.EnrollmentReplied, time.Now())
+	require.NoError(t, err)
+
+	updated, err := store.TransitionEnrollments(ctx, sequence.ID, model.EnrollmentPaused, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 1, updated)
+
+	updated, err = store.TransitionEnrollments(ctx, sequence.ID, model.EnrollmentActive, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 2, updated)
+
+	_, err = store.TransitionEnrollment(ctx, enrollments[0].ID, model.EnrollmentPaused, time.Now())
+	require.NoError(t, err)
+	updated, err = store.TransitionEnrollments(ctx, sequence.ID, model.EnrollmentStopped, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 2, updated)
+
+	statuses := []model.EnrollmentStatus{model.EnrollmentStopped, model.EnrollmentReplied, model.EnrollmentStopped}
+	for i, enrollment := range enrollments {
+		fetched, err := store.FetchEnrollment(ctx, enrollment.ID)
+		require.NoError(t, err)
+		require.Equal(t, statuses[i], fetched.Status)
+		require.NotNil(t, fetched.CompletedAt)
+	}
+
+	fetched, err := store.FetchEnrollment(ctx, foreign.ID)
+	require.NoError(t, err)
+	require.Equal(t, foreign, fetched)
+
+	_, err = store.TransitionEnrollments(ctx, other.ID+1000, model.EnrollmentStopped, time.Now())
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
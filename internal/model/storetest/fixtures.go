@@ -0,0 +1,54 @@
+package storetest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+// CreateContacts creates the number of contacts of owner 1 with distinct
+// emails.
+func CreateContacts(t *testing.T, store model.Store, count int) []*model.Contact {
+	t.Helper()
+
+	contacts := make([]*model.Contact, count)
+	for i := range contacts {
+		contacts[i] = &model.Contact{OwnerID: 1, Email: fmt.Sprintf("contact%d@example.com", i)}
+		require.NoError(t, store.CreateContact(t.Context(), contacts[i]))
+	}
+	return contacts
+}
+
+// Enroll enrolls the contacts into the first step of the sequence now.
+func Enroll(t *testing.T, store model.Store, sequence *model.Sequence, contacts ...*model.Contact) []*model.Enrollment {
+	t.Helper()
+
+	enrollments, err := store.CreateEnrollments(t.Context(), sequence.ID, sequence.Steps[0].ID, contactIDs(contacts), time.Now())
+	require.NoError(t, err)
+	return enrollments
+}
+
+// PendingEmail returns the pending email of the enrollment.
+func PendingEmail(t *testing.T, store model.Store, enrollment *model.Enrollment) *model.ScheduledEmail {
+	t.Helper()
+
+	for _, email := range listScheduledEmails(t, store, enrollment.ID) {
+		if email.Status == model.ScheduledEmailPending {
+			return email
+		}
+	}
+	require.FailNow(t, "Expected a pending email")
+	return nil
+}
+
+// LastEmail returns the latest email of the enrollment whatever its status.
+func LastEmail(t *testing.T, store model.Store, enrollment *model.Enrollment) *model.ScheduledEmail {
+	t.Helper()
+
+	emails := listScheduledEmails(t, store, enrollment.ID)
+	require.NotEmpty(t, emails)
+	return emails[len(emails)-1]
+}
@@ -0,0 +1,184 @@
+package storetest
+
+import (
+	"testing"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func createMailbox(t *testing.T, store model.Store, userID uint64, email string) *model.Mailbox {
+	t.Helper()
+
+	mailbox := &model.Mailbox{UserID: userID, Email: email, DailyCapacity: 50}
+	require.NoError(t, store.CreateMailbox(t.Context(), mailbox))
+	return mailbox
+}
+
+func mailboxIDs(mailboxes []*model.Mailbox) []uint64 {
+	ids := make([]uint64, len(mailboxes))
+	for i, mailbox := range mailboxes {
+		ids[i] = mailbox.ID
+	}
+	return ids
+}
+
+func testCreateMailbox(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	mailbox := &model.Mailbox{UserID: 1, Email: " sales@example.com ", DailyCapacity: 30}
+	require.NoError(t, store.CreateMailbox(ctx, mailbox))
+	require.NotZero(t, mailbox.ID)
+	require.Equal(t, "sales@example.com", mailbox.Email)
+	require.Equal(t, model.DefaultSMTPPort, mailbox.SMTPPort)
+	require.False(t, mailbox.CreatedAt.IsZero())
+
+	fetched, err := store.FetchMailbox(ctx, mailbox.ID)
+	require.NoError(t, err)
+	require.Equal(t, mailbox, fetched)
+
+	err = store.CreateMailbox(ctx, &model.Mailbox{UserID: 1, Email: "Sales@Example.com", DailyCapacity: 30})
+	require.ErrorIs(t, err, model.ErrMailboxExists)
+
+	createMailbox(t, store, 2, "sales@example.com")
+
+	err = store.CreateMailbox(ctx, &model.Mailbox{UserID: 1, Email: "team@example.com"})
+	require.ErrorIs(t, err, model.ErrInvalidDailyCapacity)
+
+	err = store.CreateMailbox(ctx, &model.Mailbox{UserID: 1, Email: "team", DailyCapacity: 30})
+	require.ErrorIs(t, err, model.ErrInvalidEmail)
+
+	err = store.CreateMailbox(ctx, &model.Mailbox{UserID: 1, Email: "team@example.com", DailyCapacity: 30, SMTPPort: 70000})
+	require.ErrorIs(t, err, model.ErrInvalidSMTPPort)
+
+	_, err = store.FetchMailbox(ctx, mailbox.ID+1000)
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func testListMailboxes(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	first := createMailbox(t, store, 1, "first@example.com")
+	second := createMailbox(t, store, 1, "second@example.com")
+	createMailbox(t, store, 2, "foreign@example.com")
+
+	mailboxes, next, err := store.ListMailboxes(ctx, &model.ListMailboxesParams{Limit: 1, UserID: 1})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{first.ID}, mailboxIDs(mailboxes))
+	require.NotNil(t, next)
+
+	mailboxes, next, err = store.ListMailboxes(ctx, &model.ListMailboxesParams{After: next, Limit: 1, UserID: 1})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{second.ID}, mailboxIDs(mailboxes))
+	require.Nil(t, next)
+
+	mailboxes, _, err = store.ListMailboxes(ctx, &model.ListMailboxesParams{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, mailboxes, 3)
+}
+
+func testUpdateMailbox(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	mailbox := createMailbox(t, store, 1, "sales@example.com")
+	createMailbox(t, store, 1, "team@example.com")
+
+	capacity := 120
+	updated, err := store.UpdateMailbox(ctx, mailbox.ID, &model.MailboxPatch{DailyCapacity: &capacity})
+	require.NoError(t, err)
+	require.Equal(t, 120, updated.DailyCapacity)
+	require.Equal(t, mailbox.Email, updated.Email)
+	require.Equal(t, mailbox.CreatedAt, updated.CreatedAt)
+
+	fetched, err := store.FetchMailbox(ctx, mailbox.ID)
+	require.NoError(t, err)
+	require.Equal(t, updated, fetched)
+
+	host, port, username, password := " smtp.example.com ", 2525, "sales", "secret"
+	updated, err = store.UpdateMailbox(ctx, mailbox.ID, &model.MailboxPatch{
+		SMTPHost:     &host,
+		SMTPPort:     &port,
+		SMTPUsername: &username,
+		SMTPPassword: &password,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "smtp.example.com", updated.SMTPHost)
+	require.Equal(t, 2525, updated.SMTPPort)
+	require.Equal(t, "sales", updated.SMTPUsername)
+	require.Equal(t, "secret", updated.SMTPPassword)
+	require.Equal(t, 120, updated.DailyCapacity)
+
+	email := "TEAM@example.com"
+	_, err = store.UpdateMailbox(ctx, mailbox.ID, &model.MailboxPatch{Email: &email})
+	require.ErrorIs(t, err, model.ErrMailboxExists)
+
+	capacity = 0
+	_, err = store.UpdateMailbox(ctx, mailbox.ID, &model.MailboxPatch{DailyCapacity: &capacity})
+	require.ErrorIs(t, err, model.ErrInvalidDailyCapacity)
+
+	_, err = store.UpdateMailbox(ctx, mailbox.ID+1000, &model.MailboxPatch{Email: &email})
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func testDeleteMailbox(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	mailbox := createMailbox(t, store, 1, "sales@example.com")
+	require.NoError(t, store.AttachMailbox(ctx, sequence.ID, mailbox.ID))
+
+	require.NoError(t, store.DeleteMailbox(ctx, mailbox.ID))
+
+	_, err := store.FetchMailbox(ctx, mailbox.ID)
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	mailboxes, err := store.ListSequenceMailboxes(ctx, sequence.ID)
+	require.NoError(t, err)
+	require.Empty(t, mailboxes)
+
+	err = store.DeleteMailbox(ctx, mailbox.ID)
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func testAttachMailbox(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	other := createSequence(t, store, "Other Sequence")
+	first := createMailbox(t, store, 1, "first@example.com")
+	second := createMailbox(t, store, 1, "second@example.com")
+
+	require.NoError(t, store.AttachMailbox(ctx, sequence.ID, second.ID))
+	require.NoError(t, store.AttachMailbox(ctx, sequence.ID, first.ID))
+	require.NoError(t, store.AttachMailbox(ctx, sequence.ID, first.ID))
+	require.NoError(t, store.AttachMailbox(ctx, other.ID, first.ID))
+
+	mailboxes, err := store.ListSequenceMailboxes(ctx, sequence.ID)
+	require.NoError(t, err)
+	require.Equal(t, []*model.Mailbox{first, second}, mailboxes)
+
+	require.NoError(t, store.DetachMailbox(ctx, sequence.ID, first.ID))
+	err = store.DetachMailbox(ctx, sequence.ID, first.ID)
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	mailboxes, err = store.ListSequenceMailboxes(ctx, sequence.ID)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{second.ID}, mailboxIDs(mailboxes))
+
+	mailboxes, err = store.ListSequenceMailboxes(ctx, other.ID)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{first.ID}, mailboxIDs(mailboxes))
+
+	err = store.AttachMailbox(ctx, sequence.ID, second.ID+1000)
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	err = store.AttachMailbox(ctx, sequence.ID+1000, first.ID)
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	_, err = store.ListSequenceMailboxes(ctx, sequence.ID+1000)
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	require.NoError(t, store.ArchiveSequence(ctx, other.ID, 0))
+	err = store.AttachMailbox(ctx, other.ID, second.ID)
+	require.ErrorIs(t, err, model.ErrSequenceArchived)
+}
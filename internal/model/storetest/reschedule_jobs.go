@@ -0,0 +1,79 @@
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func claimRescheduleJob(t *testing.T, store model.Store, now time.Time) *model.RescheduleJob {
+	t.Helper()
+
+	job, err := store.ClaimRescheduleJob(t.Context(), now, time.Minute)
+	require.NoError(t, err)
+	return job
+}
+
+func testRescheduleJobs(t *testing.T, store model.Store) {
+	ctx := t.Context()
+	now := time.Now().Truncate(time.Microsecond)
+
+	sequence := createSequence(t, store, "Test Sequence")
+	other := createSequence(t, store, "Other Sequence")
+	require.Nil(t, claimRescheduleJob(t, store, now), "Expected new sequences not to be queued")
+
+	step := &model.Step{SequenceID: sequence.ID, Subject: "Step 4", Content: "Content 4"}
+	require.NoError(t, store.CreateStep(ctx, step))
+	require.NoError(t, store.UpdateStep(ctx, step.ID, step))
+	mailbox := createMailbox(t, store, 1, "sales@example.com")
+	require.NoError(t, store.AttachMailbox(ctx, other.ID, mailbox.ID))
+
+	job := claimRescheduleJob(t, store, now)
+	require.NotNil(t, job)
+	require.Equal(t, sequence.ID, job.SequenceID)
+	require.Equal(t, model.RescheduleSteps, job.Kind)
+	require.Equal(t, 2, job.Version, "Expected queueing twice to bump the version")
+
+	rebalance := claimRescheduleJob(t, store, now)
+	require.NotNil(t, rebalance)
+	require.Equal(t, other.ID, rebalance.SequenceID)
+	require.Equal(t, model.RebalanceMailboxes, rebalance.Kind)
+	require.Nil(t, claimRescheduleJob(t, store, now), "Expected claimed jobs to be skipped")
+
+	// Queueing a claimed job makes it run once more after it finishes.
+	_, err := store.ReorderSteps(ctx, sequence.ID, 0, stepIDs(fetchSequence(t, store, sequence.ID).Steps))
+	require.NoError(t, err)
+	require.NoError(t, store.FinishRescheduleJob(ctx, job))
+	again := claimRescheduleJob(t, store, now)
+	require.NotNil(t, again)
+	require.Equal(t, sequence.ID, again.SequenceID)
+	require.Equal(t, 3, again.Version)
+	require.NoError(t, store.FinishRescheduleJob(ctx, again))
+
+	// Jobs whose lease is over are claimed again.
+	require.Nil(t, claimRescheduleJob(t, store, now.Add(30*time.Second)))
+	expired := claimRescheduleJob(t, store, now.Add(time.Minute))
+	require.Equal(t, rebalance, expired)
+	require.NoError(t, store.FinishRescheduleJob(ctx, expired))
+	require.Nil(t, claimRescheduleJob(t, store, now.Add(time.Hour)))
+
+	// Finishing twice is a no-op.
+	require.NoError(t, store.FinishRescheduleJob(ctx, expired))
+
+	// Deleting a sequence drops its jobs.
+	require.NoError(t, store.DetachMailbox(ctx, other.ID, mailbox.ID))
+	require.NoError(t, store.DeleteSequence(ctx, other.ID, 0))
+	require.Nil(t, claimRescheduleJob(t, store, now.Add(time.Hour)))
+
+	// Deleting a mailbox rebalances the sequences it was attached to.
+	require.NoError(t, store.AttachMailbox(ctx, sequence.ID, mailbox.ID))
+	require.NoError(t, store.FinishRescheduleJob(ctx, claimRescheduleJob(t, store, now.Add(time.Hour))))
+	require.NoError(t, store.DeleteMailbox(ctx, mailbox.ID))
+	rebalance = claimRescheduleJob(t, store, now.Add(time.Hour))
+	require.NotNil(t, rebalance)
+	require.Equal(t, sequence.ID, rebalance.SequenceID)
+	require.Equal(t, model.RebalanceMailboxes, rebalance.Kind)
+	require.Nil(t, claimRescheduleJob(t, store, now.Add(time.Hour)))
+}
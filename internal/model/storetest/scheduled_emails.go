@@ -0,0 +1,590 @@
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func testScheduleFirstStep(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	window, err := sequence.SendingWindow()
+	require.NoError(t, err)
+	first := createContact(t, store, 1, "jane@example.com")
+	second := createContact(t, store, 1, "john@example.com")
+
+	// A moment in the future shows the given time is used, not the clock.
+	now := time.Now().UTC().Add(30 * 24 * time.Hour).Truncate(time.Microsecond)
+	enrollments, err := store.CreateEnrollments(ctx, sequence.ID, sequence.Steps[0].ID, []uint64{first.ID, second.ID}, now)
+	require.NoError(t, err)
+
+	for _, enrollment := range enrollments {
+		emails, err := store.ListScheduledEmails(ctx, enrollment.ID)
+		require.NoError(t, err)
+		require.Len(t, emails, 1)
+
+		email := emails[0]
+		require.NotZero(t, email.ID)
+		require.Equal(t, sequence.ID, email.SequenceID)
+		require.Equal(t, enrollment.ID, email.EnrollmentID)
+		require.Equal(t, &sequence.Steps[0].ID, email.StepID)
+		require.Equal(t, model.ScheduledEmailPending, email.Status)
+		require.Nil(t, email.MailboxID)
+		require.Nil(t, email.SentAt)
+		require.True(t, email.SendAt.Equal(window.Next(now)), "Expected %s to be the next slot", email.SendAt)
+	}
+
+	_, err = store.ListScheduledEmails(ctx, enrollments[1].ID+1000)
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func testRescheduleOnTransition(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	first := createContact(t, store, 1, "jane@example.com")
+	second := createContact(t, store, 1, "john@example.com")
+	enrollments := Enroll(t, store, sequence, first, second)
+
+	_, err := store.TransitionEnrollment(ctx, enrollments[0].ID, model.EnrollmentPaused, time.Now())
+	require.NoError(t, err)
+	emails := listScheduledEmails(t, store, enrollments[0].ID)
+	require.Len(t, emails, 1)
+	require.Equal(t, model.ScheduledEmailCanceled, emails[0].Status)
+
+	// Resuming schedules the step again, no earlier than it was planned.
+	_, err = store.TransitionEnrollment(ctx, enrollments[0].ID, model.EnrollmentActive, time.Now())
+	require.NoError(t, err)
+	emails = listScheduledEmails(t, store, enrollments[0].ID)
+	require.Len(t, emails, 2)
+	require.Equal(t, model.ScheduledEmailPending, emails[1].Status)
+	require.Equal(t, &sequence.Steps[0].ID, emails[1].StepID)
+	require.False(t, emails[1].SendAt.Before(emails[0].SendAt))
+
+	updated, err := store.TransitionEnrollments(ctx, sequence.ID, model.EnrollmentPaused, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 2, updated)
+	for _, enrollment := range enrollments {
+		for _, email := range listScheduledEmails(t, store, enrollment.ID) {
+			require.Equal(t, model.ScheduledEmailCanceled, email.Status)
+		}
+	}
+
+	updated, err = store.TransitionEnrollments(ctx, sequence.ID, model.EnrollmentActive, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 2, updated)
+	for _, enrollment := range enrollments {
+		emails := listScheduledEmails(t, store, enrollment.ID)
+		require.Equal(t, model.ScheduledEmailPending, emails[len(emails)-1].Status)
+	}
+
+	_, err = store.TransitionEnrollment(ctx, enrollments[1].ID, model.EnrollmentStopped, time.Now())
+	require.NoError(t, err)
+	emails = listScheduledEmails(t, store, enrollments[1].ID)
+	require.Equal(t, model.ScheduledEmailCanceled, emails[len(emails)-1].Status)
+}
+
+func testPlanScheduledEmails(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	first := createContact(t, store, 1, "jane@example.com")
+	second := createContact(t, store, 1, "john@example.com")
+	enrollments := Enroll(t, store, sequence, first, second)
+	mailbox := createMailbox(t, store, 1, "sender@example.com")
+	other := createMailbox(t, store, 1, "other@example.com")
+
+	until := time.Now().Add(8 * 24 * time.Hour)
+	emails, err := store.ListUnplannedEmails(ctx, until)
+	require.NoError(t, err)
+	require.Len(t, emails, 2)
+	require.Equal(t, enrollments[0].ID, emails[0].EnrollmentID)
+	require.Equal(t, sequence.ID, emails[0].SequenceID)
+
+	emails, err = store.ListUnplannedEmails(ctx, emails[0].SendAt)
+	require.NoError(t, err)
+	require.Empty(t, emails)
+
+	day := time.Date(2030, time.January, 7, 0, 0, 0, 0, time.UTC)
+	firstEmail := listScheduledEmails(t, store, enrollments[0].ID)[0]
+	secondEmail := listScheduledEmails(t, store, enrollments[1].ID)[0]
+	planned, err := store.PlanScheduledEmails(ctx, []*model.ScheduledEmailPlan{
+		{ID: firstEmail.ID, MailboxID: &mailbox.ID, SendAt: day.Add(9 * time.Hour)},
+		{ID: secondEmail.ID, SendAt: day.Add(33 * time.Hour)},
+		{ID: secondEmail.ID + 1000, MailboxID: &mailbox.ID, SendAt: day},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, planned)
+
+	firstEmail = listScheduledEmails(t, store, enrollments[0].ID)[0]
+	require.Equal(t, &mailbox.ID, firstEmail.MailboxID)
+	require.Equal(t, day.Add(9*time.Hour), firstEmail.SendAt)
+	secondEmail = listScheduledEmails(t, store, enrollments[1].ID)[0]
+	require.Nil(t, secondEmail.MailboxID)
+	require.Equal(t, day.Add(33*time.Hour), secondEmail.SendAt)
+
+	// Emails with a mailbox are planned already.
+	emails, err = store.ListUnplannedEmails(ctx, day.Add(48*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, emails, 1)
+	require.Equal(t, secondEmail.ID, emails[0].ID)
+	planned, err = store.PlanScheduledEmails(ctx, []*model.ScheduledEmailPlan{
+		{ID: firstEmail.ID, MailboxID: &other.ID, SendAt: day},
+	})
+	require.NoError(t, err)
+	require.Zero(t, planned)
+
+	counts, err := store.CountMailboxEmails(ctx, []uint64{mailbox.ID, other.ID}, day, day.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, map[uint64]int{mailbox.ID: 1}, counts)
+	counts, err = store.CountMailboxEmails(ctx, []uint64{mailbox.ID}, day.Add(9*time.Hour+time.Microsecond), day.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, counts)
+
+	// Canceled emails no longer take up capacity.
+	_, err = store.TransitionEnrollment(ctx, enrollments[0].ID, model.EnrollmentPaused, time.Now())
+	require.NoError(t, err)
+	counts, err = store.CountMailboxEmails(ctx, []uint64{mailbox.ID}, day, day.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, counts)
+
+	// Deleting a mailbox sends its emails back to planning.
+	_, err = store.TransitionEnrollment(ctx, enrollments[0].ID, model.EnrollmentActive, time.Now())
+	require.NoError(t, err)
+	resumed := listScheduledEmails(t, store, enrollments[0].ID)[1]
+	_, err = store.PlanScheduledEmails(ctx, []*model.ScheduledEmailPlan{
+		{ID: resumed.ID, MailboxID: &other.ID, SendAt: resumed.SendAt},
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.DeleteMailbox(ctx, other.ID))
+	require.Nil(t, listScheduledEmails(t, store, enrollments[0].ID)[1].MailboxID)
+
+	// Planning within capacity hands the counts to the plan function.
+	var used map[uint64]int
+	planned, err = store.PlanMailboxEmails(ctx, []uint64{mailbox.ID}, day, day.Add(24*time.Hour), func(counts map[uint64]int) []*model.ScheduledEmailPlan {
+		used = counts
+		return []*model.ScheduledEmailPlan{{ID: resumed.ID, MailboxID: &mailbox.ID, SendAt: day.Add(10 * time.Hour)}}
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, planned)
+	require.Empty(t, used)
+	counts, err = store.CountMailboxEmails(ctx, []uint64{mailbox.ID}, day, day.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, map[uint64]int{mailbox.ID: 1}, counts)
+}
+
+func testUnplanScheduledEmails(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	other := createSequence(t, store, "Other Sequence")
+	first := createContact(t, store, 1, "jane@example.com")
+	second := createContact(t, store, 1, "john@example.com")
+	enrollments := Enroll(t, store, sequence, first, second)
+	otherEnrollment := Enroll(t, store, other, first)[0]
+	mailbox := createMailbox(t, store, 1, "sender@example.com")
+
+	monday := time.Date(2030, time.January, 7, 10, 0, 0, 0, time.UTC)
+	planEmail(t, store, enrollments[0], mailbox, monday)
+	planEmail(t, store, enrollments[1], mailbox, monday.Add(2*time.Hour))
+	planEmail(t, store, otherEnrollment, mailbox, monday.Add(2*time.Hour))
+
+	// Only emails of the sequence planned after the time lose their mailbox.
+	unplanned, err := store.UnplanScheduledEmails(ctx, sequence.ID, monday)
+	require.NoError(t, err)
+	require.Len(t, unplanned, 1)
+	require.Equal(t, enrollments[1].ID, unplanned[0].EnrollmentID)
+	require.Equal(t, sequence.ID, unplanned[0].SequenceID)
+	require.Equal(t, &mailbox.ID, unplanned[0].MailboxID)
+
+	require.Equal(t, &mailbox.ID, PendingEmail(t, store, enrollments[0]).MailboxID)
+	require.Nil(t, PendingEmail(t, store, enrollments[1]).MailboxID)
+	require.Equal(t, monday.Add(2*time.Hour), PendingEmail(t, store, enrollments[1]).SendAt)
+	require.Equal(t, &mailbox.ID, PendingEmail(t, store, otherEnrollment).MailboxID)
+
+	unplanned, err = store.UnplanScheduledEmails(ctx, sequence.ID, monday)
+	require.NoError(t, err)
+	require.Empty(t, unplanned)
+}
+
+func testClaimDueEmail(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	first := createContact(t, store, 1, "jane@example.com")
+	second := createContact(t, store, 1, "john@example.com")
+	third := createContact(t, store, 1, "mary@example.com")
+	enrollments := Enroll(t, store, sequence, first, second, third)
+	mailbox := createMailbox(t, store, 1, "sender@example.com")
+
+	now := time.Now().UTC().Truncate(time.Microsecond).Add(time.Hour)
+	var plans []*model.ScheduledEmailPlan
+	for i, enrollment := range enrollments {
+		email := listScheduledEmails(t, store, enrollment.ID)[0]
+		plans = append(plans, &model.ScheduledEmailPlan{
+			ID:        email.ID,
+			MailboxID: &mailbox.ID,
+			SendAt:    now.Add(time.Duration(i-1) * time.Minute),
+		})
+	}
+	_, err := store.PlanScheduledEmails(ctx, plans)
+	require.NoError(t, err)
+
+	delivery, err := store.ClaimDueEmail(ctx, now, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, plans[0].ID, delivery.Email.ID)
+	require.Equal(t, model.ScheduledEmailSending, delivery.Email.Status)
+	require.Equal(t, sequence.ID, delivery.Email.SequenceID)
+	require.Equal(t, mailbox.Email, delivery.Mailbox.Email)
+	require.Equal(t, first.Email, delivery.Contact.Email)
+	require.Equal(t, sequence.Steps[0].Subject, delivery.Step.Subject)
+	require.Equal(t, sequence.ID, delivery.Sequence.ID)
+	require.Equal(t, sequence.OpenTrackingEnabled, delivery.Sequence.OpenTrackingEnabled)
+	require.Equal(t, model.ScheduledEmailSending, listScheduledEmails(t, store, enrollments[0].ID)[0].Status)
+
+	// Emails being sent are skipped by concurrent claims.
+	delivery, err = store.ClaimDueEmail(ctx, now, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, second.Email, delivery.Contact.Email)
+
+	// The last email is not due yet.
+	delivery, err = store.ClaimDueEmail(ctx, now, time.Hour)
+	require.NoError(t, err)
+	require.Nil(t, delivery)
+
+	// Emails of paused enrollments are not sent.
+	_, err = store.TransitionEnrollment(ctx, enrollments[2].ID, model.EnrollmentPaused, now)
+	require.NoError(t, err)
+	delivery, err = store.ClaimDueEmail(ctx, now.Add(time.Minute), time.Hour)
+	require.NoError(t, err)
+	require.Nil(t, delivery)
+
+	// Claims older than the lease are taken over.
+	delivery, err = store.ClaimDueEmail(ctx, now.Add(time.Hour), time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, plans[0].ID, delivery.Email.ID)
+}
+
+func testFinishDelivery(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	mailbox := createMailbox(t, store, 1, "sender@example.com")
+	var enrollments []*model.Enrollment
+	for _, email := range []string{"jane@example.com", "john@example.com", "mary@example.com", "mike@example.com", "anna@example.com", "lisa@example.com"} {
+		enrollments = append(enrollments, Enroll(t, store, sequence, createContact(t, store, 1, email))...)
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond).Add(time.Hour)
+	claimed := make([]*model.Delivery, len(enrollments))
+	for i, enrollment := range enrollments {
+		planEmail(t, store, enrollment, mailbox, now)
+		delivery, err := store.ClaimDueEmail(ctx, now, time.Hour)
+		require.NoError(t, err)
+		require.Equal(t, enrollment.ID, delivery.Email.EnrollmentID)
+		claimed[i] = delivery
+	}
+
+	err := store.FinishDelivery(ctx, claimed[0].Email.ID, &model.DeliveryResult{SentAt: now})
+	require.NoError(t, err)
+	sent := listScheduledEmails(t, store, enrollments[0].ID)[0]
+	require.Equal(t, model.ScheduledEmailSent, sent.Status)
+	require.Equal(t, &now, sent.SentAt)
+	require.Equal(t, &sequence.Steps[1].ID, PendingEmail(t, store, enrollments[0]).StepID)
+
+	err = store.FinishDelivery(ctx, claimed[1].Email.ID, &model.DeliveryResult{Error: "mailbox rejected the message", Rejected: true})
+	require.NoError(t, err)
+	emails := listScheduledEmails(t, store, enrollments[1].ID)
+	require.Len(t, emails, 1)
+	require.Equal(t, model.ScheduledEmailFailed, emails[0].Status)
+	require.Equal(t, "mailbox rejected the message", emails[0].Error)
+	require.Equal(t, 1, emails[0].Attempts)
+	require.Nil(t, emails[0].SentAt)
+	bounced, err := store.FetchEnrollment(ctx, enrollments[1].ID)
+	require.NoError(t, err)
+	require.Equal(t, model.EnrollmentBounced, bounced.Status)
+	require.NotNil(t, bounced.CompletedAt)
+
+	// Finished emails are left untouched.
+	err = store.FinishDelivery(ctx, claimed[1].Email.ID, &model.DeliveryResult{SentAt: now})
+	require.NoError(t, err)
+	require.Equal(t, model.ScheduledEmailFailed, listScheduledEmails(t, store, enrollments[1].ID)[0].Status)
+
+	// An enrollment paused while its email is sent moves on, resuming
+	// schedules the next step.
+	_, err = store.TransitionEnrollment(ctx, enrollments[2].ID, model.EnrollmentPaused, now)
+	require.NoError(t, err)
+	err = store.FinishDelivery(ctx, claimed[2].Email.ID, &model.DeliveryResult{SentAt: now})
+	require.NoError(t, err)
+	require.Len(t, listScheduledEmails(t, store, enrollments[2].ID), 1)
+	_, err = store.TransitionEnrollment(ctx, enrollments[2].ID, model.EnrollmentActive, now)
+	require.NoError(t, err)
+	require.Equal(t, &sequence.Steps[1].ID, PendingEmail(t, store, enrollments[2]).StepID)
+
+	// Resuming while the email is sent leaves scheduling to the delivery.
+	_, err = store.TransitionEnrollment(ctx, enrollments[3].ID, model.EnrollmentPaused, now)
+	require.NoError(t, err)
+	_, err = store.TransitionEnrollment(ctx, enrollments[3].ID, model.EnrollmentActive, now)
+	require.NoError(t, err)
+	require.Len(t, listScheduledEmails(t, store, enrollments[3].ID), 1)
+	err = store.FinishDelivery(ctx, claimed[3].Email.ID, &model.DeliveryResult{SentAt: now})
+	require.NoError(t, err)
+	require.Equal(t, &sequence.Steps[1].ID, PendingEmail(t, store, enrollments[3]).StepID)
+
+	// Other failures pause the enrollment, resuming sends the step again.
+	err = store.FinishDelivery(ctx, claimed[5].Email.ID, &model.DeliveryResult{Error: "connection timed out"})
+	require.NoError(t, err)
+	require.Equal(t, model.ScheduledEmailFailed, listScheduledEmails(t, store, enrollments[5].ID)[0].Status)
+	paused, err := store.FetchEnrollment(ctx, enrollments[5].ID)
+	require.NoError(t, err)
+	require.Equal(t, model.EnrollmentPaused, paused.Status)
+	require.Nil(t, paused.CompletedAt)
+	_, err = store.TransitionEnrollment(ctx, enrollments[5].ID, model.EnrollmentActive, now)
+	require.NoError(t, err)
+	require.Equal(t, &sequence.Steps[0].ID, PendingEmail(t, store, enrollments[5]).StepID)
+
+	// Transient failures are sent again at the next slot after the retry
+	// time.
+	window, err := sequence.SendingWindow()
+	require.NoError(t, err)
+	retryAt := now.Add(5 * time.Minute)
+	err = store.FinishDelivery(ctx, claimed[4].Email.ID, &model.DeliveryResult{Error: "try again later", RetryAt: retryAt})
+	require.NoError(t, err)
+	retried := PendingEmail(t, store, enrollments[4])
+	require.Equal(t, claimed[4].Email.ID, retried.ID)
+	require.Equal(t, window.Next(retryAt), retried.SendAt)
+	require.Equal(t, 1, retried.Attempts)
+	require.Equal(t, "try again later", retried.Error)
+	require.Equal(t, &mailbox.ID, retried.MailboxID)
+	delivery, err := store.ClaimDueEmail(ctx, retried.SendAt, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, retried.ID, delivery.Email.ID)
+	require.Equal(t, 1, delivery.Email.Attempts)
+}
+
+func testScheduleNextStep(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	contact := createContact(t, store, 1, "jane@example.com")
+	enrollment := Enroll(t, store, sequence, contact)[0]
+	mailbox := createMailbox(t, store, 1, "sender@example.com")
+
+	// Step 2 waits two days, step 3 five hours.
+	monday := time.Date(2030, time.January, 7, 10, 0, 0, 0, time.UTC)
+	wednesday := monday.AddDate(0, 0, 2)
+	for _, want := range []struct {
+		sentAt time.Time
+		step   *model.Step
+		sendAt time.Time
+	}{
+		{monday, sequence.Steps[1], wednesday},
+		{wednesday, sequence.Steps[2], wednesday.Add(5 * time.Hour)},
+	} {
+		planEmail(t, store, enrollment, mailbox, want.sentAt)
+		deliverDueEmail(t, store, want.sentAt)
+
+		fetched, err := store.FetchEnrollment(ctx, enrollment.ID)
+		require.NoError(t, err)
+		require.Equal(t, model.EnrollmentActive, fetched.Status)
+		require.Equal(t, &want.step.ID, fetched.CurrentStepID)
+
+		pending := PendingEmail(t, store, enrollment)
+		require.Equal(t, &want.step.ID, pending.StepID)
+		require.Equal(t, want.sendAt, pending.SendAt)
+		require.Nil(t, pending.MailboxID)
+	}
+
+	// Sending the last step completes the enrollment.
+	last := wednesday.Add(5 * time.Hour)
+	planEmail(t, store, enrollment, mailbox, last)
+	deliverDueEmail(t, store, last)
+
+	fetched, err := store.FetchEnrollment(ctx, enrollment.ID)
+	require.NoError(t, err)
+	require.Equal(t, model.EnrollmentCompleted, fetched.Status)
+	require.NotNil(t, fetched.CompletedAt)
+	require.Equal(t, &sequence.Steps[2].ID, fetched.CurrentStepID)
+
+	emails := listScheduledEmails(t, store, enrollment.ID)
+	require.Len(t, emails, 3)
+	for i, email := range emails {
+		require.Equal(t, &sequence.Steps[i].ID, email.StepID)
+		require.Equal(t, model.ScheduledEmailSent, email.Status)
+	}
+}
+
+func testDeleteSentStep(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	contact := createContact(t, store, 1, "jane@example.com")
+	enrollment := Enroll(t, store, sequence, contact)[0]
+	mailbox := createMailbox(t, store, 1, "sender@example.com")
+
+	// Step 1 is sent on Monday and step 2 on Wednesday, so step 3 is
+	// pending five hours after it.
+	monday := time.Date(2030, time.January, 7, 10, 0, 0, 0, time.UTC)
+	wednesday := monday.AddDate(0, 0, 2)
+	planEmail(t, store, enrollment, mailbox, monday)
+	deliverDueEmail(t, store, monday)
+	planEmail(t, store, enrollment, mailbox, wednesday)
+	deliverDueEmail(t, store, wednesday)
+	pending := PendingEmail(t, store, enrollment)
+	require.Equal(t, &sequence.Steps[2].ID, pending.StepID)
+
+	// The email of a deleted step is kept, so it still takes up its mailbox
+	// and step 3 still follows it.
+	require.NoError(t, store.DeleteStep(ctx, sequence.Steps[1].ID, &model.Step{SequenceID: sequence.ID}))
+	emails := listScheduledEmails(t, store, enrollment.ID)
+	require.Len(t, emails, 3)
+	require.Nil(t, emails[1].StepID)
+	require.Equal(t, model.ScheduledEmailSent, emails[1].Status)
+
+	used, err := store.CountMailboxEmails(ctx, []uint64{mailbox.ID}, wednesday.Truncate(24*time.Hour), wednesday.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Equal(t, 1, used[mailbox.ID])
+
+	result, err := store.RescheduleEnrollments(ctx, sequence.ID, 0, 10, wednesday.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, &model.RescheduleResult{LastID: enrollment.ID}, result)
+	require.Equal(t, pending, PendingEmail(t, store, enrollment))
+
+	// Deleting the step of the pending email cancels it.
+	require.NoError(t, store.DeleteStep(ctx, sequence.Steps[2].ID, &model.Step{SequenceID: sequence.ID}))
+	emails = listScheduledEmails(t, store, enrollment.ID)
+	require.Len(t, emails, 3)
+	require.Nil(t, emails[2].StepID)
+	require.Equal(t, model.ScheduledEmailCanceled, emails[2].Status)
+}
+
+func testScheduleNextStepCapacity(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	first := createContact(t, store, 1, "jane@example.com")
+	second := createContact(t, store, 1, "john@example.com")
+	enrollments := Enroll(t, store, sequence, first, second)
+	mailbox := &model.Mailbox{UserID: 1, Email: "sender@example.com", DailyCapacity: 1}
+	require.NoError(t, store.CreateMailbox(ctx, mailbox))
+	require.NoError(t, store.AttachMailbox(ctx, sequence.ID, mailbox.ID))
+
+	// The second step of the first contact is due on Wednesday, which the
+	// first step of the second contact already fills up.
+	monday := time.Date(2030, time.January, 7, 10, 0, 0, 0, time.UTC)
+	wednesday := monday.AddDate(0, 0, 2)
+	planEmail(t, store, enrollments[0], mailbox, monday)
+	planEmail(t, store, enrollments[1], mailbox, wednesday.Add(-time.Hour))
+	deliverDueEmail(t, store, monday)
+
+	pending := PendingEmail(t, store, enrollments[0])
+	require.Equal(t, &sequence.Steps[1].ID, pending.StepID)
+	require.Equal(t, time.Date(2030, time.January, 10, 9, 0, 0, 0, time.UTC), pending.SendAt)
+}
+
+func testRescheduleEnrollments(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	first := createContact(t, store, 1, "jane@example.com")
+	second := createContact(t, store, 1, "john@example.com")
+	enrollments := Enroll(t, store, sequence, first, second)
+	mailbox := createMailbox(t, store, 1, "sender@example.com")
+
+	// The first contact has been sent step 1 and waits for step 2, the
+	// email of the second contact is already due.
+	monday := time.Date(2030, time.January, 7, 10, 0, 0, 0, time.UTC)
+	planEmail(t, store, enrollments[0], mailbox, monday)
+	deliverDueEmail(t, store, monday)
+	due := PendingEmail(t, store, enrollments[1])
+	now := monday.Add(2 * time.Hour)
+
+	reschedule := func(after uint64, limit int) *model.RescheduleResult {
+		t.Helper()
+
+		result, err := store.RescheduleEnrollments(ctx, sequence.ID, after, limit, now)
+		require.NoError(t, err)
+		return result
+	}
+	requirePending := func(step *model.Step, sendAt time.Time) {
+		t.Helper()
+
+		fetched, err := store.FetchEnrollment(ctx, enrollments[0].ID)
+		require.NoError(t, err)
+		require.Equal(t, &step.ID, fetched.CurrentStepID)
+
+		pending := PendingEmail(t, store, enrollments[0])
+		require.Equal(t, &step.ID, pending.StepID)
+		require.Equal(t, sendAt, pending.SendAt)
+		require.Nil(t, pending.MailboxID)
+		require.Equal(t, due, PendingEmail(t, store, enrollments[1]))
+	}
+
+	// Step 3 now follows step 1 after five hours. Enrollments are taken
+	// one batch at a time.
+	_, err := store.ReorderSteps(ctx, sequence.ID, 0, []uint64{sequence.Steps[0].ID, sequence.Steps[2].ID, sequence.Steps[1].ID})
+	require.NoError(t, err)
+	require.Equal(t, &model.RescheduleResult{LastID: enrollments[0].ID, Rescheduled: 1}, reschedule(0, 1))
+	require.Equal(t, &model.RescheduleResult{LastID: enrollments[1].ID}, reschedule(enrollments[0].ID, 1))
+	require.Equal(t, &model.RescheduleResult{}, reschedule(enrollments[1].ID, 1))
+	requirePending(sequence.Steps[2], monday.Add(5*time.Hour))
+
+	emails := listScheduledEmails(t, store, enrollments[0].ID)
+	require.Len(t, emails, 3)
+	require.Equal(t, model.ScheduledEmailCanceled, emails[1].Status)
+	require.Equal(t, &sequence.Steps[1].ID, emails[1].StepID)
+
+	// Rescheduling again changes nothing.
+	require.Equal(t, &model.RescheduleResult{LastID: enrollments[1].ID}, reschedule(0, 10))
+
+	// Deleting step 3 brings step 2 back, two days after step 1.
+	require.NoError(t, store.DeleteStep(ctx, sequence.Steps[2].ID, &model.Step{SequenceID: sequence.ID}))
+	require.Equal(t, &model.RescheduleResult{LastID: enrollments[1].ID, Rescheduled: 1}, reschedule(0, 10))
+	requirePending(sequence.Steps[1], monday.AddDate(0, 0, 2))
+
+	// Without steps left to send the enrollment is completed.
+	require.NoError(t, store.DeleteStep(ctx, sequence.Steps[1].ID, &model.Step{SequenceID: sequence.ID}))
+	require.Equal(t, &model.RescheduleResult{LastID: enrollments[1].ID, Completed: 1}, reschedule(0, 10))
+
+	fetched, err := store.FetchEnrollment(ctx, enrollments[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, model.EnrollmentCompleted, fetched.Status)
+	require.Equal(t, due, PendingEmail(t, store, enrollments[1]))
+
+	_, err = store.RescheduleEnrollments(ctx, sequence.ID+1, 0, 10, now)
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+// planEmail assigns the pending email of the enrollment to the mailbox.
+func planEmail(t *testing.T, store model.Store, enrollment *model.Enrollment, mailbox *model.Mailbox, sendAt time.Time) {
+	t.Helper()
+
+	planned, err := store.PlanScheduledEmails(t.Context(), []*model.ScheduledEmailPlan{
+		{ID: PendingEmail(t, store, enrollment).ID, MailboxID: &mailbox.ID, SendAt: sendAt},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, planned)
+}
+
+// deliverDueEmail delivers an email due at the time successfully.
+func deliverDueEmail(t *testing.T, store model.Store, now time.Time) {
+	t.Helper()
+
+	delivery, err := store.ClaimDueEmail(t.Context(), now, time.Hour)
+	require.NoError(t, err)
+	require.NotNil(t, delivery)
+	err = store.FinishDelivery(t.Context(), delivery.Email.ID, &model.DeliveryResult{SentAt: now})
+	require.NoError(t, err)
+}
+
+func listScheduledEmails(t *testing.T, store model.Store, enrollmentID uint64) []*model.ScheduledEmail {
+	t.Helper()
+
+	emails, err := store.ListScheduledEmails(t.Context(), enrollmentID)
+	require.NoError(t, err)
+	return emails
+}
@@ -0,0 +1,489 @@
+// Package storetest checks that model.Store implementations behave
+// identically. Store packages run RunConformance from their own tests, and
+// tests of the packages built on a store share its fixtures.
+package storetest
+
+import (
+	"testing"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory returns an empty store. It is called once per test case.
+type Factory func(t *testing.T) model.Store
+
+// RunConformance runs the conformance suite against stores built by factory.
+// Test cases run sequentially, so stores may share a database.
+func RunConformance(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store model.Store)
+	}{
+		{"CreateSequence", testCreateSequence},
+		{"FetchSequence", testFetchSequence},
+		{"ListSequences", testListSequences},
+		{"UpdateSequence", testUpdateSequence},
+		{"DeleteSequence", testDeleteSequence},
+		{"ArchiveSequence", testArchiveSequence},
+		{"CreateStep", testCreateStep},
+		{"ReorderSteps", testReorderSteps},
+		{"UpdateStep", testUpdateStep},
+		{"DeleteStep", testDeleteStep},
+		{"CreateContact", testCreateContact},
+		{"ListContacts", testListContacts},
+		{"UpdateContact", testUpdateContact},
+		{"DeleteContact", testDeleteContact},
+		{"ImportContacts", testImportContacts},
+		{"CreateEnrollments", testCreateEnrollments},
+		{"TransitionEnrollment", testTransitionEnrollment},
+		{"TransitionEnrollments", testTransitionEnrollments},
+		{"CreateMailbox", testCreateMailbox},
+		{"ListMailboxes", testListMailboxes},
+		{"UpdateMailbox", testUpdateMailbox},
+		{"DeleteMailbox", testDeleteMailbox},
+		{"AttachMailbox", testAttachMailbox},
+		{"ScheduleFirstStep", testScheduleFirstStep},
+		{"RescheduleOnTransition", testRescheduleOnTransition},
+		{"PlanScheduledEmails", testPlanScheduledEmails},
+		{"UnplanScheduledEmails", testUnplanScheduledEmails},
+		{"ClaimDueEmail", testClaimDueEmail},
+		{"FinishDelivery", testFinishDelivery},
+		{"ScheduleNextStep", testScheduleNextStep},
+		{"ScheduleNextStepCapacity", testScheduleNextStepCapacity},
+		{"DeleteSentStep", testDeleteSentStep},
+		{"RescheduleEnrollments", testRescheduleEnrollments},
+		{"RescheduleJobs", testRescheduleJobs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, factory(t))
+		})
+	}
+}
+
+func newSequence(name string) *model.Sequence {
+	return &model.Sequence{
+		Name:                 name,
+		OpenTrackingEnabled:  true,
+		ClickTrackingEnabled: false,
+		Steps: []*model.Step{
+			{Subject: "Step 1 Subject", Content: "Step 1 Content"},
+			{Subject: "Step 2 Subject", Content: "Step 2 Content", WaitDays: 2},
+			{Subject: "Step 3 Subject", Content: "Step 3 Content", WaitHours: 5},
+		},
+	}
+}
+
+func createSequence(t *testing.T, store model.Store, name string) *model.Sequence {
+	t.Helper()
+
+	sequence := newSequence(name)
+	require.NoError(t, store.CreateSequence(t.Context(), sequence))
+	return sequence
+}
+
+func fetchSequence(t *testing.T, store model.Store, id uint64) *model.Sequence {
+	t.Helper()
+
+	sequence, err := store.FetchSequence(t.Context(), id)
+	require.NoError(t, err)
+	return sequence
+}
+
+func stepIDs(steps []*model.Step) []uint64 {
+	ids := make([]uint64, len(steps))
+	for i, step := range steps {
+		ids[i] = step.ID
+	}
+	return ids
+}
+
+func requirePositions(t *testing.T, steps []*model.Step) {
+	t.Helper()
+
+	for i, step := range steps {
+		require.Equal(t, i+1, step.Position, "Expected positions without gaps")
+	}
+}
+
+func testCreateSequence(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	require.NotZero(t, sequence.ID)
+	require.Equal(t, 1, sequence.Version)
+	require.False(t, sequence.CreatedAt.IsZero())
+	require.Equal(t, sequence.CreatedAt, sequence.UpdatedAt)
+	require.Nil(t, sequence.ArchivedAt)
+	require.Equal(t, model.DefaultStartTime, sequence.StartTime)
+	require.Equal(t, model.DefaultEndTime, sequence.EndTime)
+	require.Equal(t, model.DefaultTimezone, sequence.Timezone)
+	require.Equal(t, model.DefaultWeekdays(), sequence.Weekdays)
+
+	require.Len(t, sequence.Steps, 3)
+	seen := make(map[uint64]bool)
+	for i, step := range sequence.Steps {
+		require.NotZero(t, step.ID)
+		require.False(t, seen[step.ID], "Expected unique step IDs")
+		seen[step.ID] = true
+		require.Equal(t, sequence.ID, step.SequenceID)
+		require.Equal(t, i+1, step.Position)
+		require.Equal(t, 1, step.Version)
+		require.False(t, step.CreatedAt.IsZero())
+	}
+	require.Equal(t, 2, sequence.Steps[1].WaitDays)
+	require.Equal(t, 5, sequence.Steps[2].WaitHours)
+
+	require.Equal(t, sequence, fetchSequence(t, store, sequence.ID))
+
+	other := createSequence(t, store, "Other Sequence")
+	require.NotEqual(t, sequence.ID, other.ID)
+
+	empty := &model.Sequence{Name: "Empty Sequence"}
+	require.NoError(t, store.CreateSequence(ctx, empty))
+	require.Empty(t, fetchSequence(t, store, empty.ID).Steps)
+
+	delayed := newSequence("Delayed Sequence")
+	delayed.Steps[0].WaitHours = 1
+	err := store.CreateSequence(ctx, delayed)
+	require.ErrorIs(t, err, model.ErrFirstStepDelay)
+
+	invalid := newSequence("Invalid Sequence")
+	invalid.StartTime, invalid.EndTime = "17:00", "09:00"
+	err = store.CreateSequence(ctx, invalid)
+	require.ErrorIs(t, err, model.ErrInvalidSendingWindow)
+	require.ErrorIs(t, err, model.ErrValidation)
+}
+
+func testFetchSequence(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+
+	_, err := store.FetchSequence(ctx, sequence.ID+1000)
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	// Steps come back in position order rather than insertion order.
+	step := &model.Step{SequenceID: sequence.ID, Position: 1, Subject: "Intro", Content: "Intro Content"}
+	require.NoError(t, store.CreateStep(ctx, step))
+
+	fetched := fetchSequence(t, store, sequence.ID)
+	require.Len(t, fetched.Steps, 4)
+	requirePositions(t, fetched.Steps)
+	require.Equal(t, step.ID, fetched.Steps[0].ID)
+	require.Equal(t, stepIDs(sequence.Steps), stepIDs(fetched.Steps[1:]))
+}
+
+func testListSequences(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	alpha := createSequence(t, store, "Alpha Outreach")
+	beta := createSequence(t, store, "Beta Outreach")
+	gamma := createSequence(t, store, "Gamma Follow-up")
+	archived := createSequence(t, store, "Archived Outreach")
+	require.NoError(t, store.ArchiveSequence(ctx, archived.ID, 0))
+
+	sequences, next, err := store.ListSequences(ctx, &model.ListSequencesParams{Limit: 2, SortBy: model.SortByID})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{alpha.ID, beta.ID}, sequenceIDs(sequences))
+	require.Len(t, sequences[0].Steps, 3)
+	requirePositions(t, sequences[0].Steps)
+	require.NotNil(t, next)
+
+	sequences, next, err = store.ListSequences(ctx, &model.ListSequencesParams{After: next, Limit: 2, SortBy: model.SortByID})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{gamma.ID}, sequenceIDs(sequences))
+	require.Nil(t, next)
+
+	// A zero limit means the default page size.
+	sequences, next, err = store.ListSequences(ctx, &model.ListSequencesParams{SortBy: model.SortByID})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{alpha.ID, beta.ID, gamma.ID}, sequenceIDs(sequences))
+	require.Nil(t, next)
+	sequences, _, err = store.ListSequences(ctx, &model.ListSequencesParams{After: &model.Cursor{ID: gamma.ID}, SortBy: model.SortByID})
+	require.NoError(t, err)
+	require.Empty(t, sequences)
+
+	sequences, _, err = store.ListSequences(ctx, &model.ListSequencesParams{Limit: 10, SortBy: model.SortByCreatedAt, Descending: true})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{gamma.ID, beta.ID, alpha.ID}, sequenceIDs(sequences))
+
+	sequences, next, err = store.ListSequences(ctx, &model.ListSequencesParams{Limit: 1, SortBy: model.SortByCreatedAt})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{alpha.ID}, sequenceIDs(sequences))
+	sequences, _, err = store.ListSequences(ctx, &model.ListSequencesParams{After: next, Limit: 1, SortBy: model.SortByCreatedAt})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{beta.ID}, sequenceIDs(sequences))
+
+	sequences, _, err = store.ListSequences(ctx, &model.ListSequencesParams{Limit: 10, Name: "outreach", SortBy: model.SortByID})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{alpha.ID, beta.ID}, sequenceIDs(sequences))
+
+	clickTracking := true
+	sequences, _, err = store.ListSequences(ctx, &model.ListSequencesParams{Limit: 10, ClickTrackingEnabled: &clickTracking, SortBy: model.SortByID})
+	require.NoError(t, err)
+	require.Empty(t, sequences)
+}
+
+func sequenceIDs(sequences []*model.Sequence) []uint64 {
+	ids := make([]uint64, len(sequences))
+	for i, sequence := range sequences {
+		ids[i] = sequence.ID
+	}
+	return ids
+}
+
+func testUpdateSequence(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+
+	name, endTime := "Renamed Sequence", "18:30"
+	updated, err := store.UpdateSequence(ctx, sequence.ID, &model.SequencePatch{Version: 1, Name: &name, EndTime: &endTime})
+	require.NoError(t, err)
+	require.Equal(t, name, updated.Name)
+	require.Equal(t, endTime, updated.EndTime)
+	require.Equal(t, sequence.StartTime, updated.StartTime)
+	require.Equal(t, sequence.OpenTrackingEnabled, updated.OpenTrackingEnabled)
+	require.Equal(t, 2, updated.Version)
+	require.False(t, updated.UpdatedAt.Before(sequence.UpdatedAt))
+
+	fetched := fetchSequence(t, store, sequence.ID)
+	require.Equal(t, name, fetched.Name)
+	require.Len(t, fetched.Steps, 3)
+
+	_, err = store.UpdateSequence(ctx, sequence.ID, &model.SequencePatch{Version: 1, Name: &name})
+	require.ErrorIs(t, err, model.ErrVersionMismatch)
+
+	startTime := "19:00"
+	_, err = store.UpdateSequence(ctx, sequence.ID, &model.SequencePatch{StartTime: &startTime})
+	require.ErrorIs(t, err, model.ErrInvalidSendingWindow)
+	require.Equal(t, sequence.StartTime, fetchSequence(t, store, sequence.ID).StartTime)
+
+	_, err = store.UpdateSequence(ctx, sequence.ID+1000, &model.SequencePatch{Name: &name})
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func testDeleteSequence(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	other := createSequence(t, store, "Other Sequence")
+
+	err := store.DeleteSequence(ctx, sequence.ID, 2)
+	require.ErrorIs(t, err, model.ErrVersionMismatch)
+
+	require.NoError(t, store.DeleteSequence(ctx, sequence.ID, 1))
+
+	_, err = store.FetchSequence(ctx, sequence.ID)
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	err = store.DeleteSequence(ctx, sequence.ID, 0)
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	err = store.UpdateStep(ctx, sequence.Steps[0].ID, &model.Step{SequenceID: sequence.ID, Subject: "Subject", Content: "Content"})
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	require.Len(t, fetchSequence(t, store, other.ID).Steps, 3)
+}
+
+func testArchiveSequence(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+
+	err := store.ArchiveSequence(ctx, sequence.ID, 2)
+	require.ErrorIs(t, err, model.ErrVersionMismatch)
+
+	require.NoError(t, store.ArchiveSequence(ctx, sequence.ID, 1))
+
+	fetched := fetchSequence(t, store, sequence.ID)
+	require.NotNil(t, fetched.ArchivedAt)
+	require.Equal(t, 2, fetched.Version)
+
+	// Archiving twice is a no-op.
+	require.NoError(t, store.ArchiveSequence(ctx, sequence.ID, 0))
+	require.Equal(t, 2, fetchSequence(t, store, sequence.ID).Version)
+
+	name := "Renamed Sequence"
+	_, err = store.UpdateSequence(ctx, sequence.ID, &model.SequencePatch{Name: &name})
+	require.ErrorIs(t, err, model.ErrSequenceArchived)
+	require.ErrorIs(t, err, model.ErrConflict)
+
+	err = store.CreateStep(ctx, &model.Step{SequenceID: sequence.ID, Subject: "Subject", Content: "Content"})
+	require.ErrorIs(t, err, model.ErrSequenceArchived)
+
+	_, err = store.ReorderSteps(ctx, sequence.ID, 0, stepIDs(sequence.Steps))
+	require.ErrorIs(t, err, model.ErrSequenceArchived)
+
+	err = store.UpdateStep(ctx, sequence.Steps[0].ID, &model.Step{SequenceID: sequence.ID, Subject: "Subject", Content: "Content"})
+	require.ErrorIs(t, err, model.ErrSequenceArchived)
+
+	err = store.DeleteStep(ctx, sequence.Steps[0].ID, &model.Step{SequenceID: sequence.ID})
+	require.ErrorIs(t, err, model.ErrSequenceArchived)
+
+	err = store.ArchiveSequence(ctx, sequence.ID+1000, 0)
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	// Archived sequences can still be deleted.
+	require.NoError(t, store.DeleteSequence(ctx, sequence.ID, 0))
+}
+
+func testCreateStep(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+
+	appended := &model.Step{SequenceID: sequence.ID, Subject: "Last", Content: "Last Content", WaitDays: 1}
+	require.NoError(t, store.CreateStep(ctx, appended))
+	require.NotZero(t, appended.ID)
+	require.Equal(t, 4, appended.Position)
+	require.Equal(t, 1, appended.Version)
+	require.False(t, appended.CreatedAt.IsZero())
+
+	inserted := &model.Step{SequenceID: sequence.ID, Position: 2, Subject: "Second", Content: "Second Content"}
+	require.NoError(t, store.CreateStep(ctx, inserted))
+	require.Equal(t, 2, inserted.Position)
+
+	fetched := fetchSequence(t, store, sequence.ID)
+	require.Len(t, fetched.Steps, 5)
+	requirePositions(t, fetched.Steps)
+	require.Equal(t, []uint64{
+		sequence.Steps[0].ID,
+		inserted.ID,
+		sequence.Steps[1].ID,
+		sequence.Steps[2].ID,
+		appended.ID,
+	}, stepIDs(fetched.Steps))
+	require.Equal(t, 1, fetched.Steps[0].Version, "Expected steps before the new one to keep their version")
+	require.Equal(t, 2, fetched.Steps[2].Version, "Expected moved steps to get a new version")
+	require.Equal(t, sequence.Version+2, fetched.Version, "Expected step changes to bump the sequence version")
+
+	// Positions past the end append the step.
+	beyond := &model.Step{SequenceID: sequence.ID, Position: 100, Subject: "Beyond", Content: "Beyond Content"}
+	require.NoError(t, store.CreateStep(ctx, beyond))
+	require.Equal(t, 6, beyond.Position)
+
+	err := store.CreateStep(ctx, &model.Step{SequenceID: sequence.ID, Position: 1, Subject: "First", Content: "First Content", WaitHours: 2})
+	require.ErrorIs(t, err, model.ErrFirstStepDelay)
+	require.Len(t, fetchSequence(t, store, sequence.ID).Steps, 6)
+
+	err = store.CreateStep(ctx, &model.Step{SequenceID: sequence.ID + 1000, Subject: "Orphan", Content: "Orphan Content"})
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func testReorderSteps(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	other := createSequence(t, store, "Other Sequence")
+	first, second, third := sequence.Steps[0], sequence.Steps[1], sequence.Steps[2]
+
+	reordered, err := store.ReorderSteps(ctx, sequence.ID, sequence.Version, []uint64{third.ID, first.ID, second.ID})
+	require.NoError(t, err)
+	require.Equal(t, sequence.Version+1, reordered.Version, "Expected the sequence to get a new version")
+	steps := reordered.Steps
+	require.Equal(t, []uint64{third.ID, first.ID, second.ID}, stepIDs(steps))
+	requirePositions(t, steps)
+	require.False(t, steps[0].HasDelay(), "Expected the new first step to lose its delay")
+	require.Equal(t, second.WaitDays, steps[2].WaitDays)
+	for _, step := range steps {
+		require.Equal(t, 2, step.Version)
+	}
+
+	require.Equal(t, steps, fetchSequence(t, store, sequence.ID).Steps)
+
+	_, err = store.ReorderSteps(ctx, sequence.ID, sequence.Version, []uint64{first.ID, second.ID, third.ID})
+	require.ErrorIs(t, err, model.ErrVersionMismatch)
+
+	invalidOrders := map[string][]uint64{
+		"Empty":     {},
+		"Missing":   {first.ID, second.ID},
+		"Duplicate": {first.ID, first.ID, second.ID},
+		"Foreign":   {first.ID, second.ID, other.Steps[0].ID},
+	}
+	for name, order := range invalidOrders {
+		_, err := store.ReorderSteps(ctx, sequence.ID, 0, order)
+		require.ErrorIs(t, err, model.ErrInvalidStepOrder, name)
+	}
+	require.Equal(t, steps, fetchSequence(t, store, sequence.ID).Steps)
+
+	_, err = store.ReorderSteps(ctx, sequence.ID+1000, 0, []uint64{first.ID})
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func testUpdateStep(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	other := createSequence(t, store, "Other Sequence")
+
+	step := &model.Step{
+		SequenceID: sequence.ID,
+		Subject:    "Updated Subject",
+		Content:    "Updated Content",
+		WaitDays:   3,
+		Version:    1,
+	}
+	require.NoError(t, store.UpdateStep(ctx, sequence.Steps[1].ID, step))
+	require.Equal(t, sequence.Steps[1].ID, step.ID)
+	require.Equal(t, 2, step.Position)
+	require.Equal(t, 3, step.WaitDays)
+	require.Equal(t, 2, step.Version)
+	require.Equal(t, sequence.Steps[1].CreatedAt, step.CreatedAt)
+
+	fetched := fetchSequence(t, store, sequence.ID)
+	require.Equal(t, step, fetched.Steps[1])
+	require.Equal(t, sequence.Version+1, fetched.Version)
+
+	err := store.UpdateStep(ctx, sequence.Steps[1].ID, &model.Step{SequenceID: sequence.ID, Subject: "Stale", Content: "Stale", Version: 1})
+	require.ErrorIs(t, err, model.ErrVersionMismatch)
+
+	err = store.UpdateStep(ctx, sequence.Steps[0].ID, &model.Step{SequenceID: sequence.ID, Subject: "First", Content: "First", WaitHours: 1})
+	require.ErrorIs(t, err, model.ErrFirstStepDelay)
+
+	err = store.UpdateStep(ctx, sequence.Steps[0].ID+1000, &model.Step{SequenceID: sequence.ID, Subject: "Missing", Content: "Missing"})
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	// A step can only be updated through the sequence it belongs to.
+	err = store.UpdateStep(ctx, other.Steps[0].ID, &model.Step{SequenceID: sequence.ID, Subject: "Foreign", Content: "Foreign"})
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	require.Equal(t, fetched, fetchSequence(t, store, sequence.ID))
+	require.Equal(t, other, fetchSequence(t, store, other.ID))
+}
+
+func testDeleteStep(t *testing.T, store model.Store) {
+	ctx := t.Context()
+
+	sequence := createSequence(t, store, "Test Sequence")
+	other := createSequence(t, store, "Other Sequence")
+
+	// A step can only be deleted through the sequence it belongs to.
+	err := store.DeleteStep(ctx, other.Steps[0].ID, &model.Step{SequenceID: sequence.ID})
+	require.ErrorIs(t, err, model.ErrNotFound)
+	require.Equal(t, other, fetchSequence(t, store, other.ID))
+
+	err = store.DeleteStep(ctx, sequence.Steps[0].ID, &model.Step{SequenceID: sequence.ID, Version: 2})
+	require.ErrorIs(t, err, model.ErrVersionMismatch)
+
+	require.NoError(t, store.DeleteStep(ctx, sequence.Steps[0].ID, &model.Step{SequenceID: sequence.ID, Version: 1}))
+
+	fetched := fetchSequence(t, store, sequence.ID)
+	require.Equal(t, []uint64{sequence.Steps[1].ID, sequence.Steps[2].ID}, stepIDs(fetched.Steps))
+	require.Equal(t, sequence.Version+1, fetched.Version)
+	requirePositions(t, fetched.Steps)
+	require.False(t, fetched.Steps[0].HasDelay(), "Expected the new first step to lose its delay")
+	require.Equal(t, sequence.Steps[2].WaitHours, fetched.Steps[1].WaitHours)
+
+	err = store.DeleteStep(ctx, sequence.Steps[0].ID, &model.Step{SequenceID: sequence.ID})
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	err = store.DeleteStep(ctx, sequence.Steps[1].ID, &model.Step{SequenceID: sequence.ID + 1000})
+	require.ErrorIs(t, err, model.ErrNotFound)
+
+	require.NoError(t, store.DeleteStep(ctx, fetched.Steps[1].ID, &model.Step{SequenceID: sequence.ID}))
+	require.NoError(t, store.DeleteStep(ctx, fetched.Steps[0].ID, &model.Step{SequenceID: sequence.ID}))
+	require.Empty(t, fetchSequence(t, store, sequence.ID).Steps)
+}
@@ -0,0 +1,463 @@
+package model
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrTemplateSyntax  = newError(ErrValidation, "template_syntax", "", "invalid template syntax")
+	ErrUnknownVariable = newError(ErrValidation, "unknown_variable", "", "unknown template variable")
+)
+
+// Prefix of variables naming contact custom fields, e.g. custom.industry.
+const customVariablePrefix = "custom."
+
+// templateVariables are the contact fields templates may refer to.
+var templateVariables = map[string]func(*Contact) string{
+	"first_name": func(c *Contact) string { return c.FirstName },
+	"last_name":  func(c *Contact) string { return c.LastName },
+	"full_name":  func(c *Contact) string { return strings.TrimSpace(c.FirstName + " " + c.LastName) },
+	"email":      func(c *Contact) string { return c.Email },
+	"company":    func(c *Contact) string { return c.Company },
+}
+
+// Template is a parsed step subject or content. Variables are written as
+// {{first_name}} and may be followed by filters, e.g.
+// {{company | default:"your team"}} or {{first_name | upper}}. Custom fields
+// of the contact are available as {{custom.<key>}}.
+//
+// Spintax groups like {Hi|Hello|Hey} render one of their options, which may
+// hold variables and further groups. Braces without options are literal
+// text, \{, \} and \| escape the spintax characters.
+type Template struct {
+	nodes []templateNode
+}
+
+// templateNode is literal text, a variable with its filters or a spintax
+// group with its options.
+type templateNode struct {
+	text     string
+	variable string
+	filters  []templateFilter
+	options  [][]templateNode
+}
+
+type templateFilter struct {
+	name string
+	arg  string
+}
+
+// ParseTemplate parses the source of a template. Errors point at the line
+// and column of the offending input.
+func ParseTemplate(source string) (*Template, error) {
+	p := &templateParser{source: source}
+	nodes, err := p.parseNodes(false)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{nodes: nodes}, nil
+}
+
+// Render evaluates the template for the contact. Unknown custom fields and
+// empty values render as empty strings unless a default is given. Spintax
+// options are picked at random from the seed, so the same seed always
+// renders the same variant.
+func (t *Template) Render(contact *Contact, seed uint64) string {
+	var b strings.Builder
+	renderNodes(&b, t.nodes, contact, rand.New(rand.NewPCG(seed, seed)))
+	return b.String()
+}
+
+// Permutations returns the number of variants the spintax groups of the
+// template produce, capped at math.MaxUint64.
+func (t *Template) Permutations() uint64 {
+	return permutations(t.nodes)
+}
+
+func renderNodes(b *strings.Builder, nodes []templateNode, contact *Contact, rng *rand.Rand) {
+	for _, node := range nodes {
+		switch {
+		case len(node.options) == 1:
+			renderNodes(b, node.options[0], contact, rng)
+		case node.options != nil:
+			renderNodes(b, node.options[rng.IntN(len(node.options))], contact, rng)
+		case node.variable != "":
+			value := lookupVariable(contact, node.variable)
+			for _, filter := range node.filters {
+				value = applyFilter(filter, value)
+			}
+			b.WriteString(value)
+		default:
+			b.WriteString(node.text)
+		}
+	}
+}
+
+func permutations(nodes []templateNode) uint64 {
+	total := uint64(1)
+	for _, node := range nodes {
+		if node.options == nil {
+			continue
+		}
+		var variants uint64
+		for _, option := range node.options {
+			sum, carry := bits.Add64(variants, permutations(option), 0)
+			if carry != 0 {
+				return math.MaxUint64
+			}
+			variants = sum
+		}
+		hi, lo := bits.Mul64(total, variants)
+		if hi != 0 {
+			return math.MaxUint64
+		}
+		total = lo
+	}
+	return total
+}
+
+// ValidateTemplates checks the syntax and variables of the subject and
+// content templates.
+func (s *Step) ValidateTemplates() error {
+	_, _, err := s.parseTemplates()
+	return err
+}
+
+// Render evaluates the subject and content templates for the contact,
+// picking spintax options from the seed, e.g. the enrollment ID. The
+// subject, the content and every step pick their options independently.
+func (s *Step) Render(contact *Contact, seed uint64) (subject, content string, err error) {
+	subjectTemplate, contentTemplate, err := s.parseTemplates()
+	if err != nil {
+		return "", "", err
+	}
+	return subjectTemplate.Render(contact, s.fieldSeed(seed, "subject")),
+		contentTemplate.Render(contact, s.fieldSeed(seed, "content")), nil
+}
+
+// RenderOrLiteral renders like Render, except that a subject or content that
+// does not parse, e.g. of a step saved before templates were supported, is
+// kept as literal text. The parse errors are returned along with the
+// result.
+func (s *Step) RenderOrLiteral(contact *Contact, seed uint64) (subject, content string, err error) {
+	subject, subjectErr := renderOrLiteral(s.Subject, contact, s.fieldSeed(seed, "subject"))
+	content, contentErr := renderOrLiteral(s.Content, contact, s.fieldSeed(seed, "content"))
+	return subject, content, errors.Join(withField(subjectErr, "subject"), withField(contentErr, "content"))
+}
+
+// fieldSeed derives the seed of a field of the step from the seed of the
+// render. Sharing the seed would tie the picks of the subject and content to
+// each other and repeat the same picks in every step.
+func (s *Step) fieldSeed(seed uint64, field string) uint64 {
+	h := fnv.New64a()
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], seed)
+	binary.BigEndian.PutUint64(buf[8:], s.ID)
+	h.Write(buf[:])
+	h.Write([]byte(field))
+	return h.Sum64()
+}
+
+func renderOrLiteral(source string, contact *Contact, seed uint64) (string, error) {
+	template, err := ParseTemplate(source)
+	if err != nil {
+		return source, err
+	}
+	return template.Render(contact, seed), nil
+}
+
+// Permutations returns the number of variants of the subject and content
+// combined, capped at math.MaxUint64.
+func (s *Step) Permutations() (uint64, error) {
+	subject, content, err := s.parseTemplates()
+	if err != nil {
+		return 0, err
+	}
+	hi, lo := bits.Mul64(subject.Permutations(), content.Permutations())
+	if hi != 0 {
+		return math.MaxUint64, nil
+	}
+	return lo, nil
+}
+
+func (s *Step) parseTemplates() (*Template, *Template, error) {
+	subject, err := ParseTemplate(s.Subject)
+	if err != nil {
+		return nil, nil, withField(err, "subject")
+	}
+	content, err := ParseTemplate(s.Content)
+	if err != nil {
+		return nil, nil, withField(err, "content")
+	}
+	return subject, content, nil
+}
+
+// withField relates a model error to the input field.
+func withField(err error, field string) error {
+	var modelErr *Error
+	if errors.As(err, &modelErr) {
+		return modelErr.WithField(field)
+	}
+	return err
+}
+
+func lookupVariable(contact *Contact, name string) string {
+	if key, ok := strings.CutPrefix(name, customVariablePrefix); ok {
+		return contact.CustomFields[key]
+	}
+	return templateVariables[name](contact)
+}
+
+func applyFilter(filter templateFilter, value string) string {
+	switch filter.name {
+	case "default":
+		if strings.TrimSpace(value) == "" {
+			return filter.arg
+		}
+	case "upper":
+		return strings.ToUpper(value)
+	case "lower":
+		return strings.ToLower(value)
+	}
+	return value
+}
+
+// templateFilters tells whether each filter takes an argument.
+var templateFilters = map[string]bool{
+	"default": true,
+	"upper":   false,
+	"lower":   false,
+}
+
+type templateParser struct {
+	source string
+	pos    int
+}
+
+// parseNodes parses text, variable tags and spintax groups up to the end of
+// the source or, inside a group, up to the | or } ending the option.
+func (p *templateParser) parseNodes(inGroup bool) ([]templateNode, error) {
+	var (
+		nodes []templateNode
+		text  strings.Builder
+	)
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, templateNode{text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for p.pos < len(p.source) {
+		rest := p.source[p.pos:]
+		switch {
+		case strings.HasPrefix(rest, "{{"):
+			flush()
+			node, err := p.parseTag()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		case len(rest) > 1 && rest[0] == '\\' && strings.IndexByte("{}|", rest[1]) >= 0:
+			text.WriteByte(rest[1])
+			p.pos += 2
+		case rest[0] == '{':
+			flush()
+			node, err := p.parseGroup()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		case inGroup && (rest[0] == '|' || rest[0] == '}'):
+			flush()
+			return nodes, nil
+		default:
+			text.WriteByte(rest[0])
+			p.pos++
+		}
+	}
+	flush()
+	return nodes, nil
+}
+
+// parseGroup parses a spintax group starting at the current position.
+func (p *templateParser) parseGroup() (templateNode, error) {
+	open := p.pos
+	p.pos++
+
+	var options [][]templateNode
+	for {
+		option, err := p.parseNodes(true)
+		if err != nil {
+			return templateNode{}, err
+		}
+		options = append(options, option)
+		if p.pos >= len(p.source) {
+			return templateNode{}, p.errorf(ErrTemplateSyntax, open, "unclosed spintax group, expected }")
+		}
+		p.pos++
+		if p.source[p.pos-1] == '}' {
+			break
+		}
+	}
+
+	if len(options) == 1 {
+		// Braces without options are kept as they are.
+		literal := append([]templateNode{{text: "{"}}, options[0]...)
+		options[0] = append(literal, templateNode{text: "}"})
+	}
+	return templateNode{options: options}, nil
+}
+
+// parseTag parses a variable tag starting at the current position.
+func (p *templateParser) parseTag() (templateNode, error) {
+	open := p.pos
+	p.pos += len("{{")
+
+	p.skipSpaces()
+	nameAt := p.pos
+	name := p.identifier()
+	if name == "" {
+		return templateNode{}, p.errorf(ErrTemplateSyntax, p.pos, "expected a variable name")
+	}
+	if !isTemplateVariable(name) {
+		return templateNode{}, p.errorf(ErrUnknownVariable, nameAt, "unknown variable %q", name)
+	}
+	node := templateNode{variable: name}
+
+	for {
+		p.skipSpaces()
+		switch {
+		case p.pos >= len(p.source):
+			return templateNode{}, p.errorf(ErrTemplateSyntax, open, "unclosed tag, expected }}")
+		case strings.HasPrefix(p.source[p.pos:], "}}"):
+			p.pos += len("}}")
+			return node, nil
+		case p.source[p.pos] == '|':
+			p.pos++
+			filter, err := p.parseFilter()
+			if err != nil {
+				return templateNode{}, err
+			}
+			node.filters = append(node.filters, filter)
+		default:
+			return templateNode{}, p.errorf(ErrTemplateSyntax, p.pos, "unexpected %q, expected | or }}", p.peekRune())
+		}
+	}
+}
+
+// parseFilter parses a filter name and its optional quoted argument.
+func (p *templateParser) parseFilter() (templateFilter, error) {
+	p.skipSpaces()
+	nameAt := p.pos
+	filter := templateFilter{name: p.identifier()}
+	if filter.name == "" {
+		return filter, p.errorf(ErrTemplateSyntax, p.pos, "expected a filter name")
+	}
+	takesArg, ok := templateFilters[filter.name]
+	if !ok {
+		return filter, p.errorf(ErrTemplateSyntax, nameAt, "unknown filter %q", filter.name)
+	}
+
+	p.skipSpaces()
+	hasArg := p.pos < len(p.source) && p.source[p.pos] == ':'
+	switch {
+	case takesArg && !hasArg:
+		return filter, p.errorf(ErrTemplateSyntax, p.pos, "filter %q expects an argument", filter.name)
+	case !takesArg && hasArg:
+		return filter, p.errorf(ErrTemplateSyntax, p.pos, "filter %q takes no argument", filter.name)
+	case hasArg:
+		p.pos++
+		p.skipSpaces()
+		arg, err := p.quoted()
+		if err != nil {
+			return filter, err
+		}
+		filter.arg = arg
+	}
+	return filter, nil
+}
+
+// quoted parses a double-quoted string in which \" and \\ are escapes.
+func (p *templateParser) quoted() (string, error) {
+	if p.pos >= len(p.source) || p.source[p.pos] != '"' {
+		return "", p.errorf(ErrTemplateSyntax, p.pos, "expected a quoted string")
+	}
+	open := p.pos
+	p.pos++
+
+	var b strings.Builder
+	for p.pos < len(p.source) {
+		c := p.source[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return b.String(), nil
+		case c == '\\' && p.pos+1 < len(p.source) && (p.source[p.pos+1] == '"' || p.source[p.pos+1] == '\\'):
+			b.WriteByte(p.source[p.pos+1])
+			p.pos += 2
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf(ErrTemplateSyntax, open, "unterminated string")
+}
+
+// identifier reads a variable or filter name.
+func (p *templateParser) identifier() string {
+	start := p.pos
+	for p.pos < len(p.source) {
+		c := p.source[p.pos]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.') {
+			break
+		}
+		p.pos++
+	}
+	return p.source[start:p.pos]
+}
+
+func (p *templateParser) skipSpaces() {
+	for p.pos < len(p.source) && strings.IndexByte(" \t\r\n", p.source[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *templateParser) peekRune() rune {
+	r, _ := utf8.DecodeRuneInString(p.source[p.pos:])
+	return r
+}
+
+// errorf returns a copy of the error describing a problem at the byte
+// offset of the source.
+func (p *templateParser) errorf(err *Error, offset int, format string, args ...any) *Error {
+	line, column := position(p.source, offset)
+	e := *err
+	e.Message = fmt.Sprintf("%s at line %d, column %d", fmt.Sprintf(format, args...), line, column)
+	return &e
+}
+
+// position returns the 1-based line and column of the byte offset, counting
+// columns in characters.
+func position(source string, offset int) (int, int) {
+	before := source[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+	return line, column
+}
+
+func isTemplateVariable(name string) bool {
+	if key, ok := strings.CutPrefix(name, customVariablePrefix); ok {
+		return key != ""
+	}
+	_, ok := templateVariables[name]
+	return ok
+}
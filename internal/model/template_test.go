@@ -0,0 +1,162 @@
+package model
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateRender(t *testing.T) {
+	contact := &Contact{
+		Email:        "jane@example.com",
+		FirstName:    "Jane",
+		LastName:     "Doe",
+		CustomFields: map[string]string{"industry": "Retail"},
+	}
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"plain text", "Hello there", "Hello there"},
+		{"variable", "Hi {{first_name}},", "Hi Jane,"},
+		{"spaces inside the tag", "Hi {{ full_name }}!", "Hi Jane Doe!"},
+		{"default for an empty field", `Hello {{company | default:"your team"}}`, "Hello your team"},
+		{"escaped quote in default", `{{company|default:"the \"A\" team"}}`, `the "A" team`},
+		{"chained filters", `{{company | default:"acme" | upper}}`, "ACME"},
+		{"custom field", "{{custom.industry | lower}}", "retail"},
+		{"missing custom field", `{{custom.size | default:"any size"}}`, "any size"},
+		{"braces without options", "{not a tag} }}", "{not a tag} }}"},
+		{"escaped spintax", `\{Hi\|Hello\} | C:\path`, `{Hi|Hello} | C:\path`},
+		{"single option group", "{Hi {{first_name}}}!", "{Hi Jane}!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := ParseTemplate(tt.source)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, template.Render(contact, 1))
+		})
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		code    *Error
+		message string
+	}{
+		{"unknown variable", "Hi {{ frist_name }}", ErrUnknownVariable, `unknown variable "frist_name" at line 1, column 7`},
+		{"unclosed tag", "Hi\nthere {{first_name", ErrTemplateSyntax, "unclosed tag, expected }} at line 2, column 7"},
+		{"missing name", "{{ }}", ErrTemplateSyntax, "expected a variable name at line 1, column 4"},
+		{"empty custom field", "{{custom.}}", ErrUnknownVariable, `unknown variable "custom." at line 1, column 3`},
+		{"unknown filter", "{{company | title}}", ErrTemplateSyntax, `unknown filter "title" at line 1, column 13`},
+		{"default without argument", "{{company | default}}", ErrTemplateSyntax, `filter "default" expects an argument at line 1, column 20`},
+		{"argument of upper", `{{company | upper:"x"}}`, ErrTemplateSyntax, `filter "upper" takes no argument at line 1, column 18`},
+		{"unquoted argument", "{{company | default:team}}", ErrTemplateSyntax, "expected a quoted string at line 1, column 21"},
+		{"unterminated string", `{{company | default:"team}}`, ErrTemplateSyntax, "unterminated string at line 1, column 21"},
+		{"unclosed spintax group", "Hi\n{Hello|Hey {{first_name}}", ErrTemplateSyntax, "unclosed spintax group, expected } at line 2, column 1"},
+		{"unknown variable in spintax", "{Hi|Hey {{name}}}", ErrUnknownVariable, `unknown variable "name" at line 1, column 11`},
+		{"unexpected character", "Ünïcode {{first_name last_name}}", ErrTemplateSyntax, `unexpected 'l', expected | or }} at line 1, column 22`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTemplate(tt.source)
+			require.ErrorIs(t, err, tt.code)
+			require.ErrorIs(t, err, ErrValidation)
+			assert.Equal(t, tt.message, err.Error())
+		})
+	}
+}
+
+func TestStepValidateTemplates(t *testing.T) {
+	step := &Step{Subject: "Hi {{first_name}}", Content: "About {{compnay}}"}
+
+	err := step.ValidateTemplates()
+	var modelErr *Error
+	require.ErrorAs(t, err, &modelErr)
+	assert.Equal(t, ErrUnknownVariable.Code, modelErr.Code)
+	assert.Equal(t, "content", modelErr.Field)
+
+	step.Content = "About {{company}}"
+	subject, content, err := step.Render(&Contact{FirstName: "Jane", Company: "Acme"}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Hi Jane", subject)
+	assert.Equal(t, "About Acme", content)
+}
+
+func TestStepRenderOrLiteral(t *testing.T) {
+	step := &Step{Subject: "Hi {{first_name}}", Content: "Price: {{ 10 USD }}"}
+
+	subject, content, err := step.RenderOrLiteral(&Contact{FirstName: "Jane"}, 1)
+	assert.ErrorIs(t, err, ErrUnknownVariable)
+	assert.Equal(t, "Hi Jane", subject)
+	assert.Equal(t, "Price: {{ 10 USD }}", content)
+
+	step.Content = "Thanks"
+	_, content, err = step.RenderOrLiteral(&Contact{}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Thanks", content)
+}
+
+func TestTemplateSpintax(t *testing.T) {
+	template, err := ParseTemplate("{Hi|Hello|Hey} {{first_name}}, {quick|short} {question|{idea|thought} for you}")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3*2*3), template.Permutations())
+
+	contact := &Contact{FirstName: "Jane"}
+	seen := map[string]bool{}
+	for seed := range uint64(200) {
+		rendered := template.Render(contact, seed)
+		assert.Equal(t, rendered, template.Render(contact, seed), "seed %d renders differently", seed)
+		assert.Regexp(t, `^(Hi|Hello|Hey) Jane, (quick|short) (question|idea for you|thought for you)$`, rendered)
+		seen[rendered] = true
+	}
+	assert.Len(t, seen, 18)
+
+	plain, err := ParseTemplate("No {options} here")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), plain.Permutations())
+	assert.Equal(t, "No {options} here", plain.Render(contact, 7))
+}
+
+func TestStepRenderSpintax(t *testing.T) {
+	first := &Step{ID: 1, Subject: "{A|B}", Content: "{X|Y}"}
+	second := &Step{ID: 2, Subject: "{A|B}", Content: "{X|Y}"}
+
+	// The subject and content, and the same field of different steps, pick
+	// their options independently, so every combination occurs.
+	fields := map[string]bool{}
+	steps := map[string]bool{}
+	for seed := range uint64(200) {
+		subject, content, err := first.Render(&Contact{}, seed)
+		require.NoError(t, err)
+		fields[subject+content] = true
+
+		other, _, err := second.Render(&Contact{}, seed)
+		require.NoError(t, err)
+		steps[subject+other] = true
+
+		literalSubject, literalContent, err := first.RenderOrLiteral(&Contact{}, seed)
+		require.NoError(t, err)
+		assert.Equal(t, subject+content, literalSubject+literalContent)
+	}
+	assert.Equal(t, map[string]bool{"AX": true, "AY": true, "BX": true, "BY": true}, fields)
+	assert.Equal(t, map[string]bool{"AA": true, "AB": true, "BA": true, "BB": true}, steps)
+}
+
+func TestStepPermutations(t *testing.T) {
+	step := &Step{Subject: "{Hi|Hello} {{first_name}}", Content: "{A|B|C}{|!}"}
+	permutations, err := step.Permutations()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2*3*2), permutations)
+
+	step.Content = strings.Repeat("{a|b|c|d}", 40)
+	permutations, err = step.Permutations()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(math.MaxUint64), permutations)
+}
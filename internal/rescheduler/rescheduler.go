@@ -0,0 +1,175 @@
+// Package rescheduler brings the pending emails of a sequence in line with
+// its steps after they are added, removed, reordered or change their waits,
+// and with its mailboxes after they are attached or detached. The store
+// queues such sequences together with the change, the rescheduler claims
+// them one at a time, so any number of reschedulers may run against the same
+// database. Enrollments are rescheduled batch by batch, so that no
+// transaction holds many of them for long.
+package rescheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/scheduler"
+)
+
+const (
+	defaultBatchSize = 500
+
+	DefaultPollInterval = 5 * time.Second
+	DefaultLease        = 10 * time.Minute
+)
+
+type Config struct {
+	Store model.Store
+	// Enrollments rescheduled in one transaction. Defaults to 500.
+	BatchSize int
+	// Pause between batches that keeps large sequences from hogging the
+	// database. Zero runs batches back to back.
+	Throttle time.Duration
+	// How long an idle rescheduler waits before looking for queued
+	// sequences again. Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+	// How long a claimed job may take before another rescheduler claims it
+	// again. A failed job is retried once its lease is over. Defaults to
+	// DefaultLease.
+	Lease time.Duration
+	// Plans sequences again after their mailboxes change. Defaults to a
+	// scheduler of the store.
+	Scheduler *scheduler.Scheduler
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+type Rescheduler struct {
+	store        model.Store
+	scheduler    *scheduler.Scheduler
+	batchSize    int
+	throttle     time.Duration
+	pollInterval time.Duration
+	lease        time.Duration
+	now          func() time.Time
+}
+
+// Report sums up the rescheduling of a sequence.
+type Report struct {
+	Batches int
+	// Enrollments that moved to another step or send time.
+	Rescheduled int
+	// Enrollments completed because every step has been sent.
+	Completed int
+}
+
+func New(cfg Config) *Rescheduler {
+	r := &Rescheduler{
+		store:        cfg.Store,
+		scheduler:    cfg.Scheduler,
+		batchSize:    cfg.BatchSize,
+		throttle:     cfg.Throttle,
+		pollInterval: cfg.PollInterval,
+		lease:        cfg.Lease,
+		now:          cfg.Now,
+	}
+	if r.batchSize <= 0 {
+		r.batchSize = defaultBatchSize
+	}
+	if r.pollInterval <= 0 {
+		r.pollInterval = DefaultPollInterval
+	}
+	if r.lease <= 0 {
+		r.lease = DefaultLease
+	}
+	if r.now == nil {
+		r.now = time.Now
+	}
+	if r.scheduler == nil {
+		r.scheduler = scheduler.New(scheduler.Config{Store: r.store, Now: r.now})
+	}
+	return r
+}
+
+// Run handles queued sequences until the context is canceled.
+func (r *Rescheduler) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		queued, err := r.RunNext(ctx)
+		if err != nil {
+			log.Printf("Rescheduler failed to run a job: %v", err)
+		}
+		if queued && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+// RunNext claims the oldest queued job, if any, runs it and reports whether
+// there was one. A job that fails stays claimed and is retried after the
+// lease.
+func (r *Rescheduler) RunNext(ctx context.Context) (bool, error) {
+	job, err := r.store.ClaimRescheduleJob(ctx, r.now(), r.lease)
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	// Jobs of deleted sequences are done as well.
+	if err := r.run(ctx, job); err != nil && !errors.Is(err, model.ErrNotFound) {
+		return true, err
+	}
+	return true, r.store.FinishRescheduleJob(ctx, job)
+}
+
+func (r *Rescheduler) run(ctx context.Context, job *model.RescheduleJob) error {
+	switch job.Kind {
+	case model.RescheduleSteps:
+		report, err := r.RescheduleSequence(ctx, job.SequenceID)
+		if err != nil {
+			return err
+		}
+		log.Printf("Rescheduled sequence %d in %d batches: %d enrollments moved, %d completed",
+			job.SequenceID, report.Batches, report.Rescheduled, report.Completed)
+	case model.RebalanceMailboxes:
+		report, err := r.scheduler.Rebalance(ctx, job.SequenceID)
+		if err != nil {
+			return err
+		}
+		log.Printf("Rebalanced sequence %d: %d emails moved to another mailbox, %d slipped a day, %d planned, %d left without a mailbox",
+			job.SequenceID, report.Moved, report.Slipped, report.Planned, report.Unassigned)
+	}
+	return nil
+}
+
+// RescheduleSequence reschedules the enrollments of the sequence, see
+// model.Progress.Replan. Every batch is committed on its own.
+func (r *Rescheduler) RescheduleSequence(ctx context.Context, sequenceID uint64) (*Report, error) {
+	report := &Report{}
+	var after uint64
+	for {
+		result, err := r.store.RescheduleEnrollments(ctx, sequenceID, after, r.batchSize, r.now())
+		if err != nil {
+			return report, err
+		}
+		if result.LastID == 0 {
+			return report, nil
+		}
+		report.Batches++
+		report.Rescheduled += result.Rescheduled
+		report.Completed += result.Completed
+		after = result.LastID
+
+		if r.throttle > 0 {
+			select {
+			case <-ctx.Done():
+				return report, ctx.Err()
+			case <-time.After(r.throttle):
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package rescheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/model/memory"
+	"github.com/danikarik/salesforge/internal/model/storetest"
+	"github.com/stretchr/testify/require"
+)
+
+// setup enrolls the number of contacts into a sequence of two steps and
+// swaps the steps.
+func setup(t *testing.T, store model.Store, contacts int) (*model.Sequence, []*model.Enrollment) {
+	t.Helper()
+	ctx := t.Context()
+
+	sequence := &model.Sequence{
+		Name: "Test Sequence",
+		Steps: []*model.Step{
+			{Subject: "Step 1", Content: "Content 1"},
+			{Subject: "Step 2", Content: "Content 2"},
+		},
+	}
+	require.NoError(t, store.CreateSequence(ctx, sequence))
+
+	enrollments := storetest.Enroll(t, store, sequence, storetest.CreateContacts(t, store, contacts)...)
+
+	_, err := store.ReorderSteps(ctx, sequence.ID, 0, []uint64{sequence.Steps[1].ID, sequence.Steps[0].ID})
+	require.NoError(t, err)
+
+	return sequence, enrollments
+}
+
+// beforeEnrollment is a clock for which the first emails are not due yet.
+func beforeEnrollment() time.Time {
+	return time.Now().Add(-time.Hour)
+}
+
+func TestRescheduleSequence(t *testing.T) {
+	store := memory.NewStore()
+	sequence, enrollments := setup(t, store, 5)
+
+	rescheduler := New(Config{Store: store, BatchSize: 2, Throttle: time.Millisecond, Now: beforeEnrollment})
+	report, err := rescheduler.RescheduleSequence(t.Context(), sequence.ID)
+	require.NoError(t, err)
+	require.Equal(t, &Report{Batches: 3, Rescheduled: 5}, report)
+
+	for _, enrollment := range enrollments {
+		require.Equal(t, sequence.Steps[1].ID, *storetest.PendingEmail(t, store, enrollment).StepID)
+	}
+
+	_, err = rescheduler.RescheduleSequence(t.Context(), sequence.ID+1)
+	require.ErrorIs(t, err, model.ErrNotFound)
+}
+
+func TestRunNext(t *testing.T) {
+	store := memory.NewStore()
+	sequence, enrollments := setup(t, store, 3)
+
+	rescheduler := New(Config{Store: store, Now: beforeEnrollment})
+	queued, err := rescheduler.RunNext(t.Context())
+	require.NoError(t, err)
+	require.True(t, queued)
+	for _, enrollment := range enrollments {
+		require.Equal(t, sequence.Steps[1].ID, *storetest.PendingEmail(t, store, enrollment).StepID)
+	}
+
+	queued, err = rescheduler.RunNext(t.Context())
+	require.NoError(t, err)
+	require.False(t, queued, "Expected the finished job to be gone")
+}
+
+func TestRun(t *testing.T) {
+	store := memory.NewStore()
+	sequence, enrollments := setup(t, store, 1)
+
+	rescheduler := New(Config{Store: store, PollInterval: 10 * time.Millisecond, Now: beforeEnrollment})
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		rescheduler.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		return *storetest.PendingEmail(t, store, enrollments[0]).StepID == sequence.Steps[1].ID
+	}, time.Second, 10*time.Millisecond)
+
+	// Steps changed while the rescheduler idles are picked up on the next poll.
+	_, err := store.ReorderSteps(t.Context(), sequence.ID, 0, []uint64{sequence.Steps[0].ID, sequence.Steps[1].ID})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return *storetest.PendingEmail(t, store, enrollments[0]).StepID == sequence.Steps[0].ID
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
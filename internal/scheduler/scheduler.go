@@ -0,0 +1,268 @@
+// Package scheduler plans pending scheduled emails: it assigns them to the
+// mailboxes of their sequence without exceeding the daily capacity of any
+// mailbox, spreads them evenly across the sending window and postpones the
+// overflow to the next sending day. Sequences whose mailboxes change are
+// planned again with Rebalance.
+package scheduler
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+// planningHorizon bounds the emails loaded by a run. It covers the next
+// sending day of any window, which may be a week away.
+const planningHorizon = 8 * 24 * time.Hour
+
+type Config struct {
+	Store model.Store
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+type Scheduler struct {
+	store model.Store
+	now   func() time.Time
+}
+
+// Report sums up a run.
+type Report struct {
+	// Emails assigned to a mailbox and a send time.
+	Planned int
+	// Emails moved to the next sending day for lack of mailbox capacity.
+	Postponed int
+	// Emails left alone because their sequence has no mailboxes.
+	Unassigned int
+}
+
+// RebalanceReport sums up the rebalancing of a sequence.
+type RebalanceReport struct {
+	// Planned emails that moved to another mailbox.
+	Moved int
+	// Emails that slipped to the next sending day for lack of capacity.
+	Slipped int
+	// Emails without a mailbox that got one.
+	Planned int
+	// Planned emails left without a mailbox, e.g. because the sequence has
+	// none left.
+	Unassigned int
+}
+
+func New(cfg Config) *Scheduler {
+	s := &Scheduler{store: cfg.Store, now: cfg.Now}
+	if s.now == nil {
+		s.now = time.Now
+	}
+	return s
+}
+
+// Start runs the scheduler right away and then every interval until the
+// context is canceled.
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := s.Run(ctx)
+		if err != nil {
+			log.Printf("Scheduler run failed: %v", err)
+		} else {
+			log.Printf("Scheduler planned %d emails, postponed %d, left %d without a mailbox",
+				report.Planned, report.Postponed, report.Unassigned)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run plans the emails due on the current sending day of their sequence.
+// Emails that already have a mailbox are not moved, but they take up the
+// capacity of their mailbox.
+func (s *Scheduler) Run(ctx context.Context) (*Report, error) {
+	now := s.now().UTC()
+	emails, err := s.store.ListUnplannedEmails(ctx, now.Add(planningHorizon))
+	if err != nil {
+		return nil, err
+	}
+
+	bySequence := make(map[uint64][]*model.ScheduledEmail)
+	for _, email := range emails {
+		bySequence[email.SequenceID] = append(bySequence[email.SequenceID], email)
+	}
+
+	report := &Report{}
+	for _, sequenceID := range slices.Sorted(maps.Keys(bySequence)) {
+		if _, err := s.planSequence(ctx, sequenceID, bySequence[sequenceID], now, report); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// Rebalance plans the rest of the current sending day of the sequence again
+// after its mailboxes changed. Pending emails planned after now lose their
+// mailbox and are planned together with the emails still waiting for one, so
+// they are shared between the attached mailboxes within their capacity.
+// Emails already postponed to a later day stay there.
+func (s *Scheduler) Rebalance(ctx context.Context, sequenceID uint64) (*RebalanceReport, error) {
+	now := s.now().UTC()
+	unplanned, err := s.store.UnplanScheduledEmails(ctx, sequenceID, now)
+	if err != nil {
+		return nil, err
+	}
+	emails, err := s.store.ListUnplannedEmails(ctx, now.Add(planningHorizon))
+	if err != nil {
+		return nil, err
+	}
+	emails = slices.DeleteFunc(emails, func(email *model.ScheduledEmail) bool {
+		return email.SequenceID != sequenceID
+	})
+
+	plans, err := s.planSequence(ctx, sequenceID, emails, now, &Report{})
+	if err != nil {
+		return nil, err
+	}
+
+	previous := make(map[uint64]*uint64, len(unplanned))
+	for _, email := range unplanned {
+		previous[email.ID] = email.MailboxID
+	}
+	report := &RebalanceReport{}
+	for _, plan := range plans {
+		mailboxID, wasPlanned := previous[plan.ID]
+		delete(previous, plan.ID)
+		switch {
+		case plan.MailboxID == nil:
+			report.Slipped++
+		case !wasPlanned:
+			report.Planned++
+		case *plan.MailboxID != *mailboxID:
+			report.Moved++
+		}
+	}
+	// Emails that were not planned again stay without a mailbox.
+	report.Unassigned = len(previous)
+	return report, nil
+}
+
+// planSequence plans the emails of a sequence, ordered by send time, and
+// returns the plans.
+func (s *Scheduler) planSequence(ctx context.Context, sequenceID uint64, emails []*model.ScheduledEmail, now time.Time, report *Report) ([]*model.ScheduledEmailPlan, error) {
+	sequence, err := s.store.FetchSequence(ctx, sequenceID)
+	if err != nil {
+		return nil, err
+	}
+	window, err := sequence.SendingWindow()
+	if err != nil {
+		return nil, err
+	}
+
+	// The current sending day is the one of the next slot. Emails planned
+	// after its end wait for a later run.
+	start, end, _ := window.Day(window.Next(now))
+	from := latest(start, now)
+	due := slices.IndexFunc(emails, func(email *model.ScheduledEmail) bool {
+		return !email.SendAt.Before(end)
+	})
+	if due >= 0 {
+		emails = emails[:due]
+	}
+	if len(emails) == 0 {
+		return nil, nil
+	}
+
+	mailboxes, err := s.store.ListSequenceMailboxes(ctx, sequenceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(mailboxes) == 0 {
+		report.Unassigned += len(emails)
+		return nil, nil
+	}
+
+	mailboxIDs := make([]uint64, len(mailboxes))
+	for i, mailbox := range mailboxes {
+		mailboxIDs[i] = mailbox.ID
+	}
+	// Mailboxes are counted and planned in one go, so planners running at
+	// the same time, here or in other processes, never overfill them. The
+	// count covers the whole mailbox day, as other sequences may send from
+	// the same mailboxes outside of this window.
+	dayStart, dayEnd := mailboxDay(start, end)
+	var plans []*model.ScheduledEmailPlan
+	_, err = s.store.PlanMailboxEmails(ctx, mailboxIDs, dayStart, dayEnd, func(used map[uint64]int) []*model.ScheduledEmailPlan {
+		plans = assign(emails, mailboxes, used, window, from, end, report)
+		return plans
+	})
+	return plans, err
+}
+
+// assign shares the emails between the mailboxes given the emails they have
+// planned already and returns the plans.
+func assign(emails []*model.ScheduledEmail, mailboxes []*model.Mailbox, used map[uint64]int, window *model.SendingWindow, from, end time.Time, report *Report) []*model.ScheduledEmailPlan {
+	// Every email goes to the mailbox with the most capacity left, so the
+	// load is shared between mailboxes.
+	assigned := make(map[uint64][]*model.ScheduledEmail)
+	var plans []*model.ScheduledEmailPlan
+	for _, email := range emails {
+		mailbox := slices.MaxFunc(mailboxes, func(a, b *model.Mailbox) int {
+			return cmp.Or(
+				cmp.Compare(a.DailyCapacity-used[a.ID], b.DailyCapacity-used[b.ID]),
+				cmp.Compare(b.ID, a.ID),
+			)
+		})
+		if used[mailbox.ID] >= mailbox.DailyCapacity {
+			plans = append(plans, &model.ScheduledEmailPlan{ID: email.ID, SendAt: window.Next(end)})
+			report.Postponed++
+			continue
+		}
+		used[mailbox.ID]++
+		assigned[mailbox.ID] = append(assigned[mailbox.ID], email)
+	}
+
+	// Spread the emails of every mailbox evenly across the rest of the
+	// window, never before they are due.
+	for mailboxID, emails := range assigned {
+		interval := end.Sub(from) / time.Duration(len(emails))
+		for i, email := range emails {
+			slot := from.Add(time.Duration(i) * interval).Truncate(time.Microsecond)
+			plans = append(plans, &model.ScheduledEmailPlan{
+				ID:        email.ID,
+				MailboxID: &mailboxID,
+				SendAt:    latest(slot, email.SendAt),
+			})
+		}
+		report.Planned += len(emails)
+	}
+	return plans
+}
+
+// mailboxDay returns the UTC days holding the window from start to end.
+// Mailboxes have no timezone, so their capacity is counted per UTC day
+// whatever the windows of the sequences sharing them. A window crossing
+// midnight counts both days, which keeps every day within capacity.
+func mailboxDay(start, end time.Time) (time.Time, time.Time) {
+	return midnight(start), midnight(end.Add(-time.Nanosecond)).AddDate(0, 0, 1)
+}
+
+func midnight(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,273 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/model/memory"
+	"github.com/danikarik/salesforge/internal/model/storetest"
+	"github.com/stretchr/testify/require"
+)
+
+// tomorrow is a sending day for every test sequence, after the first step of
+// any enrollment made by the tests is due.
+var tomorrow = time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+
+func at(day time.Time, hour, minute int) time.Time {
+	return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+}
+
+// setup creates a sequence sending every day from 09:00 to 17:00 UTC with
+// the given number of enrolled contacts and mailboxes of the capacities.
+func setup(t *testing.T, store model.Store, contacts int, capacities ...int) []*model.Enrollment {
+	t.Helper()
+	ctx := t.Context()
+
+	sequence := &model.Sequence{
+		Name:     "Test Sequence",
+		Weekdays: []time.Weekday{0, 1, 2, 3, 4, 5, 6},
+		Steps:    []*model.Step{{Subject: "Step 1", Content: "Content 1"}},
+	}
+	require.NoError(t, store.CreateSequence(ctx, sequence))
+
+	enrollments := storetest.Enroll(t, store, sequence, storetest.CreateContacts(t, store, contacts)...)
+
+	for i, capacity := range capacities {
+		mailbox := &model.Mailbox{UserID: 1, Email: fmt.Sprintf("sender%d@example.com", i), DailyCapacity: capacity}
+		require.NoError(t, store.CreateMailbox(ctx, mailbox))
+		require.NoError(t, store.AttachMailbox(ctx, sequence.ID, mailbox.ID))
+	}
+
+	return enrollments
+}
+
+func fixedClock(t time.Time) func() time.Time {
+	return func() time.Time { return t }
+}
+
+func TestRun(t *testing.T) {
+	t.Run("DistributesEvenly", func(t *testing.T) {
+		store := memory.NewStore()
+		enrollments := setup(t, store, 4, 3)
+
+		scheduler := New(Config{Store: store, Now: fixedClock(at(tomorrow, 8, 0))})
+		report, err := scheduler.Run(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, &Report{Planned: 3, Postponed: 1}, report)
+
+		for i, want := range []time.Time{at(tomorrow, 9, 0), at(tomorrow, 11, 40), at(tomorrow, 14, 20)} {
+			email := storetest.PendingEmail(t, store, enrollments[i])
+			require.NotNil(t, email.MailboxID)
+			require.Equal(t, want, email.SendAt)
+		}
+
+		// The overflow moves to the next day and is planned by its run.
+		postponed := storetest.PendingEmail(t, store, enrollments[3])
+		require.Nil(t, postponed.MailboxID)
+		require.Equal(t, at(tomorrow.AddDate(0, 0, 1), 9, 0), postponed.SendAt)
+
+		report, err = scheduler.Run(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, &Report{}, report)
+
+		scheduler = New(Config{Store: store, Now: fixedClock(at(tomorrow.AddDate(0, 0, 1), 0, 0))})
+		report, err = scheduler.Run(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, &Report{Planned: 1}, report)
+		postponed = storetest.PendingEmail(t, store, enrollments[3])
+		require.NotNil(t, postponed.MailboxID)
+		require.Equal(t, at(tomorrow.AddDate(0, 0, 1), 9, 0), postponed.SendAt)
+	})
+
+	t.Run("SharesLoadBetweenMailboxes", func(t *testing.T) {
+		store := memory.NewStore()
+		enrollments := setup(t, store, 4, 2, 2)
+
+		scheduler := New(Config{Store: store, Now: fixedClock(at(tomorrow, 8, 0))})
+		report, err := scheduler.Run(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, &Report{Planned: 4}, report)
+
+		perMailbox := make(map[uint64][]time.Time)
+		for _, enrollment := range enrollments {
+			email := storetest.PendingEmail(t, store, enrollment)
+			require.NotNil(t, email.MailboxID)
+			perMailbox[*email.MailboxID] = append(perMailbox[*email.MailboxID], email.SendAt)
+		}
+		require.Len(t, perMailbox, 2)
+		for _, sendTimes := range perMailbox {
+			require.Equal(t, []time.Time{at(tomorrow, 9, 0), at(tomorrow, 13, 0)}, sendTimes)
+		}
+	})
+
+	t.Run("SharesCapacityBetweenSequences", func(t *testing.T) {
+		store := memory.NewStore()
+		ctx := t.Context()
+
+		mailbox := &model.Mailbox{UserID: 1, Email: "sender@example.com", DailyCapacity: 2}
+		require.NoError(t, store.CreateMailbox(ctx, mailbox))
+		contacts := storetest.CreateContacts(t, store, 4)
+
+		// A morning and an afternoon sequence send from the same mailbox.
+		var enrollments []*model.Enrollment
+		for i, window := range [][2]string{{"09:00", "12:00"}, {"13:00", "17:00"}} {
+			sequence := &model.Sequence{
+				Name:      fmt.Sprintf("Sequence %d", i),
+				StartTime: window[0],
+				EndTime:   window[1],
+				Weekdays:  []time.Weekday{0, 1, 2, 3, 4, 5, 6},
+				Steps:     []*model.Step{{Subject: "Step 1", Content: "Content 1"}},
+			}
+			require.NoError(t, store.CreateSequence(ctx, sequence))
+			require.NoError(t, store.AttachMailbox(ctx, sequence.ID, mailbox.ID))
+			enrollments = append(enrollments, storetest.Enroll(t, store, sequence, contacts[2*i:2*i+2]...)...)
+		}
+
+		scheduler := New(Config{Store: store, Now: fixedClock(at(tomorrow, 8, 0))})
+		report, err := scheduler.Run(ctx)
+		require.NoError(t, err)
+		require.Equal(t, &Report{Planned: 2, Postponed: 2}, report)
+
+		for _, enrollment := range enrollments[2:] {
+			email := storetest.PendingEmail(t, store, enrollment)
+			require.Nil(t, email.MailboxID)
+			require.Equal(t, at(tomorrow.AddDate(0, 0, 1), 13, 0), email.SendAt)
+		}
+	})
+
+	t.Run("CountsPlannedEmails", func(t *testing.T) {
+		store := memory.NewStore()
+		enrollments := setup(t, store, 2, 2)
+
+		scheduler := New(Config{Store: store, Now: fixedClock(at(tomorrow, 8, 0))})
+		_, err := scheduler.Run(t.Context())
+		require.NoError(t, err)
+
+		// Later enrollments only get the capacity left for the day.
+		sequenceID := enrollments[0].SequenceID
+		sequence, err := store.FetchSequence(t.Context(), sequenceID)
+		require.NoError(t, err)
+		contact := &model.Contact{OwnerID: 1, Email: "late@example.com"}
+		require.NoError(t, store.CreateContact(t.Context(), contact))
+		late, err := store.CreateEnrollments(t.Context(), sequenceID, sequence.Steps[0].ID, []uint64{contact.ID}, time.Now())
+		require.NoError(t, err)
+
+		scheduler = New(Config{Store: store, Now: fixedClock(at(tomorrow, 12, 0))})
+		report, err := scheduler.Run(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, &Report{Postponed: 1}, report)
+		require.Equal(t, at(tomorrow.AddDate(0, 0, 1), 9, 0), storetest.PendingEmail(t, store, late[0]).SendAt)
+	})
+
+	t.Run("ConcurrentRuns", func(t *testing.T) {
+		store := memory.NewStore()
+		enrollments := setup(t, store, 6, 3)
+		sequenceID := enrollments[0].SequenceID
+
+		// Runs and rebalances of other processes never overfill a mailbox.
+		scheduler := New(Config{Store: store, Now: fixedClock(at(tomorrow, 8, 0))})
+		var wg sync.WaitGroup
+		for i := range 6 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var err error
+				if i%2 == 0 {
+					_, err = scheduler.Run(t.Context())
+				} else {
+					_, err = scheduler.Rebalance(t.Context(), sequenceID)
+				}
+				require.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		mailboxes, err := store.ListSequenceMailboxes(t.Context(), sequenceID)
+		require.NoError(t, err)
+		counts, err := store.CountMailboxEmails(t.Context(), []uint64{mailboxes[0].ID}, tomorrow, tomorrow.AddDate(0, 0, 1))
+		require.NoError(t, err)
+		require.Equal(t, 3, counts[mailboxes[0].ID])
+	})
+
+	t.Run("StartsFromNow", func(t *testing.T) {
+		store := memory.NewStore()
+		enrollments := setup(t, store, 2, 10)
+
+		scheduler := New(Config{Store: store, Now: fixedClock(at(tomorrow, 13, 0))})
+		_, err := scheduler.Run(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, at(tomorrow, 13, 0), storetest.PendingEmail(t, store, enrollments[0]).SendAt)
+		require.Equal(t, at(tomorrow, 15, 0), storetest.PendingEmail(t, store, enrollments[1]).SendAt)
+	})
+
+	t.Run("WithoutMailboxes", func(t *testing.T) {
+		store := memory.NewStore()
+		enrollments := setup(t, store, 2)
+
+		scheduler := New(Config{Store: store, Now: fixedClock(at(tomorrow, 8, 0))})
+		report, err := scheduler.Run(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, &Report{Unassigned: 2}, report)
+		require.Nil(t, storetest.PendingEmail(t, store, enrollments[0]).MailboxID)
+	})
+
+	t.Run("NotDueYet", func(t *testing.T) {
+		store := memory.NewStore()
+		enrollments := setup(t, store, 1, 10)
+		planned := storetest.PendingEmail(t, store, enrollments[0]).SendAt
+
+		scheduler := New(Config{Store: store, Now: fixedClock(at(tomorrow.AddDate(0, 0, -3), 8, 0))})
+		report, err := scheduler.Run(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, &Report{}, report)
+		require.Equal(t, planned, storetest.PendingEmail(t, store, enrollments[0]).SendAt)
+	})
+}
+
+func TestRebalance(t *testing.T) {
+	store := memory.NewStore()
+	enrollments := setup(t, store, 4, 2, 2)
+	sequenceID := enrollments[0].SequenceID
+	mailboxes, err := store.ListSequenceMailboxes(t.Context(), sequenceID)
+	require.NoError(t, err)
+
+	scheduler := New(Config{Store: store, Now: fixedClock(at(tomorrow, 8, 0))})
+	_, err = scheduler.Run(t.Context())
+	require.NoError(t, err)
+
+	// The first mailbox takes over as much as it can, the rest slips a day.
+	require.NoError(t, store.DetachMailbox(t.Context(), sequenceID, mailboxes[1].ID))
+	report, err := scheduler.Rebalance(t.Context(), sequenceID)
+	require.NoError(t, err)
+	require.Equal(t, &RebalanceReport{Moved: 1, Slipped: 2}, report)
+	for i, want := range []time.Time{at(tomorrow, 9, 0), at(tomorrow, 13, 0)} {
+		email := storetest.PendingEmail(t, store, enrollments[i])
+		require.Equal(t, &mailboxes[0].ID, email.MailboxID)
+		require.Equal(t, want, email.SendAt)
+	}
+	for _, enrollment := range enrollments[2:] {
+		email := storetest.PendingEmail(t, store, enrollment)
+		require.Nil(t, email.MailboxID)
+		require.Equal(t, at(tomorrow.AddDate(0, 0, 1), 9, 0), email.SendAt)
+	}
+
+	// A new mailbox shares the emails left for the day.
+	mailbox := &model.Mailbox{UserID: 1, Email: "new@example.com", DailyCapacity: 2}
+	require.NoError(t, store.CreateMailbox(t.Context(), mailbox))
+	require.NoError(t, store.AttachMailbox(t.Context(), sequenceID, mailbox.ID))
+	report, err = scheduler.Rebalance(t.Context(), sequenceID)
+	require.NoError(t, err)
+	require.Equal(t, &RebalanceReport{Moved: 1}, report)
+	require.Equal(t, &mailbox.ID, storetest.PendingEmail(t, store, enrollments[1]).MailboxID)
+
+	// Without mailboxes the emails wait for one.
+	require.NoError(t, store.DetachMailbox(t.Context(), sequenceID, mailboxes[0].ID))
+	require.NoError(t, store.DetachMailbox(t.Context(), sequenceID, mailbox.ID))
+	report, err = scheduler.Rebalance(t.Context(), sequenceID)
+	require.NoError(t, err)
+	require.Equal(t, &RebalanceReport{Unassigned: 2}, report)
+	require.Nil(t, storetest.PendingEmail(t, store, enrollments[0]).MailboxID)
+}
@@ -0,0 +1,82 @@
+// Package secret encrypts secrets kept at rest, such as the SMTP passwords
+// of mailboxes, with AES-256-GCM.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// KeySize is the length of keys in bytes before base64 encoding.
+const KeySize = 32
+
+// prefix marks sealed values. Values without it are plaintext stored before
+// secrets were encrypted.
+const prefix = "v1:"
+
+var (
+	ErrInvalidKey = errors.New("secret key must be 32 bytes encoded as base64")
+	ErrMalformed  = errors.New("malformed secret")
+)
+
+// Box seals and opens secrets with a single key.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// NewBox returns a box using the base64 encoded key, for example one made by
+// openssl rand -base64 32.
+func NewBox(key string) (*Box, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts the plaintext with a random nonce. Empty secrets stay empty,
+// so an unset secret reads as unset.
+func (b *Box) Seal(plaintext string) string {
+	if plaintext == "" {
+		return ""
+	}
+	nonce := make([]byte, b.aead.NonceSize())
+	rand.Read(nonce)
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// Open decrypts a value returned by Seal. Plaintext values, see IsSealed,
+// are returned as they are.
+func (b *Box) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil || len(sealed) < b.aead.NonceSize() {
+		return "", ErrMalformed
+	}
+	nonce, ciphertext := sealed[:b.aead.NonceSize()], sealed[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", ErrMalformed
+	}
+	return string(plaintext), nil
+}
+
+// IsSealed reports whether the value was returned by Seal.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
@@ -0,0 +1,43 @@
+package secret
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+func TestBox(t *testing.T) {
+	box, err := NewBox(testKey)
+	require.NoError(t, err)
+
+	sealed := box.Seal("hunter2")
+	require.True(t, IsSealed(sealed))
+	require.NotContains(t, sealed, "hunter2")
+	require.NotEqual(t, sealed, box.Seal("hunter2"), "Expected a fresh nonce for every seal")
+	opened, err := box.Open(sealed)
+	require.NoError(t, err)
+	require.Equal(t, "hunter2", opened)
+
+	// Empty and plaintext values are left alone.
+	require.Empty(t, box.Seal(""))
+	opened, err = box.Open("legacy")
+	require.NoError(t, err)
+	require.Equal(t, "legacy", opened)
+
+	// Values sealed with another key or tampered with fail to open.
+	other, err := NewBox("ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=")
+	require.NoError(t, err)
+	_, err = other.Open(sealed)
+	require.ErrorIs(t, err, ErrMalformed)
+	_, err = box.Open(prefix + "not base64")
+	require.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestNewBoxInvalidKey(t *testing.T) {
+	for _, key := range []string{"", "not base64", "c2hvcnQ="} {
+		_, err := NewBox(key)
+		require.ErrorIs(t, err, ErrInvalidKey, key)
+	}
+}
@@ -0,0 +1,70 @@
+package sender
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+// CapturedMessage is a message kept by CaptureSender.
+type CapturedMessage struct {
+	From string
+	To   string
+	Data []byte
+}
+
+// CaptureSender keeps messages instead of sending them, for running flows
+// locally. Messages are written to a directory as .eml files or, without a
+// directory, kept in memory.
+type CaptureSender struct {
+	dir      string
+	tracking Tracking
+	now      func() time.Time
+
+	mu       sync.Mutex
+	messages []*CapturedMessage
+}
+
+// NewCaptureSender returns a sender writing to the directory, which is
+// created if needed. An empty directory keeps messages in memory.
+func NewCaptureSender(dir string, tracking Tracking) (*CaptureSender, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &CaptureSender{dir: dir, tracking: tracking, now: time.Now}, nil
+}
+
+func (s *CaptureSender) Send(ctx context.Context, delivery *model.Delivery) error {
+	date := s.now()
+	message := NewMessage(delivery, date, s.tracking)
+	captured := &CapturedMessage{
+		From: message.From.Address,
+		To:   message.To.Address,
+		Data: message.Bytes(),
+	}
+
+	if s.dir != "" {
+		name := fmt.Sprintf("%s-%d.eml", date.UTC().Format("20060102T150405.000000000Z"), delivery.Email.ID)
+		return os.WriteFile(filepath.Join(s.dir, name), captured.Data, 0o644)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, captured)
+	return nil
+}
+
+// Messages returns the messages kept in memory in the order they were sent.
+func (s *CaptureSender) Messages() []*CapturedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.messages)
+}
@@ -0,0 +1,49 @@
+package sender
+
+import (
+	"bytes"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureSender(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		s, err := NewCaptureSender("", Tracking{})
+		require.NoError(t, err)
+
+		require.NoError(t, s.Send(t.Context(), testDelivery(&model.Mailbox{Email: "sales@example.com"})))
+
+		messages := s.Messages()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "sales@example.com", messages[0].From)
+		assert.Equal(t, "jane@example.com", messages[0].To)
+		assert.Contains(t, string(messages[0].Data), "Subject: Quick question\r\n")
+	})
+
+	t.Run("Directory", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "outbox")
+		s, err := NewCaptureSender(dir, Tracking{})
+		require.NoError(t, err)
+
+		require.NoError(t, s.Send(t.Context(), testDelivery(&model.Mailbox{Email: "sales@example.com"})))
+		assert.Empty(t, s.Messages())
+
+		files, err := filepath.Glob(filepath.Join(dir, "*-7.eml"))
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+
+		data, err := os.ReadFile(files[0])
+		require.NoError(t, err)
+		msg, err := mail.ReadMessage(bytes.NewReader(data))
+		require.NoError(t, err)
+		to, err := mail.ParseAddress(msg.Header.Get("To"))
+		require.NoError(t, err)
+		assert.Equal(t, "jane@example.com", to.Address)
+	})
+}
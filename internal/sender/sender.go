@@ -0,0 +1,143 @@
+// Package sender delivers scheduled emails. Senders render a delivery as an
+// RFC 5322 message and either send it over SMTP with the credentials of its
+// mailbox, capture it locally or only log it.
+package sender
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+// Sender sends the email of a delivery from its mailbox.
+type Sender interface {
+	Send(ctx context.Context, delivery *model.Delivery) error
+}
+
+// RejectedError is a failure that retrying cannot fix: the server refused
+// the recipient or the message.
+type RejectedError struct {
+	Err error
+}
+
+func (e *RejectedError) Error() string { return e.Err.Error() }
+
+func (e *RejectedError) Unwrap() error { return e.Err }
+
+// IsPermanent reports whether sending failed for good, see RejectedError.
+// Other failures are worth retrying.
+func IsPermanent(err error) bool {
+	var rejected *RejectedError
+	return errors.As(err, &rejected)
+}
+
+// LogSender only logs deliveries.
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, delivery *model.Delivery) error {
+	log.Printf("Sending step %d from %s to %s: %s",
+		delivery.Step.ID, delivery.Mailbox.Email, delivery.Contact.Email, delivery.Step.Subject)
+	return nil
+}
+
+// Message is an email sending a step to a contact, with a plain text and an
+// HTML alternative.
+type Message struct {
+	From      mail.Address
+	To        mail.Address
+	Subject   string
+	Date      time.Time
+	MessageID string
+	Text      string
+	HTML      string
+}
+
+// NewMessage builds the message of a delivery dated at the time. The step
+// subject and content are rendered as templates for the contact, with
+// spintax resolved per enrollment, and tracking is applied as enabled on the
+// sequence. Templates that do not parse are sent as they were written.
+func NewMessage(delivery *model.Delivery, date time.Time, tracking Tracking) *Message {
+	subject, text, err := delivery.Step.RenderOrLiteral(delivery.Contact, delivery.Email.EnrollmentID)
+	if err != nil {
+		// Steps saved before templates were supported were never validated.
+		log.Printf("Sending step %d as literal text: %v", delivery.Step.ID, err)
+	}
+
+	var opens, clicks bool
+	if tracking.BaseURL != "" && delivery.Sequence != nil {
+		opens = delivery.Sequence.OpenTrackingEnabled
+		clicks = delivery.Sequence.ClickTrackingEnabled
+	}
+	html := tracking.textToHTML(text, delivery.Email.ID, opens, clicks)
+	if clicks {
+		text = tracking.rewriteLinks(text, delivery.Email.ID)
+	}
+
+	name := strings.TrimSpace(delivery.Contact.FirstName + " " + delivery.Contact.LastName)
+	return &Message{
+		From:      mail.Address{Address: delivery.Mailbox.Email},
+		To:        mail.Address{Name: name, Address: delivery.Contact.Email},
+		Subject:   subject,
+		Date:      date,
+		MessageID: fmt.Sprintf("<%d.%d@%s>", delivery.Email.ID, date.UnixNano(), domain(delivery.Mailbox.Email)),
+		Text:      text,
+		HTML:      html,
+	}
+}
+
+// Bytes renders the message in RFC 5322 format with CRLF line endings as a
+// multipart/alternative of the text and HTML parts. Non-ASCII headers are
+// encoded as RFC 2047 words, the parts as quoted-printable.
+func (m *Message) Bytes() []byte {
+	var b bytes.Buffer
+	// Writes to a buffer do not fail.
+	parts := multipart.NewWriter(&b)
+	for _, header := range [][2]string{
+		{"From", m.From.String()},
+		{"To", m.To.String()},
+		{"Subject", mime.QEncoding.Encode("utf-8", m.Subject)},
+		{"Date", m.Date.Format(time.RFC1123Z)},
+		{"Message-ID", m.MessageID},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": parts.Boundary()})},
+	} {
+		fmt.Fprintf(&b, "%s: %s\r\n", header[0], header[1])
+	}
+	b.WriteString("\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, _ := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		qp := quotedprintable.NewWriter(w)
+		qp.Write([]byte(part.body))
+		qp.Close()
+	}
+	parts.Close()
+	return b.Bytes()
+}
+
+// domain returns the domain of an email address.
+func domain(address string) string {
+	_, domain, _ := strings.Cut(address, "@")
+	return cmp.Or(domain, "localhost")
+}
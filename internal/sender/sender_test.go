@@ -0,0 +1,113 @@
+package sender
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"testing"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readParts parses a rendered message and returns its headers and the
+// decoded bodies of its parts by content type.
+func readParts(t *testing.T, data []byte) (mail.Header, map[string]string) {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	require.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	parts := map[string]string{}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+		contentType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		parts[contentType] = string(body)
+	}
+	return msg.Header, parts
+}
+
+func TestMessageBytes(t *testing.T) {
+	delivery := testDelivery(&model.Mailbox{Email: "sales@example.com"})
+	delivery.Contact.FirstName = "Zoë"
+	delivery.Step.Subject = "Привет, {{first_name}}"
+	date := time.Date(2030, time.January, 7, 10, 0, 0, 0, time.UTC)
+
+	message := NewMessage(delivery, date, Tracking{})
+	header, parts := readParts(t, message.Bytes())
+
+	to, err := header.AddressList("To")
+	require.NoError(t, err)
+	assert.Equal(t, []*mail.Address{{Name: "Zoë Doe", Address: "jane@example.com"}}, to)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Привет, Zoë", subject)
+
+	sent, err := header.Date()
+	require.NoError(t, err)
+	assert.True(t, date.Equal(sent))
+	assert.Equal(t, "<7.1894010400000000000@example.com>", header.Get("Message-ID"))
+
+	assert.Equal(t, "Hi Zoë,\r\n\r\nDo you have a minute?", parts["text/plain"])
+	assert.Contains(t, parts["text/html"], "Hi Zoë,<br>\r\n<br>\r\nDo you have a minute?")
+}
+
+func TestNewMessageTracking(t *testing.T) {
+	delivery := testDelivery(&model.Mailbox{Email: "sales@example.com"})
+	delivery.Step.Content = "See https://example.com/pricing?plan=pro. Or <reply>."
+	tracking := Tracking{BaseURL: "https://t.example.com/"}
+
+	t.Run("Disabled", func(t *testing.T) {
+		delivery.Sequence = &model.Sequence{}
+
+		message := NewMessage(delivery, time.Now(), tracking)
+		assert.Equal(t, "See https://example.com/pricing?plan=pro. Or <reply>.", message.Text)
+		assert.Contains(t, message.HTML, `See <a href="https://example.com/pricing?plan=pro">https://example.com/pricing?plan=pro</a>. Or &lt;reply&gt;.`)
+		assert.NotContains(t, message.HTML, "<img")
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		delivery.Sequence = &model.Sequence{OpenTrackingEnabled: true, ClickTrackingEnabled: true}
+
+		message := NewMessage(delivery, time.Now(), tracking)
+		click := "https://t.example.com/c/7?url=https%3A%2F%2Fexample.com%2Fpricing%3Fplan%3Dpro"
+		assert.Equal(t, "See "+click+". Or <reply>.", message.Text)
+		assert.Contains(t, message.HTML, `<a href="`+click+`">https://example.com/pricing?plan=pro</a>`)
+		assert.Contains(t, message.HTML, `<img src="https://t.example.com/o/7.gif"`)
+	})
+
+	t.Run("WithoutBaseURL", func(t *testing.T) {
+		delivery.Sequence = &model.Sequence{OpenTrackingEnabled: true, ClickTrackingEnabled: true}
+
+		message := NewMessage(delivery, time.Now(), Tracking{})
+		assert.NotContains(t, message.Text, "t.example.com")
+		assert.NotContains(t, message.HTML, "<img")
+	})
+}
+
+func TestNewMessageInvalidTemplate(t *testing.T) {
+	delivery := testDelivery(&model.Mailbox{Email: "sales@example.com"})
+	delivery.Step.Subject = "Hi {{first_name}}"
+	delivery.Step.Content = "Hi {{first_name"
+
+	// Steps saved before templates were supported are sent as written.
+	message := NewMessage(delivery, time.Now(), Tracking{})
+	assert.Equal(t, "Hi Jane", message.Subject)
+	assert.Equal(t, "Hi {{first_name", message.Text)
+}
@@ -0,0 +1,272 @@
+package sender
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+)
+
+const defaultSMTPTimeout = 30 * time.Second
+
+// SMTPSPort is the port of servers expecting TLS from the start of the
+// connection rather than STARTTLS.
+const SMTPSPort = 465
+
+var (
+	ErrNoSMTPServer     = errors.New("mailbox has no SMTP server")
+	ErrUnsupportedAuth  = errors.New("SMTP server supports neither AUTH PLAIN nor AUTH LOGIN")
+	ErrTLSRequired      = errors.New("SMTP server does not support STARTTLS")
+	errUnencryptedLogin = errors.New("unencrypted connection")
+)
+
+// SMTPServer is the address and credentials of an SMTP server.
+type SMTPServer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+type SMTPConfig struct {
+	// Server of mailboxes without their own.
+	Default SMTPServer
+	// Settings of TLS connections. The server name defaults to the host of
+	// the server.
+	TLSConfig *tls.Config
+	// Refuse to send through servers that do not offer STARTTLS, instead of
+	// sending the message unencrypted.
+	RequireTLS bool
+	// Ports of servers expecting TLS from the start of the connection.
+	// Defaults to SMTPSPort.
+	ImplicitTLSPorts []int
+	// Time allowed for sending a message, including dialing. Defaults to
+	// 30 seconds.
+	Timeout time.Duration
+	// Name sent with EHLO. Defaults to localhost.
+	LocalName string
+	// Tracking of opens and clicks.
+	Tracking Tracking
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+// SMTPSender sends messages through the SMTP server of their mailbox. It
+// speaks TLS from the start on implicit TLS ports, upgrades other
+// connections with STARTTLS when the server offers it, unless TLS is
+// required, and logs in with AUTH PLAIN or LOGIN when the mailbox has a
+// username. Credentials are never sent over an unencrypted connection to a
+// remote host.
+type SMTPSender struct {
+	fallback         SMTPServer
+	tlsConfig        *tls.Config
+	requireTLS       bool
+	implicitTLSPorts []int
+	timeout          time.Duration
+	localName        string
+	tracking         Tracking
+	now              func() time.Time
+}
+
+func NewSMTPSender(cfg SMTPConfig) *SMTPSender {
+	s := &SMTPSender{
+		fallback:         cfg.Default,
+		tlsConfig:        cfg.TLSConfig,
+		requireTLS:       cfg.RequireTLS,
+		implicitTLSPorts: cfg.ImplicitTLSPorts,
+		timeout:          cfg.Timeout,
+		localName:        cfg.LocalName,
+		tracking:         cfg.Tracking,
+		now:              cfg.Now,
+	}
+	if s.fallback.Port == 0 {
+		s.fallback.Port = model.DefaultSMTPPort
+	}
+	if s.tlsConfig == nil {
+		s.tlsConfig = &tls.Config{}
+	}
+	if s.implicitTLSPorts == nil {
+		s.implicitTLSPorts = []int{SMTPSPort}
+	}
+	if s.timeout <= 0 {
+		s.timeout = defaultSMTPTimeout
+	}
+	if s.localName == "" {
+		s.localName = "localhost"
+	}
+	if s.now == nil {
+		s.now = time.Now
+	}
+	return s
+}
+
+func (s *SMTPSender) Send(ctx context.Context, delivery *model.Delivery) error {
+	server := s.server(delivery.Mailbox)
+	if server.Host == "" {
+		return ErrNoSMTPServer
+	}
+	message := NewMessage(delivery, s.now(), s.tracking)
+	return s.send(ctx, server, message.From.Address, message.To.Address, message.Bytes())
+}
+
+// server returns the SMTP server of the mailbox, or the default one when
+// the mailbox has none.
+func (s *SMTPSender) server(mailbox *model.Mailbox) SMTPServer {
+	if mailbox.SMTPHost == "" {
+		return s.fallback
+	}
+	return SMTPServer{
+		Host:     mailbox.SMTPHost,
+		Port:     mailbox.SMTPPort,
+		Username: mailbox.SMTPUsername,
+		Password: mailbox.SMTPPassword,
+	}
+}
+
+func (s *SMTPSender) send(ctx context.Context, server SMTPServer, from, to string, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(server.Host, strconv.Itoa(server.Port)))
+	if err != nil {
+		return err
+	}
+	implicitTLS := slices.Contains(s.implicitTLSPorts, server.Port)
+	if implicitTLS {
+		tlsConn := tls.Client(conn, s.tlsConfigFor(server.Host))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return err
+		}
+		conn = tlsConn
+	}
+	// Canceling the context interrupts whatever the client waits for.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, server.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Hello(s.localName); err != nil {
+		return err
+	}
+	if !implicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(s.tlsConfigFor(server.Host)); err != nil {
+				return err
+			}
+		} else if s.requireTLS {
+			return ErrTLSRequired
+		}
+	}
+	if server.Username != "" {
+		auth, err := chooseAuth(client, server)
+		if err != nil {
+			return err
+		}
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return rejected(err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return rejected(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return rejected(err)
+	}
+	return client.Quit()
+}
+
+// tlsConfigFor returns the TLS settings of connections to the host.
+func (s *SMTPSender) tlsConfigFor(host string) *tls.Config {
+	config := s.tlsConfig.Clone()
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	return config
+}
+
+// rejected marks permanent negative replies to the recipient or the message
+// as RejectedError. Transient 4xx replies are returned as they are.
+func rejected(err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return &RejectedError{Err: err}
+	}
+	return err
+}
+
+// chooseAuth prefers AUTH PLAIN and falls back to AUTH LOGIN.
+func chooseAuth(client *smtp.Client, server SMTPServer) (smtp.Auth, error) {
+	_, params := client.Extension("AUTH")
+	mechanisms := strings.Fields(strings.ToUpper(params))
+	switch {
+	case slices.Contains(mechanisms, "PLAIN"):
+		return smtp.PlainAuth("", server.Username, server.Password, server.Host), nil
+	case slices.Contains(mechanisms, "LOGIN"):
+		return &loginAuth{username: server.Username, password: server.Password, host: server.Host}, nil
+	default:
+		return nil, ErrUnsupportedAuth
+	}
+}
+
+// loginAuth implements AUTH LOGIN, which net/smtp lacks. Like
+// smtp.PlainAuth, it only sends credentials over TLS or to localhost.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errUnencryptedLogin
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected AUTH LOGIN challenge %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
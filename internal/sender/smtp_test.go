@@ -0,0 +1,423 @@
+package sender
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// received is a message accepted by fakeSMTPServer.
+type received struct {
+	TLS      bool
+	Username string
+	Password string
+	From     string
+	To       []string
+	Data     string
+}
+
+// fakeSMTPServer accepts messages on a local port. It offers STARTTLS when
+// it has a TLS config, unless it expects TLS from the start, and the given
+// AUTH mechanisms.
+type fakeSMTPServer struct {
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	mechanisms  []string
+
+	mu       sync.Mutex
+	messages []*received
+	replies  map[string]string
+}
+
+func startFakeSMTPServer(t *testing.T, tlsConfig *tls.Config, mechanisms ...string) *fakeSMTPServer {
+	t.Helper()
+
+	s := &fakeSMTPServer{tlsConfig: tlsConfig, mechanisms: mechanisms}
+	s.start(t)
+	return s
+}
+
+// startFakeSMTPSServer starts a server expecting TLS from the start of
+// every connection.
+func startFakeSMTPSServer(t *testing.T, tlsConfig *tls.Config, mechanisms ...string) *fakeSMTPServer {
+	t.Helper()
+
+	s := &fakeSMTPServer{tlsConfig: tlsConfig, implicitTLS: true, mechanisms: mechanisms}
+	s.start(t)
+	return s
+}
+
+func (s *fakeSMTPServer) start(t *testing.T) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	s.listener = listener
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+}
+
+func (s *fakeSMTPServer) server() SMTPServer {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return SMTPServer{Host: addr.IP.String(), Port: addr.Port}
+}
+
+// reply makes the server answer RCPT of the recipient with the line instead
+// of accepting it.
+func (s *fakeSMTPServer) reply(to, line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replies == nil {
+		s.replies = make(map[string]string)
+	}
+	s.replies[to] = line
+}
+
+func (s *fakeSMTPServer) inbox() []*received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messages
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	message := &received{}
+	if s.implicitTLS {
+		tlsConn := tls.Server(conn, s.tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		conn = tlsConn
+		message.TLS = true
+	}
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			lines := []string{"fake"}
+			if s.tlsConfig != nil && !message.TLS {
+				lines = append(lines, "STARTTLS")
+			}
+			if len(s.mechanisms) > 0 {
+				lines = append(lines, "AUTH "+strings.Join(s.mechanisms, " "))
+			}
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				text.PrintfLine("250%s%s", sep, l)
+			}
+		case "STARTTLS":
+			text.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			message.TLS = true
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			switch mechanism {
+			case "PLAIN":
+				decoded, _ := base64.StdEncoding.DecodeString(initial)
+				parts := strings.Split(string(decoded), "\x00")
+				if len(parts) != 3 {
+					text.PrintfLine("501 malformed")
+					continue
+				}
+				message.Username, message.Password = parts[1], parts[2]
+			case "LOGIN":
+				message.Username = s.challenge(text, "Username:")
+				message.Password = s.challenge(text, "Password:")
+			default:
+				text.PrintfLine("504 unsupported")
+				continue
+			}
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			message.From = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			to := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			s.mu.Lock()
+			reply, ok := s.replies[to]
+			s.mu.Unlock()
+			if ok {
+				text.PrintfLine("%s", reply)
+				continue
+			}
+			message.To = append(message.To, to)
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			message.Data = string(data)
+			s.mu.Lock()
+			s.messages = append(s.messages, message)
+			s.mu.Unlock()
+			message = &received{TLS: message.TLS}
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+// challenge sends an AUTH LOGIN prompt and returns the decoded answer.
+func (s *fakeSMTPServer) challenge(text *textproto.Conn, prompt string) string {
+	text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+	line, _ := text.ReadLine()
+	decoded, _ := base64.StdEncoding.DecodeString(line)
+	return string(decoded)
+}
+
+// selfSignedTLS returns a server config with a certificate for 127.0.0.1
+// and a client config trusting it.
+func selfSignedTLS(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake smtp"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: roots}
+}
+
+func testDelivery(mailbox *model.Mailbox) *model.Delivery {
+	return &model.Delivery{
+		Email:   &model.ScheduledEmail{ID: 7},
+		Mailbox: mailbox,
+		Contact: &model.Contact{Email: "jane@example.com", FirstName: "Jane", LastName: "Doe"},
+		Step:    &model.Step{ID: 3, Subject: "Quick question", Content: "Hi {{first_name}},\n\nDo you have a minute?"},
+	}
+}
+
+func withServer(mailbox *model.Mailbox, server SMTPServer) *model.Mailbox {
+	mailbox.SMTPHost = server.Host
+	mailbox.SMTPPort = server.Port
+	mailbox.SMTPUsername = server.Username
+	mailbox.SMTPPassword = server.Password
+	return mailbox
+}
+
+func TestSMTPSender(t *testing.T) {
+	t.Run("PlainOverSTARTTLS", func(t *testing.T) {
+		serverTLS, clientTLS := selfSignedTLS(t)
+		fake := startFakeSMTPServer(t, serverTLS, "PLAIN", "LOGIN")
+
+		server := fake.server()
+		server.Username, server.Password = "sales", "secret"
+		mailbox := withServer(&model.Mailbox{Email: "sales@example.com"}, server)
+
+		s := NewSMTPSender(SMTPConfig{TLSConfig: clientTLS})
+		require.NoError(t, s.Send(t.Context(), testDelivery(mailbox)))
+
+		messages := fake.inbox()
+		require.Len(t, messages, 1)
+		assert.True(t, messages[0].TLS)
+		assert.Equal(t, "sales", messages[0].Username)
+		assert.Equal(t, "secret", messages[0].Password)
+		assert.Equal(t, "sales@example.com", messages[0].From)
+		assert.Equal(t, []string{"jane@example.com"}, messages[0].To)
+		assert.Contains(t, messages[0].Data, "Subject: Quick question\n")
+		assert.Contains(t, messages[0].Data, "Do you have a minute?")
+	})
+
+	t.Run("ImplicitTLS", func(t *testing.T) {
+		serverTLS, clientTLS := selfSignedTLS(t)
+		fake := startFakeSMTPSServer(t, serverTLS, "PLAIN")
+
+		server := fake.server()
+		server.Username, server.Password = "sales", "secret"
+		mailbox := withServer(&model.Mailbox{Email: "sales@example.com"}, server)
+
+		s := NewSMTPSender(SMTPConfig{TLSConfig: clientTLS, RequireTLS: true, ImplicitTLSPorts: []int{server.Port}})
+		require.NoError(t, s.Send(t.Context(), testDelivery(mailbox)))
+
+		messages := fake.inbox()
+		require.Len(t, messages, 1)
+		assert.True(t, messages[0].TLS)
+		assert.Equal(t, "secret", messages[0].Password)
+	})
+
+	t.Run("RequireTLS", func(t *testing.T) {
+		fake := startFakeSMTPServer(t, nil)
+
+		s := NewSMTPSender(SMTPConfig{Default: fake.server(), RequireTLS: true})
+		err := s.Send(t.Context(), testDelivery(&model.Mailbox{Email: "sales@example.com"}))
+		assert.ErrorIs(t, err, ErrTLSRequired)
+		assert.False(t, IsPermanent(err))
+		assert.Empty(t, fake.inbox())
+	})
+
+	t.Run("Login", func(t *testing.T) {
+		fake := startFakeSMTPServer(t, nil, "LOGIN")
+
+		server := fake.server()
+		server.Username, server.Password = "sales", "secret"
+		mailbox := withServer(&model.Mailbox{Email: "sales@example.com"}, server)
+
+		s := NewSMTPSender(SMTPConfig{})
+		require.NoError(t, s.Send(t.Context(), testDelivery(mailbox)))
+
+		messages := fake.inbox()
+		require.Len(t, messages, 1)
+		assert.False(t, messages[0].TLS)
+		assert.Equal(t, "sales", messages[0].Username)
+		assert.Equal(t, "secret", messages[0].Password)
+	})
+
+	t.Run("DefaultServer", func(t *testing.T) {
+		fake := startFakeSMTPServer(t, nil)
+
+		s := NewSMTPSender(SMTPConfig{Default: fake.server()})
+		require.NoError(t, s.Send(t.Context(), testDelivery(&model.Mailbox{Email: "sales@example.com"})))
+
+		messages := fake.inbox()
+		require.Len(t, messages, 1)
+		assert.Empty(t, messages[0].Username)
+	})
+
+	t.Run("NoServer", func(t *testing.T) {
+		s := NewSMTPSender(SMTPConfig{})
+		err := s.Send(t.Context(), testDelivery(&model.Mailbox{Email: "sales@example.com"}))
+		assert.ErrorIs(t, err, ErrNoSMTPServer)
+	})
+
+	t.Run("UnsupportedAuth", func(t *testing.T) {
+		fake := startFakeSMTPServer(t, nil, "CRAM-MD5")
+
+		server := fake.server()
+		server.Username, server.Password = "sales", "secret"
+		mailbox := withServer(&model.Mailbox{Email: "sales@example.com"}, server)
+
+		s := NewSMTPSender(SMTPConfig{})
+		err := s.Send(t.Context(), testDelivery(mailbox))
+		assert.ErrorIs(t, err, ErrUnsupportedAuth)
+		assert.Empty(t, fake.inbox())
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		fake := startFakeSMTPServer(t, nil)
+		fake.reply("jane@example.com", "550 no such user")
+		fake.reply("john@example.com", "451 try again later")
+		s := NewSMTPSender(SMTPConfig{Default: fake.server()})
+
+		err := s.Send(t.Context(), testDelivery(&model.Mailbox{Email: "sales@example.com"}))
+		require.Error(t, err)
+		assert.True(t, IsPermanent(err))
+
+		delivery := testDelivery(&model.Mailbox{Email: "sales@example.com"})
+		delivery.Contact.Email = "john@example.com"
+		err = s.Send(t.Context(), delivery)
+		require.Error(t, err)
+		assert.False(t, IsPermanent(err))
+		assert.Empty(t, fake.inbox())
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		// The server accepts connections but never greets.
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		go func() {
+			conn, err := listener.Accept()
+			if err == nil {
+				defer conn.Close()
+				bufio.NewReader(conn).ReadString('\n')
+			}
+		}()
+
+		addr := listener.Addr().(*net.TCPAddr)
+		s := NewSMTPSender(SMTPConfig{
+			Default: SMTPServer{Host: addr.IP.String(), Port: addr.Port},
+			Timeout: 50 * time.Millisecond,
+		})
+		err = s.Send(t.Context(), testDelivery(&model.Mailbox{Email: "sales@example.com"}))
+		assert.Error(t, err)
+		assert.False(t, IsPermanent(err))
+	})
+}
+
+func TestLoginAuth(t *testing.T) {
+	auth := &loginAuth{username: "sales", password: "secret", host: "smtp.example.com"}
+
+	_, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", Auth: []string{"LOGIN"}})
+	assert.ErrorIs(t, err, errUnencryptedLogin)
+
+	mechanism, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true, Auth: []string{"LOGIN"}})
+	require.NoError(t, err)
+	assert.Equal(t, "LOGIN", mechanism)
+
+	username, err := auth.Next([]byte("Username:"), true)
+	require.NoError(t, err)
+	assert.Equal(t, "sales", string(username))
+
+	password, err := auth.Next([]byte("Password:"), true)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(password))
+
+	_, err = auth.Next([]byte("Token:"), true)
+	assert.Error(t, err)
+}
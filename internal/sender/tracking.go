@@ -0,0 +1,69 @@
+package sender
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// linkPattern matches the links rewritten for click tracking.
+var linkPattern = regexp.MustCompile(`https?://[^\s<>"]+[^\s<>".,;:!?)\]']`)
+
+// Tracking adds an open pixel to the HTML part and rewrites links of
+// messages whose sequence enables open or click tracking. Opens are tracked
+// with <BaseURL>/o/<email ID>.gif, clicks redirect through
+// <BaseURL>/c/<email ID>?url=<link>. Without a base URL nothing is tracked.
+type Tracking struct {
+	BaseURL string
+}
+
+// OpenURL returns the address of the open pixel of an email.
+func (t Tracking) OpenURL(emailID uint64) string {
+	return fmt.Sprintf("%s/o/%d.gif", strings.TrimRight(t.BaseURL, "/"), emailID)
+}
+
+// ClickURL returns the address redirecting to the link of an email.
+func (t Tracking) ClickURL(emailID uint64, link string) string {
+	return fmt.Sprintf("%s/c/%d?url=%s", strings.TrimRight(t.BaseURL, "/"), emailID, url.QueryEscape(link))
+}
+
+// rewriteLinks replaces every link of the text with its click tracking URL.
+func (t Tracking) rewriteLinks(text string, emailID uint64) string {
+	return linkPattern.ReplaceAllStringFunc(text, func(link string) string {
+		return t.ClickURL(emailID, link)
+	})
+}
+
+// textToHTML renders plain text as an HTML document, turning line breaks
+// into <br> and links into anchors. With click tracking the anchors point at
+// the tracking URLs, with open tracking the pixel is appended.
+func (t Tracking) textToHTML(text string, emailID uint64, opens, clicks bool) string {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html><body>\n")
+
+	last := 0
+	for _, match := range linkPattern.FindAllStringIndex(text, -1) {
+		b.WriteString(escapeText(text[last:match[0]]))
+		link := text[match[0]:match[1]]
+		href := link
+		if clicks {
+			href = t.ClickURL(emailID, link)
+		}
+		fmt.Fprintf(&b, `<a href="%s">%s</a>`, html.EscapeString(href), html.EscapeString(link))
+		last = match[1]
+	}
+	b.WriteString(escapeText(text[last:]))
+
+	if opens {
+		fmt.Fprintf(&b, "\n"+`<img src="%s" width="1" height="1" alt="" style="display:none">`, html.EscapeString(t.OpenURL(emailID)))
+	}
+	b.WriteString("\n</body></html>\n")
+	return b.String()
+}
+
+func escapeText(text string) string {
+	text = html.EscapeString(strings.ReplaceAll(text, "\r\n", "\n"))
+	return strings.ReplaceAll(text, "\n", "<br>\n")
+}
@@ -0,0 +1,182 @@
+// Package worker sends due scheduled emails. A pool of workers claims emails
+// from the store one at a time, so any number of pools may run against the
+// same database. Emails are sent outside of any transaction and the result is
+// recorded once sending is done.
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/sender"
+)
+
+const (
+	DefaultConcurrency  = 4
+	DefaultPollInterval = 5 * time.Second
+	DefaultLease        = 10 * time.Minute
+	DefaultMaxAttempts  = 5
+	DefaultRetryBackoff = 5 * time.Minute
+
+	// finishAttempts is how many times the result of a send is recorded
+	// before giving up, the email is sent already and must not be claimed
+	// again.
+	finishAttempts = 5
+	finishBackoff  = time.Second
+)
+
+type Config struct {
+	Store model.Store
+	// Sender of due emails. Defaults to sender.LogSender.
+	Sender sender.Sender
+	// Number of emails sent at the same time. Defaults to DefaultConcurrency.
+	Concurrency int
+	// How long an idle worker waits before looking for due emails again.
+	// Defaults to DefaultPollInterval.
+	PollInterval time.Duration
+	// How long a claimed email may take before other workers claim it again.
+	// Must be longer than sending an email takes. Defaults to DefaultLease.
+	Lease time.Duration
+	// Number of times an email is tried before it fails and its enrollment
+	// is paused. Defaults to DefaultMaxAttempts.
+	MaxAttempts int
+	// Pause before the first retry, doubled for every further one. Defaults
+	// to DefaultRetryBackoff.
+	RetryBackoff time.Duration
+	// Now returns the current time. Defaults to time.Now.
+	Now func() time.Time
+}
+
+type Pool struct {
+	store        model.Store
+	sender       sender.Sender
+	concurrency  int
+	pollInterval time.Duration
+	lease        time.Duration
+	maxAttempts  int
+	retryBackoff time.Duration
+	backoff      time.Duration
+	now          func() time.Time
+}
+
+func New(cfg Config) *Pool {
+	p := &Pool{
+		store:        cfg.Store,
+		sender:       cfg.Sender,
+		concurrency:  cfg.Concurrency,
+		pollInterval: cfg.PollInterval,
+		lease:        cfg.Lease,
+		maxAttempts:  cfg.MaxAttempts,
+		retryBackoff: cfg.RetryBackoff,
+		backoff:      finishBackoff,
+		now:          cfg.Now,
+	}
+	if p.sender == nil {
+		p.sender = sender.LogSender{}
+	}
+	if p.concurrency < 1 {
+		p.concurrency = DefaultConcurrency
+	}
+	if p.pollInterval <= 0 {
+		p.pollInterval = DefaultPollInterval
+	}
+	if p.lease <= 0 {
+		p.lease = DefaultLease
+	}
+	if p.maxAttempts < 1 {
+		p.maxAttempts = DefaultMaxAttempts
+	}
+	if p.retryBackoff <= 0 {
+		p.retryBackoff = DefaultRetryBackoff
+	}
+	if p.now == nil {
+		p.now = time.Now
+	}
+	return p
+}
+
+// Run sends due emails until the context is canceled. It returns once every
+// worker has finished the email it was sending.
+func (p *Pool) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range p.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work sends emails one by one and sleeps while none are due.
+func (p *Pool) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		due, err := p.SendNext(ctx)
+		if err != nil {
+			log.Printf("Worker failed to deliver an email: %v", err)
+		}
+		if due && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(p.pollInterval):
+		}
+	}
+}
+
+// SendNext sends the earliest due email, if any, and reports whether there
+// was one. The email is sent and its result recorded even if the context is
+// canceled meanwhile, so shutting down never leaves an email half done.
+func (p *Pool) SendNext(ctx context.Context) (bool, error) {
+	ctx = context.WithoutCancel(ctx)
+	delivery, err := p.store.ClaimDueEmail(ctx, p.now(), p.lease)
+	if err != nil || delivery == nil {
+		return false, err
+	}
+
+	result := &model.DeliveryResult{}
+	if err := p.sender.Send(ctx, delivery); err != nil {
+		result.Error = err.Error()
+		result.Rejected = sender.IsPermanent(err)
+		result.RetryAt = p.retryAt(delivery.Email, err)
+		if result.RetryAt.IsZero() {
+			log.Printf("Failed to send email %d, giving up: %v", delivery.Email.ID, err)
+		} else {
+			log.Printf("Failed to send email %d, retrying at %s: %v", delivery.Email.ID, result.RetryAt, err)
+		}
+	} else {
+		result.SentAt = p.now()
+	}
+	return true, p.finish(ctx, delivery.Email.ID, result)
+}
+
+// retryAt returns when to try the email again after the error, or zero when
+// the error is permanent or the email is out of attempts.
+func (p *Pool) retryAt(email *model.ScheduledEmail, err error) time.Time {
+	attempt := email.Attempts + 1
+	if sender.IsPermanent(err) || attempt >= p.maxAttempts {
+		return time.Time{}
+	}
+	return p.now().Add(p.retryBackoff << (attempt - 1))
+}
+
+// finish records the result of a send, retrying with a growing pause when
+// the store fails.
+func (p *Pool) finish(ctx context.Context, id uint64, result *model.DeliveryResult) error {
+	backoff := p.backoff
+	for attempt := 1; ; attempt++ {
+		err := p.store.FinishDelivery(ctx, id, result)
+		if err == nil || attempt == finishAttempts {
+			return err
+		}
+		log.Printf("Failed to record the result of email %d, retrying: %v", id, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,207 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danikarik/salesforge/internal/model"
+	"github.com/danikarik/salesforge/internal/model/memory"
+	"github.com/danikarik/salesforge/internal/model/mock"
+	"github.com/danikarik/salesforge/internal/model/storetest"
+	"github.com/danikarik/salesforge/internal/sender"
+	mocky "github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	now      = time.Date(2030, time.January, 7, 10, 0, 0, 0, time.UTC)
+	rejected = &sender.RejectedError{Err: errors.New("recipient rejected")}
+)
+
+// setup enrolls the number of contacts and plans their first emails from a
+// single mailbox a minute apart, the first one a minute before now.
+func setup(t *testing.T, store model.Store, contacts int) []*model.Enrollment {
+	t.Helper()
+	ctx := t.Context()
+
+	sequence := &model.Sequence{
+		Name:  "Test Sequence",
+		Steps: []*model.Step{{Subject: "Step 1", Content: "Content 1"}},
+	}
+	require.NoError(t, store.CreateSequence(ctx, sequence))
+	mailbox := &model.Mailbox{UserID: 1, Email: "sender@example.com", DailyCapacity: 50}
+	require.NoError(t, store.CreateMailbox(ctx, mailbox))
+
+	enrollments := storetest.Enroll(t, store, sequence, storetest.CreateContacts(t, store, contacts)...)
+
+	var plans []*model.ScheduledEmailPlan
+	for i, enrollment := range enrollments {
+		plans = append(plans, &model.ScheduledEmailPlan{
+			ID:        storetest.PendingEmail(t, store, enrollment).ID,
+			MailboxID: &mailbox.ID,
+			SendAt:    now.Add(time.Duration(i-1) * time.Minute),
+		})
+	}
+	_, err := store.PlanScheduledEmails(ctx, plans)
+	require.NoError(t, err)
+
+	return enrollments
+}
+
+// fakeSender records deliveries and fails the ones to failing addresses
+// with their error.
+type fakeSender struct {
+	mu        sync.Mutex
+	delivered []*model.Delivery
+	failing   map[string]error
+}
+
+func (s *fakeSender) Send(ctx context.Context, delivery *model.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.delivered = append(s.delivered, delivery)
+	return s.failing[delivery.Contact.Email]
+}
+
+func TestSendNext(t *testing.T) {
+	store := memory.NewStore()
+	enrollments := setup(t, store, 3)
+	sender := &fakeSender{failing: map[string]error{"contact1@example.com": rejected}}
+	pool := New(Config{Store: store, Sender: sender, Now: func() time.Time { return now }})
+
+	due, err := pool.SendNext(t.Context())
+	require.NoError(t, err)
+	require.True(t, due)
+	sent := storetest.LastEmail(t, store, enrollments[0])
+	require.Equal(t, model.ScheduledEmailSent, sent.Status)
+	require.Equal(t, &now, sent.SentAt)
+
+	due, err = pool.SendNext(t.Context())
+	require.NoError(t, err)
+	require.True(t, due)
+	failed := storetest.LastEmail(t, store, enrollments[1])
+	require.Equal(t, model.ScheduledEmailFailed, failed.Status)
+	require.Equal(t, "recipient rejected", failed.Error)
+	bounced, err := store.FetchEnrollment(t.Context(), enrollments[1].ID)
+	require.NoError(t, err)
+	require.Equal(t, model.EnrollmentBounced, bounced.Status)
+
+	due, err = pool.SendNext(t.Context())
+	require.NoError(t, err)
+	require.False(t, due)
+	require.Equal(t, model.ScheduledEmailPending, storetest.LastEmail(t, store, enrollments[2]).Status)
+	require.Len(t, sender.delivered, 2)
+}
+
+func TestSendNextRetries(t *testing.T) {
+	store := memory.NewStore()
+	enrollment := setup(t, store, 1)[0]
+	sender := &fakeSender{failing: map[string]error{"contact0@example.com": errors.New("try again later")}}
+	clock := now
+	pool := New(Config{
+		Store:        store,
+		Sender:       sender,
+		MaxAttempts:  2,
+		RetryBackoff: time.Minute,
+		Now:          func() time.Time { return clock },
+	})
+
+	// A transient failure is retried after the backoff.
+	due, err := pool.SendNext(t.Context())
+	require.NoError(t, err)
+	require.True(t, due)
+	retried := storetest.LastEmail(t, store, enrollment)
+	require.Equal(t, model.ScheduledEmailPending, retried.Status)
+	require.Equal(t, 1, retried.Attempts)
+	require.Equal(t, now.Add(time.Minute), retried.SendAt)
+
+	due, err = pool.SendNext(t.Context())
+	require.NoError(t, err)
+	require.False(t, due)
+
+	// The last attempt fails the email and pauses the enrollment.
+	clock = retried.SendAt
+	due, err = pool.SendNext(t.Context())
+	require.NoError(t, err)
+	require.True(t, due)
+	failed := storetest.LastEmail(t, store, enrollment)
+	require.Equal(t, model.ScheduledEmailFailed, failed.Status)
+	require.Equal(t, 2, failed.Attempts)
+	paused, err := store.FetchEnrollment(t.Context(), enrollment.ID)
+	require.NoError(t, err)
+	require.Equal(t, model.EnrollmentPaused, paused.Status)
+	require.Len(t, sender.delivered, 2)
+}
+
+func TestSendNextRetriesFinish(t *testing.T) {
+	store := &mock.MockStore{}
+	delivery := &model.Delivery{Email: &model.ScheduledEmail{ID: 7}, Contact: &model.Contact{Email: "jane@example.com"}}
+	store.On("ClaimDueEmail", mocky.Anything, now, DefaultLease).Return(delivery, nil).Once()
+	result := &model.DeliveryResult{SentAt: now}
+	store.On("FinishDelivery", mocky.Anything, uint64(7), result).Return(errors.New("connection reset")).Once()
+	store.On("FinishDelivery", mocky.Anything, uint64(7), result).Return(nil).Once()
+	sender := &fakeSender{}
+	pool := New(Config{Store: store, Sender: sender, Now: func() time.Time { return now }})
+	pool.backoff = 0
+
+	// The email is sent once even though recording it failed at first.
+	due, err := pool.SendNext(t.Context())
+	require.NoError(t, err)
+	require.True(t, due)
+	require.Len(t, sender.delivered, 1)
+	store.AssertExpectations(t)
+}
+
+// blockingSender waits for release before every send.
+type blockingSender struct {
+	started chan *model.Delivery
+	release chan struct{}
+}
+
+func (s *blockingSender) Send(ctx context.Context, delivery *model.Delivery) error {
+	s.started <- delivery
+	<-s.release
+	return ctx.Err()
+}
+
+func TestRun(t *testing.T) {
+	store := memory.NewStore()
+	enrollments := setup(t, store, 2)
+	sender := &blockingSender{started: make(chan *model.Delivery), release: make(chan struct{})}
+	pool := New(Config{
+		Store:        store,
+		Sender:       sender,
+		Concurrency:  2,
+		PollInterval: time.Millisecond,
+		Now:          func() time.Time { return now },
+	})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		pool.Run(ctx)
+		close(done)
+	}()
+
+	// Both workers send at the same time.
+	first, second := <-sender.started, <-sender.started
+	require.NotEqual(t, first.Email.ID, second.Email.ID)
+
+	// Shutting down waits for the emails being sent.
+	cancel()
+	select {
+	case <-done:
+		require.FailNow(t, "Expected the pool to wait for its workers")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(sender.release)
+	<-done
+
+	for _, enrollment := range enrollments {
+		require.Equal(t, model.ScheduledEmailSent, storetest.LastEmail(t, store, enrollment).Status)
+	}
+}